@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// commandAckLatencySeconds 命令发送后收到各sserver响应的耗时
+	commandAckLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "command_ack_latency_seconds",
+		Help:    "Latency between sending a command and receiving each sserver response to it.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"algorithm"})
+
+	// commandAckTimeoutsTotal 在 AckTimeoutSeconds 内没有收到任何响应的命令数
+	commandAckTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "command_ack_timeouts_total",
+		Help: "Number of commands without any sserver response within AckTimeoutSeconds.",
+	}, []string{"algorithm"})
+
+	// lastCommandConfirmations 最近一条到期的命令收到的响应数
+	lastCommandConfirmations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "last_command_confirmations",
+		Help: "Number of sservers that responded to the last command whose AckTimeoutSeconds expired.",
+	}, []string{"algorithm"})
+)
+
+func init() {
+	prometheus.MustRegister(commandAckLatencySeconds, commandAckTimeoutsTotal, lastCommandConfirmations)
+}
+
+// pendingAck 已发送、尚未到期的命令
+type pendingAck struct {
+	command   KafkaCommand
+	sentAt    time.Time
+	responses int // 收到的响应数
+	succeeded int // 其中成功的响应数
+}
+
+// ackTracker 跟踪每条已发送命令的sserver响应
+// 命令发送和到期检查在切换币种的goroutine中进行，响应在读取Kafka的goroutine中记录
+type ackTracker struct {
+	lock      sync.Mutex
+	clock     Clock
+	algorithm string // 指标的 algorithm 标签
+	timeout   time.Duration
+	pending   map[uint64]*pendingAck
+}
+
+// newAckTracker 创建算法的响应跟踪，timeout为0时返回nil
+func newAckTracker(clock Clock, algorithm string, timeout time.Duration) *ackTracker {
+	if timeout <= 0 {
+		return nil
+	}
+	return &ackTracker{
+		clock:     clock,
+		algorithm: algorithm,
+		timeout:   timeout,
+		pending:   make(map[uint64]*pendingAck),
+	}
+}
+
+// commandSent 记录已发送的命令
+func (t *ackTracker) commandSent(command KafkaCommand) {
+	if t == nil {
+		return
+	}
+	id, ok := command.ID.(uint64)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[id] = &pendingAck{command: command, sentAt: t.clock.Now()}
+}
+
+// responseReceived 将sserver的响应匹配到已发送的命令，记录响应耗时
+func (t *ackTracker) responseReceived(response *KafkaMessage) {
+	if t == nil {
+		return
+	}
+	// JSON数字被解析为float64
+	id, ok := response.ID.(float64)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ack, ok := t.pending[uint64(id)]
+	if !ok {
+		return
+	}
+	latency := t.clock.Now().Sub(ack.sentAt)
+	ack.responses++
+	if response.Result {
+		ack.succeeded++
+	}
+	commandAckLatencySeconds.WithLabelValues(t.algorithm).Observe(latency.Seconds())
+	glog.V(2).Info("Command ", uint64(id), " acknowledged by server ", response.ServerID,
+		" in ", latency, ", result: ", response.Result, ", responses: ", ack.responses)
+}
+
+// check 结束已到期的命令的跟踪，没有收到任何响应的命令输出警告并计入 command_ack_timeouts_total
+// 返回没有收到响应的命令数
+func (t *ackTracker) check() (timeouts int) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock.Now()
+	for id, ack := range t.pending {
+		if now.Sub(ack.sentAt) < t.timeout {
+			continue
+		}
+		delete(t.pending, id)
+		lastCommandConfirmations.WithLabelValues(t.algorithm).Set(float64(ack.responses))
+		if ack.responses == 0 {
+			timeouts++
+			commandAckTimeoutsTotal.WithLabelValues(t.algorithm).Inc()
+			glog.Warning("No sserver response of command ", id, " in ", t.timeout,
+				", chain_name: ", ack.command.ChainName,
+				", subpool_name: ", ack.command.SubPool,
+				", segment: ", ack.command.Segment,
+				", correlation_id: ", ack.command.CorrelationID)
+			continue
+		}
+		glog.Info("Command ", id, " (", ack.command.ChainName, ") confirmed by ", ack.responses,
+			" servers, ", ack.succeeded, " succeeded")
+	}
+	return
+}
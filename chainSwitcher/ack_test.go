@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// 测试匹配sserver响应到已发送的命令，超时未收到任何响应的命令计入告警
+func TestAckTracker(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	tracker := newAckTracker(clock, "sha256", 30*time.Second)
+	timeouts := testutil.ToFloat64(commandAckTimeoutsTotal.WithLabelValues("sha256"))
+	latencies := ackLatencySamples()
+
+	tracker.commandSent(s.newKafkaCommand(1, "bcc"))
+	tracker.commandSent(s.newKafkaCommand(2, "bcc"))
+	clock.advance(3 * time.Second)
+	tracker.responseReceived(&KafkaMessage{ID: float64(1), ServerID: 1, Result: true})
+	tracker.responseReceived(&KafkaMessage{ID: float64(1), ServerID: 2, Result: false})
+	// 未知的命令
+	tracker.responseReceived(&KafkaMessage{ID: float64(99), ServerID: 1, Result: true})
+
+	if n := tracker.check(); n != 0 {
+		t.Errorf("no timeout expected before AckTimeoutSeconds, got: %d", n)
+	}
+	clock.advance(30 * time.Second)
+	if n := tracker.check(); n != 1 {
+		t.Errorf("command 2 expected to time out, got: %d", n)
+	}
+	if v := testutil.ToFloat64(commandAckTimeoutsTotal.WithLabelValues("sha256")) - timeouts; v != 1 {
+		t.Errorf("ack timeouts expected: 1, got: %v", v)
+	}
+	if n := ackLatencySamples() - latencies; n != 2 {
+		t.Errorf("2 ack latency samples expected, got: %d", n)
+	}
+	if len(tracker.pending) != 0 {
+		t.Errorf("expired commands should not be tracked, got: %d", len(tracker.pending))
+	}
+
+	// 到期后的响应不再计入
+	tracker.responseReceived(&KafkaMessage{ID: float64(2), ServerID: 1, Result: true})
+	if n := ackLatencySamples() - latencies; n != 2 {
+		t.Errorf("late response should be ignored, samples: %d", n)
+	}
+
+	if newAckTracker(clock, "sha256", 0) != nil {
+		t.Errorf("tracker should be disabled when AckTimeoutSeconds is 0")
+	}
+}
+
+// ackLatencySamples 命令响应耗时的样本数
+func ackLatencySamples() uint64 {
+	var m dto.Metric
+	commandAckLatencySeconds.WithLabelValues("sha256").(prometheus.Histogram).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
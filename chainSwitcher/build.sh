@@ -4,6 +4,8 @@ cd $(dirname "$0")
 go get -v github.com/segmentio/kafka-go
 go get -v github.com/golang/snappy
 go get -v github.com/go-sql-driver/mysql
+go get -v github.com/lib/pq
 go get -v github.com/golang/glog
+go get -v github.com/prometheus/client_golang/prometheus
 
 go build -v
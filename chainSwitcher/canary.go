@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 灰度切换的默认配置
+var defaultCanarySteps = []int{10, 50, 100}
+
+const defaultCanaryStepSeconds = 300
+
+// CanaryRolloutConfig 灰度切换配置：切换到新币种时先只切换部分矿机，sserver响应正常后逐步扩大比例
+type CanaryRolloutConfig struct {
+	Enabled     bool
+	Steps       []int         // 各阶段的切换比例（百分比），递增且最后一项为100
+	StepSeconds time.Duration // 每个阶段至少持续的时间
+	ServerIDs   []int         // 灰度中（未到100%时）只让这些id的sserver执行命令，为空时所有sserver按比例切换
+}
+
+// checkCanaryRollout 检查灰度切换配置并填充默认值
+func checkCanaryRollout(conf *CanaryRolloutConfig) error {
+	if len(conf.Steps) == 0 {
+		conf.Steps = defaultCanarySteps
+	}
+	if conf.StepSeconds == 0 {
+		conf.StepSeconds = defaultCanaryStepSeconds
+	}
+	last := 0
+	for _, percent := range conf.Steps {
+		if percent <= last || percent > 100 {
+			return fmt.Errorf("Steps %v should be increasing within 1-100", conf.Steps)
+		}
+		last = percent
+	}
+	if last != 100 {
+		return fmt.Errorf("the last step of %v should be 100", conf.Steps)
+	}
+	return nil
+}
+
+// canaryRollout 当前币种的灰度切换进度
+// 命令发送在切换币种的goroutine中进行，响应在读取Kafka的goroutine中记录
+type canaryRollout struct {
+	lock         sync.Mutex
+	clock        Clock
+	steps        []int
+	stepDuration time.Duration
+	serverIDs    []int
+
+	chain     string          // 灰度中的币种，为空时没有进行中的灰度
+	step      int             // 当前阶段在steps中的下标
+	stepStart time.Time       // 当前阶段的开始时间
+	commands  map[uint64]bool // 当前阶段发送的命令
+	acked     bool            // 当前阶段的命令收到了成功响应
+	failed    bool            // 当前阶段的命令收到了失败响应
+}
+
+// newCanaryRollout 创建灰度切换，未开启时返回nil
+func newCanaryRollout(clock Clock, conf CanaryRolloutConfig) *canaryRollout {
+	if !conf.Enabled {
+		return nil
+	}
+	return &canaryRollout{
+		clock:        clock,
+		steps:        conf.Steps,
+		stepDuration: conf.StepSeconds * time.Second,
+		serverIDs:    conf.ServerIDs,
+	}
+}
+
+// beginSwitch 开始从 prevChain 到 chain 的灰度切换
+// prevChain 为空（启动后的首次选择、API失效及自动回滚）时直接全量切换
+func (c *canaryRollout) beginSwitch(prevChain string, chain string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if prevChain == "" {
+		c.chain = ""
+		return
+	}
+	c.chain = chain
+	c.enterStep(0)
+	glog.Info("Canary rollout of ", chain, " started at ", c.steps[0], "%")
+}
+
+// enterStep 进入新的阶段，调用者需持有锁
+func (c *canaryRollout) enterStep(step int) {
+	c.step = step
+	c.stepStart = c.clock.Now()
+	c.commands = make(map[uint64]bool)
+	c.acked = false
+	c.failed = false
+}
+
+// commandPercent 返回发送 chain 的命令时应带的切换比例，不在灰度中时返回0（全量）
+// 当前阶段已持续 StepSeconds、收到了成功响应且没有失败响应时为下一阶段的比例；只构造命令，不改变阶段
+func (c *canaryRollout) commandPercent(chain string) int {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.chain == "" || c.chain != chain {
+		return 0
+	}
+	if c.step == len(c.steps)-1 || c.clock.Now().Sub(c.stepStart) < c.stepDuration {
+		return c.steps[c.step]
+	}
+	if c.failed {
+		glog.Warning("Canary rollout of ", chain, " held at ", c.steps[c.step], "%: failed responses received")
+		return c.steps[c.step]
+	}
+	if !c.acked {
+		glog.Warning("Canary rollout of ", chain, " held at ", c.steps[c.step], "%: no successful response yet")
+		return c.steps[c.step]
+	}
+	return c.steps[c.step+1]
+}
+
+// commandsSent 记录成功发送的 chain 的命令，命令中的比例高于当前阶段时进入该阶段
+// 只在命令全部发送成功后调用（试运行时不调用），以免构造了命令但没有发出时灰度进度前移；到达100%后灰度结束
+func (c *canaryRollout) commandsSent(chain string, commands []KafkaCommand) {
+	if c == nil || len(commands) == 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.chain == "" || c.chain != chain {
+		return
+	}
+	percent := commands[0].RolloutPercent
+	if c.step+1 < len(c.steps) && percent == c.steps[c.step+1] {
+		c.enterStep(c.step + 1)
+		glog.Info("Canary rollout of ", chain, " escalated to ", percent, "%")
+	}
+	if percent != c.steps[c.step] {
+		return
+	}
+	for _, command := range commands {
+		if id, ok := command.ID.(uint64); ok {
+			c.commands[id] = true
+		}
+	}
+	if c.step == len(c.steps)-1 {
+		// 最后一个阶段（100%）的命令发送后灰度结束，之后的命令不再带比例
+		c.chain = ""
+		glog.Info("Canary rollout of ", chain, " finished")
+	}
+}
+
+// commandServerIDs 返回带有切换比例 percent 的命令应发往的sserver id，不在灰度中或未配置 ServerIDs 时返回nil
+func (c *canaryRollout) commandServerIDs(percent int) []int {
+	if c == nil || percent <= 0 || percent >= 100 {
+		return nil
+	}
+	return c.serverIDs
+}
+
+// responseReceived 记录sserver对当前阶段命令的响应
+func (c *canaryRollout) responseReceived(response *KafkaMessage) {
+	if c == nil {
+		return
+	}
+	// JSON数字被解析为float64
+	id, ok := response.ID.(float64)
+	if !ok {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.commands[uint64(id)] {
+		return
+	}
+	if response.Result {
+		c.acked = true
+	} else {
+		c.failed = true
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 测试检查灰度切换配置
+func TestCheckCanaryRollout(t *testing.T) {
+	conf := CanaryRolloutConfig{Enabled: true}
+	if err := checkCanaryRollout(&conf); err != nil {
+		t.Fatalf("default config failed: %v", err)
+	}
+	if len(conf.Steps) != 3 || conf.StepSeconds != defaultCanaryStepSeconds {
+		t.Errorf("defaults expected, got: %+v", conf)
+	}
+	for _, steps := range [][]int{{10, 50}, {50, 10, 100}, {0, 100}, {10, 10, 100}, {10, 120}} {
+		if err := checkCanaryRollout(&CanaryRolloutConfig{Steps: steps}); err == nil {
+			t.Errorf("invalid steps %v should fail", steps)
+		}
+	}
+}
+
+// 测试灰度比例随sserver的成功响应逐步提高，命令中带有相应的比例
+func TestCanaryRolloutProgression(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	s.canary = newCanaryRollout(clock, CanaryRolloutConfig{Enabled: true, Steps: []int{10, 50, 100}, StepSeconds: 60})
+
+	// 启动后的首次选择直接全量切换
+	s.currentChainName = "btc"
+	s.canary.beginSwitch("", "btc")
+
+	s.currentChainName = "bcc"
+	s.canary.beginSwitch("btc", "bcc")
+
+	// emit 在每次发送后模拟sserver的响应，返回发送的命令中的比例
+	emit := func(result *bool) int {
+		s.sendCurrentChainToKafka()
+		if result != nil {
+			s.canary.responseReceived(&KafkaMessage{ID: float64(s.commandID), Result: *result})
+		}
+		var command KafkaCommand
+		if err := json.Unmarshal(writer.messages[len(writer.messages)-1].Value, &command); err != nil {
+			t.Fatal(err)
+		}
+		return command.RolloutPercent
+	}
+	ok, failed := true, false
+
+	steps := []struct {
+		advance time.Duration
+		result  *bool
+		percent int
+	}{
+		{0, &ok, 10},                // 开始灰度
+		{30 * time.Second, nil, 10}, // 阶段未满 StepSeconds
+		{30 * time.Second, nil, 50}, // 已收到成功响应，进入下一阶段
+		{60 * time.Second, nil, 50}, // 本阶段没有响应，保持
+		{0, &failed, 50},            // 收到失败响应
+		{60 * time.Second, &ok, 50}, // 有失败响应，保持
+		{60 * time.Second, nil, 50}, // 仍然保持
+	}
+	for i, step := range steps {
+		clock.advance(step.advance)
+		if percent := emit(step.result); percent != step.percent {
+			t.Fatalf("step %d: rollout percent expected: %d, got: %d", i, step.percent, percent)
+		}
+	}
+
+	// 新的切换重新开始灰度，并最终到达100%
+	s.currentChainName = "bsv"
+	s.canary.beginSwitch("bcc", "bsv")
+	expected := []int{10, 50, 100, 0, 0}
+	for i, percent := range expected {
+		if got := emit(&ok); got != percent {
+			t.Errorf("emit %d: rollout percent expected: %d, got: %d", i, percent, got)
+		}
+		clock.advance(60 * time.Second)
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(writer.messages[len(writer.messages)-1].Value, &fields)
+	if _, ok := fields["rollout_percent"]; ok {
+		t.Errorf("rollout_percent should be omitted after rollout: %s", writer.messages[len(writer.messages)-1].Value)
+	}
+}
+
+// 测试试运行及发送失败的命令不推进灰度进度
+func TestCanaryRolloutUnsentCommands(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	s.canary = newCanaryRollout(clock, CanaryRolloutConfig{Enabled: true, Steps: []int{50, 100}, StepSeconds: 60})
+
+	s.currentChainName = "bcc"
+	s.canary.beginSwitch("btc", "bcc")
+	if err := s.sendCurrentChainToKafka(); err != nil {
+		t.Fatal(err)
+	}
+	s.canary.responseReceived(&KafkaMessage{ID: float64(s.commandID), Result: true})
+	clock.advance(60 * time.Second)
+
+	// 100%的命令没有发出，灰度没有结束
+	writer.err = errors.New("kafka unavailable")
+	if err := s.sendCurrentChainToKafka(); err == nil {
+		t.Fatal("send expected to fail")
+	}
+	writer.err = nil
+	configData.DryRun = true
+	s.sendCurrentChainToKafka()
+	configData.DryRun = false
+	if percent := s.canary.commandPercent("bcc"); percent != 100 {
+		t.Fatalf("rollout expected to wait at 100%% until sent, got: %d", percent)
+	}
+
+	// 成功发送后灰度结束
+	if err := s.sendCurrentChainToKafka(); err != nil {
+		t.Fatal(err)
+	}
+	var command KafkaCommand
+	json.Unmarshal(writer.messages[len(writer.messages)-1].Value, &command)
+	if command.RolloutPercent != 100 || s.canary.commandPercent("bcc") != 0 {
+		t.Errorf("rollout expected to finish after the 100%% command was sent, sent: %d", command.RolloutPercent)
+	}
+}
+
+// 测试配置了 ServerIDs 时灰度中的命令只发往这些sserver，灰度结束及未配置时发往所有sserver
+func TestCanaryTargetServerIDs(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	s.canary = newCanaryRollout(clock, CanaryRolloutConfig{Enabled: true, Steps: []int{50, 100}, StepSeconds: 60, ServerIDs: []int{3, 7}})
+
+	// emit 发送并确认当前币种的命令，返回命令中的 target_server_ids
+	emit := func() []int {
+		s.sendCurrentChainToKafka()
+		s.canary.responseReceived(&KafkaMessage{ID: float64(s.commandID), Result: true})
+		var command KafkaCommand
+		if err := json.Unmarshal(writer.messages[len(writer.messages)-1].Value, &command); err != nil {
+			t.Fatal(err)
+		}
+		return command.TargetServerIDs
+	}
+
+	s.currentChainName = "bcc"
+	s.canary.beginSwitch("btc", "bcc")
+	if ids := emit(); !reflect.DeepEqual(ids, []int{3, 7}) {
+		t.Errorf("targeted rollout expected server ids [3 7], got: %v", ids)
+	}
+	clock.advance(60 * time.Second)
+	if ids := emit(); ids != nil {
+		t.Errorf("100%% step expected all servers, got: %v", ids)
+	}
+	if ids := emit(); ids != nil {
+		t.Errorf("finished rollout expected all servers, got: %v", ids)
+	}
+
+	// 未配置 ServerIDs 时灰度命令也发往所有sserver
+	s.canary = newCanaryRollout(clock, CanaryRolloutConfig{Enabled: true, Steps: []int{50, 100}, StepSeconds: 60})
+	s.currentChainName = "bsv"
+	s.canary.beginSwitch("bcc", "bsv")
+	if ids := emit(); ids != nil {
+		t.Errorf("untargeted rollout expected all servers, got: %v", ids)
+	}
+
+	// 全局配置的 TargetServerIDs 用于灰度以外的命令
+	configData.TargetServerIDs = []int{1}
+	s.canary = nil
+	if ids := emit(); !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("configured server ids [1] expected, got: %v", ids)
+	}
+}
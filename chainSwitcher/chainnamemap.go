@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ChainNameMap 接口中的币种到 sserver 币种名的映射
+//
+// 值可以是币种名：
+//
+//	{"BTC": "btc", "BCH": "bcc"}
+//
+// 也可以是对象，以便为该币种单独配置切换阈值（见 parseChainSwitchThresholds）：
+//
+//	{"BTC": "btc", "BCH": {"chain": "bcc", "switch_threshold_percent": 5}}
+type ChainNameMap map[string]string
+
+// chainNameEntry ChainNameMap 中对象格式的值
+type chainNameEntry struct {
+	Chain                  string   `json:"chain"`
+	SwitchThresholdPercent *float64 `json:"switch_threshold_percent"`
+}
+
+// parseChainNameEntry 解析 ChainNameMap 中的单个值，未配置切换阈值时 threshold 为nil
+func parseChainNameEntry(raw json.RawMessage) (entry chainNameEntry, err error) {
+	if err = json.Unmarshal(raw, &entry.Chain); err == nil {
+		return
+	}
+	entry = chainNameEntry{}
+	if err = json.Unmarshal(raw, &entry); err != nil {
+		return
+	}
+	if entry.Chain == "" {
+		err = fmt.Errorf("missing chain")
+	}
+	return
+}
+
+// UnmarshalJSON 解析两种格式的值，只保留币种名
+func (m *ChainNameMap) UnmarshalJSON(data []byte) error {
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+	names := make(ChainNameMap, len(raws))
+	for coin, raw := range raws {
+		entry, err := parseChainNameEntry(raw)
+		if err != nil {
+			return fmt.Errorf("ChainNameMap %s: %s", coin, err)
+		}
+		names[coin] = entry.Chain
+	}
+	*m = names
+	return nil
+}
+
+// parseChainSwitchThresholds 从配置文件中解析各币种名单独配置的切换阈值（百分比）
+// 多个币种映射到同一币种名时，其切换阈值必须相同
+func parseChainSwitchThresholds(configJSON []byte) (map[string]float64, error) {
+	var config struct {
+		ChainNameMap map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, err
+	}
+	return chainSwitchThresholds(config.ChainNameMap)
+}
+
+// parseAlgorithmSwitchThresholds 解析 Algorithms 中各算法的 ChainNameMap 单独配置的切换阈值
+func parseAlgorithmSwitchThresholds(configJSON []byte, algorithms []AlgorithmConfig) error {
+	var config struct {
+		Algorithms []struct {
+			ChainNameMap map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return err
+	}
+	for i := range algorithms {
+		if i >= len(config.Algorithms) {
+			break
+		}
+		thresholds, err := chainSwitchThresholds(config.Algorithms[i].ChainNameMap)
+		if err != nil {
+			return fmt.Errorf("Algorithms[%d]: %s", i, err)
+		}
+		algorithms[i].ChainSwitchThresholds = thresholds
+	}
+	return nil
+}
+
+// chainSwitchThresholds 从 ChainNameMap 的各值中取出单独配置的切换阈值
+func chainSwitchThresholds(chainNameMap map[string]json.RawMessage) (map[string]float64, error) {
+	thresholds := make(map[string]float64)
+	for coin, raw := range chainNameMap {
+		entry, err := parseChainNameEntry(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ChainNameMap %s: %s", coin, err)
+		}
+		if entry.SwitchThresholdPercent == nil {
+			continue
+		}
+		if *entry.SwitchThresholdPercent < 0 {
+			return nil, fmt.Errorf("ChainNameMap %s: negative switch_threshold_percent", coin)
+		}
+		if threshold, ok := thresholds[entry.Chain]; ok && threshold != *entry.SwitchThresholdPercent {
+			return nil, fmt.Errorf("ChainNameMap %s: conflicting switch_threshold_percent of chain %s", coin, entry.Chain)
+		}
+		thresholds[entry.Chain] = *entry.SwitchThresholdPercent
+	}
+	return thresholds, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Clock 时钟接口，便于在测试中注入模拟时钟
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock 系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// checkIntervals 以 SwitchIntervalSeconds 填充未配置的轮询和发送间隔，并检查轮询和发送间隔都为正数
+// 只有作为默认值被使用时才检查 SwitchIntervalSeconds
+func checkIntervals(conf *ChainSwitcherConfig) error {
+	if (conf.PollIntervalSeconds == 0 || conf.EmitIntervalSeconds == 0) && conf.SwitchIntervalSeconds <= 0 {
+		return fmt.Errorf("SwitchIntervalSeconds should be positive, got: %d", conf.SwitchIntervalSeconds)
+	}
+	if conf.PollIntervalSeconds == 0 {
+		conf.PollIntervalSeconds = conf.SwitchIntervalSeconds
+	}
+	if conf.EmitIntervalSeconds == 0 {
+		conf.EmitIntervalSeconds = conf.SwitchIntervalSeconds
+	}
+	if conf.PollIntervalSeconds < 0 {
+		return fmt.Errorf("PollIntervalSeconds should be positive, got: %d", conf.PollIntervalSeconds)
+	}
+	if conf.EmitIntervalSeconds < 0 {
+		return fmt.Errorf("EmitIntervalSeconds should be positive, got: %d", conf.EmitIntervalSeconds)
+	}
+	return nil
+}
+
+// runPeriodically 以固定的周期执行work，直到work返回false或ctx被取消
+// 周期从每次执行的开始时间算起，不会因work的耗时而漂移。
+// 若某次执行超过了一个或多个周期，则跳过错过的周期并记录日志，而不是立即补执行。
+// ctx被取消时不中断正在进行的work，而是在其完成后立即返回，不再等待下一个周期。
+// interval不为正数时不执行work，直接返回，避免除零或无间隔地循环。
+func runPeriodically(ctx context.Context, clock Clock, interval time.Duration, work func() bool) {
+	if interval <= 0 {
+		glog.Error("invalid interval ", interval, ", periodic work not started")
+		return
+	}
+	next := clock.Now()
+	for work() {
+		next = next.Add(interval)
+		now := clock.Now()
+		if now.After(next) {
+			skipped := now.Sub(next)/interval + 1
+			glog.Warning("iteration overran by ", now.Sub(next), ", interval: ", interval,
+				", skipped ", int64(skipped), " tick(s)")
+			next = next.Add(skipped * interval)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(next.Sub(now)):
+		}
+	}
+}
+
+// runPollLoop 每隔pollInterval执行一次poll，直到poll返回false
+// 同时每隔emitInterval最多执行一次emit（在poll之后），emit返回是否实际执行了发送
+func runPollLoop(ctx context.Context, clock Clock, pollInterval time.Duration, emitInterval time.Duration, poll func() bool, emit func() bool) {
+	var lastEmit time.Time
+	runPeriodically(ctx, clock, pollInterval, func() bool {
+		start := clock.Now()
+		if !poll() {
+			return false
+		}
+		if lastEmit.IsZero() || start.Sub(lastEmit) >= emitInterval {
+			if emit() {
+				lastEmit = start
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock 模拟时钟，After()会立即把时间拨到到期时刻
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// 测试执行耗时不影响周期，超时的执行会跳过错过的周期
+func TestRunPeriodically(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	clock := &fakeClock{begin}
+	interval := 60 * time.Second
+
+	workDurations := []time.Duration{10 * time.Second, 130 * time.Second, 59 * time.Second, 60 * time.Second, 1 * time.Second}
+	expectedStarts := []time.Duration{0, 60 * time.Second, 240 * time.Second, 300 * time.Second, 360 * time.Second}
+
+	var starts []time.Duration
+	runPeriodically(context.Background(), clock, interval, func() bool {
+		starts = append(starts, clock.Now().Sub(begin))
+		clock.advance(workDurations[len(starts)-1])
+		return len(starts) < len(workDurations)
+	})
+
+	if len(starts) != len(expectedStarts) {
+		t.Fatalf("run times expected: %d, got: %d", len(expectedStarts), len(starts))
+	}
+	for i := range starts {
+		if starts[i] != expectedStarts[i] {
+			t.Errorf("start time of run %d expected: %s, got: %s", i, expectedStarts[i], starts[i])
+		}
+	}
+}
+
+// 测试周期不为正数时不执行也不panic
+func TestRunPeriodicallyInvalidInterval(t *testing.T) {
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		runs := 0
+		runPeriodically(context.Background(), clock, interval, func() bool {
+			runs++
+			return runs < 3
+		})
+		if runs != 0 {
+			t.Errorf("work should not run with interval %s, runs: %d", interval, runs)
+		}
+	}
+}
+
+// 测试缺失或不为正数的间隔被拒绝，未配置的轮询和发送间隔默认为 SwitchIntervalSeconds
+func TestCheckIntervals(t *testing.T) {
+	invalid := []ChainSwitcherConfig{
+		{},
+		{SwitchIntervalSeconds: -1},
+		{SwitchIntervalSeconds: 60, PollIntervalSeconds: -10},
+		{SwitchIntervalSeconds: 60, EmitIntervalSeconds: -10},
+		{PollIntervalSeconds: 10},
+		{PollIntervalSeconds: 10, EmitIntervalSeconds: -10},
+	}
+	for _, conf := range invalid {
+		if err := checkIntervals(&conf); err == nil {
+			t.Errorf("intervals should be rejected: %+v", conf)
+		}
+	}
+
+	conf := ChainSwitcherConfig{SwitchIntervalSeconds: 60, PollIntervalSeconds: 10}
+	if err := checkIntervals(&conf); err != nil || conf.PollIntervalSeconds != 10 || conf.EmitIntervalSeconds != 60 {
+		t.Errorf("poll 10 / emit 60 expected, got: %d / %d, %v", conf.PollIntervalSeconds, conf.EmitIntervalSeconds, err)
+	}
+
+	// 轮询和发送间隔都已配置时不需要 SwitchIntervalSeconds
+	conf = ChainSwitcherConfig{PollIntervalSeconds: 10, EmitIntervalSeconds: 60}
+	if err := checkIntervals(&conf); err != nil || conf.PollIntervalSeconds != 10 || conf.EmitIntervalSeconds != 60 {
+		t.Errorf("poll 10 / emit 60 without SwitchIntervalSeconds expected, got: %d / %d, %v", conf.PollIntervalSeconds, conf.EmitIntervalSeconds, err)
+	}
+}
+
+// 测试ctx被取消时等待当前的执行完成后立即返回，不再等待下一个周期
+func TestRunPeriodicallyCancel(t *testing.T) {
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	runPeriodically(ctx, clock, time.Minute, func() bool {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+		return true
+	})
+	if runs != 3 {
+		t.Errorf("run times expected: 3, got: %d", runs)
+	}
+
+	// 等待下一个周期时被取消
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	runs = 0
+	runPeriodically(ctx, realClock{}, time.Hour, func() bool {
+		runs++
+		return true
+	})
+	if runs != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("expected to return after 1 run without waiting for the interval, runs: %d, elapsed: %s", runs, time.Since(start))
+	}
+}
+
+// 测试轮询和发送命令的周期互相独立
+func TestRunPollLoop(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	clock := &fakeClock{begin}
+
+	var polls, emits []time.Duration
+	runPollLoop(context.Background(), clock, 10*time.Second, 30*time.Second, func() bool {
+		polls = append(polls, clock.Now().Sub(begin))
+		clock.advance(2 * time.Second)
+		return len(polls) <= 7
+	}, func() bool {
+		emits = append(emits, clock.Now().Sub(begin))
+		return true
+	})
+
+	if len(polls) != 8 {
+		t.Errorf("poll times expected: 8, got: %d", len(polls))
+	}
+	expectedEmits := []time.Duration{2 * time.Second, 32 * time.Second, 62 * time.Second}
+	if len(emits) != len(expectedEmits) {
+		t.Fatalf("emit times expected: %v, got: %v", expectedEmits, emits)
+	}
+	for i := range emits {
+		if emits[i] != expectedEmits[i] {
+			t.Errorf("emit %d expected at: %s, got: %s", i, expectedEmits[i], emits[i])
+		}
+	}
+}
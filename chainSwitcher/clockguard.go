@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultClockJumpThresholdSeconds 未配置 ClockJumpThresholdSeconds 时，视为时钟回拨的最小幅度
+const defaultClockJumpThresholdSeconds = 5
+
+// clockBackwardJumpsTotal 检测到系统时钟回拨的次数
+var clockBackwardJumpsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "clock_backward_jumps_total",
+	Help: "Number of backward system clock jumps larger than ClockJumpThresholdSeconds.",
+}, []string{"algorithm"})
+
+func init() {
+	prometheus.MustRegister(clockBackwardJumpsTotal)
+}
+
+// clockGuard 检测两次发送之间系统时钟（墙上时间）的回拨
+// 命令的 created_at 取自墙上时间，时钟回拨（如NTP校正）后下游看到的命令时间会倒退
+type clockGuard struct {
+	clock     Clock
+	algorithm string // 指标的 algorithm 标签，各算法的发送循环各有一个检测
+	threshold time.Duration
+	// deferEmit 为true时，回拨后暂停发送，直到墙上时间重新超过回拨前的最大值
+	deferEmit bool
+
+	// highWater 观察到的最大墙上时间
+	highWater time.Time
+	// jumping 当前是否处于回拨状态，每次回拨只记录一次
+	jumping bool
+}
+
+// newClockGuard 创建算法的时钟回拨检测
+func newClockGuard(clock Clock, algorithm string, threshold time.Duration, deferEmit bool) *clockGuard {
+	return &clockGuard{clock: clock, algorithm: algorithm, threshold: threshold, deferEmit: deferEmit}
+}
+
+// allowEmit 在每次发送前调用，返回是否可以发送
+func (g *clockGuard) allowEmit() bool {
+	// Round(0) 去掉单调时钟读数，按墙上时间比较
+	now := g.clock.Now().Round(0)
+	if g.highWater.IsZero() || !now.Before(g.highWater) {
+		if g.jumping {
+			glog.Info("system clock recovered, now: ", now.UTC().Format("2006-01-02 15:04:05"))
+			g.jumping = false
+		}
+		g.highWater = now
+		return true
+	}
+
+	backward := g.highWater.Sub(now)
+	if backward <= g.threshold {
+		return true
+	}
+	if !g.jumping {
+		g.jumping = true
+		clockBackwardJumpsTotal.WithLabelValues(g.algorithm).Inc()
+		glog.Warning("system clock jumped backward by ", backward,
+			", from: ", g.highWater.UTC().Format("2006-01-02 15:04:05"),
+			", to: ", now.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if g.deferEmit {
+		glog.Warning("emission deferred until clock reaches ", g.highWater.UTC().Format("2006-01-02 15:04:05"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试系统时钟回拨的检测及暂停发送
+func TestClockGuard(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	clock := &fakeClock{begin}
+	guard := newClockGuard(clock, "sha256", 5*time.Second, true)
+
+	if !guard.allowEmit() {
+		t.Errorf("first emission should be allowed")
+	}
+	clock.advance(60 * time.Second)
+	if !guard.allowEmit() {
+		t.Errorf("emission after forward time should be allowed")
+	}
+
+	// 小于阈值的回拨忽略
+	clock.advance(-3 * time.Second)
+	if !guard.allowEmit() || guard.jumping {
+		t.Errorf("backward jump within threshold should be ignored")
+	}
+
+	// 超过阈值的回拨，暂停发送直到时钟追上回拨前的时间
+	clock.advance(-57 * time.Second)
+	if guard.allowEmit() || !guard.jumping {
+		t.Errorf("emission should be deferred after backward jump")
+	}
+	clock.advance(30 * time.Second)
+	if guard.allowEmit() {
+		t.Errorf("emission should be deferred until clock stabilizes")
+	}
+	clock.advance(30 * time.Second)
+	if !guard.allowEmit() || guard.jumping {
+		t.Errorf("emission should resume after clock reaches previous time")
+	}
+
+	// 不暂停时只记录警告
+	clock = &fakeClock{begin}
+	guard = newClockGuard(clock, "sha256", 5*time.Second, false)
+	guard.allowEmit()
+	clock.advance(-time.Hour)
+	if !guard.allowEmit() || !guard.jumping {
+		t.Errorf("backward jump should be detected but emission allowed")
+	}
+}
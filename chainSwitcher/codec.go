@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 命令编码（CommandEncoding），sserver发来的消息使用相同的编码
+const (
+	// commandEncodingJSON JSON（默认）
+	commandEncodingJSON = "json"
+	// commandEncodingProtobuf Protobuf，消息定义见 kafkacommand.proto
+	commandEncodingProtobuf = "protobuf"
+)
+
+// checkCommandEncoding 检查命令编码是否支持
+func checkCommandEncoding(encoding string) error {
+	switch encoding {
+	case "", commandEncodingJSON, commandEncodingProtobuf:
+		return nil
+	}
+	return fmt.Errorf("unknown CommandEncoding: %s", encoding)
+}
+
+// encodeCommand 按编码序列化发送到Kafka的命令
+func encodeCommand(encoding string, command KafkaCommand) ([]byte, error) {
+	if encoding != commandEncodingProtobuf {
+		return json.Marshal(command)
+	}
+
+	id, _ := command.ID.(uint64)
+	var b []byte
+	b = appendVarintField(b, 1, uint64(int64(command.Version)))
+	b = appendVarintField(b, 2, id)
+	b = appendStringField(b, 3, command.Type)
+	b = appendStringField(b, 4, command.Action)
+	b = appendStringField(b, 5, command.CreatedAt)
+	b = appendStringField(b, 6, command.ChainName)
+	b = appendStringField(b, 7, command.SubPool)
+	b = appendStringField(b, 8, command.Segment)
+	if command.Metrics != nil {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeCommandMetrics(*command.Metrics))
+	}
+	b = appendVarintField(b, 10, uint64(int64(command.RolloutPercent)))
+	b = appendVarintField(b, 11, uint64(int64(command.GraceSeconds)))
+	b = appendStringField(b, 12, command.CorrelationID)
+	if len(command.TargetServerIDs) > 0 {
+		// proto3 的 repeated 数值字段默认使用packed编码
+		var packed []byte
+		for _, id := range command.TargetServerIDs {
+			packed = protowire.AppendVarint(packed, uint64(int64(id)))
+		}
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b, nil
+}
+
+func encodeCommandMetrics(metrics CommandMetrics) []byte {
+	var b []byte
+	b = appendDoubleField(b, 1, metrics.DispatchHashrate)
+	b = appendDoubleField(b, 2, metrics.DispatchableHashrate)
+	b = appendStringField(b, 3, metrics.RunnerUpChain)
+	b = appendDoubleField(b, 4, metrics.RunnerUpDispatchHashrate)
+	b = appendDoubleField(b, 5, metrics.RunnerUpDispatchableHashrate)
+	return b
+}
+
+// decodeCommand 按编码解析命令，用于读回已发送的命令
+// Protobuf编码时 ID 为 uint64，与发送前的命令相同
+func decodeCommand(encoding string, value []byte) (command KafkaCommand, err error) {
+	if encoding != commandEncodingProtobuf {
+		err = json.Unmarshal(value, &command)
+		return
+	}
+
+	err = consumeFields(value, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			command.Version = int(int32(v))
+		case 2:
+			command.ID = v
+		case 3:
+			command.Type = string(data)
+		case 4:
+			command.Action = string(data)
+		case 5:
+			command.CreatedAt = string(data)
+		case 6:
+			command.ChainName = string(data)
+		case 7:
+			command.SubPool = string(data)
+		case 8:
+			command.Segment = string(data)
+		case 9:
+			command.Metrics = new(CommandMetrics)
+			return decodeCommandMetrics(data, command.Metrics)
+		case 10:
+			command.RolloutPercent = int(int32(v))
+		case 11:
+			command.GraceSeconds = int(int32(v))
+		case 12:
+			command.CorrelationID = string(data)
+		case 13:
+			if data == nil {
+				// 未使用packed编码
+				command.TargetServerIDs = append(command.TargetServerIDs, int(int32(v)))
+				return nil
+			}
+			for len(data) > 0 {
+				id, n := protowire.ConsumeVarint(data)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				command.TargetServerIDs = append(command.TargetServerIDs, int(int32(id)))
+				data = data[n:]
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func decodeCommandMetrics(value []byte, metrics *CommandMetrics) error {
+	return consumeFields(value, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			metrics.DispatchHashrate = math.Float64frombits(v)
+		case 2:
+			metrics.DispatchableHashrate = math.Float64frombits(v)
+		case 3:
+			metrics.RunnerUpChain = string(data)
+		case 4:
+			metrics.RunnerUpDispatchHashrate = math.Float64frombits(v)
+		case 5:
+			metrics.RunnerUpDispatchableHashrate = math.Float64frombits(v)
+		}
+		return nil
+	})
+}
+
+// decodeKafkaMessage 按编码解析sserver发来的消息
+// Protobuf编码时 ID 转为 float64，与JSON解析的结果一致
+func decodeKafkaMessage(encoding string, value []byte) (*KafkaMessage, error) {
+	message := new(KafkaMessage)
+	if encoding != commandEncodingProtobuf {
+		if err := json.Unmarshal(value, message); err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+
+	err := consumeFields(value, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			message.Version = int(int32(v))
+		case 2:
+			message.ID = float64(v)
+		case 3:
+			message.Type = string(data)
+		case 4:
+			message.Action = string(data)
+		case 5:
+			message.CreatedAt = string(data)
+		case 6:
+			message.NewChainName = string(data)
+		case 7:
+			message.OldChainName = string(data)
+		case 8:
+			message.Result = v != 0
+		case 9:
+			message.ServerID = int(int32(v))
+		case 10:
+			message.SwitchedConnections = int(int32(v))
+		case 11:
+			message.SwitchedUsers = int(int32(v))
+		case 12:
+			message.CorrelationID = string(data)
+		case 13:
+			return decodeHost(data, message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func decodeHost(value []byte, message *KafkaMessage) error {
+	return consumeFields(value, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			message.Host.Hostname = string(data)
+		case 2:
+			// map<string, IPList> 的每一项是 key = 1, value = 2 的消息
+			var key string
+			var ips []string
+			err := consumeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					key = string(data)
+				case 2:
+					return consumeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+						if num == 1 {
+							ips = append(ips, string(data))
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if message.Host.IP == nil {
+				message.Host.IP = make(map[string][]string)
+			}
+			message.Host.IP[key] = ips
+		}
+		return nil
+	})
+}
+
+// consumeFields 依次解析Protobuf消息中的字段并调用handle
+// varint及定长字段的值在v中，长度分隔的字段在data中，未知的字段类型被跳过
+func consumeFields(value []byte, handle func(num protowire.Number, v uint64, data []byte) error) error {
+	for len(value) > 0 {
+		num, typ, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		value = value[n:]
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(value)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(value)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(value)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, value)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = value[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		value = value[n:]
+
+		if err := handle(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendStringField(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDoubleField(b []byte, num protowire.Number, f float64) []byte {
+	if f == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(f))
+}
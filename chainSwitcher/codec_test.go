@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 测试命令经JSON及Protobuf编码后解析回的内容不变
+func TestCommandEncodingRoundTrip(t *testing.T) {
+	command := KafkaCommand{
+		Version:   kafkaSchemaVersion,
+		ID:        uint64(42),
+		Type:      "sserver_cmd",
+		Action:    "auto_switch_chain",
+		CreatedAt: "2020-01-02 03:04:05",
+		ChainName: "bcc",
+		SubPool:   "pool1",
+		Segment:   "eu",
+		Metrics: &CommandMetrics{
+			DispatchHashrate:             150.5,
+			DispatchableHashrate:         200,
+			RunnerUpChain:                "btc",
+			RunnerUpDispatchHashrate:     100,
+			RunnerUpDispatchableHashrate: 120.25,
+		},
+		RolloutPercent:  25,
+		GraceSeconds:    30,
+		CorrelationID:   "sha256-bcc-1",
+		TargetServerIDs: []int{1, 3},
+	}
+
+	for _, encoding := range []string{commandEncodingJSON, commandEncodingProtobuf} {
+		value, err := encodeCommand(encoding, command)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %s", encoding, err)
+		}
+		decoded, err := decodeCommand(encoding, value)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %s", encoding, err)
+		}
+		// JSON解析的id为float64
+		if id, ok := decoded.ID.(float64); ok && id == 42 {
+			decoded.ID = uint64(42)
+		}
+		if !reflect.DeepEqual(decoded, command) {
+			t.Errorf("%s: round trip expected: %+v, got: %+v", encoding, command, decoded)
+		}
+	}
+
+	// 未设置的可选字段在Protobuf中同样被省略
+	value, _ := encodeCommand(commandEncodingProtobuf, KafkaCommand{ID: uint64(1), ChainName: "btc"})
+	decoded, _ := decodeCommand(commandEncodingProtobuf, value)
+	if decoded.Metrics != nil || decoded.SubPool != "" || decoded.ChainName != "btc" {
+		t.Errorf("wrong decoded command: %+v", decoded)
+	}
+}
+
+// 测试以Protobuf编码发送命令
+func TestEmitOnceProtobuf(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc"}
+	configData.CommandEncoding = commandEncodingProtobuf
+	writer := &mockWriter{}
+
+	command, err := s.emitOnce(writer, "bcc")
+	if err != nil {
+		t.Fatalf("emit failed: %s", err)
+	}
+	sent, err := decodeCommand(commandEncodingProtobuf, writer.messages[0].Value)
+	if err != nil {
+		t.Fatalf("decode sent command failed: %s", err)
+	}
+	if sent.Action != "auto_switch_chain" || sent.ChainName != "bcc" || sent.ID != command.ID {
+		t.Errorf("wrong command sent: %+v", sent)
+	}
+}
+
+// 测试解析Protobuf编码的sserver响应，id与JSON解析的结果一样为float64
+func TestParseKafkaMessageProtobuf(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.CommandEncoding = commandEncodingProtobuf
+
+	ipList := protowire.AppendTag(nil, 1, protowire.BytesType)
+	ipList = protowire.AppendString(ipList, "10.0.0.1")
+	ipList = protowire.AppendTag(ipList, 1, protowire.BytesType)
+	ipList = protowire.AppendString(ipList, "10.0.0.2")
+	entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, "eth0")
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, ipList)
+	host := protowire.AppendTag(nil, 1, protowire.BytesType)
+	host = protowire.AppendString(host, "sserver-1")
+	host = protowire.AppendTag(host, 2, protowire.BytesType)
+	host = protowire.AppendBytes(host, entry)
+
+	var value []byte
+	value = appendVarintField(value, 1, 1)
+	value = appendVarintField(value, 2, 7)
+	value = appendStringField(value, 3, "sserver_response")
+	value = appendStringField(value, 4, "auto_switch_chain")
+	value = appendStringField(value, 6, "bcc")
+	value = appendStringField(value, 7, "btc")
+	value = appendVarintField(value, 8, 1)
+	value = appendVarintField(value, 9, 3)
+	value = appendVarintField(value, 11, 12)
+	value = appendStringField(value, 12, "sha256-bcc-1")
+	value = protowire.AppendTag(value, 13, protowire.BytesType)
+	value = protowire.AppendBytes(value, host)
+	// 未知字段被忽略
+	value = appendStringField(value, 99, "unknown")
+
+	response, err := s.parseKafkaMessage(value)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	if response.ID != float64(7) || response.Type != "sserver_response" || response.NewChainName != "bcc" ||
+		response.OldChainName != "btc" || !response.Result || response.ServerID != 3 || response.SwitchedUsers != 12 ||
+		response.CorrelationID != "sha256-bcc-1" {
+		t.Errorf("wrong response: %+v", response)
+	}
+	if response.Host.Hostname != "sserver-1" || !reflect.DeepEqual(response.Host.IP, map[string][]string{"eth0": {"10.0.0.1", "10.0.0.2"}}) {
+		t.Errorf("wrong host: %+v", response.Host)
+	}
+
+	if _, err := s.parseKafkaMessage(value[:len(value)-3]); err == nil {
+		t.Errorf("truncated message should be rejected")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coins 对象格式中的逻辑字段，可通过 CoinFieldNames 配置其在接口中实际的JSON键名
+const (
+	// coinFieldDispatch 推荐调度到该币种的算力
+	coinFieldDispatch = "dispatch"
+	// coinFieldDispatchable 该币种可接收的算力
+	coinFieldDispatchable = "dispatchable"
+)
+
+// defaultCoinFieldNames 未配置 CoinFieldNames 时各逻辑字段的JSON键名
+var defaultCoinFieldNames = map[string]string{
+	coinFieldDispatch:     "dispatch_hashrate",
+	coinFieldDispatchable: "dispatchable_hashrate",
+}
+
+// coinFieldName 逻辑字段在接口中的JSON键名
+func coinFieldName(field string) string {
+	if configData != nil {
+		if name := configData.CoinFieldNames[field]; name != "" {
+			return name
+		}
+	}
+	return defaultCoinFieldNames[field]
+}
+
+// checkCoinFieldNames 检查 CoinFieldNames 中的逻辑字段是否都是已知的
+func checkCoinFieldNames(names map[string]string) error {
+	for field := range names {
+		if _, ok := defaultCoinFieldNames[field]; !ok {
+			return fmt.Errorf("unknown field %s", field)
+		}
+	}
+	return nil
+}
+
+// CoinRecord HTTP API中单个币种的推荐信息
+type CoinRecord struct {
+	Coin                 string  `json:"coin"`
+	DispatchHashrate     float64 `json:"dispatch_hashrate"`     // 推荐调度到该币种的算力
+	DispatchableHashrate float64 `json:"dispatchable_hashrate"` // 该币种可接收的算力
+}
+
+// CoinList 按推荐顺序排列的币种列表
+//
+// 接口中的 coins 可以是币种名数组（按收益从高到低排序）：
+//
+//	["BCH", "BTC"]
+//
+// 也可以是以币种名为键的对象，此时按 dispatch_hashrate 从高到低排序：
+//
+//	{"BCH": {"dispatch_hashrate": 100, "dispatchable_hashrate": 120}, "BTC": {...}}
+//
+// 对象中的键名可通过 CoinFieldNames 配置
+type CoinList []CoinRecord
+
+// UnmarshalJSON 解析两种格式的 coins
+func (coins *CoinList) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err == nil {
+		list := make(CoinList, 0, len(names))
+		for _, name := range names {
+			list = append(list, CoinRecord{Coin: name})
+		}
+		*coins = list
+		return nil
+	}
+
+	var records map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	list := make(CoinList, 0, len(records))
+	for name, fields := range records {
+		record := CoinRecord{Coin: name}
+		if err := parseCoinField(fields, coinFieldDispatch, &record.DispatchHashrate); err != nil {
+			return fmt.Errorf("coin %s: %s", name, err)
+		}
+		if err := parseCoinField(fields, coinFieldDispatchable, &record.DispatchableHashrate); err != nil {
+			return fmt.Errorf("coin %s: %s", name, err)
+		}
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DispatchHashrate != list[j].DispatchHashrate {
+			return list[i].DispatchHashrate > list[j].DispatchHashrate
+		}
+		return list[i].Coin < list[j].Coin
+	})
+	*coins = list
+	return nil
+}
+
+// parseCoinField 按配置的键名解析逻辑字段，字段不存在时保持为0
+func parseCoinField(fields map[string]json.RawMessage, field string, value *float64) error {
+	key := coinFieldName(field)
+	raw, ok := fields[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return fmt.Errorf("wrong %s: %s", key, err)
+	}
+	return nil
+}
+
+// coinScores 按币种名排序输出各币种的 dispatch_hashrate/dispatchable_hashrate，用于日志
+// 与推荐顺序无关，使连续几次轮询的日志可以逐行对比
+func coinScores(coins CoinList) string {
+	sorted := make(CoinList, len(coins))
+	copy(sorted, coins)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Coin < sorted[j].Coin
+	})
+
+	scores := make([]string, 0, len(sorted))
+	for _, coin := range sorted {
+		scores = append(scores, coin.Coin+": "+strconv.FormatFloat(coin.DispatchHashrate, 'f', -1, 64)+
+			"/"+strconv.FormatFloat(coin.DispatchableHashrate, 'f', -1, 64))
+	}
+	return strings.Join(scores, ", ")
+}
+
+// candidateChains 将币种转换为 ChainNameMap 中的币种名，按推荐顺序排列，去除重复及未配置的币种
+// 配置 AggregateByChain 后，映射到同一币种名的多个币种的 dispatch_hashrate 相加后再排序
+func (s *algorithmSwitcher) candidateChains(coins CoinList) []string {
+	chains, _ := s.chainHashrates(coins)
+	return chains
+}
+
+// chainHashrates 返回按推荐顺序排列的币种名及各币种名的 dispatch_hashrate
+// 默认取映射到该币种名的排名最高的币种的算力，配置 AggregateByChain 后为所有币种的算力之和
+func (s *algorithmSwitcher) chainHashrates(coins CoinList) (chains []string, hashrates map[string]float64) {
+	chains = make([]string, 0, len(coins))
+	hashrates = make(map[string]float64)
+	for _, coin := range coins {
+		chainName, ok := s.config.ChainNameMap[coin.Coin]
+		if !ok {
+			continue
+		}
+		if _, exists := hashrates[chainName]; !exists {
+			chains = append(chains, chainName)
+			hashrates[chainName] = coin.DispatchHashrate
+		} else if s.config.AggregateByChain {
+			hashrates[chainName] += coin.DispatchHashrate
+		}
+	}
+
+	if s.config.AggregateByChain {
+		sort.SliceStable(chains, func(i, j int) bool {
+			return hashrates[chains[i]] > hashrates[chains[j]]
+		})
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// 测试解析数组格式和对象格式的 coins
+func TestCoinListUnmarshal(t *testing.T) {
+	var record ChainRecord
+	err := json.Unmarshal([]byte(`{"coins":["BCH","BTC"]}`), &record)
+	if err != nil {
+		t.Fatalf("parse coin names failed: %s", err)
+	}
+	if len(record.Coins) != 2 || record.Coins[0].Coin != "BCH" || record.Coins[1].Coin != "BTC" {
+		t.Errorf("wrong coins: %+v", record.Coins)
+	}
+
+	err = json.Unmarshal([]byte(`{"coins":{"BTC":{"dispatch_hashrate":50,"dispatchable_hashrate":80},`+
+		`"BCH":{"dispatch_hashrate":70,"dispatchable_hashrate":90},"BSV":{"dispatch_hashrate":50}}}`), &record)
+	if err != nil {
+		t.Fatalf("parse coin records failed: %s", err)
+	}
+	expected := CoinList{
+		{Coin: "BCH", DispatchHashrate: 70, DispatchableHashrate: 90},
+		{Coin: "BSV", DispatchHashrate: 50},
+		{Coin: "BTC", DispatchHashrate: 50, DispatchableHashrate: 80},
+	}
+	if !reflect.DeepEqual(record.Coins, expected) {
+		t.Errorf("coins expected: %+v, got: %+v", expected, record.Coins)
+	}
+}
+
+// 测试映射到同一币种名的多个币种合并算力后胜出
+func TestCandidateChainsAggregate(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.FailSafeChain = "btc"
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc", "BCHN": "bcc"}
+
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BTC":{"dispatch_hashrate":50},"BCH":{"dispatch_hashrate":30},`+
+		`"BCHN":{"dispatch_hashrate":30},"XXX":{"dispatch_hashrate":100}}}`), &record)
+
+	// 默认按单个币种比较
+	if chains := s.candidateChains(record.Coins); !reflect.DeepEqual(chains, []string{"btc", "bcc"}) {
+		t.Errorf("per-coin chains expected: [btc bcc], got: %v", chains)
+	}
+	if best := s.selectBestChain(record.Coins); best != "btc" {
+		t.Errorf("per-coin best chain expected: btc, got: %s", best)
+	}
+
+	configData.AggregateByChain = true
+	if chains := s.candidateChains(record.Coins); !reflect.DeepEqual(chains, []string{"bcc", "btc"}) {
+		t.Errorf("aggregated chains expected: [bcc btc], got: %v", chains)
+	}
+	if best := s.selectBestChain(record.Coins); best != "bcc" {
+		t.Errorf("aggregated best chain expected: bcc, got: %s", best)
+	}
+}
+
+// 测试按 CoinFieldNames 解析字段名不同的 coins
+func TestCoinListUnmarshalFieldNames(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	configData.CoinFieldNames = map[string]string{coinFieldDispatch: "hashrate_dispatch"}
+
+	var record ChainRecord
+	err := json.Unmarshal([]byte(`{"coins":{"BTC":{"hashrate_dispatch":50,"dispatchable_hashrate":80,"dispatch_hashrate":999},`+
+		`"BCH":{"hashrate_dispatch":70}}}`), &record)
+	if err != nil {
+		t.Fatalf("parse coin records failed: %s", err)
+	}
+	expected := CoinList{
+		{Coin: "BCH", DispatchHashrate: 70},
+		{Coin: "BTC", DispatchHashrate: 50, DispatchableHashrate: 80},
+	}
+	if !reflect.DeepEqual(record.Coins, expected) {
+		t.Errorf("coins expected: %+v, got: %+v", expected, record.Coins)
+	}
+
+	err = json.Unmarshal([]byte(`{"coins":{"BTC":{"hashrate_dispatch":"50"}}}`), &record)
+	if err == nil {
+		t.Errorf("parse non-numeric hashrate should fail")
+	}
+
+	if err := checkCoinFieldNames(map[string]string{"dispatch_rate": "x"}); err == nil {
+		t.Errorf("unknown field should be rejected")
+	}
+}
+
+// 测试日志中的币种按币种名排序，与推荐顺序及map的遍历顺序无关
+func TestCoinScores(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	var record ChainRecord
+	err := json.Unmarshal([]byte(`{"coins":{"BTC":{"dispatch_hashrate":50,"dispatchable_hashrate":80},`+
+		`"BSV":{"dispatch_hashrate":200},"BCH":{"dispatch_hashrate":100.5,"dispatchable_hashrate":90}}}`), &record)
+	if err != nil {
+		t.Fatalf("parse coins failed: %s", err)
+	}
+
+	expected := "BCH: 100.5/90, BSV: 200/0, BTC: 50/80"
+	for i := 0; i < 10; i++ {
+		if scores := coinScores(record.Coins); scores != expected {
+			t.Fatalf("coin scores expected: %s, got: %s", expected, scores)
+		}
+	}
+	if record.Coins[0].Coin != "BSV" {
+		t.Errorf("coinScores should not change the recommended order, got: %v", record.Coins)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+// CommandMetrics 开启 IncludeMetrics 时切换命令中附带的算力信息，来自最近一次轮询的接口数据
+// 选中币种及次优币种各取映射到该币种名的排名最高的币种的数据
+type CommandMetrics struct {
+	DispatchHashrate             float64 `json:"dispatch_hashrate"`
+	DispatchableHashrate         float64 `json:"dispatchable_hashrate"`
+	RunnerUpChain                string  `json:"runner_up_chain,omitempty"` // 次优币种，没有其他可选币种时为空
+	RunnerUpDispatchHashrate     float64 `json:"runner_up_dispatch_hashrate,omitempty"`
+	RunnerUpDispatchableHashrate float64 `json:"runner_up_dispatchable_hashrate,omitempty"`
+}
+
+// chainMetricsRecord 某个币种的算力信息
+type chainMetricsRecord struct {
+	chain   string
+	metrics CommandMetrics
+}
+
+// buildCommandMetrics 从按推荐顺序排列的币种中取出 chain 及次优币种的算力，coins 中没有 chain 时ok为false
+func (s *algorithmSwitcher) buildCommandMetrics(coins CoinList, chain string) (metrics CommandMetrics, ok bool) {
+	runnerUpFound := false
+	for _, coin := range coins {
+		chainName, known := s.config.ChainNameMap[coin.Coin]
+		if !known {
+			continue
+		}
+		if chainName == chain {
+			if !ok {
+				metrics.DispatchHashrate = coin.DispatchHashrate
+				metrics.DispatchableHashrate = coin.DispatchableHashrate
+				ok = true
+			}
+		} else if !runnerUpFound {
+			metrics.RunnerUpChain = chainName
+			metrics.RunnerUpDispatchHashrate = coin.DispatchHashrate
+			metrics.RunnerUpDispatchableHashrate = coin.DispatchableHashrate
+			runnerUpFound = true
+		}
+	}
+	return
+}
+
+// updateChainMetrics 记录子池（非子池模式下为空字符串）当前币种的算力信息
+func (s *algorithmSwitcher) updateChainMetrics(subPool string, coins CoinList, chain string) {
+	if !s.config.IncludeMetrics {
+		return
+	}
+	s.chainMetricsLock.Lock()
+	defer s.chainMetricsLock.Unlock()
+
+	metrics, ok := s.buildCommandMetrics(coins, chain)
+	if !ok {
+		delete(s.chainMetrics, subPool)
+		return
+	}
+	s.chainMetrics[subPool] = chainMetricsRecord{chain, metrics}
+}
+
+// attachCommandMetrics 开启 IncludeMetrics 时为命令附带算力信息
+// 只有记录的币种与命令的币种相同时才附带（如 FailSafeChain 切换的命令不附带）
+func (s *algorithmSwitcher) attachCommandMetrics(command *KafkaCommand) {
+	if !s.config.IncludeMetrics {
+		return
+	}
+	s.chainMetricsLock.Lock()
+	defer s.chainMetricsLock.Unlock()
+
+	if record, ok := s.chainMetrics[command.SubPool]; ok && record.chain == command.ChainName {
+		metrics := record.metrics
+		command.Metrics = &metrics
+	}
+}
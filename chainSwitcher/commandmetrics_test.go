@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 测试开启 IncludeMetrics 时命令中附带选中币种及次优币种的算力
+func TestCommandMetrics(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BCH": "bcc", "BTC": "btc", "BCHABC": "bcc"}
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+
+	coins := CoinList{
+		{Coin: "BCH", DispatchHashrate: 100, DispatchableHashrate: 120},
+		{Coin: "UNKNOWN", DispatchHashrate: 98, DispatchableHashrate: 99},
+		{Coin: "BCHABC", DispatchHashrate: 97, DispatchableHashrate: 110},
+		{Coin: "BTC", DispatchHashrate: 90, DispatchableHashrate: 200},
+	}
+
+	// 默认不附带
+	s.updateChainMetrics("", coins, "bcc")
+	s.writeCommand(s.newKafkaCommand(1, "bcc"))
+	var fields map[string]json.RawMessage
+	json.Unmarshal(writer.messages[0].Value, &fields)
+	if _, ok := fields["metrics"]; ok {
+		t.Errorf("metrics should not be sent by default: %s", writer.messages[0].Value)
+	}
+
+	configData.IncludeMetrics = true
+	s.updateChainMetrics("", coins, "bcc")
+	s.writeCommand(s.newKafkaCommand(2, "bcc"))
+	var command KafkaCommand
+	if err := json.Unmarshal(writer.messages[1].Value, &command); err != nil {
+		t.Fatal(err)
+	}
+	expected := CommandMetrics{
+		DispatchHashrate:             100,
+		DispatchableHashrate:         120,
+		RunnerUpChain:                "btc",
+		RunnerUpDispatchHashrate:     90,
+		RunnerUpDispatchableHashrate: 200,
+	}
+	if command.Metrics == nil || *command.Metrics != expected {
+		t.Errorf("metrics expected: %+v, got: %s", expected, writer.messages[1].Value)
+	}
+
+	// 与记录的币种不同的命令（如 FailSafeChain）不附带
+	s.writeCommand(s.newKafkaCommand(3, "btc"))
+	command = KafkaCommand{}
+	json.Unmarshal(writer.messages[2].Value, &command)
+	if command.Metrics != nil {
+		t.Errorf("metrics of another chain should not be sent: %s", writer.messages[2].Value)
+	}
+
+	// 没有其他可选币种时不附带次优币种
+	metrics, ok := s.buildCommandMetrics(CoinList{{Coin: "BTC", DispatchHashrate: 1}}, "btc")
+	if !ok || metrics.RunnerUpChain != "" {
+		t.Errorf("metrics without runner-up expected, got: %+v, %v", metrics, ok)
+	}
+	if _, ok := s.buildCommandMetrics(coins, "ltc"); ok {
+		t.Errorf("metrics of chain not in coins should not be found")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCorrelatedSwitches 最多保留多少次切换的关联id，更早的切换的响应视为未知
+const maxCorrelatedSwitches = 1024
+
+// 响应中关联id的匹配结果
+const (
+	correlationMatched = "matched" // 关联id属于本进程发出的切换
+	correlationUnknown = "unknown" // 关联id不属于最近的切换（如重启前发出的命令）
+	correlationMissing = "missing" // 旧版sserver不回传关联id
+)
+
+// switchResponsesTotal 按关联id匹配结果统计的sserver响应数
+var switchResponsesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "switch_responses_total",
+	Help: "Number of sserver switch responses, by whether their correlation_id matches a switch we sent.",
+}, []string{"algorithm", "correlation"})
+
+func init() {
+	prometheus.MustRegister(switchResponsesTotal)
+}
+
+// correlatedSwitch 一次切换：某个子池（非子池模式下为空字符串）切换到的币种
+type correlatedSwitch struct {
+	subPool string
+	chain   string
+}
+
+// newCorrelationID 生成随机的UUID（版本4）
+func newCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		glog.Error("generate correlation id failed: ", err)
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// commandCorrelationID 返回子池切换到 chain 的关联id
+// 币种改变时生成新的id，同一次切换的重复发送使用相同的id，以便跨服务追踪一次切换
+func (s *algorithmSwitcher) commandCorrelationID(subPool string, chain string) string {
+	s.correlationLock.Lock()
+	defer s.correlationLock.Unlock()
+
+	current := correlatedSwitch{subPool, chain}
+	if id, ok := s.currentCorrelationIDs[current]; ok {
+		return id
+	}
+	id := newCorrelationID()
+	if id == "" {
+		return ""
+	}
+	for key := range s.currentCorrelationIDs {
+		if key.subPool == subPool {
+			delete(s.currentCorrelationIDs, key)
+		}
+	}
+	s.currentCorrelationIDs[current] = id
+	s.correlatedSwitches[id] = current
+	s.correlationOrder = append(s.correlationOrder, id)
+	if len(s.correlationOrder) > maxCorrelatedSwitches {
+		delete(s.correlatedSwitches, s.correlationOrder[0])
+		s.correlationOrder = s.correlationOrder[1:]
+	}
+	return id
+}
+
+// checkResponseCorrelation 按关联id找到sserver响应所属的切换并计数，返回匹配结果
+func (s *algorithmSwitcher) checkResponseCorrelation(response *KafkaMessage) string {
+	if response.CorrelationID == "" {
+		switchResponsesTotal.WithLabelValues(s.config.Algorithm, correlationMissing).Inc()
+		return correlationMissing
+	}
+
+	s.correlationLock.Lock()
+	current, ok := s.correlatedSwitches[response.CorrelationID]
+	s.correlationLock.Unlock()
+
+	if !ok {
+		switchResponsesTotal.WithLabelValues(s.config.Algorithm, correlationUnknown).Inc()
+		glog.Warning("Server response with unknown correlation_id: ", response.CorrelationID,
+			", id: ", response.ID, ", server_id: ", response.ServerID)
+		return correlationUnknown
+	}
+	switchResponsesTotal.WithLabelValues(s.config.Algorithm, correlationMatched).Inc()
+	glog.V(3).Info("Server response of switch ", response.CorrelationID,
+		": chain_name: ", current.chain, ", subpool_name: ", current.subPool, ", server_id: ", response.ServerID)
+	return correlationMatched
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+// 测试同一次切换的命令使用相同的关联id，切换后生成新的id
+func TestCommandCorrelationID(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+
+	commandIDs := func() []string {
+		ids := []string{}
+		for _, message := range writer.messages {
+			var command KafkaCommand
+			json.Unmarshal(message.Value, &command)
+			ids = append(ids, command.CorrelationID)
+		}
+		writer.messages = nil
+		return ids
+	}
+
+	s.currentChainName = "btc"
+	s.sendCurrentChainToKafka()
+	s.sendCurrentChainToKafka()
+	ids := commandIDs()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(ids[0]) {
+		t.Errorf("correlation id should be a UUID, got: %s", ids[0])
+	}
+	if ids[1] != ids[0] {
+		t.Errorf("resent command should keep correlation id %s, got: %s", ids[0], ids[1])
+	}
+
+	s.currentChainName = "bcc"
+	s.sendCurrentChainToKafka()
+	if id := commandIDs()[0]; id == ids[0] {
+		t.Errorf("new switch should get a new correlation id, got: %s", id)
+	}
+
+	// 其他子池的切换不影响非子池模式的关联id
+	if s.commandCorrelationID("pool1", "btc") == ids[0] {
+		t.Errorf("sub-pool switch should get its own correlation id")
+	}
+	if id := s.commandCorrelationID("", "bcc"); id == ids[0] || id == "" {
+		t.Errorf("correlation id of the current switch expected, got: %s", id)
+	}
+}
+
+// 测试sserver回传的关联id与发送的切换匹配
+func TestResponseCorrelationRoundTrip(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.currentChainName = "bsv"
+	s.sendCurrentChainToKafka()
+
+	var command KafkaCommand
+	json.Unmarshal(writer.messages[0].Value, &command)
+
+	// 模拟sserver的响应，回传命令中的关联id
+	reply, _ := json.Marshal(map[string]interface{}{
+		"version": 1, "id": s.commandID, "type": "sserver_response", "action": "auto_switch_chain",
+		"new_chain_name": "bsv", "result": true, "server_id": 1, "correlation_id": command.CorrelationID})
+	response, err := s.parseKafkaMessage(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.CorrelationID != command.CorrelationID {
+		t.Errorf("correlation id expected: %s, got: %s", command.CorrelationID, response.CorrelationID)
+	}
+	if result := s.checkResponseCorrelation(response); result != correlationMatched {
+		t.Errorf("response expected: %s, got: %s", correlationMatched, result)
+	}
+
+	response.CorrelationID = "00000000-0000-4000-8000-000000000000"
+	if result := s.checkResponseCorrelation(response); result != correlationUnknown {
+		t.Errorf("response expected: %s, got: %s", correlationUnknown, result)
+	}
+	response.CorrelationID = ""
+	if result := s.checkResponseCorrelation(response); result != correlationMissing {
+		t.Errorf("response expected: %s, got: %s", correlationMissing, result)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/golang/glog"
+)
+
+// 推荐算力与系数的组合方式
+const (
+	// combineMultiply dispatch_hashrate 乘以系数
+	combineMultiply = "multiply"
+	// combineAdd dispatch_hashrate 加上系数
+	combineAdd = "add"
+)
+
+// 币种在系数接口中缺失时的处理方式
+const (
+	// missingSkip 不再考虑该币种
+	missingSkip = "skip"
+	// missingNeutral 视为不影响结果的系数（相乘时为1，相加时为0）
+	missingNeutral = "neutral"
+)
+
+// DispatchSource 额外的调度接口，为 ChainDispatchAPI 中的币种提供系数（如收益率）
+// 响应格式与 ChainDispatchAPI 的对象格式相同：{"algorithms": {"<算法>": {"coins": {"BCH": {"<Field>": 1.2}, ...}}}}
+type DispatchSource struct {
+	Name          string // 用于日志的名称
+	URL           string
+	Field         string // 各币种中系数的JSON键名
+	Combine       string // multiply（默认）或 add
+	MissingPolicy string // 币种缺失时：skip（默认）或 neutral
+}
+
+// dispatchFactorRecord 系数接口的响应
+type dispatchFactorRecord struct {
+	Algorithms map[string]struct {
+		Coins map[string]map[string]json.RawMessage `json:"coins"`
+	} `json:"algorithms"`
+}
+
+// checkDispatchSources 检查 DispatchSources 配置并填充默认值
+func checkDispatchSources(sources []DispatchSource) error {
+	names := make(map[string]bool)
+	for i := range sources {
+		source := &sources[i]
+		if source.Name == "" || source.URL == "" || source.Field == "" {
+			return fmt.Errorf("Name, URL and Field of source %d cannot be empty", i)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("duplicate source name %s", source.Name)
+		}
+		names[source.Name] = true
+
+		switch source.Combine {
+		case "":
+			source.Combine = combineMultiply
+		case combineMultiply, combineAdd:
+		default:
+			return fmt.Errorf("unknown Combine %s of source %s", source.Combine, source.Name)
+		}
+		switch source.MissingPolicy {
+		case "":
+			source.MissingPolicy = missingSkip
+		case missingSkip, missingNeutral:
+		default:
+			return fmt.Errorf("unknown MissingPolicy %s of source %s", source.MissingPolicy, source.Name)
+		}
+	}
+	return nil
+}
+
+// fetchDispatchSource 请求系数接口，返回当前算法各币种的系数
+func (s *algorithmSwitcher) fetchDispatchSource(source DispatchSource) (map[string]float64, error) {
+	glog.Info("HTTP GET ", source.URL, " (", source.Name, ")")
+	response, err := httpClient.Get(source.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP status %s, body: %s", response.Status, truncateBody(body))
+	}
+
+	record := new(dispatchFactorRecord)
+	if err = json.Unmarshal(body, record); err != nil {
+		return nil, err
+	}
+	algorithm, ok := record.Algorithms[s.config.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("cannot find algorithm %s", s.config.Algorithm)
+	}
+
+	factors := make(map[string]float64, len(algorithm.Coins))
+	for coin, fields := range algorithm.Coins {
+		raw, ok := fields[source.Field]
+		if !ok {
+			continue
+		}
+		var factor float64
+		if err := json.Unmarshal(raw, &factor); err != nil {
+			return nil, fmt.Errorf("coin %s: wrong %s: %s", coin, source.Field, err)
+		}
+		factors[coin] = factor
+	}
+	return factors, nil
+}
+
+// fetchDispatchFactors 请求所有 DispatchSources，返回以来源名为键的各币种系数
+// 任一来源请求失败时返回错误，本次轮询保持当前币种，与 ChainDispatchAPI 请求失败时相同
+func (s *algorithmSwitcher) fetchDispatchFactors() (map[string]map[string]float64, error) {
+	factors := make(map[string]map[string]float64, len(s.config.DispatchSources))
+	for _, source := range s.config.DispatchSources {
+		sourceFactors, err := s.fetchDispatchSource(source)
+		if err != nil {
+			glog.Error("Fetch dispatch source ", source.Name, " failed: ", err)
+			return nil, fmt.Errorf("dispatch source %s: %s", source.Name, err)
+		}
+		factors[source.Name] = sourceFactors
+	}
+	return factors, nil
+}
+
+// combineDispatchFactors 按各来源的组合方式将系数作用于 dispatch_hashrate，并按结果从高到低重新排序
+// 没有配置 DispatchSources 时原样返回
+func (s *algorithmSwitcher) combineDispatchFactors(coins CoinList, factors map[string]map[string]float64) CoinList {
+	if len(s.config.DispatchSources) == 0 {
+		return coins
+	}
+
+	combined := make(CoinList, 0, len(coins))
+	for _, coin := range coins {
+		skipped := false
+		for _, source := range s.config.DispatchSources {
+			factor, ok := factors[source.Name][coin.Coin]
+			if !ok {
+				if source.MissingPolicy == missingSkip {
+					glog.Info("coin ", coin.Coin, " not in dispatch source ", source.Name, ", skipped")
+					skipped = true
+					break
+				}
+				continue
+			}
+			if source.Combine == combineAdd {
+				coin.DispatchHashrate += factor
+			} else {
+				coin.DispatchHashrate *= factor
+			}
+		}
+		if !skipped {
+			combined = append(combined, coin)
+		}
+	}
+
+	sort.SliceStable(combined, func(i, j int) bool {
+		return combined[i].DispatchHashrate > combined[j].DispatchHashrate
+	})
+	glog.Info("Coins combined with dispatch sources (dispatch/dispatchable): ", coinScores(combined))
+	return combined
+}
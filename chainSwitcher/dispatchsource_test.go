@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newDispatchSourceServer 返回固定响应的系数接口
+func newDispatchSourceServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+}
+
+// 测试检查 DispatchSources 配置
+func TestCheckDispatchSources(t *testing.T) {
+	sources := []DispatchSource{{Name: "profit", URL: "http://127.0.0.1/", Field: "factor"}}
+	if err := checkDispatchSources(sources); err != nil {
+		t.Fatalf("valid sources failed: %v", err)
+	}
+	if sources[0].Combine != combineMultiply || sources[0].MissingPolicy != missingSkip {
+		t.Errorf("defaults expected: %s/%s, got: %s/%s", combineMultiply, missingSkip, sources[0].Combine, sources[0].MissingPolicy)
+	}
+
+	invalid := [][]DispatchSource{
+		{{Name: "profit", URL: "http://127.0.0.1/"}},
+		{{Name: "a", URL: "http://127.0.0.1/", Field: "f"}, {Name: "a", URL: "http://127.0.0.1/", Field: "f"}},
+		{{Name: "a", URL: "http://127.0.0.1/", Field: "f", Combine: "max"}},
+		{{Name: "a", URL: "http://127.0.0.1/", Field: "f", MissingPolicy: "zero"}},
+	}
+	for _, sources := range invalid {
+		if err := checkDispatchSources(sources); err == nil {
+			t.Errorf("invalid sources %v should fail", sources)
+		}
+	}
+}
+
+// 测试将两个系数接口与 ChainDispatchAPI 的算力组合后选择币种
+func TestCombineDispatchSources(t *testing.T) {
+	profit := newDispatchSourceServer(`{"algorithms":{"sha256":{"coins":{` +
+		`"BTC":{"profitability":1.5},"BCH":{"profitability":1.0},"BSV":{"profitability":2.0}}}}}`)
+	defer profit.Close()
+	bonus := newDispatchSourceServer(`{"algorithms":{"sha256":{"coins":{"BCH":{"bonus":60}}}}}`)
+	defer bonus.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc", "BSV": "bsv", "UBTC": "ubtc"}
+	configData.DispatchSources = []DispatchSource{
+		{Name: "profit", URL: profit.URL, Field: "profitability", MissingPolicy: missingSkip},
+		{Name: "bonus", URL: bonus.URL, Field: "bonus", Combine: combineAdd, MissingPolicy: missingNeutral},
+	}
+	if err := checkDispatchSources(configData.DispatchSources); err != nil {
+		t.Fatal(err)
+	}
+
+	coins := CoinList{
+		{Coin: "BCH", DispatchHashrate: 100},
+		{Coin: "UBTC", DispatchHashrate: 95},
+		{Coin: "BTC", DispatchHashrate: 90},
+		{Coin: "BSV", DispatchHashrate: 10},
+	}
+	factors, err := s.fetchDispatchFactors()
+	if err != nil {
+		t.Fatalf("fetchDispatchFactors failed: %v", err)
+	}
+	combined := s.combineDispatchFactors(coins, factors)
+
+	// BTC: 90*1.5 = 135, BCH: 100*1.0+60 = 160, BSV: 10*2.0 = 20，UBTC 不在 profit 中被跳过
+	expected := CoinList{
+		{Coin: "BCH", DispatchHashrate: 160},
+		{Coin: "BTC", DispatchHashrate: 135},
+		{Coin: "BSV", DispatchHashrate: 20},
+	}
+	if len(combined) != len(expected) {
+		t.Fatalf("combined coins expected: %v, got: %v", expected, combined)
+	}
+	for i := range expected {
+		if combined[i] != expected[i] {
+			t.Errorf("combined coin %d expected: %v, got: %v", i, expected[i], combined[i])
+		}
+	}
+	if chain := s.selectBestChain(combined); chain != "bcc" {
+		t.Errorf("best chain expected: bcc, got: %s", chain)
+	}
+
+	// profit 缺失时视为中性，UBTC 保留原算力；没有 bonus 时 BTC 胜出
+	configData.DispatchSources[0].MissingPolicy = missingNeutral
+	delete(factors, "bonus")
+	combined = s.combineDispatchFactors(coins, factors)
+	if len(combined) != 4 || combined[0].Coin != "BTC" || combined[2] != (CoinRecord{Coin: "UBTC", DispatchHashrate: 95}) {
+		t.Errorf("combined coins with neutral policy: %v", combined)
+	}
+}
+
+// 测试系数接口请求失败时返回错误
+func TestFetchDispatchFactorsFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.DispatchSources = []DispatchSource{{Name: "profit", URL: server.URL, Field: "profitability"}}
+	if _, err := s.fetchDispatchFactors(); err == nil {
+		t.Errorf("fetchDispatchFactors should fail on HTTP 503")
+	}
+
+	configData.DispatchSources = nil
+	factors, err := s.fetchDispatchFactors()
+	if err != nil || len(factors) != 0 {
+		t.Errorf("no sources expected no factors, got: %v, %v", factors, err)
+	}
+	coins := CoinList{{Coin: "BTC", DispatchHashrate: 1}}
+	if combined := s.combineDispatchFactors(coins, factors); len(combined) != 1 || combined[0] != coins[0] {
+		t.Errorf("coins without sources should be unchanged, got: %v", combined)
+	}
+}
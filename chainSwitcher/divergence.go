@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxExpectedResponses 最多保留多少条已发送命令的预期，更早的命令的响应不再检查
+const maxExpectedResponses = 1024
+
+// chainDivergenceTotal sserver响应中的原币种与预期不符的次数
+var chainDivergenceTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "chain_divergence_total",
+	Help: "Number of sserver responses whose old chain differs from the chain we last sent.",
+}, []string{"algorithm", "expected_chain", "actual_chain"})
+
+func init() {
+	prometheus.MustRegister(chainDivergenceTotal)
+}
+
+// recordSentCommand 记录已发送的命令，用于检查sserver的响应
+func (s *algorithmSwitcher) recordSentCommand(command KafkaCommand) {
+	id, ok := command.ID.(uint64)
+	if !ok {
+		return
+	}
+
+	s.expectationLock.Lock()
+	defer s.expectationLock.Unlock()
+
+	// 启动后的第一条命令没有预期
+	if oldChain, ok := s.lastSentChains[command.SubPool]; ok {
+		s.expectedOldChains[id] = oldChain
+	}
+	s.lastSentChains[command.SubPool] = command.ChainName
+	if id > maxExpectedResponses {
+		delete(s.expectedOldChains, id-maxExpectedResponses)
+	}
+}
+
+// sentChain 最近一次成功发送的币种，启动后尚未发送过时ok为false
+func (s *algorithmSwitcher) sentChain(subPool string) (chain string, ok bool) {
+	s.expectationLock.Lock()
+	defer s.expectationLock.Unlock()
+	chain, ok = s.lastSentChains[subPool]
+	return
+}
+
+// checkResponseChain 检查sserver响应中的原币种是否与预期一致，不一致时计数并返回true
+// 不一致说明部分sserver没有处于我们认为的币种上（如错过了之前的命令）
+func (s *algorithmSwitcher) checkResponseChain(response *KafkaMessage) bool {
+	id, ok := response.ID.(float64)
+	if !ok || response.OldChainName == "" {
+		return false
+	}
+
+	s.expectationLock.Lock()
+	expected, ok := s.expectedOldChains[uint64(id)]
+	s.expectationLock.Unlock()
+
+	if !ok || expected == response.OldChainName {
+		return false
+	}
+	chainDivergenceTotal.WithLabelValues(s.config.Algorithm, expected, response.OldChainName).Inc()
+	glog.Warning("Server chain diverged, id: ", response.ID,
+		", server_id: ", response.ServerID,
+		", hostname: ", response.Host.Hostname,
+		", expected old_chain_name: ", expected,
+		", actual old_chain_name: ", response.OldChainName)
+	return true
+}
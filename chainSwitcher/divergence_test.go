@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 测试sserver响应中的原币种与预期不符时计数
+func TestCheckResponseChain(t *testing.T) {
+	chainDivergenceTotal.Reset()
+	s := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "sha256"})
+
+	s.recordSentCommand(s.newKafkaCommand(1, "btc"))
+	s.recordSentCommand(s.newKafkaCommand(2, "bcc"))
+	s.recordSentCommand(s.newKafkaCommand(3, "bcc"))
+
+	// 启动后的第一条命令没有预期
+	if s.checkResponseChain(&KafkaMessage{ID: float64(1), OldChainName: "ltc"}) {
+		t.Errorf("first command should not be checked")
+	}
+	if s.checkResponseChain(&KafkaMessage{ID: float64(2), OldChainName: "btc"}) {
+		t.Errorf("expected old chain should not diverge")
+	}
+	if s.checkResponseChain(&KafkaMessage{ID: float64(3), OldChainName: "bcc"}) {
+		t.Errorf("repeated command on the same chain should not diverge")
+	}
+	if !s.checkResponseChain(&KafkaMessage{ID: float64(2), OldChainName: "ltc", NewChainName: "bcc"}) {
+		t.Errorf("unexpected old chain should diverge")
+	}
+	if v := testutil.ToFloat64(chainDivergenceTotal.WithLabelValues("sha256", "btc", "ltc")); v != 1 {
+		t.Errorf("divergence btc -> ltc expected: 1, got: %v", v)
+	}
+
+	// 子池分别记录
+	s.recordSentCommand(KafkaCommand{ID: uint64(4), ChainName: "btc", SubPool: "pool1"})
+	s.recordSentCommand(KafkaCommand{ID: uint64(5), ChainName: "bcc", SubPool: "pool1"})
+	if s.checkResponseChain(&KafkaMessage{ID: float64(5), OldChainName: "btc"}) {
+		t.Errorf("sub-pool expectation should be tracked separately")
+	}
+
+	// 过旧的命令不再检查
+	s.recordSentCommand(s.newKafkaCommand(2+maxExpectedResponses, "btc"))
+	if s.checkResponseChain(&KafkaMessage{ID: float64(2), OldChainName: "ltc"}) {
+		t.Errorf("expired command should not be checked")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/golang/glog"
+)
+
+// dryRunPrefix 试运行模式下决策日志的前缀
+const dryRunPrefix = "[DRY-RUN] "
+
+// logPrefix 决策日志的前缀：试运行模式（DryRun）下为 dryRunPrefix，同一进程切换多个算法时再加上算法名
+func (s *algorithmSwitcher) logPrefix() string {
+	prefix := ""
+	if s.config.DryRun {
+		prefix = dryRunPrefix
+	}
+	if len(switchers) > 1 {
+		prefix += "[" + s.config.Algorithm + "] "
+	}
+	return prefix
+}
+
+// dryRunHistoryStore 试运行模式下的切换记录，只输出日志，不写入数据库
+// 读取仍使用实际的切换记录，以便按每日切换次数限制等做出与正常运行相同的决策
+type dryRunHistoryStore struct {
+	HistoryStore
+}
+
+func (s dryRunHistoryStore) InsertRecord(algorithm string, prevChain string, currChain string, reason string, apiResult []byte) error {
+	glog.Info(dryRunPrefix, "Skip switch record: ", algorithm, ", ", prevChain, " -> ", currChain, " (", reason, ")")
+	return nil
+}
+
+// dryRunStateStore 试运行模式下的运行状态，照常读取，不写入数据库
+type dryRunStateStore struct {
+	StateStore
+}
+
+func (s dryRunStateStore) SaveState(algorithm string, chain string, commandID uint64) error {
+	glog.V(1).Info(dryRunPrefix, "Skip saving state: ", algorithm, ", ", chain, ", command id: ", commandID)
+	return nil
+}
+
+// dryRunDecisionStore 试运行模式下的决策记录，不写入数据库
+type dryRunDecisionStore struct{}
+
+func (dryRunDecisionStore) InsertDecision(record DecisionRecord) error {
+	glog.V(1).Info(dryRunPrefix, "Skip decision record: ", record.Outcome, ", ", record.OldChain, " -> ", record.NewChain)
+	return nil
+}
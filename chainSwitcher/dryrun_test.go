@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试试运行模式下照常决策，但不发送命令，不写入切换记录
+func TestDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":["BCH","BTC"]}}}`))
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.DryRun = true
+	httpClient = server.Client()
+	store := &memHistoryStore{}
+	s.historyStore = dryRunHistoryStore{store}
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.acks = nil
+	s.currentChainName = "btc"
+
+	s.updateCurrentChain()
+	if s.currentChainName != "bcc" {
+		t.Errorf("best chain bcc expected in dry run, got: %s", s.currentChainName)
+	}
+	if err := s.sendCurrentChainToKafka(); err != nil {
+		t.Errorf("dry run expected no error, got: %s", err)
+	}
+
+	if len(writer.messages) != 0 {
+		t.Errorf("no command expected in dry run, got: %d", len(writer.messages))
+	}
+	if len(store.records) != 0 {
+		t.Errorf("no switch record expected in dry run, got: %v", store.records)
+	}
+}
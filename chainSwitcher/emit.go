@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/segmentio/kafka-go"
+)
+
+// emitResponseTimeout 单次发送（-emit）后等待sserver响应的时间
+const emitResponseTimeout = 10 * time.Second
+
+// ActionManualSwitch 通过 -emit 参数手动切换时记录的api_result
+type ActionManualSwitch struct {
+	Action       string `json:"action"`
+	NewChainName string `json:"new_chain_name"`
+}
+
+// isKnownChain 判断币种名是否为 ChainNameMap 中的值
+func (s *algorithmSwitcher) isKnownChain(chainName string) bool {
+	for _, chain := range s.config.ChainNameMap {
+		if chain == chainName {
+			return true
+		}
+	}
+	return false
+}
+
+// emitOnce 验证币种名并向控制topic发送一条切换命令
+func (s *algorithmSwitcher) emitOnce(writer kafkaWriter, chainName string) (command KafkaCommand, err error) {
+	if !s.isKnownChain(chainName) {
+		err = fmt.Errorf("unknown chain %s, not in ChainNameMap", chainName)
+		return
+	}
+
+	s.commandID++
+	command = s.newKafkaCommand(s.commandID, chainName)
+	bytes, err := encodeCommand(s.config.CommandEncoding, command)
+	if err != nil {
+		err = fmt.Errorf("encode command failed: %s", err)
+		return
+	}
+	err = writer.WriteMessages(context.Background(), kafka.Message{Value: bytes})
+	if err != nil {
+		err = fmt.Errorf("write kafka failed: %s", err)
+		return
+	}
+
+	glog.Info("Send to Kafka, id: ", command.ID,
+		", created_at: ", command.CreatedAt,
+		", type: ", command.Type,
+		", action: ", command.Action,
+		", chain_name: ", command.ChainName)
+	return
+}
+
+// waitForResponses 在timeout内读取sserver对命令id的响应，返回收到的响应
+func (s *algorithmSwitcher) waitForResponses(read func(ctx context.Context) (kafka.Message, error), id uint64, timeout time.Duration) []*KafkaMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	responses := []*KafkaMessage{}
+	for {
+		m, err := read(ctx)
+		if err != nil {
+			return responses
+		}
+		response, err := s.parseKafkaMessage(m.Value)
+		if err != nil {
+			glog.Error("Parse Result Failed: ", err)
+			continue
+		}
+		if response.Type != "sserver_response" || response.Action != "auto_switch_chain" {
+			continue
+		}
+		// JSON数字被解析为float64
+		if responseID, ok := response.ID.(float64); !ok || uint64(responseID) != id {
+			continue
+		}
+		responses = append(responses, response)
+	}
+}
+
+// runEmitOnce 发送一条切换命令并记录到MySQL，等待sserver响应后退出
+func (s *algorithmSwitcher) runEmitOnce(chainName string) {
+	s.processorConsumer.SetOffset(kafka.LastOffset)
+
+	command, err := s.emitOnce(s.controllerProducer, chainName)
+	if err != nil {
+		glog.Fatal("emit failed: ", err)
+		return
+	}
+	s.saveState(chainName)
+
+	apiResult, _ := json.Marshal(ActionManualSwitch{"manual_switch", chainName})
+	err = s.historyStore.InsertRecord(s.config.Algorithm, "", chainName, switchReasonManualSwitch, apiResult)
+	if err != nil {
+		glog.Fatal(s.config.DBDriver, " error: ", err.Error())
+		return
+	}
+
+	responses := s.waitForResponses(s.processorConsumer.ReadMessage, command.ID.(uint64), emitResponseTimeout)
+	for _, response := range responses {
+		glog.Info("Server Response, id: ", response.ID,
+			", server_id: ", response.ServerID,
+			", result: ", response.Result,
+			", old_chain_name: ", response.OldChainName,
+			", new_chain_name: ", response.NewChainName,
+			", switched_users: ", response.SwitchedUsers,
+			", switched_connections: ", response.SwitchedConnections)
+	}
+	glog.Info("Emit finished, chain: ", chainName, ", responses: ", len(responses))
+	glog.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// mockWriter 记录写入的Kafka消息
+type mockWriter struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (w *mockWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+// 测试单次发送切换命令
+func TestEmitOnce(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc"}
+	writer := &mockWriter{}
+
+	if _, err := s.emitOnce(writer, "BCH"); err == nil {
+		t.Errorf("chain not in ChainNameMap values should be rejected")
+	}
+	if len(writer.messages) != 0 {
+		t.Fatalf("nothing should be sent for unknown chain, got: %d messages", len(writer.messages))
+	}
+
+	command, err := s.emitOnce(writer, "bcc")
+	if err != nil {
+		t.Fatalf("emit failed: %s", err)
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("message number expected: 1, got: %d", len(writer.messages))
+	}
+	var sent KafkaCommand
+	json.Unmarshal(writer.messages[0].Value, &sent)
+	if sent.Action != "auto_switch_chain" || sent.ChainName != "bcc" || sent.ID.(float64) != float64(command.ID.(uint64)) {
+		t.Errorf("wrong command sent: %s", string(writer.messages[0].Value))
+	}
+
+	writer.err = errors.New("broker down")
+	if _, err := s.emitOnce(writer, "btc"); err == nil {
+		t.Errorf("write error should be returned")
+	}
+}
+
+// 测试等待sserver对指定命令的响应
+func TestWaitForResponses(t *testing.T) {
+	values := []string{
+		`{"id":1,"type":"sserver_response","action":"auto_switch_chain","server_id":1,"result":true}`,
+		`{"id":2,"type":"sserver_response","action":"auto_switch_chain","server_id":2,"result":true}`,
+		`{"type":"sserver_notify","action":"online","server_id":3}`,
+		`{"id":2,"type":"sserver_response","action":"auto_switch_chain","server_id":4,"result":false}`,
+	}
+	read := func(ctx context.Context) (kafka.Message, error) {
+		if len(values) == 0 {
+			<-ctx.Done()
+			return kafka.Message{}, ctx.Err()
+		}
+		value := values[0]
+		values = values[1:]
+		return kafka.Message{Value: []byte(value)}, nil
+	}
+
+	s := newAlgorithmSwitcher(new(ChainSwitcherConfig))
+	responses := s.waitForResponses(read, 2, 50*time.Millisecond)
+	if len(responses) != 2 {
+		t.Fatalf("response number expected: 2, got: %d", len(responses))
+	}
+	if responses[0].ServerID != 2 || responses[1].ServerID != 4 || responses[1].Result {
+		t.Errorf("wrong responses: %+v, %+v", responses[0], responses[1])
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+// defaultRecentChainsSize 默认保留的最近币种数，即识别 A->B->A 式的回退
+const defaultRecentChainsSize = 2
+
+// chainHistory 最近使用过的币种，最多保留size个，最新的在最后
+type chainHistory struct {
+	size   int
+	chains []string
+}
+
+func newChainHistory(size int) *chainHistory {
+	return &chainHistory{size: size}
+}
+
+// push 记录切换到chain，返回是否为回退（chain是当前币种之前最近使用过的币种之一）
+func (h *chainHistory) push(chain string) (revert bool) {
+	for i := 0; i < len(h.chains)-1; i++ {
+		if h.chains[i] == chain {
+			revert = true
+			break
+		}
+	}
+
+	h.chains = append(h.chains, chain)
+	if len(h.chains) > h.size {
+		h.chains = h.chains[len(h.chains)-h.size:]
+	}
+	return
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+// 测试 A->B->A 被识别为回退
+func TestChainHistoryRevert(t *testing.T) {
+	h := newChainHistory(2)
+
+	sequence := []string{"btc", "bcc", "btc", "bsv", "bcc", "bsv"}
+	expected := []bool{false, false, true, false, false, true}
+
+	for i, chain := range sequence {
+		if revert := h.push(chain); revert != expected[i] {
+			t.Errorf("switch %d to %s, revert expected: %v, got: %v", i, chain, expected[i], revert)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 切换记录数据库的驱动
+const (
+	dbDriverMySQL    = "mysql"
+	dbDriverPostgres = "postgres"
+)
+
+// HistoryStore 切换记录的存储
+type HistoryStore interface {
+	// InsertRecord 写入一条切换记录，reason 为切换原因（switchReason*）
+	InsertRecord(algorithm string, prevChain string, currChain string, reason string, apiResult []byte) error
+	// RecentSwitches 按时间顺序返回 algorithm 在 since 之后发生的切换（prev_chain 与 curr_chain 不同）的时间
+	RecentSwitches(algorithm string, since time.Time) ([]time.Time, error)
+}
+
+// 切换记录的 switch_reason 列
+const (
+	switchReasonStartup          = "startup"           // 启动后第一次选择币种
+	switchReasonThresholdCrossed = "threshold_crossed" // 其他币种的收益超过当前币种（及粘性要求的幅度）
+	switchReasonChainDisappeared = "chain_disappeared" // 当前币种不再出现在API结果中
+	switchReasonFailSafe         = "fail_safe"         // API失效，切换到 FailSafeChain
+	switchReasonManualOverride   = "manual_override"   // 通过 /override 手动指定币种
+	switchReasonManualSwitch     = "manual_switch"     // 通过 -emit 手动发送命令
+	switchReasonAutoRollback     = "auto_rollback"     // 切换后sserver确认失败，自动回滚
+)
+
+// autoSwitchReason 返回从oldChain自动切换到其他币种的原因
+func (s *algorithmSwitcher) autoSwitchReason(coins CoinList, oldChain string) string {
+	if oldChain == "" {
+		return switchReasonStartup
+	}
+	for _, chain := range s.candidateChains(coins) {
+		if chain == oldChain {
+			return switchReasonThresholdCrossed
+		}
+	}
+	return switchReasonChainDisappeared
+}
+
+// algorithmPlaceholder 切换记录表名中的算法名占位符
+const algorithmPlaceholder = "{algorithm}"
+
+// historyTableName 将表名中的 {algorithm} 替换为算法名，使多个算法的程序共用同一份配置模板时写入各自的表
+// 算法名中字母、数字和下划线以外的字符替换为下划线，以便作为表名
+func historyTableName(template string, algorithm string) string {
+	if !strings.Contains(template, algorithmPlaceholder) {
+		return template
+	}
+	name := []rune(algorithm)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	return strings.Replace(template, algorithmPlaceholder, string(name), -1)
+}
+
+// historyDialect 不同数据库的切换记录表SQL
+type historyDialect interface {
+	// createTableSQL 建表语句，temporary 为true时建立只在当前连接中可见的临时表
+	createTableSQL(table string, temporary bool) string
+	// insertSQL 写入一条记录的语句，参数依次为 algorithm, prev_chain, curr_chain, switch_reason, api_result
+	insertSQL(table string) string
+	// lastRecordSQL 读取最后一条记录的 curr_chain 和 api_result
+	lastRecordSQL(table string) string
+	// recentSwitchesSQL 读取切换时间（unix时间戳）的语句，参数依次为 algorithm 和起始的unix时间戳
+	recentSwitchesSQL(table string) string
+	// columnExistsSQL 查询表中是否有某列的语句，参数为列名，返回匹配的列数
+	columnExistsSQL(table string) string
+	// addColumnSQL 为已有的表增加一列的语句
+	addColumnSQL(table string, column string, definition string) string
+	// indexExistsSQL 查询表中是否有 (algorithm, created_at) 索引的语句，返回匹配的索引数
+	indexExistsSQL(table string) string
+	// addIndexSQL 为已有的表增加 (algorithm, created_at) 索引的语句
+	addIndexSQL(table string) string
+	// createJournalTableSQL 决策记录表的建表语句
+	createJournalTableSQL(table string) string
+	// insertJournalSQL 写入一条决策记录的语句，参数依次为 algorithm, decision_hash, outcome, prev_chain, best_chain, curr_chain, inputs
+	insertJournalSQL(table string) string
+	// createStateTableSQL 运行状态表的建表语句，每个算法一行
+	createStateTableSQL(table string) string
+	// loadStateSQL 读取运行状态的 curr_chain 和 command_id，参数为 algorithm
+	loadStateSQL(table string) string
+	// saveStateSQL 写入或更新运行状态的语句，参数依次为 algorithm, curr_chain, command_id
+	saveStateSQL(table string) string
+}
+
+// newHistoryDialect 按 DBDriver 选择SQL方言，为空时为MySQL
+func newHistoryDialect(driver string) (historyDialect, error) {
+	switch driver {
+	case "", dbDriverMySQL:
+		return mysqlDialect{}, nil
+	case dbDriverPostgres:
+		return postgresDialect{}, nil
+	}
+	return nil, fmt.Errorf("unknown DBDriver %s", driver)
+}
+
+// mysqlDialect MySQL的切换记录表SQL
+type mysqlDialect struct{}
+
+func (mysqlDialect) createTableSQL(table string, temporary bool) string {
+	create := "CREATE TABLE IF NOT EXISTS "
+	if temporary {
+		create = "CREATE TEMPORARY TABLE "
+	}
+	return create + "`" + table + "`(" + `
+		id bigint(20) NOT NULL AUTO_INCREMENT,
+		algorithm varchar(255) NOT NULL,
+		prev_chain varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		switch_reason ` + switchReasonColumn + `,
+		api_result text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY ` + historyIndexName + ` (algorithm, created_at)
+		)
+	`
+}
+
+func (mysqlDialect) insertSQL(table string) string {
+	return "INSERT INTO `" + table + "`(algorithm,prev_chain,curr_chain,switch_reason,api_result) VALUES(?,?,?,?,?)"
+}
+
+func (mysqlDialect) lastRecordSQL(table string) string {
+	return "SELECT curr_chain, api_result FROM `" + table + "` ORDER BY id DESC LIMIT 1"
+}
+
+func (mysqlDialect) recentSwitchesSQL(table string) string {
+	return "SELECT unix_timestamp(created_at) FROM `" + table + "` WHERE " +
+		"algorithm = ? AND prev_chain <> curr_chain AND created_at > FROM_UNIXTIME(?) ORDER BY id"
+}
+
+func (mysqlDialect) columnExistsSQL(table string) string {
+	return "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE " +
+		"TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '" + strings.Replace(table, "'", "''", -1) + "' AND COLUMN_NAME = ?"
+}
+
+func (mysqlDialect) addColumnSQL(table string, column string, definition string) string {
+	return "ALTER TABLE `" + table + "` ADD COLUMN `" + column + "` " + definition
+}
+
+func (mysqlDialect) indexExistsSQL(table string) string {
+	return "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE " +
+		"TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '" + strings.Replace(table, "'", "''", -1) + "' AND INDEX_NAME = '" + historyIndexName + "'"
+}
+
+func (mysqlDialect) addIndexSQL(table string) string {
+	return "ALTER TABLE `" + table + "` ADD INDEX " + historyIndexName + " (algorithm, created_at)"
+}
+
+func (mysqlDialect) createJournalTableSQL(table string) string {
+	return "CREATE TABLE IF NOT EXISTS `" + table + "`(" + `
+		id bigint(20) NOT NULL AUTO_INCREMENT,
+		algorithm varchar(255) NOT NULL,
+		decision_hash char(64) NOT NULL,
+		outcome varchar(32) NOT NULL,
+		prev_chain varchar(255) NOT NULL,
+		best_chain varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		inputs text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY decision_hash (decision_hash)
+		)
+	`
+}
+
+func (mysqlDialect) insertJournalSQL(table string) string {
+	return "INSERT INTO `" + table + "`(algorithm,decision_hash,outcome,prev_chain,best_chain,curr_chain,inputs) " +
+		"VALUES(?,?,?,?,?,?,?)"
+}
+
+func (mysqlDialect) createStateTableSQL(table string) string {
+	return "CREATE TABLE IF NOT EXISTS `" + table + "`(" + `
+		algorithm varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		command_id bigint(20) unsigned NOT NULL,
+		updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (algorithm)
+		)
+	`
+}
+
+func (mysqlDialect) loadStateSQL(table string) string {
+	return "SELECT curr_chain, command_id FROM `" + table + "` WHERE algorithm = ?"
+}
+
+func (mysqlDialect) saveStateSQL(table string) string {
+	return "INSERT INTO `" + table + "`(algorithm,curr_chain,command_id) VALUES(?,?,?) " +
+		"ON DUPLICATE KEY UPDATE curr_chain = VALUES(curr_chain), command_id = VALUES(command_id)"
+}
+
+// postgresDialect PostgreSQL的切换记录表SQL
+type postgresDialect struct{}
+
+// quote 引用标识符，使表名区分大小写并可包含特殊字符
+func (postgresDialect) quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (d postgresDialect) createTableSQL(table string, temporary bool) string {
+	create := "CREATE TABLE IF NOT EXISTS "
+	if temporary {
+		create = "CREATE TEMPORARY TABLE "
+	}
+	return create + d.quote(table) + `(
+		id bigserial NOT NULL,
+		algorithm varchar(255) NOT NULL,
+		prev_chain varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		switch_reason ` + switchReasonColumn + `,
+		api_result text NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id)
+		)
+	`
+}
+
+func (d postgresDialect) insertSQL(table string) string {
+	return "INSERT INTO " + d.quote(table) + "(algorithm,prev_chain,curr_chain,switch_reason,api_result) VALUES($1,$2,$3,$4,$5)"
+}
+
+func (d postgresDialect) lastRecordSQL(table string) string {
+	return "SELECT curr_chain, api_result FROM " + d.quote(table) + " ORDER BY id DESC LIMIT 1"
+}
+
+func (d postgresDialect) recentSwitchesSQL(table string) string {
+	return "SELECT CAST(extract(epoch FROM created_at) AS bigint) FROM " + d.quote(table) + " WHERE " +
+		"algorithm = $1 AND prev_chain <> curr_chain AND created_at > to_timestamp($2) ORDER BY id"
+}
+
+func (d postgresDialect) columnExistsSQL(table string) string {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE " +
+		"table_schema = current_schema() AND table_name = '" + strings.Replace(table, "'", "''", -1) + "' AND column_name = $1"
+}
+
+func (d postgresDialect) addColumnSQL(table string, column string, definition string) string {
+	return "ALTER TABLE " + d.quote(table) + " ADD COLUMN IF NOT EXISTS " + d.quote(column) + " " + definition
+}
+
+func (d postgresDialect) indexExistsSQL(table string) string {
+	return "SELECT COUNT(*) FROM pg_indexes WHERE " +
+		"schemaname = current_schema() AND indexname = '" + strings.Replace(d.indexName(table), "'", "''", -1) + "'"
+}
+
+func (d postgresDialect) addIndexSQL(table string) string {
+	return "CREATE INDEX IF NOT EXISTS " + d.quote(d.indexName(table)) + " ON " + d.quote(table) + " (algorithm, created_at)"
+}
+
+// indexName PostgreSQL 的索引名在schema内唯一，以表名为前缀
+func (postgresDialect) indexName(table string) string {
+	return table + "_" + historyIndexName
+}
+
+func (d postgresDialect) createJournalTableSQL(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + d.quote(table) + `(
+		id bigserial NOT NULL,
+		algorithm varchar(255) NOT NULL,
+		decision_hash char(64) NOT NULL,
+		outcome varchar(32) NOT NULL,
+		prev_chain varchar(255) NOT NULL,
+		best_chain varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		inputs text NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id)
+		)
+	`
+}
+
+func (d postgresDialect) insertJournalSQL(table string) string {
+	return "INSERT INTO " + d.quote(table) + "(algorithm,decision_hash,outcome,prev_chain,best_chain,curr_chain,inputs) " +
+		"VALUES($1,$2,$3,$4,$5,$6,$7)"
+}
+
+func (d postgresDialect) createStateTableSQL(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + d.quote(table) + `(
+		algorithm varchar(255) NOT NULL,
+		curr_chain varchar(255) NOT NULL,
+		command_id bigint NOT NULL,
+		updated_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (algorithm)
+		)
+	`
+}
+
+func (d postgresDialect) loadStateSQL(table string) string {
+	return "SELECT curr_chain, command_id FROM " + d.quote(table) + " WHERE algorithm = $1"
+}
+
+func (d postgresDialect) saveStateSQL(table string) string {
+	return "INSERT INTO " + d.quote(table) + "(algorithm,curr_chain,command_id) VALUES($1,$2,$3) " +
+		"ON CONFLICT (algorithm) DO UPDATE SET curr_chain = EXCLUDED.curr_chain, command_id = EXCLUDED.command_id, updated_at = CURRENT_TIMESTAMP"
+}
+
+// sqlHistoryStore 使用 database/sql 的 HistoryStore
+type sqlHistoryStore struct {
+	db         *sql.DB
+	table      string
+	dialect    historyDialect
+	insertStmt *sql.Stmt
+}
+
+// newSQLHistoryStore 建表（若不存在）、为已有的表补充新增的列和索引并准备写入语句
+// extraColumns 为额外的列（列名 -> 列定义），写入切换记录时使用列定义中的默认值
+func newSQLHistoryStore(db *sql.DB, dialect historyDialect, table string, extraColumns map[string]string) (*sqlHistoryStore, error) {
+	columns, err := historyColumns(extraColumns)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(dialect.createTableSQL(table, false))
+	if err != nil {
+		// 没有建表权限时表可能已由DBA建好，由之后的 Prepare 判断表是否可用
+		glog.Warning("create table ", table, " failed: ", err)
+	}
+	migrateHistoryTable(db, dialect, table, columns)
+	insertStmt, err := db.Prepare(dialect.insertSQL(table))
+	if err != nil {
+		return nil, err
+	}
+	return &sqlHistoryStore{db, table, dialect, insertStmt}, nil
+}
+
+func (s *sqlHistoryStore) InsertRecord(algorithm string, prevChain string, currChain string, reason string, apiResult []byte) error {
+	_, err := s.insertStmt.Exec(algorithm, prevChain, currChain, reason, apiResult)
+	return err
+}
+
+func (s *sqlHistoryStore) RecentSwitches(algorithm string, since time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(s.dialect.recentSwitchesSQL(s.table), algorithm, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var switches []time.Time
+	for rows.Next() {
+		var createdAt int64
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		switches = append(switches, time.Unix(createdAt, 0))
+	}
+	return switches, rows.Err()
+}
+
+// historyIndexName 切换记录表的 (algorithm, created_at) 索引名，用于按算法查询近期的切换
+const historyIndexName = "algorithm_created_at"
+
+// switchReasonColumn switch_reason 列的定义，升级前写入的记录为空
+const switchReasonColumn = "varchar(64) NOT NULL DEFAULT ''"
+
+// historyColumn 切换记录表在最初的版本之后增加的列
+type historyColumn struct {
+	name       string
+	definition string
+}
+
+// historyColumns 返回需要确认存在的列：switch_reason 及按列名排序的额外列
+func historyColumns(extraColumns map[string]string) ([]historyColumn, error) {
+	columns := []historyColumn{{"switch_reason", switchReasonColumn}}
+	names := make([]string, 0, len(extraColumns))
+	for name := range extraColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isColumnName(name) {
+			return nil, fmt.Errorf("invalid column name %q in MySQLExtraColumns", name)
+		}
+		if strings.TrimSpace(extraColumns[name]) == "" {
+			return nil, fmt.Errorf("empty definition of column %s in MySQLExtraColumns", name)
+		}
+		columns = append(columns, historyColumn{name, extraColumns[name]})
+	}
+	return columns, nil
+}
+
+// isColumnName 列名只允许字母、数字和下划线，且不以数字开头
+func isColumnName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// migrateHistoryTable 为已有的切换记录表补充缺少的列和索引，已存在的跳过，因此重启时可重复执行
+// 失败时只输出警告：没有ALTER权限时由DBA手动变更，缺少 switch_reason 列时之后的 Prepare 会报错
+func migrateHistoryTable(db *sql.DB, dialect historyDialect, table string, columns []historyColumn) {
+	for _, column := range columns {
+		var count int
+		err := db.QueryRow(dialect.columnExistsSQL(table), column.name).Scan(&count)
+		if err != nil {
+			glog.Warning("check column ", column.name, " of table ", table, " failed: ", err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = db.Exec(dialect.addColumnSQL(table, column.name, column.definition))
+		if err != nil {
+			glog.Warning("add column ", column.name, " to table ", table, " failed: ", err)
+			continue
+		}
+		glog.Info("added column ", column.name, " to table ", table)
+	}
+
+	var count int
+	err := db.QueryRow(dialect.indexExistsSQL(table)).Scan(&count)
+	if err != nil {
+		glog.Warning("check index ", historyIndexName, " of table ", table, " failed: ", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	_, err = db.Exec(dialect.addIndexSQL(table))
+	if err != nil {
+		glog.Warning("add index ", historyIndexName, " to table ", table, " failed: ", err)
+		return
+	}
+	glog.Info("added index ", historyIndexName, " to table ", table)
+}
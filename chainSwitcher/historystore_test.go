@@ -0,0 +1,196 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// 测试MySQL的切换记录读写
+func TestMySQLHistoryStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `chain_switcher_record`(")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectHistoryMigrated(mock)
+	insert := mock.ExpectPrepare(regexp.QuoteMeta(
+		"INSERT INTO `chain_switcher_record`(algorithm,prev_chain,curr_chain,switch_reason,api_result) VALUES(?,?,?,?,?)"))
+	insert.ExpectExec().WithArgs("sha256", "btc", "bcc", switchReasonThresholdCrossed, []byte(`{"coins":[]}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	since := time.Unix(1500000000, 0)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT unix_timestamp(created_at) FROM `chain_switcher_record` WHERE")).
+		WithArgs("sha256", since.Unix()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(1500000100).AddRow(1500000200))
+
+	store, err := newSQLHistoryStore(db, mysqlDialect{}, "chain_switcher_record", nil)
+	if err != nil {
+		t.Fatalf("newSQLHistoryStore failed: %s", err)
+	}
+	if err := store.InsertRecord("sha256", "btc", "bcc", switchReasonThresholdCrossed, []byte(`{"coins":[]}`)); err != nil {
+		t.Errorf("InsertRecord failed: %s", err)
+	}
+	switches, err := store.RecentSwitches("sha256", since)
+	if err != nil {
+		t.Fatalf("RecentSwitches failed: %s", err)
+	}
+	if len(switches) != 2 || switches[0].Unix() != 1500000100 || switches[1].Unix() != 1500000200 {
+		t.Errorf("wrong recent switches: %v", switches)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+// expectHistoryMigrated 模拟已有 switch_reason 列和 (algorithm, created_at) 索引的表
+func expectHistoryMigrated(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.COLUMNS")).WithArgs("switch_reason").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.STATISTICS")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+}
+
+// 测试为升级前建立的表补充 switch_reason 列、额外的列和索引，已存在的不重复添加
+func TestMigrateHistoryTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `old_record`(")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'old_record'")).
+		WithArgs("switch_reason").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `old_record` ADD COLUMN `switch_reason` varchar(64) NOT NULL DEFAULT ''")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.COLUMNS")).
+		WithArgs("datacenter").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'old_record' AND INDEX_NAME = 'algorithm_created_at'")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `old_record` ADD INDEX algorithm_created_at (algorithm, created_at)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO `old_record`("))
+
+	extraColumns := map[string]string{"datacenter": "varchar(32) NOT NULL DEFAULT 'eu'"}
+	if _, err := newSQLHistoryStore(db, mysqlDialect{}, "old_record", extraColumns); err != nil {
+		t.Fatalf("newSQLHistoryStore failed: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+
+	for _, name := range []string{"", "1st", "a b", "x`; DROP--"} {
+		if _, err := newSQLHistoryStore(db, mysqlDialect{}, "old_record", map[string]string{name: "int"}); err == nil {
+			t.Errorf("invalid column name %q should be rejected", name)
+		}
+	}
+}
+
+// 测试切换原因：启动、收益超过当前币种、当前币种从API结果中消失
+func TestAutoSwitchReason(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	coins := CoinList{{Coin: "BCH"}, {Coin: "BTC"}}
+
+	cases := map[string]string{
+		"":    switchReasonStartup,
+		"btc": switchReasonThresholdCrossed,
+		"bsv": switchReasonChainDisappeared,
+	}
+	for oldChain, expected := range cases {
+		if reason := s.autoSwitchReason(coins, oldChain); reason != expected {
+			t.Errorf("reason of switching from %q expected: %s, got: %s", oldChain, expected, reason)
+		}
+	}
+}
+
+// 测试PostgreSQL的建表及写入语句
+func TestPostgresHistoryDialect(t *testing.T) {
+	dialect, err := newHistoryDialect(dbDriverPostgres)
+	if err != nil {
+		t.Fatalf("newHistoryDialect failed: %s", err)
+	}
+
+	ddl := dialect.createTableSQL("Chain_Switcher", false)
+	for _, expected := range []string{`CREATE TABLE IF NOT EXISTS "Chain_Switcher"(`, "id bigserial NOT NULL", "created_at timestamptz"} {
+		if !strings.Contains(ddl, expected) {
+			t.Errorf("DDL should contain %q, got: %s", expected, ddl)
+		}
+	}
+	if strings.Contains(ddl, "`") || strings.Contains(ddl, "AUTO_INCREMENT") {
+		t.Errorf("DDL should not contain MySQL syntax, got: %s", ddl)
+	}
+	if ddl := dialect.createTableSQL("t", true); !strings.HasPrefix(ddl, `CREATE TEMPORARY TABLE "t"(`) {
+		t.Errorf("wrong temporary table DDL: %s", ddl)
+	}
+	if insert := dialect.insertSQL(`a"b`); insert != `INSERT INTO "a""b"(algorithm,prev_chain,curr_chain,switch_reason,api_result) VALUES($1,$2,$3,$4,$5)` {
+		t.Errorf("wrong insert SQL: %s", insert)
+	}
+	if alter := dialect.addColumnSQL("t", "switch_reason", switchReasonColumn); alter != `ALTER TABLE "t" ADD COLUMN IF NOT EXISTS "switch_reason" varchar(64) NOT NULL DEFAULT ''` {
+		t.Errorf("wrong add column SQL: %s", alter)
+	}
+	if index := dialect.addIndexSQL("t"); index != `CREATE INDEX IF NOT EXISTS "t_algorithm_created_at" ON "t" (algorithm, created_at)` {
+		t.Errorf("wrong add index SQL: %s", index)
+	}
+
+	if dialect, err := newHistoryDialect(""); err != nil || dialect != (mysqlDialect{}) {
+		t.Errorf("default dialect should be mysql, got: %v, %v", dialect, err)
+	}
+	if _, err := newHistoryDialect("sqlite"); err == nil {
+		t.Errorf("unknown driver should be rejected")
+	}
+}
+
+// 测试表名中的 {algorithm} 使两个算法写入各自的表
+func TestHistoryTableNamePerAlgorithm(t *testing.T) {
+	cases := map[string]string{
+		"sha256":     "chain_switcher_record_sha256",
+		"scrypt":     "chain_switcher_record_scrypt",
+		"eth/pool-a": "chain_switcher_record_eth_pool_a",
+		"x`; DROP--": "chain_switcher_record_x___DROP__",
+	}
+	for algorithm, expected := range cases {
+		if table := historyTableName("chain_switcher_record_{algorithm}", algorithm); table != expected {
+			t.Errorf("table of %s expected: %s, got: %s", algorithm, expected, table)
+		}
+	}
+	if table := historyTableName("chain_switcher_record", "sha256"); table != "chain_switcher_record" {
+		t.Errorf("table without placeholder should be unchanged, got: %s", table)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	for _, algorithm := range []string{"sha256", "scrypt"} {
+		table := historyTableName("chain_switcher_record_{algorithm}", algorithm)
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `" + table + "`(")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectHistoryMigrated(mock)
+		mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO `"+table+"`(")).
+			ExpectExec().WithArgs(algorithm, "btc", "bcc", switchReasonThresholdCrossed, []byte("{}")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		store, err := newSQLHistoryStore(db, mysqlDialect{}, table, nil)
+		if err != nil {
+			t.Fatalf("newSQLHistoryStore of %s failed: %s", algorithm, err)
+		}
+		if err := store.InsertRecord(algorithm, "btc", "bcc", switchReasonThresholdCrossed, []byte("{}")); err != nil {
+			t.Errorf("InsertRecord of %s failed: %s", algorithm, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
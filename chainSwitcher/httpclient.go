@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// TLSClientConfig HTTPS双向认证的客户端配置
+type TLSClientConfig struct {
+	CertFile string // 客户端证书（PEM）
+	KeyFile  string // 客户端私钥（PEM）
+	CAFile   string // 验证服务器证书的CA（PEM），为空则使用系统CA
+}
+
+// 访问 ChainDispatchAPI 的HTTP客户端
+var httpClient = http.DefaultClient
+
+// defaultHTTPTimeoutSeconds 请求 ChainDispatchAPI 及 DispatchSources 的默认超时时间
+const defaultHTTPTimeoutSeconds = 10
+
+// maxLoggedBodySize 请求失败时日志中记录的响应内容的最大长度
+const maxLoggedBodySize = 512
+
+// noRedirect 不跟随重定向，直接返回重定向响应
+func noRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// truncateBody 截断过长的响应内容，用于记录日志
+func truncateBody(body []byte) string {
+	if len(body) <= maxLoggedBodySize {
+		return string(body)
+	}
+	return string(body[:maxLoggedBodySize]) + "...(" + strconv.Itoa(len(body)) + " bytes)"
+}
+
+// newHTTPClient 根据TLS配置创建HTTP客户端，未配置证书时使用默认的Transport
+func newHTTPClient(conf TLSClientConfig) (*http.Client, error) {
+	if conf.CertFile == "" && conf.KeyFile == "" && conf.CAFile == "" {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert %s / key %s failed: %s", conf.CertFile, conf.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if conf.CAFile != "" {
+		pool, err := loadCAFile(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadCAFile 读取PEM格式的CA证书，用于验证服务器证书
+func loadCAFile(caFile string) (*x509.CertPool, error) {
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file %s failed: %s", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in CA file %s", caFile)
+	}
+	return pool, nil
+}
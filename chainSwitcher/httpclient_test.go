@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeClientCert 生成自签名的客户端证书，写入dir，返回证书及其文件路径
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chainSwitcher"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, certFile, keyFile
+}
+
+// 测试使用客户端证书访问要求双向认证的服务器
+func TestNewHTTPClientWithClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chainSwitcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{}}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	client, err := newHTTPClient(TLSClientConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("newHTTPClient failed: %s", err)
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with client cert failed: %s", err)
+	}
+	response.Body.Close()
+
+	// 没有客户端证书时应被服务器拒绝
+	client, err = newHTTPClient(TLSClientConfig{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("newHTTPClient failed: %s", err)
+	}
+	if response, err = client.Get(server.URL); err == nil {
+		response.Body.Close()
+		t.Errorf("request without client cert should fail")
+	}
+}
+
+// 测试证书文件无法加载时返回错误
+func TestNewHTTPClientBadCert(t *testing.T) {
+	_, err := newHTTPClient(TLSClientConfig{CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"})
+	if err == nil {
+		t.Errorf("newHTTPClient should fail with missing cert files")
+	}
+}
+
+// 测试接口返回错误状态码或重定向时视为请求失败
+func TestFetchChainDispatchAPIStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/error", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "<html>internal error</html>", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"algorithms":{}}`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/login", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	httpClient = &http.Client{CheckRedirect: noRedirect}
+	defer func() { httpClient = http.DefaultClient }()
+
+	configData.ChainDispatchAPI = server.URL + "/error"
+	if body, err := s.fetchChainDispatchAPI(); err == nil {
+		t.Errorf("HTTP 500 should fail, got: %s", body)
+	}
+
+	configData.ChainDispatchAPI = server.URL + "/redirect"
+	if body, err := s.fetchChainDispatchAPI(); err == nil {
+		t.Errorf("redirect should fail by default, got: %s", body)
+	}
+
+	httpClient = &http.Client{}
+	body, err := s.fetchChainDispatchAPI()
+	if err != nil {
+		t.Fatalf("redirect should be followed when enabled: %s", err)
+	}
+	if string(body) != `{"algorithms":{}}` {
+		t.Errorf("wrong body after redirect: %s", body)
+	}
+}
+
+// 测试请求失败时以指数退避重试，全部失败时保持当前币种
+func TestFetchChainDispatchAPIRetry(t *testing.T) {
+	requests, failures := 0, 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{"BCH":{"dispatch_hashrate":150,"dispatchable_hashrate":200}}}}}`))
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.HTTPRetryCount = 2
+	configData.HTTPRetryBaseDelayMilliseconds = 100
+	httpClient = server.Client()
+	defer func() { httpClient = http.DefaultClient }()
+	var delays []time.Duration
+	retrySleep = func(d time.Duration) { delays = append(delays, d) }
+	defer func() { retrySleep = time.Sleep }()
+
+	body, err := s.fetchChainDispatchAPI()
+	if err != nil || requests != 3 {
+		t.Fatalf("success expected at attempt 3, requests: %d, err: %v", requests, err)
+	}
+	if !strings.Contains(string(body), "BCH") {
+		t.Errorf("wrong body: %s", body)
+	}
+	if len(delays) != 2 || delays[0] != 100*time.Millisecond || delays[1] != 200*time.Millisecond {
+		t.Errorf("exponential backoff expected: [100ms 200ms], got: %v", delays)
+	}
+
+	// 全部失败时不切换
+	requests, failures, delays = 0, 3, nil
+	s.currentChainName = "btc"
+	s.updateCurrentChain()
+	if requests != 3 || len(delays) != 2 {
+		t.Errorf("3 attempts expected, requests: %d, delays: %v", requests, delays)
+	}
+	if s.currentChainName != "btc" {
+		t.Errorf("current chain should be kept after all retries failed, got: %s", s.currentChainName)
+	}
+}
+
+// 测试截断日志中的响应内容
+func TestTruncateBody(t *testing.T) {
+	if s := truncateBody([]byte("short")); s != "short" {
+		t.Errorf("short body should not be truncated, got: %s", s)
+	}
+	long := make([]byte, maxLoggedBodySize+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if s := truncateBody(long); s[maxLoggedBodySize:] != "...(522 bytes)" {
+		t.Errorf("long body should be truncated, got: %s", s[maxLoggedBodySize:])
+	}
+}
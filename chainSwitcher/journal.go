@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// decisionJournalQueueSize 等待写入的决策记录数上限，超过时丢弃新的记录
+const decisionJournalQueueSize = 1000
+
+// defaultDecisionJournalTableSuffix 未配置 DecisionJournalTable 时，在切换记录表名后追加的后缀
+const defaultDecisionJournalTableSuffix = "_decision"
+
+// 决策结果
+const (
+	decisionSwitched         = "switched"           // 切换到新币种
+	decisionUnchanged        = "unchanged"          // 最优币种即当前币种
+	decisionHeldByRollback   = "held_by_rollback"   // 新币种刚被自动回滚，尚在 AutoRollback.HoldSeconds 内
+	decisionHeldByThreshold  = "held_by_threshold"  // 新币种的优势未达到 SwitchThresholdPercent
+	decisionHeldByStickiness = "held_by_stickiness" // 新币种的优势不足以抵消当前币种的粘性
+	decisionSuppressed       = "suppressed"         // 达到每日切换次数上限
+	decisionUnsupported      = "unsupported"        // sserver不支持最优币种
+)
+
+// DecisionRecord 一次选择币种的决策，包含重放该决策所需的输入和计算结果
+type DecisionRecord struct {
+	Algorithm      string             `json:"algorithm"`
+	Outcome        string             `json:"outcome"`
+	OldChain       string             `json:"old_chain"`
+	BestChain      string             `json:"best_chain"`
+	NewChain       string             `json:"new_chain"`
+	RequiredMargin float64            `json:"required_margin"` // 粘性要求的优势（%）
+	Coins          CoinList           `json:"coins"`           // 合并调度因子后的币种列表
+	Scores         map[string]float64 `json:"scores"`          // 各币种名的 dispatch_hashrate
+	Hash           string             `json:"decision_hash"`
+	Time           string             `json:"time"`
+}
+
+// decisionHash 输入和结果相同的决策的hash相同，不含决策时间，用于去重
+func decisionHash(record DecisionRecord) string {
+	record.Hash = ""
+	record.Time = ""
+	bytes, _ := json.Marshal(record)
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// DecisionStore 决策记录的存储
+type DecisionStore interface {
+	// InsertDecision 写入一条决策记录
+	InsertDecision(record DecisionRecord) error
+}
+
+// sqlDecisionStore 使用 database/sql 的 DecisionStore，与切换记录共用数据库连接
+type sqlDecisionStore struct {
+	insertStmt *sql.Stmt
+}
+
+// newSQLDecisionStore 建表（若不存在）并准备写入语句
+func newSQLDecisionStore(db *sql.DB, dialect historyDialect, table string) (*sqlDecisionStore, error) {
+	_, err := db.Exec(dialect.createJournalTableSQL(table))
+	if err != nil {
+		// 没有建表权限时表可能已由DBA建好，由之后的 Prepare 判断表是否可用
+		glog.Warning("create table ", table, " failed: ", err)
+	}
+	insertStmt, err := db.Prepare(dialect.insertJournalSQL(table))
+	if err != nil {
+		return nil, err
+	}
+	return &sqlDecisionStore{insertStmt}, nil
+}
+
+func (s *sqlDecisionStore) InsertDecision(record DecisionRecord) error {
+	inputs, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.insertStmt.Exec(record.Algorithm, record.Hash, record.Outcome,
+		record.OldChain, record.BestChain, record.NewChain, inputs)
+	return err
+}
+
+// decisionJournal 在单独的goroutine中写入决策记录，避免数据库写入拖慢切换
+type decisionJournal struct {
+	algorithm string
+	store     DecisionStore
+	queue     chan DecisionRecord
+	done      chan struct{}
+}
+
+func newDecisionJournal(algorithm string, store DecisionStore) *decisionJournal {
+	return &decisionJournal{algorithm, store, make(chan DecisionRecord, decisionJournalQueueSize), make(chan struct{})}
+}
+
+// record 计算决策hash并放入写入队列，队列已满时丢弃
+func (j *decisionJournal) record(record DecisionRecord) {
+	if j == nil {
+		return
+	}
+	record.Algorithm = j.algorithm
+	record.Hash = decisionHash(record)
+	record.Time = time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	select {
+	case j.queue <- record:
+	default:
+		glog.Warning("decision journal queue is full, decision ", record.Hash, " dropped")
+	}
+}
+
+// run 依次写入队列中的决策记录，直到队列关闭
+func (j *decisionJournal) run() {
+	defer close(j.done)
+	for record := range j.queue {
+		if err := j.store.InsertDecision(record); err != nil {
+			glog.Error("write decision journal failed: ", err)
+		}
+	}
+}
+
+// close 关闭写入队列，并等待队列中剩余的决策记录写入完成
+func (j *decisionJournal) close() {
+	if j == nil {
+		return
+	}
+	close(j.queue)
+	<-j.done
+}
+
+// decisionJournalTable 决策记录的表名，未配置时为切换记录表名加 _decision 后缀
+func (s *algorithmSwitcher) decisionJournalTable() string {
+	if s.config.DecisionJournalTable != "" {
+		return historyTableName(s.config.DecisionJournalTable, s.config.Algorithm)
+	}
+	return historyTableName(s.config.MySQL.Table, s.config.Algorithm) + defaultDecisionJournalTableSuffix
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// memDecisionStore 记录写入的决策
+type memDecisionStore struct {
+	records []DecisionRecord
+}
+
+func (s *memDecisionStore) InsertDecision(record DecisionRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+// 测试未切换的决策也写入决策记录，并带有各币种的算力和决策hash
+func TestDecisionJournalNoSwitch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{` +
+			`"BTC":{"dispatch_hashrate":100,"dispatchable_hashrate":120},` +
+			`"BCH":{"dispatch_hashrate":40,"dispatchable_hashrate":50}}}}}`))
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	httpClient = server.Client()
+	s.historyStore = &memHistoryStore{}
+	s.currentChainName = "btc"
+
+	store := &memDecisionStore{}
+	s.journal = newDecisionJournal(configData.Algorithm, store)
+
+	s.updateCurrentChain()
+	s.updateCurrentChain()
+	close(s.journal.queue)
+	s.journal.run()
+
+	if len(store.records) != 2 {
+		t.Fatalf("2 decisions expected, got: %d", len(store.records))
+	}
+	record := store.records[0]
+	if record.Outcome != decisionUnchanged || record.OldChain != "btc" || record.BestChain != "btc" || record.NewChain != "btc" {
+		t.Errorf("wrong decision: %+v", record)
+	}
+	if record.Algorithm != "sha256" || len(record.Coins) != 2 {
+		t.Errorf("wrong decision inputs: %+v", record)
+	}
+	if len(record.Scores) != 2 || record.Scores["btc"] != 100 || record.Scores["bcc"] != 40 {
+		t.Errorf("wrong decision scores: %v", record.Scores)
+	}
+	if len(record.Hash) != 64 || record.Hash != decisionHash(record) {
+		t.Errorf("wrong decision hash: %s", record.Hash)
+	}
+	if store.records[1].Hash != record.Hash {
+		t.Errorf("same decision expected same hash, got: %s and %s", record.Hash, store.records[1].Hash)
+	}
+}
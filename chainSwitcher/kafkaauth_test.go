@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试按TLS及SASL配置创建连接Kafka的Dialer
+func TestNewKafkaDialer(t *testing.T) {
+	dialer, err := newKafkaDialer(KafkaTLSConfig{}, KafkaSASLConfig{})
+	if err != nil || dialer != nil {
+		t.Errorf("default dialer expected without TLS and SASL, got: %v, %v", dialer, err)
+	}
+
+	dir, err := ioutil.TempDir("", "chainSwitcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, caFile, _ := writeClientCert(t, dir)
+
+	dialer, err = newKafkaDialer(KafkaTLSConfig{Enabled: true, CAFile: caFile},
+		KafkaSASLConfig{Mechanism: saslMechanismScramSHA512, Username: "switcher", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialer.TLS == nil || dialer.TLS.RootCAs == nil || dialer.TLS.InsecureSkipVerify {
+		t.Errorf("TLS with CA expected, got: %+v", dialer.TLS)
+	}
+	if dialer.SASLMechanism == nil || dialer.SASLMechanism.Name() != saslMechanismScramSHA512 {
+		t.Errorf("SASL mechanism %s expected, got: %v", saslMechanismScramSHA512, dialer.SASLMechanism)
+	}
+
+	// 只配置SASL时不使用TLS
+	dialer, err = newKafkaDialer(KafkaTLSConfig{}, KafkaSASLConfig{Mechanism: saslMechanismPlain, Username: "switcher"})
+	if err != nil || dialer.TLS != nil || dialer.SASLMechanism.Name() != saslMechanismPlain {
+		t.Errorf("SASL PLAIN without TLS expected, got: %+v, %v", dialer, err)
+	}
+
+	dialer, err = newKafkaDialer(KafkaTLSConfig{Enabled: true, InsecureSkipVerify: true}, KafkaSASLConfig{})
+	if err != nil || !dialer.TLS.InsecureSkipVerify || dialer.SASLMechanism != nil {
+		t.Errorf("TLS without verification expected, got: %+v, %v", dialer, err)
+	}
+
+	if _, err = newKafkaDialer(KafkaTLSConfig{}, KafkaSASLConfig{Mechanism: "GSSAPI"}); err == nil {
+		t.Errorf("unknown mechanism expected error")
+	}
+	if _, err = newKafkaDialer(KafkaTLSConfig{Enabled: true, CAFile: filepath.Join(dir, "missing.crt")}, KafkaSASLConfig{}); err == nil {
+		t.Errorf("missing CA file expected error")
+	}
+}
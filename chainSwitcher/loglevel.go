@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+// LogVerbosity 日志详细程度（glog的 -v 参数）
+type LogVerbosity struct {
+	V int `json:"v"`
+}
+
+// currentLogVerbosity 当前的日志详细程度
+func currentLogVerbosity() int {
+	v, _ := strconv.Atoi(flag.Lookup("v").Value.String())
+	return v
+}
+
+// logVerbosityHandle 查询（GET）或修改（POST v=<level>）日志详细程度，无需重启
+func logVerbosityHandle(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		v, err := strconv.Atoi(req.FormValue("v"))
+		if err != nil || v < 0 {
+			http.Error(w, "v must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		old := currentLogVerbosity()
+		if err := flag.Set("v", strconv.Itoa(v)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		glog.Info("log verbosity changed: ", old, " -> ", v)
+	default:
+		http.Error(w, "method not allowed, use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, _ := json.Marshal(LogVerbosity{currentLogVerbosity()})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/glog"
+)
+
+// 测试通过 /loglevel 修改日志详细程度
+func TestLogVerbosityHandle(t *testing.T) {
+	old := flag.Lookup("v").Value.String()
+	defer flag.Set("v", old)
+	flag.Set("v", "0")
+	configData = &ChainSwitcherConfig{OverrideAPIUser: "admin", OverrideAPIPassword: "secret"}
+
+	mux := newMetricsMux()
+	request := func(method string, url string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, url, nil)
+		request.SetBasicAuth("admin", "secret")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// 与 /override 相同需要认证
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("POST", "/loglevel?v=3", nil))
+	if recorder.Code != http.StatusUnauthorized || glog.V(3) {
+		t.Errorf("request without auth expected: 401, got: %d", recorder.Code)
+	}
+
+	if glog.V(3) {
+		t.Errorf("V(3) should be disabled by default")
+	}
+
+	recorder = request("POST", "/loglevel?v=3")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"v":3}` {
+		t.Errorf("set verbosity expected: 200 {\"v\":3}, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if !glog.V(3) {
+		t.Errorf("V(3) should be enabled after setting v=3")
+	}
+	if glog.V(4) {
+		t.Errorf("V(4) should be disabled after setting v=3")
+	}
+	if recorder = request("GET", "/loglevel"); recorder.Body.String() != `{"v":3}` {
+		t.Errorf("get verbosity expected: {\"v\":3}, got: %s", recorder.Body.String())
+	}
+
+	if recorder = request("POST", "/loglevel?v=abc"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid verbosity expected: 400, got: %d", recorder.Code)
+	}
+
+	request("POST", "/loglevel?v=0")
+	if glog.V(3) {
+		t.Errorf("V(3) should be disabled after setting v=0")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// unchangedLogLimiter 限制“币种未变化”日志的输出频率，子池模式下各子池单独计算
+// 只在轮询的goroutine中使用，不需要加锁
+type unchangedLogLimiter struct {
+	clock      Clock
+	interval   time.Duration
+	last       map[string]time.Time // 各子池（非子池模式为空字符串）上次输出的时间
+	suppressed map[string]int       // 上次输出后省略的条数
+}
+
+// newUnchangedLogLimiter 创建日志限制，interval不大于0时返回nil
+func newUnchangedLogLimiter(clock Clock, interval time.Duration) *unchangedLogLimiter {
+	if interval <= 0 {
+		return nil
+	}
+	return &unchangedLogLimiter{
+		clock:      clock,
+		interval:   interval,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// allow 返回现在是否输出 subPool 的“币种未变化”日志，以及输出时上次输出后被省略的条数
+func (l *unchangedLogLimiter) allow(subPool string) (ok bool, suppressed int) {
+	if l == nil {
+		return true, 0
+	}
+	now := l.clock.Now()
+	if last, exists := l.last[subPool]; exists && now.Sub(last) < l.interval {
+		l.suppressed[subPool]++
+		return false, 0
+	}
+	suppressed = l.suppressed[subPool]
+	l.last[subPool] = now
+	l.suppressed[subPool] = 0
+	return true, suppressed
+}
+
+// suppressedLogSuffix 输出时附加的省略条数说明
+func suppressedLogSuffix(suppressed int) string {
+	if suppressed == 0 {
+		return ""
+	}
+	return " (" + strconv.Itoa(suppressed) + " similar lines suppressed)"
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试“币种未变化”日志在间隔内被省略，间隔后输出并带上省略的条数
+func TestUnchangedLogLimiter(t *testing.T) {
+	if ok, suppressed := (*unchangedLogLimiter)(nil).allow(""); !ok || suppressed != 0 {
+		t.Errorf("nil limiter should always allow")
+	}
+	if newUnchangedLogLimiter(realClock{}, 0) != nil {
+		t.Errorf("zero interval expected nil limiter")
+	}
+
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	limiter := newUnchangedLogLimiter(clock, 5*time.Minute)
+
+	if ok, suppressed := limiter.allow(""); !ok || suppressed != 0 {
+		t.Errorf("first line expected to be logged, got: %v %d", ok, suppressed)
+	}
+	for i := 0; i < 4; i++ {
+		clock.advance(time.Minute)
+		if ok, _ := limiter.allow(""); ok {
+			t.Errorf("line %d within interval expected to be suppressed", i)
+		}
+	}
+	// 子池单独计算
+	if ok, _ := limiter.allow("pool1"); !ok {
+		t.Errorf("first line of another sub-pool expected to be logged")
+	}
+
+	clock.advance(time.Minute)
+	if ok, suppressed := limiter.allow(""); !ok || suppressed != 4 {
+		t.Errorf("line after interval expected to be logged with 4 suppressed, got: %v %d", ok, suppressed)
+	}
+	if suffix := suppressedLogSuffix(4); suffix != " (4 similar lines suppressed)" {
+		t.Errorf("wrong suffix: %s", suffix)
+	}
+	if suffix := suppressedLogSuffix(0); suffix != "" {
+		t.Errorf("no suffix expected, got: %s", suffix)
+	}
+}
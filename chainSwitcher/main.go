@@ -5,16 +5,18 @@ import (
 	"database/sql"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
-	"net/http"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/snappy"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/segmentio/kafka-go/snappy"
 )
 
@@ -40,21 +42,78 @@ type ChainSwitcherConfig struct {
 		Brokers         []string
 		ControllerTopic string
 		ProcessorTopic  string
+		StagingTopic    string
+		StagingMode     string
+		StagingSeconds  time.Duration
+		SelfTestTopic   string
+		TLS             KafkaTLSConfig  // 连接broker的TLS配置，默认不使用TLS
+		SASL            KafkaSASLConfig // 连接broker的SASL认证，默认不认证
 	}
-	Algorithm             string
-	ChainDispatchAPI      string
-	SwitchIntervalSeconds time.Duration
-	FailSafeChain         string
-	FailSafeSeconds       time.Duration
-	ChainNameMap          map[string]string
-	MySQL                 MySQLInfo
-	ChainLimits           map[string]ChainLimit
-	RecordLifetime        uint64
+	Algorithm                      string
+	ChainDispatchAPI               string
+	ChainDispatchAPITLS            TLSClientConfig
+	ChainDispatchAPIRedirect       bool
+	HTTPTimeoutSeconds             time.Duration // 请求 ChainDispatchAPI 及 DispatchSources 的超时时间，默认10秒
+	HTTPRetryCount                 int           // 请求 ChainDispatchAPI 失败后的重试次数，为0时不重试
+	HTTPRetryBaseDelayMilliseconds time.Duration // 第一次重试前的等待时间（毫秒），之后每次重试加倍
+	DispatchSources                []DispatchSource
+	SwitchIntervalSeconds          time.Duration
+	PollIntervalSeconds            time.Duration
+	EmitIntervalSeconds            time.Duration
+	FailSafeChain                  string
+	FailSafeSeconds                time.Duration
+	ChainNameMap                   ChainNameMap
+	SwitchThresholdPercent         float64            // 新币种的 dispatch_hashrate 需超过当前币种该百分比才切换，为0时不限制
+	DBDriver                       string             // 切换记录数据库的驱动，mysql（默认）或 postgres，连接信息仍使用 MySQL 配置
+	ChainSwitchThresholds          map[string]float64 `json:"-"` // 由 ChainNameMap 解析
+	MySQL                          MySQLInfo
+	MySQLMaxOpenConns              int
+	MySQLMaxIdleConns              int
+	MySQLConnMaxLifetimeSeconds    time.Duration
+	MySQLExtraColumns              map[string]string // 切换记录表的额外列（列名 -> 列定义），启动时自动添加
+	ChainLimits                    map[string]ChainLimit
+	RecordLifetime                 uint64
+	MetricsListenAddr              string
+	MaxSwitchesPerDay              int
+	RecentChainsSize               int
+	SubPoolDispatch                bool
+	AggregateByChain               bool
+	CoinFieldNames                 map[string]string
+	PprofListenAddr                string
+	Stickiness                     StickinessConfig
+	ClockJumpThresholdSeconds      time.Duration
+	ClockJumpDeferEmit             bool
+	AutoRollback                   AutoRollbackConfig
+	NotifyWebhookURL               string
+	NotifyFormat                   string
+	NotifyTemplate                 string
+	IncludeMetrics                 bool
+	CanaryRollout                  CanaryRolloutConfig
+	SwitchGraceSeconds             int      // 切换后原币种的share仍可接受的秒数，大于0时随命令发送
+	SupportedChains                []string // sserver支持的币种名，配置后不会切换到其他币种
+	OverrideAPIUser                string   // /override、/loglevel 及 /preview 接口的 HTTP Basic 认证用户名，为空时禁用这些接口
+	OverrideAPIPassword            string
+	SwitchSegments                 []string      // 只切换这些分段（如子池、地区）的用户，为空时切换所有用户
+	UnchangedLogIntervalSeconds    time.Duration // “币种未变化”日志的最小输出间隔，为0时每次轮询都输出
+	DecisionJournal                bool          // 是否将每次决策（包括未切换）的输入和结果写入决策记录表
+	DecisionJournalTable           string        // 决策记录表名，为空时为切换记录表名加 _decision 后缀
+	CommandEncoding                string        // Kafka消息的编码，json（默认）或 protobuf，sserver的响应使用相同的编码
+	PreferenceWeightsFile          string        // 各币种权重（dispatch_hashrate 的乘数）的JSON文件，为空时不使用
+	PreferenceWeightsReloadSeconds time.Duration // 重新读取 PreferenceWeightsFile 的间隔，默认60秒
+	AckTimeoutSeconds              time.Duration // 命令发送后等待sserver响应的时间，超时未收到任何响应时告警，为0时不跟踪
+	TargetServerIDs                []int         // 只让这些id的sserver执行切换命令，为空时所有sserver执行
+	DryRun                         bool          // 试运行：照常轮询和决策并输出日志，但不发送Kafka命令，不写入切换记录和决策记录
+	HashrateSmoothing              HashrateSmoothingConfig
+	PersistState                   bool   // 是否将最后发送的币种和命令id写入运行状态表，重启后恢复
+	StateTable                     string // 运行状态表名，为空时为切换记录表名加 _state 后缀
+	// Algorithms 同一进程中切换的多个算法，各自使用不同的Kafka topic，共用数据库连接池
+	// 为空时只切换 Algorithm；配置后忽略顶层的 Algorithm
+	Algorithms []AlgorithmConfig
 }
 
 // ChainRecord HTTP API中的币种记录
 type ChainRecord struct {
-	Coins []string `json:"coins"`
+	Coins CoinList `json:"coins"`
 }
 
 // ChainDispatchRecord HTTP API响应
@@ -62,8 +121,12 @@ type ChainDispatchRecord struct {
 	Algorithms map[string]ChainRecord `json:"algorithms"`
 }
 
+// kafkaSchemaVersion 发送的Kafka消息格式版本号，格式变化时递增
+const kafkaSchemaVersion = 1
+
 // KafkaMessage Kafka中接收的消息结构
 type KafkaMessage struct {
+	Version             int         `json:"version"` // 旧版sserver不发送该字段，此时为0
 	ID                  interface{} `json:"id"`
 	Type                string      `json:"type"`
 	Action              string      `json:"action"`
@@ -74,6 +137,7 @@ type KafkaMessage struct {
 	ServerID            int         `json:"server_id"`
 	SwitchedConnections int         `json:"switched_connections"`
 	SwitchedUsers       int         `json:"switched_users"`
+	CorrelationID       string      `json:"correlation_id"` // 回传命令中的关联id，旧版sserver不发送
 	Host                struct {
 		Hostname string              `json:"hostname"`
 		IP       map[string][]string `json:"ip"`
@@ -82,11 +146,23 @@ type KafkaMessage struct {
 
 // KafkaCommand Kafka中发送的消息结构
 type KafkaCommand struct {
-	ID        interface{} `json:"id"`
-	Type      string      `json:"type"`
-	Action    string      `json:"action"`
-	CreatedAt string      `json:"created_at"`
-	ChainName string      `json:"chain_name"`
+	Version   int             `json:"version"`
+	ID        interface{}     `json:"id"`
+	Type      string          `json:"type"`
+	Action    string          `json:"action"`
+	CreatedAt string          `json:"created_at"`
+	ChainName string          `json:"chain_name"`
+	SubPool   string          `json:"subpool_name,omitempty"` // 仅在子池模式下发送
+	Segment   string          `json:"segment,omitempty"`      // 仅在配置了 SwitchSegments 时发送
+	Metrics   *CommandMetrics `json:"metrics,omitempty"`      // 仅在开启 IncludeMetrics 时发送
+	// RolloutPercent 灰度切换中应切换到该币种的矿机比例，仅在开启 CanaryRollout 且灰度进行中时发送
+	RolloutPercent int `json:"rollout_percent,omitempty"`
+	// GraceSeconds 切换后原币种的share仍可接受的秒数，仅在配置了 SwitchGraceSeconds 时发送
+	GraceSeconds int `json:"grace_seconds,omitempty"`
+	// CorrelationID 切换的关联id，同一次切换的所有命令相同，sserver在响应中回传
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// TargetServerIDs 只有这些id的sserver执行该命令，为空时所有sserver执行
+	TargetServerIDs []int `json:"target_server_ids,omitempty"`
 }
 
 // ActionFailSafeSwitch API失效切换到默认币种时记录的api_result
@@ -98,24 +174,41 @@ type ActionFailSafeSwitch struct {
 	NewChainName   string `json:"new_chain_name"`
 }
 
-// 配置数据
+// 预发布模式（Kafka.StagingMode）
+const (
+	// stagingModeOff 只发送到生产topic
+	stagingModeOff = ""
+	// stagingModeStaging 只发送到预发布topic，直到被提升到生产环境
+	stagingModeStaging = "staging"
+	// stagingModeBoth 同时发送到生产topic和预发布topic
+	stagingModeBoth = "both"
+)
+
+// 配置数据（顶层配置），各算法的配置见 algorithmSwitcher.config
 var configData *ChainSwitcherConfig
 
-var updateTime int64
-var currentChainName string
+// 程序启动时间
+var startTime time.Time
 
-var controllerProducer *kafka.Writer
-var processorConsumer *kafka.Reader
-var commandID uint64
+// kafkaWriter 发送Kafka消息，便于测试时替换
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
 
-var insertStmt *sql.Stmt
-var mysqlConn *sql.DB
+// historyDB 切换记录及决策记录使用的数据库连接，各算法共用，退出时关闭
+var historyDB *sql.DB
 
 func main() {
 	// 解析命令行参数
 	configFilePath := flag.String("config", "./config.json", "Path of config file")
+	promote := flag.Bool("promote", false, "Also send commands to the production topic in staging mode")
+	emitChain := flag.String("emit", "", "Send a single switch command of the chain and exit")
+	emitAlgorithm := flag.String("algorithm", "", "Algorithm of the -emit command, required when multiple Algorithms are configured")
+	selfTest := flag.Bool("selftest", false, "Check the dispatch API, database and Kafka once and exit")
 	flag.Parse()
 
+	startTime = time.Now()
+
 	// 读取配置文件
 	configJSON, err := ioutil.ReadFile(*configFilePath)
 
@@ -132,6 +225,16 @@ func main() {
 		return
 	}
 
+	configData.ChainSwitchThresholds, err = parseChainSwitchThresholds(configJSON)
+	if err != nil {
+		glog.Fatal("parse config failed: ", err)
+		return
+	}
+	if err = parseAlgorithmSwitchThresholds(configJSON, configData.Algorithms); err != nil {
+		glog.Fatal("parse config failed: ", err)
+		return
+	}
+
 	// 验证配置
 	for chain, limit := range configData.ChainLimits {
 		limit.hashrate, err = parseHashrate(limit.MaxHashrate)
@@ -151,76 +254,329 @@ func main() {
 
 		glog.Info("chain ", limit.name, " max hashrate: ", formatHashrate(limit.hashrate))
 	}
+	if err = checkIntervals(configData); err != nil {
+		glog.Fatal(err)
+		return
+	}
+	if configData.HTTPTimeoutSeconds == 0 {
+		configData.HTTPTimeoutSeconds = defaultHTTPTimeoutSeconds
+	}
+	if configData.PreferenceWeightsReloadSeconds == 0 {
+		configData.PreferenceWeightsReloadSeconds = defaultPreferenceWeightsReloadSeconds
+	}
 	if configData.RecordLifetime == 0 {
 		configData.RecordLifetime = 60
 	}
+	if configData.ClockJumpThresholdSeconds == 0 {
+		configData.ClockJumpThresholdSeconds = defaultClockJumpThresholdSeconds
+	}
+	if configData.DBDriver == "" {
+		configData.DBDriver = dbDriverMySQL
+	}
+	if configData.AutoRollback.MaxFailedAcks == 0 {
+		configData.AutoRollback.MaxFailedAcks = defaultRollbackMaxFailedAcks
+	}
+	if configData.AutoRollback.AckTimeoutSeconds == 0 {
+		configData.AutoRollback.AckTimeoutSeconds = defaultRollbackAckTimeoutSeconds
+	}
+	if configData.AutoRollback.HoldSeconds == 0 {
+		configData.AutoRollback.HoldSeconds = defaultRollbackHoldSeconds
+	}
+	if configData.AutoRollback.Enabled && configData.SubPoolDispatch {
+		glog.Warning("AutoRollback is not supported with SubPoolDispatch, ignored")
+		configData.AutoRollback.Enabled = false
+	}
+	if configData.CanaryRollout.Enabled && configData.SubPoolDispatch {
+		glog.Warning("CanaryRollout is not supported with SubPoolDispatch, ignored")
+		configData.CanaryRollout.Enabled = false
+	}
+	if configData.CanaryRollout.Enabled {
+		if err = checkCanaryRollout(&configData.CanaryRollout); err != nil {
+			glog.Fatal("wrong CanaryRollout: ", err)
+			return
+		}
+	}
+	if configData.SwitchThresholdPercent < 0 {
+		glog.Fatal("SwitchThresholdPercent should not be negative, got: ", configData.SwitchThresholdPercent)
+		return
+	}
+	if err = checkHashrateSmoothing(configData.HashrateSmoothing); err != nil {
+		glog.Fatal("wrong HashrateSmoothing: ", err)
+		return
+	}
+	if len(configData.SwitchSegments) > 0 && configData.SubPoolDispatch {
+		glog.Warning("SwitchSegments is not supported with SubPoolDispatch, ignored")
+		configData.SwitchSegments = nil
+	}
+	if err = checkSwitchSegments(configData.SwitchSegments); err != nil {
+		glog.Fatal("wrong SwitchSegments: ", err)
+		return
+	}
+	if configData.SwitchGraceSeconds < 0 {
+		glog.Fatal("wrong SwitchGraceSeconds: ", configData.SwitchGraceSeconds, ", should not be negative")
+		return
+	}
+	if _, err = newHistoryDialect(configData.DBDriver); err != nil {
+		glog.Fatal(err)
+		return
+	}
+	if err = checkCoinFieldNames(configData.CoinFieldNames); err != nil {
+		glog.Fatal("wrong CoinFieldNames: ", err)
+		return
+	}
+	if err = checkDispatchSources(configData.DispatchSources); err != nil {
+		glog.Fatal("wrong DispatchSources: ", err)
+		return
+	}
+	switch configData.NotifyFormat {
+	case "", notifyFormatRaw, notifyFormatSlack, notifyFormatDiscord:
+	default:
+		glog.Fatal("unknown NotifyFormat: ", configData.NotifyFormat)
+		return
+	}
+	if err = checkCommandEncoding(configData.CommandEncoding); err != nil {
+		glog.Fatal(err)
+		return
+	}
+	notifyTemplate, err = parseNotifyTemplate(configData.NotifyTemplate)
+	if err != nil {
+		glog.Fatal("parse NotifyTemplate failed: ", err)
+		return
+	}
+	if configData.PreferenceWeightsFile != "" {
+		preferences, err = newPreferenceWeights(configData.PreferenceWeightsFile)
+		if err != nil {
+			glog.Fatal("load PreferenceWeightsFile failed: ", err)
+			return
+		}
+		go preferences.runReload(configData.PreferenceWeightsFile, configData.PreferenceWeightsReloadSeconds*time.Second)
+	}
+	switch configData.Stickiness.DecayFunction {
+	case "":
+		configData.Stickiness.DecayFunction = stickinessDecayLinear
+	case stickinessDecayLinear, stickinessDecayExponential:
+	default:
+		glog.Fatal("unknown Stickiness.DecayFunction: ", configData.Stickiness.DecayFunction)
+		return
+	}
+	switch configData.Kafka.StagingMode {
+	case stagingModeOff:
+	case stagingModeStaging, stagingModeBoth:
+		if configData.Kafka.StagingTopic == "" {
+			glog.Fatal("Kafka.StagingTopic cannot be empty in staging mode ", configData.Kafka.StagingMode)
+			return
+		}
+	default:
+		glog.Fatal("unknown Kafka.StagingMode: ", configData.Kafka.StagingMode)
+		return
+	}
 
-	processorConsumer = kafka.NewReader(kafka.ReaderConfig{
-		Brokers:   configData.Kafka.Brokers,
-		Topic:     configData.Kafka.ProcessorTopic,
-		Partition: 0,
-		MinBytes:  128,  // 128B
-		MaxBytes:  10e6, // 10MB
-	})
+	// 各算法的配置，未配置 Algorithms 时只有顶层配置
+	configs, err := algorithmConfigs(configData)
+	if err != nil {
+		glog.Fatal("wrong Algorithms: ", err)
+		return
+	}
+	for _, conf := range configs {
+		s := newAlgorithmSwitcher(conf)
+		if err = s.checkSupportedChains(); err != nil {
+			glog.Fatal("wrong SupportedChains of algorithm ", conf.Algorithm, ": ", err)
+			return
+		}
+		s.stagingPromoted = *promote
+		switchers = append(switchers, s)
+	}
+	glog.Info("algorithms: ", switcherAlgorithms())
+
+	kafkaDialer, err = newKafkaDialer(configData.Kafka.TLS, configData.Kafka.SASL)
+	if err != nil {
+		glog.Fatal("init Kafka dialer failed: ", err)
+		return
+	}
+	for _, s := range switchers {
+		s.openKafka()
+	}
 
-	controllerProducer = kafka.NewWriter(kafka.WriterConfig{
-		Brokers:          configData.Kafka.Brokers,
-		Topic:            configData.Kafka.ControllerTopic,
-		Balancer:         &kafka.LeastBytes{},
-		CompressionCodec: snappy.NewCompressionCodec(),
-	})
+	if configData.MetricsListenAddr != "" {
+		go runMetricsServer(configData.MetricsListenAddr)
+	}
+	if server := newPprofServer(configData.PprofListenAddr); server != nil {
+		go runPprofServer(server)
+	}
+
+	httpClient, err = newHTTPClient(configData.ChainDispatchAPITLS)
+	if err != nil {
+		glog.Fatal("init ChainDispatchAPI client failed: ", err)
+		return
+	}
+	if !configData.ChainDispatchAPIRedirect {
+		httpClient.CheckRedirect = noRedirect
+	}
+	httpClient.Timeout = configData.HTTPTimeoutSeconds * time.Second
 
-	initMySQL()
-	go failSafe()
-	go readResponse()
-	updateChain()
+	if *selfTest {
+		ok := runSelfTest()
+		glog.Flush()
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	db, dialect := openHistoryDB()
+	for _, s := range switchers {
+		s.initHistoryStore(db, dialect)
+		s.restoreState()
+	}
+
+	if *emitChain != "" {
+		if configData.DryRun {
+			glog.Fatal("-emit is not supported in DryRun mode")
+			return
+		}
+		s, err := findSwitcher(*emitAlgorithm)
+		if err != nil {
+			glog.Fatal("-emit: ", err)
+			return
+		}
+		s.runEmitOnce(*emitChain)
+		return
+	}
+
+	ctx := handleShutdownSignals()
+	var workers sync.WaitGroup
+	for _, s := range switchers {
+		s.loadSwitchHistory()
+		workers.Add(3)
+		go func(s *algorithmSwitcher) {
+			defer workers.Done()
+			s.failSafe(ctx)
+		}(s)
+		go func(s *algorithmSwitcher) {
+			defer workers.Done()
+			s.readResponse(ctx)
+		}(s)
+		go func(s *algorithmSwitcher) {
+			defer workers.Done()
+			s.updateChain(ctx)
+		}(s)
+	}
+	workers.Wait()
+	shutdown()
 }
 
-func initMySQL() {
-	var err error
+// openHistoryDB 连接切换记录数据库，各算法共用该连接池
+func openHistoryDB() (*sql.DB, historyDialect) {
+	dialect, err := newHistoryDialect(configData.DBDriver)
+	if err != nil {
+		glog.Fatal(err)
+		return nil, nil
+	}
 
-	glog.Info("connecting to MySQL...")
-	mysqlConn, err = sql.Open("mysql", configData.MySQL.ConnStr)
+	glog.Info("connecting to ", configData.DBDriver, "...")
+	db, err := sql.Open(configData.DBDriver, configData.MySQL.ConnStr)
 	if err != nil {
-		glog.Fatal("mysql error: ", err)
-		return
+		glog.Fatal(configData.DBDriver, " error: ", err)
+		return nil, nil
+	}
+	applyMySQLPoolConfig(db)
+	historyDB = db
+
+	err = db.Ping()
+	if err != nil {
+		glog.Fatal(configData.DBDriver, " error: ", err.Error())
+		return nil, nil
 	}
+	return db, dialect
+}
 
-	err = mysqlConn.Ping()
+// initHistoryStore 在共用的数据库连接上创建本算法的切换记录、运行状态及决策记录的存储
+func (s *algorithmSwitcher) initHistoryStore(db *sql.DB, dialect historyDialect) {
+	table := historyTableName(s.config.MySQL.Table, s.config.Algorithm)
+	glog.Info("switch history table of algorithm ", s.config.Algorithm, ": ", table)
+	var err error
+	s.historyStore, err = newSQLHistoryStore(db, dialect, table, s.config.MySQLExtraColumns)
 	if err != nil {
-		glog.Fatal("mysql error: ", err.Error())
+		glog.Fatal(s.config.DBDriver, " error: ", err.Error())
 		return
 	}
+	if s.config.DryRun {
+		// 仍然建表，使同一份配置可以在两种模式下使用
+		glog.Info(dryRunPrefix, "switch history and decision journal will not be written")
+		s.historyStore = dryRunHistoryStore{s.historyStore}
+	}
+
+	if s.config.PersistState {
+		table := s.stateTable()
+		glog.Info("state table: ", table)
+		store := newSQLStateStore(db, dialect, table)
+		if s.config.DryRun {
+			s.stateStore = dryRunStateStore{store}
+		} else {
+			s.stateStore = store
+		}
+	}
+
+	if s.config.DecisionJournal {
+		table := s.decisionJournalTable()
+		glog.Info("decision journal table: ", table)
+		store, err := newSQLDecisionStore(db, dialect, table)
+		if err != nil {
+			glog.Fatal(s.config.DBDriver, " error: ", err.Error())
+			return
+		}
+		if s.config.DryRun {
+			s.journal = newDecisionJournal(s.config.Algorithm, dryRunDecisionStore{})
+		} else {
+			s.journal = newDecisionJournal(s.config.Algorithm, store)
+		}
+		go s.journal.run()
+	}
+}
 
-	mysqlConn.Exec("CREATE TABLE IF NOT EXISTS `" + configData.MySQL.Table + "`(" + `
-		id bigint(20) NOT NULL AUTO_INCREMENT,
-		algorithm varchar(255) NOT NULL,
-		prev_chain varchar(255) NOT NULL,
-		curr_chain varchar(255) NOT NULL,
-		api_result text NOT NULL,
-		created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (id)
-		)
-	`)
+// applyMySQLPoolConfig 设置MySQL连接池，避免连接数过多或长期使用已失效的连接
+func applyMySQLPoolConfig(db *sql.DB) {
+	if configData.MySQLMaxOpenConns > 0 {
+		db.SetMaxOpenConns(configData.MySQLMaxOpenConns)
+	}
+	if configData.MySQLMaxIdleConns > 0 {
+		db.SetMaxIdleConns(configData.MySQLMaxIdleConns)
+	}
+	if configData.MySQLConnMaxLifetimeSeconds > 0 {
+		db.SetConnMaxLifetime(configData.MySQLConnMaxLifetimeSeconds * time.Second)
+	}
+}
 
-	insertStmt, err = mysqlConn.Prepare("INSERT INTO `" + configData.MySQL.Table +
-		"`(algorithm,prev_chain,curr_chain,api_result) VALUES(?,?,?,?)")
+// loadSwitchHistory 从数据库读取最近24小时的切换记录，使每日切换次数限制在重启后依然有效
+func (s *algorithmSwitcher) loadSwitchHistory() {
+	if s.config.MaxSwitchesPerDay <= 0 {
+		return
+	}
+
+	switches, err := s.historyStore.RecentSwitches(s.config.Algorithm, time.Now().Add(-24*time.Hour))
 	if err != nil {
-		glog.Fatal("mysql error: ", err.Error())
+		glog.Error("load switch history failed: ", err)
 		return
 	}
+	for _, switchTime := range switches {
+		s.switchLimit.record(switchTime)
+	}
+	glog.Info("switches in last 24 hours: ", s.switchLimit.count(time.Now()), ", max: ", s.config.MaxSwitchesPerDay)
 }
 
-func getHashrate(chainLimit ChainLimit) (hashrate5m float64, userNum int64, err error) {
+// hashrateDBDriver 读取 ChainLimits 中矿机算力的数据库驱动，测试时替换
+var hashrateDBDriver = "mysql"
+
+func (s *algorithmSwitcher) getHashrate(chainLimit ChainLimit) (hashrate5m float64, userNum int64, err error) {
 	glog.Info("connecting to MySQL of chain ", chainLimit.name, "...")
-	conn, err := sql.Open("mysql", chainLimit.MySQL.ConnStr)
+	conn, err := sql.Open(hashrateDBDriver, chainLimit.MySQL.ConnStr)
 	if err != nil {
 		return
 	}
 
 	sql := "SELECT sum(accept_5m), sum(1) FROM `" + chainLimit.MySQL.Table + "` WHERE " +
 		"worker_id = 0 AND " +
-		"unix_timestamp() - unix_timestamp(updated_at) < " + strconv.FormatUint(configData.RecordLifetime, 10)
+		"unix_timestamp() - unix_timestamp(updated_at) < " + strconv.FormatUint(s.config.RecordLifetime, 10)
 	glog.V(5).Info("SQL: ", sql)
 	rows, err := conn.Query(sql)
 	if err != nil {
@@ -237,80 +593,333 @@ func getHashrate(chainLimit ChainLimit) (hashrate5m float64, userNum int64, err
 	return
 }
 
-func failSafe() {
+func (s *algorithmSwitcher) failSafe(ctx context.Context) {
 	for {
-		time.Sleep(configData.FailSafeSeconds * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.FailSafeSeconds * time.Second):
+		}
 
 		now := time.Now().Unix()
-		if updateTime+int64(configData.FailSafeSeconds) < now {
-			oldChainName := currentChainName
-			currentChainName = configData.FailSafeChain
+		if s.updateTime+int64(s.config.FailSafeSeconds) < now {
+			if s.config.SubPoolDispatch {
+				s.failSafeSubPools(now)
+				s.updateTime = now
+				continue
+			}
+
+			oldChainName := s.currentChainName
+			if oldChainName != s.config.FailSafeChain {
+				s.switchTo(s.config.FailSafeChain, time.Unix(now, 0))
+				// 不回滚到API失效前的币种
+				s.switchRollback.beginSwitch("", s.currentChainName)
+				s.canary.beginSwitch("", s.currentChainName)
+				s.notifySwitch(SwitchEvent{Action: "fail_safe_switch", OldChain: oldChainName, NewChain: s.currentChainName})
+				s.recordSwitchMetrics(oldChainName, s.currentChainName, time.Unix(now, 0))
+				s.switchLimit.record(time.Unix(now, 0))
+			}
 
-			glog.Info("Fail Safe Switch: ", oldChainName, " -> ", currentChainName,
-				", lastUpdateTime: ", time.Unix(updateTime, 0).UTC().Format("2006-01-02 15:04:05"),
+			glog.Info(s.logPrefix(), "Fail Safe Switch: ", oldChainName, " -> ", s.currentChainName,
+				", lastUpdateTime: ", time.Unix(s.updateTime, 0).UTC().Format("2006-01-02 15:04:05"),
 				", currentTime: ", time.Unix(now, 0).UTC().Format("2006-01-02 15:04:05"))
-			sendCurrentChainToKafka()
+			s.sendCurrentChainToKafka()
 
 			apiResult := ActionFailSafeSwitch{
 				"fail_safe_switch",
-				updateTime,
+				s.updateTime,
 				now,
 				oldChainName,
-				currentChainName}
+				s.currentChainName}
 			bytes, _ := json.Marshal(apiResult)
-			_, err := insertStmt.Exec(configData.Algorithm, oldChainName, currentChainName, bytes)
+			err := s.historyStore.InsertRecord(s.config.Algorithm, oldChainName, s.currentChainName, switchReasonFailSafe, bytes)
 			if err != nil {
-				glog.Fatal("mysql error: ", err.Error())
+				glog.Fatal(s.config.DBDriver, " error: ", err.Error())
 				return
 			}
 
-			updateTime = now
+			s.updateTime = now
+		}
+	}
+}
+
+// newKafkaCommand 构造币种切换命令
+func (s *algorithmSwitcher) newKafkaCommand(id uint64, chainName string) KafkaCommand {
+	return KafkaCommand{
+		Version:         kafkaSchemaVersion,
+		ID:              id,
+		Type:            "sserver_cmd",
+		Action:          "auto_switch_chain",
+		CreatedAt:       time.Now().UTC().Format("2006-01-02 15:04:05"),
+		ChainName:       chainName,
+		GraceSeconds:    s.config.SwitchGraceSeconds,
+		TargetServerIDs: s.config.TargetServerIDs}
+}
+
+// commandTargets 判断命令应发送到生产topic和/或预发布topic
+// 预发布模式下，若设置了 Kafka.StagingSeconds，则启动该时间后自动提升到生产环境（同时发送到两者）
+func (s *algorithmSwitcher) commandTargets(now time.Time) (toProduction bool, toStaging bool) {
+	switch s.config.Kafka.StagingMode {
+	case stagingModeBoth:
+		return true, true
+	case stagingModeStaging:
+		if s.stagingPromoted {
+			return true, true
+		}
+		if s.config.Kafka.StagingSeconds > 0 && now.Sub(startTime) >= s.config.Kafka.StagingSeconds*time.Second {
+			s.stagingPromoted = true
+			glog.Info("Staging period finished, promoted to production topic ", s.config.Kafka.ControllerTopic)
+			return true, true
 		}
+		return false, true
 	}
+	return true, false
 }
 
-func sendCurrentChainToKafka() {
-	commandID++
-	command := KafkaCommand{
-		commandID,
-		"sserver_cmd",
-		"auto_switch_chain",
-		time.Now().UTC().Format("2006-01-02 15:04:05"),
-		currentChainName}
-	bytes, _ := json.Marshal(command)
-	controllerProducer.WriteMessages(context.Background(), kafka.Message{Value: []byte(bytes)})
+// sendChainsToKafka 发送当前币种（子池模式下为各子池的币种）
+func (s *algorithmSwitcher) sendChainsToKafka() {
+	if s.config.SubPoolDispatch {
+		s.sendSubPoolChainsToKafka()
+		return
+	}
+	s.sendCurrentChainToKafka()
+}
+
+// sendCurrentChainToKafka 发送当前币种，配置了 SwitchSegments 时每个分段一条命令，任一命令发送失败时返回错误
+// 全部发送成功后才推进灰度切换的进度
+func (s *algorithmSwitcher) sendCurrentChainToKafka() (sendErr error) {
+	commands := s.currentChainCommands()
+	for _, command := range commands {
+		if err := s.writeCommand(command); err != nil {
+			sendErr = err
+		}
+	}
+	if sendErr == nil && !s.config.DryRun {
+		s.canary.commandsSent(s.currentChainName, commands)
+	}
+	return
+}
+
+// writeCommand 将命令写入生产topic和/或预发布topic，任一topic写入失败时返回错误
+// 只有全部写入成功的命令才记录为已发送，失败的命令由之后的轮询重新发送
+func (s *algorithmSwitcher) writeCommand(command KafkaCommand) (sendErr error) {
+	s.attachCommandMetrics(&command)
+	if command.CorrelationID == "" {
+		command.CorrelationID = s.commandCorrelationID(command.SubPool, command.ChainName)
+	}
+	bytes, err := encodeCommand(s.config.CommandEncoding, command)
+	if err != nil {
+		glog.Error("encode command failed: ", err)
+		return err
+	}
+
+	if s.config.DryRun {
+		glog.Info(dryRunPrefix, "Skip sending to Kafka, id: ", command.ID,
+			", action: ", command.Action,
+			", chain_name: ", command.ChainName,
+			", subpool_name: ", command.SubPool,
+			", segment: ", command.Segment)
+		return
+	}
+
+	toProduction, toStaging := s.commandTargets(time.Now())
+	if toProduction {
+		err := s.controllerProducer.WriteMessages(context.Background(), kafka.Message{Value: []byte(bytes)})
+		if err != nil {
+			kafkaWriteFailuresTotal.WithLabelValues(s.config.Algorithm, s.config.Kafka.ControllerTopic).Inc()
+			glog.Error("Send to Kafka topic ", s.config.Kafka.ControllerTopic, " failed: ", err)
+			sendErr = err
+		}
+	}
+	if toStaging {
+		err := s.stagingProducer.WriteMessages(context.Background(), kafka.Message{Value: []byte(bytes)})
+		if err != nil {
+			kafkaWriteFailuresTotal.WithLabelValues(s.config.Algorithm, s.config.Kafka.StagingTopic).Inc()
+			glog.Error("Send to Kafka topic ", s.config.Kafka.StagingTopic, " failed: ", err)
+			sendErr = err
+		}
+	}
+	if sendErr != nil {
+		return
+	}
+	s.recordSentCommand(command)
+	s.acks.commandSent(command)
+	s.switchRollback.commandSent(command)
 
 	glog.Info("Send to Kafka, id: ", command.ID,
 		", created_at: ", command.CreatedAt,
 		", type: ", command.Type,
 		", action: ", command.Action,
-		", chain_name: ", command.ChainName)
+		", chain_name: ", command.ChainName,
+		", subpool_name: ", command.SubPool,
+		", segment: ", command.Segment,
+		", correlation_id: ", command.CorrelationID,
+		", production: ", toProduction,
+		", staging: ", toStaging)
+	return
 }
 
-func updateChain() {
-	for {
-		updateCurrentChain()
-		if currentChainName != "" {
-			sendCurrentChainToKafka()
+func (s *algorithmSwitcher) updateChain(ctx context.Context) {
+	guard := newClockGuard(realClock{}, s.config.Algorithm, s.config.ClockJumpThresholdSeconds*time.Second, s.config.ClockJumpDeferEmit)
+	runPollLoop(ctx, realClock{}, s.config.PollIntervalSeconds*time.Second, s.config.EmitIntervalSeconds*time.Second,
+		func() bool {
+			if s.config.SubPoolDispatch {
+				s.updateSubPoolChains()
+			} else {
+				s.updateCurrentChain()
+			}
+			s.acks.check()
+			return true
+		},
+		func() bool {
+			return s.emitChains(guard)
+		})
+}
+
+// emitChains 发送选定的币种，返回是否发送成功
+// 发送失败时不更新上次发送的时间，下次轮询时会重新发送，直到成功为止
+// 重启后选出的币种与恢复的币种相同时跳过第一次发送，视为发送成功
+func (s *algorithmSwitcher) emitChains(guard *clockGuard) bool {
+	if !guard.allowEmit() {
+		return false
+	}
+	if s.config.SubPoolDispatch {
+		if s.subPoolChainCount() == 0 {
+			return false
+		}
+		if err := s.sendSubPoolChainsToKafka(); err != nil {
+			glog.Warning("Send chains of sub-pools failed, will retry in next poll")
+			return false
 		}
+		s.saveState("")
+		return true
+	}
+	if s.currentChainName == "" {
+		return false
+	}
+	if s.skipRestoredEmit() {
+		return true
+	}
+	s.rollbackCurrentChain()
+	if err := s.sendCurrentChainToKafka(); err != nil {
+		sent, _ := s.sentChain("")
+		glog.Warning("Send chain ", s.currentChainName, " failed, will retry in next poll, last sent chain: ", sent)
+		return false
+	}
+	s.saveState(s.currentChainName)
+	return true
+}
 
-		time.Sleep(configData.SwitchIntervalSeconds * time.Second)
+// fetchChainDispatchAPI 请求 ChainDispatchAPI，失败时按 HTTPRetryCount 以指数退避重试
+// 全部失败时返回最后一次的错误，调用者保持当前币种
+func (s *algorithmSwitcher) fetchChainDispatchAPI() ([]byte, error) {
+	attempts := s.config.HTTPRetryCount + 1
+	delay := s.config.HTTPRetryBaseDelayMilliseconds * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		body, err := s.fetchChainDispatchAPIOnce(attempt, attempts)
+		if err == nil {
+			if attempt > 1 {
+				glog.Info("HTTP GET ", s.config.ChainDispatchAPI, " succeeded at attempt ", attempt, "/", attempts)
+			}
+			return body, nil
+		}
+		if attempt >= attempts {
+			if attempts > 1 {
+				glog.Error("HTTP GET ", s.config.ChainDispatchAPI, " failed after ", attempts, " attempts, keep current chain: ", s.currentChainName)
+			}
+			return nil, err
+		}
+		glog.Warning("HTTP GET attempt ", attempt, "/", attempts, " failed, retry in ", delay)
+		retrySleep(delay)
+		delay *= 2
 	}
 }
 
-func updateCurrentChain() {
-	oldChainName := currentChainName
+// retrySleep 重试前的等待，便于测试时替换
+var retrySleep = time.Sleep
 
-	glog.Info("HTTP GET ", configData.ChainDispatchAPI)
-	response, err := http.Get(configData.ChainDispatchAPI)
+// fetchChainDispatchAPIOnce 请求一次 ChainDispatchAPI
+func (s *algorithmSwitcher) fetchChainDispatchAPIOnce(attempt int, attempts int) ([]byte, error) {
+	if attempts > 1 {
+		glog.Info("HTTP GET ", s.config.ChainDispatchAPI, " (attempt ", attempt, "/", attempts, ")")
+	} else {
+		glog.Info("HTTP GET ", s.config.ChainDispatchAPI)
+	}
+	start := time.Now()
+	response, err := httpClient.Get(s.config.ChainDispatchAPI)
 	if err != nil {
+		chainDispatchAPIFetchSeconds.WithLabelValues(s.config.Algorithm).Observe(time.Since(start).Seconds())
+		chainDispatchAPIFailuresTotal.WithLabelValues(s.config.Algorithm).Inc()
 		glog.Error("HTTP Request Failed: ", err)
-		return
+		return nil, err
 	}
+	defer response.Body.Close()
 
 	body, err := ioutil.ReadAll(response.Body)
+	chainDispatchAPIFetchSeconds.WithLabelValues(s.config.Algorithm).Observe(time.Since(start).Seconds())
 	if err != nil {
+		chainDispatchAPIFailuresTotal.WithLabelValues(s.config.Algorithm).Inc()
 		glog.Error("HTTP Fetch Body Failed: ", err)
+		return nil, err
+	}
+
+	// 重定向（未开启 ChainDispatchAPIRedirect 时）及错误页面都视为请求失败，保持当前币种
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = fmt.Errorf("HTTP status %s", response.Status)
+		if location := response.Header.Get("Location"); location != "" {
+			err = fmt.Errorf("HTTP status %s, redirect to %s", response.Status, location)
+		}
+		chainDispatchAPIFailuresTotal.WithLabelValues(s.config.Algorithm).Inc()
+		glog.Error("HTTP Request Failed: ", err, ", body: ", truncateBody(body))
+		return nil, err
+	}
+	if response.Request.URL.String() != s.config.ChainDispatchAPI {
+		glog.Info("HTTP GET redirected to ", response.Request.URL)
+	}
+	return body, nil
+}
+
+// selectBestChain 按收益顺序选择第一个已配置且算力未超限的币种，均不可用时返回FailSafeChain
+func (s *algorithmSwitcher) selectBestChain(coins CoinList) string {
+	return s.selectChain(coins, s.hashrateSmoothing.update)
+}
+
+// previewBestChain 与 selectBestChain 相同，但只读取算力平滑值而不更新
+func (s *algorithmSwitcher) previewBestChain(coins CoinList) string {
+	return s.selectChain(coins, s.hashrateSmoothing.peek)
+}
+
+// selectChain 按收益顺序选择第一个已配置且算力未超限的币种，smooth 用于平滑读取到的矿机算力
+func (s *algorithmSwitcher) selectChain(coins CoinList, smooth func(chain string, hashrate float64) float64) string {
+	for _, chainName := range s.candidateChains(coins) {
+		limit, ok := s.config.ChainLimits[chainName]
+		if !ok {
+			return chainName
+		}
+
+		hashrate, userNum, err := s.getHashrate(limit)
+		if err != nil {
+			glog.Error("get hashrate of chain ", limit.name, " failed: ", err)
+			continue
+		}
+		hashrate = smooth(chainName, hashrate)
+		if hashrate < limit.hashrate {
+			glog.Info("chain ", limit.name, " (hashrate: ", formatHashrate(hashrate),
+				") < (limit: ", formatHashrate(limit.hashrate), "), ",
+				userNum, " users, selected")
+			return chainName
+		}
+		glog.Info("chain ", limit.name, " (hashrate: ", formatHashrate(hashrate),
+			") >= (limit: ", formatHashrate(limit.hashrate), "), ",
+			userNum, " users,  ignored")
+	}
+	return s.config.FailSafeChain
+}
+
+// fetchAlgorithmCoins 请求ChainDispatchAPI及各调度来源，返回响应内容和合并调度因子后本算法的币种列表
+func (s *algorithmSwitcher) fetchAlgorithmCoins() (body []byte, coins CoinList, err error) {
+	body, err = s.fetchChainDispatchAPI()
+	if err != nil {
 		return
 	}
 
@@ -321,67 +930,174 @@ func updateCurrentChain() {
 		return
 	}
 
-	algorithms, ok := chainDispatchRecord.Algorithms[configData.Algorithm]
+	algorithms, ok := chainDispatchRecord.Algorithms[s.config.Algorithm]
 	if !ok {
-		glog.Error("Cannot find algorithm ", configData.Algorithm, ", json: ", string(body))
-		return
-	}
-
-	bestChain := configData.FailSafeChain
-	for _, coin := range algorithms.Coins {
-		chainName, ok := configData.ChainNameMap[coin]
-		if ok {
-			if limit, ok := configData.ChainLimits[chainName]; ok {
-				hashrate, userNum, err := getHashrate(limit)
-				if err == nil {
-					if hashrate < limit.hashrate {
-						glog.Info("chain ", limit.name, " (hashrate: ", formatHashrate(hashrate),
-							") < (limit: ", formatHashrate(limit.hashrate), "), ",
-							userNum, " users, selected")
-						bestChain = chainName
-						break
-					} else {
-						glog.Info("chain ", limit.name, " (hashrate: ", formatHashrate(hashrate),
-							") >= (limit: ", formatHashrate(limit.hashrate), "), ",
-							userNum, " users,  ignored")
-					}
-				} else {
-					glog.Error("get hashrate of chain ", limit.name, " failed: ", err)
-				}
-			} else {
-				bestChain = chainName
-				break
-			}
+		glog.Error("Cannot find algorithm ", s.config.Algorithm, ", json: ", string(body))
+		err = fmt.Errorf("cannot find algorithm %s", s.config.Algorithm)
+		return
+	}
+	glog.Info("Coins (dispatch/dispatchable): ", coinScores(algorithms.Coins))
+
+	factors, err := s.fetchDispatchFactors()
+	if err != nil {
+		return
+	}
+	coins = s.applyPreferences(s.combineDispatchFactors(algorithms.Coins, factors))
+	return
+}
+
+// decideChain 按sserver支持的币种、切换阈值、粘性及每日切换次数限制决定是否从oldChain切换到bestChain，不修改任何状态
+// Outcome 为第一个阻止切换的限制，reasons 为所有阻止切换的限制的说明
+func (s *algorithmSwitcher) decideChain(coins CoinList, oldChain string, lastSwitchTime time.Time, bestChain string, now time.Time) (decision DecisionRecord, reasons []string) {
+	decision = DecisionRecord{OldChain: oldChain, BestChain: bestChain, NewChain: oldChain, Outcome: decisionUnchanged}
+	if bestChain == "" || bestChain == oldChain {
+		return
+	}
+
+	suppress := func(outcome string, reason string) {
+		if len(reasons) == 0 {
+			decision.Outcome = outcome
 		}
+		reasons = append(reasons, reason)
 	}
 
+	margin := requiredSwitchMargin(s.chainStickiness(bestChain), now.Sub(lastSwitchTime))
+	decision.RequiredMargin = margin
+	if !s.chainSupported(bestChain) {
+		suppress(decisionUnsupported, "chain "+bestChain+" is not in SupportedChains")
+	}
+	if until, held := s.switchRollback.holdUntil(bestChain); held {
+		suppress(decisionHeldByRollback, "chain "+bestChain+" was rolled back, held until "+until.UTC().Format("2006-01-02 15:04:05"))
+	}
+	// 固定的切换阈值，当前币种不在接口结果中时不限制
+	threshold := s.chainSwitchThreshold(bestChain)
+	if s.keepCurrentChain(coins, oldChain, bestChain, threshold) {
+		_, hashrates := s.chainHashrates(coins)
+		suppress(decisionHeldByThreshold, "held by SwitchThresholdPercent, dispatch hashrate: "+
+			strconv.FormatFloat(hashrates[bestChain], 'f', -1, 64)+" vs "+strconv.FormatFloat(hashrates[oldChain], 'f', -1, 64)+
+			", threshold: "+strconv.FormatFloat(threshold, 'f', 2, 64)+"%")
+	}
+	if s.keepCurrentChain(coins, oldChain, bestChain, margin) {
+		_, hashrates := s.chainHashrates(coins)
+		suppress(decisionHeldByStickiness, "held by stickiness, dispatch hashrate: "+
+			strconv.FormatFloat(hashrates[bestChain], 'f', -1, 64)+" vs "+strconv.FormatFloat(hashrates[oldChain], 'f', -1, 64)+
+			", required margin: "+strconv.FormatFloat(margin, 'f', 2, 64)+"%"+
+			", last switch: "+lastSwitchTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if oldChain != "" && !s.switchLimit.allow(now) {
+		suppress(decisionSuppressed, "reached MaxSwitchesPerDay "+strconv.Itoa(s.config.MaxSwitchesPerDay)+
+			", next switch allowed at "+s.switchLimit.nextAllowed(now).UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if len(reasons) == 0 {
+		decision.NewChain = bestChain
+		decision.Outcome = decisionSwitched
+	}
+	return
+}
+
+func (s *algorithmSwitcher) updateCurrentChain() {
+	if chain := s.overrideChain(); chain != "" {
+		s.applyManualOverride(chain)
+		return
+	}
+
+	oldChainName := s.currentChainName
+
+	body, coins, err := s.fetchAlgorithmCoins()
+	if err != nil {
+		return
+	}
+
+	bestChain := s.selectBestChain(coins)
+	now := time.Now()
+	decision, _ := s.decideChain(coins, oldChainName, s.lastSwitchTime, bestChain, now)
+
 	if bestChain != "" {
-		currentChainName = bestChain
-		updateTime = time.Now().Unix()
+		switch decision.Outcome {
+		case decisionUnsupported:
+			// sserver不支持该币种，保持当前币种
+			s.refuseUnsupportedChain("", bestChain)
+		case decisionHeldByRollback:
+			// 新币种刚被自动回滚，暂不切换，可通过 /override 手动指定
+			until, _ := s.switchRollback.holdUntil(bestChain)
+			glog.Warning("Switch held by rollback: ", oldChainName, " -> ", bestChain,
+				", held until ", until.UTC().Format("2006-01-02 15:04:05"))
+		case decisionHeldByThreshold:
+			// 新币种的优势未达到切换阈值，保持当前币种
+			// 输出两者的算力，便于调整 SwitchThresholdPercent
+			_, hashrates := s.chainHashrates(coins)
+			glog.Info("Switch held by threshold: ", oldChainName, " -> ", bestChain,
+				", dispatch hashrate: ", strconv.FormatFloat(hashrates[bestChain], 'f', -1, 64),
+				" (candidate) vs ", strconv.FormatFloat(hashrates[oldChainName], 'f', -1, 64), " (current)",
+				", threshold: ", strconv.FormatFloat(s.chainSwitchThreshold(bestChain), 'f', 2, 64), "%")
+		case decisionHeldByStickiness:
+			// 新币种的优势不足以抵消当前币种的粘性，保持当前币种
+			// 输出两者的算力，便于调整 InitialMarginPercent
+			_, hashrates := s.chainHashrates(coins)
+			glog.Info("Switch held by stickiness: ", oldChainName, " -> ", bestChain,
+				", dispatch hashrate: ", strconv.FormatFloat(hashrates[bestChain], 'f', -1, 64),
+				" (candidate) vs ", strconv.FormatFloat(hashrates[oldChainName], 'f', -1, 64), " (current)",
+				", required margin: ", strconv.FormatFloat(decision.RequiredMargin, 'f', 2, 64), "%",
+				", last switch: ", s.lastSwitchTime.UTC().Format("2006-01-02 15:04:05"))
+		case decisionSuppressed:
+			// 达到每日切换次数上限，保持当前币种
+			switchesSuppressedTotal.WithLabelValues(s.config.Algorithm).Inc()
+			glog.Warning("Switch suppressed: ", oldChainName, " -> ", bestChain,
+				", reached MaxSwitchesPerDay ", s.config.MaxSwitchesPerDay,
+				", next switch allowed at ", s.switchLimit.nextAllowed(now).UTC().Format("2006-01-02 15:04:05"))
+		}
+		if decision.NewChain != oldChainName {
+			s.switchTo(decision.NewChain, now)
+		}
+		s.updateTime = now.Unix()
+		lastSuccessfulPollTimestamp.WithLabelValues(s.config.Algorithm).Set(float64(s.updateTime))
+		s.setCurrentChainMetric(s.currentChainName)
+		s.updateChainMetrics("", coins, s.currentChainName)
 	}
 
-	if oldChainName != currentChainName {
-		glog.Info("Best Chain Changed: ", oldChainName, " -> ", bestChain)
-		_, err := insertStmt.Exec(configData.Algorithm, oldChainName, currentChainName, body)
+	_, hashrates := s.chainHashrates(coins)
+	decision.Coins = coins
+	decision.Scores = hashrates
+	s.journal.record(decision)
+
+	if oldChainName != s.currentChainName {
+		s.recordSwitchMetrics(oldChainName, s.currentChainName, time.Now())
+		s.switchLimit.record(time.Now())
+		s.switchRollback.beginSwitch(oldChainName, s.currentChainName)
+		s.canary.beginSwitch(oldChainName, s.currentChainName)
+		glog.Info(s.logPrefix(), "Best Chain Changed: ", oldChainName, " -> ", bestChain)
+		s.notifySwitch(SwitchEvent{
+			Action:      "best_chain_changed",
+			OldChain:    oldChainName,
+			NewChain:    s.currentChainName,
+			OldHashrate: hashrates[oldChainName],
+			NewHashrate: hashrates[s.currentChainName]})
+		err := s.historyStore.InsertRecord(s.config.Algorithm, oldChainName, s.currentChainName, s.autoSwitchReason(coins, oldChainName), body)
 		if err != nil {
-			glog.Fatal("mysql error: ", err.Error())
+			glog.Fatal(s.config.DBDriver, " error: ", err.Error())
 			return
 		}
 	} else {
-		glog.Info("Best Chain not Changed: ", bestChain)
+		s.observeChainDwell(s.currentChainName, time.Now())
+		if ok, suppressed := s.unchangedLog.allow(""); ok {
+			glog.Info(s.logPrefix(), "Best Chain not Changed: ", bestChain, suppressedLogSuffix(suppressed))
+		}
 	}
 }
 
-func readResponse() {
-	processorConsumer.SetOffset(kafka.LastOffset)
+func (s *algorithmSwitcher) readResponse(ctx context.Context) {
+	s.processorConsumer.SetOffset(kafka.LastOffset)
 	for {
-		m, err := processorConsumer.ReadMessage(context.Background())
+		m, err := s.processorConsumer.ReadMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			glog.Error("read kafka failed: ", err)
 			continue
 		}
-		response := new(KafkaMessage)
-		err = json.Unmarshal(m.Value, response)
+		response, err := s.parseKafkaMessage(m.Value)
 		if err != nil {
 			glog.Error("Parse Result Failed: ", err)
 			continue
@@ -395,7 +1111,12 @@ func readResponse() {
 				", old_chain_name: ", response.OldChainName,
 				", new_chain_name: ", response.NewChainName,
 				", switched_users: ", response.SwitchedUsers,
-				", switched_connections: ", response.SwitchedConnections)
+				", switched_connections: ", response.SwitchedConnections,
+				", correlation_id: ", response.CorrelationID)
+			s.checkResponseCorrelation(response)
+			s.acks.responseReceived(response)
+			s.switchRollback.responseReceived(response)
+			s.canary.responseReceived(response)
 			continue
 		}
 
@@ -405,8 +1126,27 @@ func readResponse() {
 				", server_id: ", response.ServerID,
 				", hostname: ", response.Host.Hostname,
 				", ip: ", response.Host.IP)
-			sendCurrentChainToKafka()
+			s.sendChainsToKafka()
 			continue
 		}
 	}
 }
+
+// parseKafkaMessage 解析sserver发来的消息
+// 版本号高于当前程序所知的版本时不报错，只解析已知字段，以便sserver与本程序分别升级
+func (s *algorithmSwitcher) parseKafkaMessage(value []byte) (*KafkaMessage, error) {
+	response, err := decodeKafkaMessage(s.config.CommandEncoding, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Version > kafkaSchemaVersion {
+		raw := string(value)
+		if s.config.CommandEncoding == commandEncodingProtobuf {
+			raw = fmt.Sprintf("%x", value)
+		}
+		glog.Warning("Unknown message version ", response.Version,
+			" (known: ", kafkaSchemaVersion, "), only known fields are used: ", raw)
+	}
+	return response, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// 测试发送的命令带有版本号
+func TestKafkaCommandVersion(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	command := s.newKafkaCommand(5, "bcc")
+	if command.Version != kafkaSchemaVersion {
+		t.Errorf("command version expected: %d, got: %d", kafkaSchemaVersion, command.Version)
+	}
+
+	bytes, _ := json.Marshal(command)
+	var fields map[string]interface{}
+	json.Unmarshal(bytes, &fields)
+	if v, ok := fields["version"]; !ok || v.(float64) != kafkaSchemaVersion {
+		t.Errorf("version missing in command json: %s", string(bytes))
+	}
+}
+
+// 测试命令中的 grace_seconds 随 SwitchGraceSeconds 配置，未配置时不发送
+func TestKafkaCommandGraceSeconds(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	bytes, _ := json.Marshal(s.newKafkaCommand(1, "bcc"))
+	var fields map[string]interface{}
+	json.Unmarshal(bytes, &fields)
+	if _, ok := fields["grace_seconds"]; ok {
+		t.Errorf("grace_seconds should be omitted when zero: %s", string(bytes))
+	}
+
+	configData.SwitchGraceSeconds = 30
+	bytes, _ = json.Marshal(s.newKafkaCommand(2, "bcc"))
+	fields = nil
+	json.Unmarshal(bytes, &fields)
+	if v, ok := fields["grace_seconds"]; !ok || v.(float64) != 30 {
+		t.Errorf("grace_seconds expected: 30, got command: %s", string(bytes))
+	}
+}
+
+// 测试未知版本的响应可以被正常解析
+func TestParseKafkaMessageUnknownVersion(t *testing.T) {
+	value := []byte(`{"version":99,"id":3,"type":"sserver_response","action":"auto_switch_chain",` +
+		`"new_chain_name":"bcc","old_chain_name":"btc","result":true,"server_id":2,"new_field":{"a":1}}`)
+	s := newAlgorithmSwitcher(new(ChainSwitcherConfig))
+	response, err := s.parseKafkaMessage(value)
+	if err != nil {
+		t.Fatalf("parse message with unknown version failed: %s", err)
+	}
+	if response.Version != 99 || response.Type != "sserver_response" || response.NewChainName != "bcc" || response.ServerID != 2 {
+		t.Errorf("wrong parse result: %+v", response)
+	}
+
+	// 旧版sserver不带版本号
+	response, err = s.parseKafkaMessage([]byte(`{"id":3,"type":"sserver_response","action":"auto_switch_chain"}`))
+	if err != nil {
+		t.Fatalf("parse message without version failed: %s", err)
+	}
+	if response.Version != 0 {
+		t.Errorf("legacy message version expected: 0, got: %d", response.Version)
+	}
+}
+
+// 测试预发布模式下命令发送的目标topic
+func TestCommandTargets(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	startTime = time.Unix(1500000000, 0)
+	s.stagingPromoted = false
+
+	toProduction, toStaging := s.commandTargets(startTime.Add(time.Hour))
+	if !toProduction || toStaging {
+		t.Errorf("default mode expected: production only, got: production %v, staging %v", toProduction, toStaging)
+	}
+
+	configData.Kafka.StagingMode = stagingModeBoth
+	toProduction, toStaging = s.commandTargets(startTime)
+	if !toProduction || !toStaging {
+		t.Errorf("dual-write mode expected: both, got: production %v, staging %v", toProduction, toStaging)
+	}
+
+	// 只发送到预发布环境
+	configData.Kafka.StagingMode = stagingModeStaging
+	toProduction, toStaging = s.commandTargets(startTime.Add(24 * time.Hour))
+	if toProduction || !toStaging {
+		t.Errorf("staging-only mode expected: staging only, got: production %v, staging %v", toProduction, toStaging)
+	}
+
+	// 预发布期结束后提升到生产环境
+	configData.Kafka.StagingSeconds = 600
+	toProduction, toStaging = s.commandTargets(startTime.Add(599 * time.Second))
+	if toProduction || !toStaging {
+		t.Errorf("in staging period expected: staging only, got: production %v, staging %v", toProduction, toStaging)
+	}
+	toProduction, toStaging = s.commandTargets(startTime.Add(600 * time.Second))
+	if !toProduction || !toStaging {
+		t.Errorf("after staging period expected: both, got: production %v, staging %v", toProduction, toStaging)
+	}
+}
+
+// decodeCommands 解析写入的Kafka命令，清除每次不同的 created_at 和 correlation_id
+func decodeCommands(t *testing.T, writer *mockWriter) []KafkaCommand {
+	commands := []KafkaCommand{}
+	for _, message := range writer.messages {
+		var command KafkaCommand
+		if err := json.Unmarshal(message.Value, &command); err != nil {
+			t.Fatalf("parse command failed: %s; %s", err, message.Value)
+		}
+		command.CreatedAt = ""
+		command.CorrelationID = ""
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// 测试发送当前币种时写入的命令内容及目标topic
+func TestSendChainsToKafka(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	startTime = time.Now()
+	s.stagingPromoted = false
+	s.commandID = 10
+	s.currentChainName = "bcc"
+	production := &mockWriter{}
+	staging := &mockWriter{}
+	s.controllerProducer = production
+	s.stagingProducer = staging
+
+	s.sendChainsToKafka()
+	expected := []KafkaCommand{{Version: kafkaSchemaVersion, ID: float64(11), Type: "sserver_cmd", Action: "auto_switch_chain", ChainName: "bcc"}}
+	if commands := decodeCommands(t, production); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("production commands expected: %+v, got: %+v", expected, commands)
+	}
+	if len(staging.messages) != 0 {
+		t.Errorf("nothing should be sent to staging topic by default, got: %d messages", len(staging.messages))
+	}
+
+	// 子池模式下按子池名顺序为每个子池发送一条命令，同时发送到两个topic
+	configData.SubPoolDispatch = true
+	configData.Kafka.StagingMode = stagingModeBoth
+	s.subPoolChains = map[string]string{"pool2": "btc", "pool1": "bcc"}
+	production.messages = nil
+
+	s.sendChainsToKafka()
+	expected = []KafkaCommand{
+		{Version: kafkaSchemaVersion, ID: float64(12), Type: "sserver_cmd", Action: "auto_switch_chain", ChainName: "bcc", SubPool: "pool1"},
+		{Version: kafkaSchemaVersion, ID: float64(13), Type: "sserver_cmd", Action: "auto_switch_chain", ChainName: "btc", SubPool: "pool2"},
+	}
+	if commands := decodeCommands(t, production); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("production commands expected: %+v, got: %+v", expected, commands)
+	}
+	if commands := decodeCommands(t, staging); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("staging commands expected: %+v, got: %+v", expected, commands)
+	}
+	if string(production.messages[0].Value[:12]) != `{"version":1` {
+		t.Errorf("command JSON should begin with version, got: %s", production.messages[0].Value)
+	}
+
+	// 写入失败不影响后续发送
+	production.err = errors.New("broker down")
+	s.sendChainsToKafka()
+	if len(staging.messages) != 4 {
+		t.Errorf("staging should still receive commands when production fails, got: %d messages", len(staging.messages))
+	}
+}
+
+// failingWriter 前fails次写入失败的mockWriter
+type failingWriter struct {
+	mockWriter
+	fails int
+}
+
+func (w *failingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.fails > 0 {
+		w.fails--
+		return errors.New("broker down")
+	}
+	return w.mockWriter.WriteMessages(ctx, msgs...)
+}
+
+// 测试发送失败时不记录为已发送，下次轮询时重新发送
+func TestEmitChainsRetry(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	s.currentChainName = "bcc"
+	writer := &failingWriter{fails: 1}
+	s.controllerProducer = writer
+
+	begin := time.Unix(1500000000, 0)
+	clock := &fakeClock{begin}
+	guard := newClockGuard(clock, "sha256", 5*time.Second, false)
+
+	var emits []time.Duration
+	polls := 0
+	runPollLoop(context.Background(), clock, 10*time.Second, 60*time.Second, func() bool {
+		polls++
+		return polls <= 4
+	}, func() bool {
+		sent := s.emitChains(guard)
+		if sent {
+			emits = append(emits, clock.Now().Sub(begin))
+		}
+		if polls == 1 {
+			if sent {
+				t.Errorf("first emit should fail")
+			}
+			if chain, ok := s.sentChain(""); ok {
+				t.Errorf("failed command should not be recorded as sent, got: %s", chain)
+			}
+		}
+		return sent
+	})
+
+	// 第一次发送失败，第二次轮询时重新发送，之后按发送间隔发送
+	if len(emits) != 1 || emits[0] != 10*time.Second {
+		t.Errorf("successful emits expected at: [10s], got: %v", emits)
+	}
+	if commands := decodeCommands(t, &writer.mockWriter); len(commands) != 1 || commands[0].ChainName != "bcc" {
+		t.Errorf("one command of bcc expected, got: %+v", commands)
+	}
+	if chain, _ := s.sentChain(""); chain != "bcc" {
+		t.Errorf("sent chain expected: bcc, got: %s", chain)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// switchesTotal 切换到各币种的次数
+	switchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "switches_total",
+		Help: "Number of chain switches, by the chain switched to.",
+	}, []string{"algorithm", "to_chain"})
+
+	// timeOnChainSeconds 在各币种上停留的累计时间
+	timeOnChainSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "time_on_chain_seconds",
+		Help: "Accumulated time spent on each chain.",
+	}, []string{"algorithm", "chain"})
+
+	// switchRevertsTotal 切换回最近使用过的币种的次数
+	switchRevertsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "switch_reverts_total",
+		Help: "Number of switches back to a recently used chain, by the chain switched to.",
+	}, []string{"algorithm", "to_chain"})
+
+	// switchesSuppressedTotal 因达到每日切换次数上限而被抑制的切换次数
+	switchesSuppressedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "switches_suppressed_total",
+		Help: "Number of switches suppressed by MaxSwitchesPerDay.",
+	}, []string{"algorithm"})
+
+	// currentChain 当前币种，值为1的序列即为当前币种
+	currentChain = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "current_chain",
+		Help: "Current chain of the algorithm, the series with value 1 is the current one.",
+	}, []string{"algorithm", "chain"})
+
+	// chainDispatchAPIFailuresTotal 请求 ChainDispatchAPI 失败的次数
+	chainDispatchAPIFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chain_dispatch_api_failures_total",
+		Help: "Number of failed requests to ChainDispatchAPI, including non-2xx responses.",
+	}, []string{"algorithm"})
+
+	// chainDispatchAPIFetchSeconds 请求 ChainDispatchAPI 的耗时
+	chainDispatchAPIFetchSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chain_dispatch_api_fetch_seconds",
+		Help:    "Latency of requests to ChainDispatchAPI, including failed ones.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"algorithm"})
+
+	// kafkaWriteFailuresTotal 写入各Kafka topic失败的次数
+	kafkaWriteFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_write_failures_total",
+		Help: "Number of failed writes of switch commands, by Kafka topic.",
+	}, []string{"algorithm", "topic"})
+
+	// lastSuccessfulPollTimestamp 最近一次成功轮询的时间，用于对接口失效告警
+	lastSuccessfulPollTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "last_successful_poll_timestamp_seconds",
+		Help: "Unix time of the last successful poll of ChainDispatchAPI.",
+	}, []string{"algorithm"})
+)
+
+func init() {
+	prometheus.MustRegister(switchesTotal, timeOnChainSeconds, switchRevertsTotal, switchesSuppressedTotal)
+	prometheus.MustRegister(currentChain, chainDispatchAPIFailuresTotal, chainDispatchAPIFetchSeconds,
+		kafkaWriteFailuresTotal, lastSuccessfulPollTimestamp)
+}
+
+// setCurrentChainMetric 将chain设为本算法的当前币种，本算法其他币种的序列被删除
+func (s *algorithmSwitcher) setCurrentChainMetric(chain string) {
+	s.chainDwellLock.Lock()
+	defer s.chainDwellLock.Unlock()
+
+	if s.currentChainLabel != "" {
+		currentChain.DeleteLabelValues(s.config.Algorithm, s.currentChainLabel)
+	}
+	s.currentChainLabel = chain
+	if chain != "" {
+		currentChain.WithLabelValues(s.config.Algorithm, chain).Set(1)
+	}
+}
+
+// observeChainDwell 把从上次统计到now的时间计入chain的停留时间
+func (s *algorithmSwitcher) observeChainDwell(chain string, now time.Time) {
+	s.chainDwellLock.Lock()
+	defer s.chainDwellLock.Unlock()
+
+	if chain != "" && !s.chainObservedAt.IsZero() && now.After(s.chainObservedAt) {
+		timeOnChainSeconds.WithLabelValues(s.config.Algorithm, chain).Add(now.Sub(s.chainObservedAt).Seconds())
+	}
+	s.chainObservedAt = now
+}
+
+// recordSwitchMetrics 记录一次从oldChain到newChain的切换
+func (s *algorithmSwitcher) recordSwitchMetrics(oldChain string, newChain string, now time.Time) {
+	s.observeChainDwell(oldChain, now)
+	switchesTotal.WithLabelValues(s.config.Algorithm, newChain).Inc()
+	s.setCurrentChainMetric(newChain)
+
+	s.chainDwellLock.Lock()
+	revert := s.recentChains.push(newChain)
+	s.chainDwellLock.Unlock()
+
+	if revert {
+		switchRevertsTotal.WithLabelValues(s.config.Algorithm, newChain).Inc()
+		glog.Warning("Revert to recently used chain: ", oldChain, " -> ", newChain,
+			", recent chains: ", s.recentChains.chains)
+	}
+}
+
+// newMetricsMux Prometheus指标及内部管理接口
+func newMetricsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/loglevel", requireOverrideAuth(logVerbosityHandle))
+	mux.HandleFunc("/override", requireOverrideAuth(overrideHandle))
+	mux.HandleFunc("/preview", requireOverrideAuth(previewHandle))
+	return mux
+}
+
+// runMetricsServer 启动Prometheus指标的HTTP服务
+func runMetricsServer(listenAddr string) {
+	glog.Info("Listen HTTP ", listenAddr)
+	err := http.ListenAndServe(listenAddr, newMetricsMux())
+	if err != nil {
+		glog.Fatal("HTTP Listen Failed: ", err)
+		return
+	}
+}
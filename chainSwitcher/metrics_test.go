@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// 测试切换时的计数和停留时间统计
+func TestRecordSwitchMetrics(t *testing.T) {
+	switchesTotal.Reset()
+	timeOnChainSeconds.Reset()
+	s := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "sha256"})
+
+	begin := time.Unix(1500000000, 0)
+	s.recordSwitchMetrics("", "btc", begin)
+	s.observeChainDwell("btc", begin.Add(60*time.Second))
+	s.recordSwitchMetrics("btc", "bcc", begin.Add(100*time.Second))
+	s.recordSwitchMetrics("bcc", "btc", begin.Add(130*time.Second))
+
+	if v := testutil.ToFloat64(switchesTotal.WithLabelValues("sha256", "btc")); v != 2 {
+		t.Errorf("switches to btc expected: 2, got: %v", v)
+	}
+	if v := testutil.ToFloat64(switchesTotal.WithLabelValues("sha256", "bcc")); v != 1 {
+		t.Errorf("switches to bcc expected: 1, got: %v", v)
+	}
+	if v := testutil.ToFloat64(timeOnChainSeconds.WithLabelValues("sha256", "btc")); v != 100 {
+		t.Errorf("time on btc expected: 100, got: %v", v)
+	}
+	if v := testutil.ToFloat64(timeOnChainSeconds.WithLabelValues("sha256", "bcc")); v != 30 {
+		t.Errorf("time on bcc expected: 30, got: %v", v)
+	}
+}
+
+// 测试回退被计入指标
+func TestRecordSwitchMetricsRevert(t *testing.T) {
+	switchRevertsTotal.Reset()
+	s := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "sha256"})
+
+	now := time.Unix(1500000000, 0)
+	s.recordSwitchMetrics("", "btc", now)
+	s.recordSwitchMetrics("btc", "bcc", now)
+	s.recordSwitchMetrics("bcc", "btc", now)
+
+	if v := testutil.ToFloat64(switchRevertsTotal.WithLabelValues("sha256", "btc")); v != 1 {
+		t.Errorf("reverts to btc expected: 1, got: %v", v)
+	}
+	if v := testutil.ToFloat64(switchRevertsTotal.WithLabelValues("sha256", "bcc")); v != 0 {
+		t.Errorf("reverts to bcc expected: 0, got: %v", v)
+	}
+}
+
+// 测试轮询时的当前币种、接口请求及Kafka写入指标
+func TestPollMetrics(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{` +
+			`"BCH":{"dispatch_hashrate":150,"dispatchable_hashrate":200},` +
+			`"BTC":{"dispatch_hashrate":100,"dispatchable_hashrate":120}}}}}`))
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.Kafka.ControllerTopic = "BtcManController"
+	httpClient = server.Client()
+	s.historyStore = &memHistoryStore{}
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.currentChainName = "btc"
+	s.setCurrentChainMetric("btc")
+	lastSuccessfulPollTimestamp.WithLabelValues("sha256").Set(0)
+	failures := testutil.ToFloat64(chainDispatchAPIFailuresTotal.WithLabelValues("sha256"))
+	fetches := fetchLatencySamples()
+
+	s.updateCurrentChain()
+	if v := testutil.ToFloat64(currentChain.WithLabelValues("sha256", "bcc")); v != 1 {
+		t.Errorf("current chain bcc expected: 1, got: %v", v)
+	}
+	if n := testutil.CollectAndCount(currentChain); n != 1 {
+		t.Errorf("only the current chain expected to be exported, got: %d series", n)
+	}
+	if v := testutil.ToFloat64(lastSuccessfulPollTimestamp.WithLabelValues("sha256")); v < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("last successful poll timestamp expected to be updated, got: %v", v)
+	}
+	if n := fetchLatencySamples() - fetches; n != 1 {
+		t.Errorf("fetch latency samples expected: 1, got: %d", n)
+	}
+
+	// 接口返回错误时计入失败次数，不更新成功轮询时间
+	status = http.StatusInternalServerError
+	lastSuccessfulPollTimestamp.WithLabelValues("sha256").Set(1)
+	s.updateCurrentChain()
+	if v := testutil.ToFloat64(chainDispatchAPIFailuresTotal.WithLabelValues("sha256")) - failures; v != 1 {
+		t.Errorf("API failures expected: 1, got: %v", v)
+	}
+	if v := testutil.ToFloat64(lastSuccessfulPollTimestamp.WithLabelValues("sha256")); v != 1 {
+		t.Errorf("last successful poll timestamp should not be updated on failure, got: %v", v)
+	}
+	if n := fetchLatencySamples() - fetches; n != 2 {
+		t.Errorf("failed fetch expected to be observed, samples: %d", n)
+	}
+
+	writeFailures := testutil.ToFloat64(kafkaWriteFailuresTotal.WithLabelValues("sha256", "BtcManController"))
+	writer.err = errors.New("broker down")
+	if err := s.writeCommand(s.newKafkaCommand(1, "bcc")); err == nil {
+		t.Errorf("write error should be returned")
+	}
+	if v := testutil.ToFloat64(kafkaWriteFailuresTotal.WithLabelValues("sha256", "BtcManController")) - writeFailures; v != 1 {
+		t.Errorf("kafka write failures expected: 1, got: %v", v)
+	}
+}
+
+// fetchLatencySamples 请求 ChainDispatchAPI 耗时的样本数
+func fetchLatencySamples() uint64 {
+	var m dto.Metric
+	chainDispatchAPIFetchSeconds.WithLabelValues("sha256").(prometheus.Histogram).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// 测试MySQL连接池设置
+func TestApplyMySQLPoolConfig(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	db, err := sql.Open("mysql", "user:password@tcp(127.0.0.1:3306)/dbname")
+	if err != nil {
+		t.Fatalf("open mysql failed: %s", err)
+	}
+	defer db.Close()
+
+	applyMySQLPoolConfig(db)
+	if n := db.Stats().MaxOpenConnections; n != 0 {
+		t.Errorf("default max open conns expected: 0 (unlimited), got: %d", n)
+	}
+
+	configData.MySQLMaxOpenConns = 8
+	configData.MySQLMaxIdleConns = 4
+	configData.MySQLConnMaxLifetimeSeconds = 300
+	applyMySQLPoolConfig(db)
+	if n := db.Stats().MaxOpenConnections; n != 8 {
+		t.Errorf("max open conns expected: 8, got: %d", n)
+	}
+}
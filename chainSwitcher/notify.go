@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 通知格式（NotifyFormat）
+const (
+	// notifyFormatRaw 直接发送 SwitchEvent 的JSON
+	notifyFormatRaw = "raw"
+	// notifyFormatSlack Slack Incoming Webhook：{"text": "..."}
+	notifyFormatSlack = "slack"
+	// notifyFormatDiscord Discord Webhook：{"content": "..."}
+	notifyFormatDiscord = "discord"
+)
+
+// defaultNotifyTemplate 默认的通知消息模板
+const defaultNotifyTemplate = "[{{.Algorithm}}] {{.Action}}: {{.OldChain}} -> {{.NewChain}}" +
+	" (dispatch hashrate: {{.OldHashrate}} -> {{.NewHashrate}})"
+
+// notifyTimeout 发送通知的超时时间
+const notifyTimeout = 10 * time.Second
+
+// SwitchEvent 切换事件，用于发送通知
+type SwitchEvent struct {
+	Algorithm   string  `json:"algorithm"`
+	Action      string  `json:"action"` // best_chain_changed、fail_safe_switch、auto_rollback 或 manual_override
+	OldChain    string  `json:"old_chain"`
+	NewChain    string  `json:"new_chain"`
+	OldHashrate float64 `json:"old_hashrate"` // 原币种的 dispatch_hashrate，接口未提供时为0
+	NewHashrate float64 `json:"new_hashrate"` // 新币种的 dispatch_hashrate，接口未提供时为0
+	Time        string  `json:"time"`
+}
+
+// 通知消息模板
+var notifyTemplate *template.Template
+
+// parseNotifyTemplate 解析通知消息模板，为空时使用默认模板
+func parseNotifyTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	return template.New("notify").Parse(text)
+}
+
+// renderNotification 按通知格式生成webhook请求的内容
+func renderNotification(format string, tmpl *template.Template, event SwitchEvent) ([]byte, error) {
+	if format == notifyFormatRaw || format == "" {
+		return json.Marshal(event)
+	}
+
+	var text bytes.Buffer
+	err := tmpl.Execute(&text, event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case notifyFormatSlack:
+		return json.Marshal(map[string]string{"text": text.String()})
+	case notifyFormatDiscord:
+		return json.Marshal(map[string]string{"content": text.String()})
+	}
+	return nil, fmt.Errorf("unknown NotifyFormat: %s", format)
+}
+
+// notifySwitch 异步发送切换通知，未配置 NotifyWebhookURL 时不发送
+func (s *algorithmSwitcher) notifySwitch(event SwitchEvent) {
+	if s.config.NotifyWebhookURL == "" {
+		return
+	}
+
+	event.Algorithm = s.config.Algorithm
+	event.Time = time.Now().UTC().Format("2006-01-02 15:04:05")
+	body, err := renderNotification(s.config.NotifyFormat, notifyTemplate, event)
+	if err != nil {
+		glog.Error("render notification failed: ", err)
+		return
+	}
+
+	go func() {
+		client := http.Client{Timeout: notifyTimeout}
+		response, err := client.Post(s.config.NotifyWebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			glog.Error("send notification failed: ", err)
+			return
+		}
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			glog.Error("send notification failed, HTTP status: ", response.Status)
+		}
+	}()
+}
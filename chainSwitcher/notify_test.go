@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 测试各通知格式的渲染结果
+func TestRenderNotification(t *testing.T) {
+	event := SwitchEvent{
+		Algorithm:   "SHA256",
+		Action:      "best_chain_changed",
+		OldChain:    "btc",
+		NewChain:    "bcc",
+		OldHashrate: 100,
+		NewHashrate: 120,
+		Time:        "2020-01-01 00:00:00",
+	}
+	tmpl, err := parseNotifyTemplate("")
+	if err != nil {
+		t.Fatalf("parse default template failed: %s", err)
+	}
+	text := "[SHA256] best_chain_changed: btc -> bcc (dispatch hashrate: 100 -> 120)"
+
+	body, err := renderNotification(notifyFormatSlack, tmpl, event)
+	if err != nil {
+		t.Fatalf("render slack failed: %s", err)
+	}
+	var fields map[string]string
+	json.Unmarshal(body, &fields)
+	if fields["text"] != text || len(fields) != 1 {
+		t.Errorf("slack payload expected text: %s, got: %s", text, string(body))
+	}
+
+	body, err = renderNotification(notifyFormatDiscord, tmpl, event)
+	if err != nil {
+		t.Fatalf("render discord failed: %s", err)
+	}
+	fields = nil
+	json.Unmarshal(body, &fields)
+	if fields["content"] != text || len(fields) != 1 {
+		t.Errorf("discord payload expected content: %s, got: %s", text, string(body))
+	}
+
+	body, err = renderNotification(notifyFormatRaw, tmpl, event)
+	if err != nil {
+		t.Fatalf("render raw failed: %s", err)
+	}
+	var raw SwitchEvent
+	json.Unmarshal(body, &raw)
+	if raw != event {
+		t.Errorf("raw payload expected: %+v, got: %s", event, string(body))
+	}
+
+	// 自定义模板
+	tmpl, err = parseNotifyTemplate("{{.NewChain}} now")
+	if err != nil {
+		t.Fatalf("parse template failed: %s", err)
+	}
+	body, _ = renderNotification(notifyFormatSlack, tmpl, event)
+	fields = nil
+	json.Unmarshal(body, &fields)
+	if fields["text"] != "bcc now" {
+		t.Errorf("custom template expected: bcc now, got: %s", string(body))
+	}
+
+	if _, err := renderNotification("teams", tmpl, event); err == nil {
+		t.Errorf("unknown format should fail")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// OverrideState 手动指定币种的状态
+type OverrideState struct {
+	Active     bool   `json:"active"`
+	Chain      string `json:"chain"`
+	Algorithm  string `json:"algorithm,omitempty"`   // 只切换一个算法时可选，配置了多个算法时必填（GET、DELETE时为查询参数）
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"` // 设置时可选，经过该秒数后自动恢复自动选择，为0时一直有效
+	ExpiresAt  int64  `json:"expires_at,omitempty"`  // 自动恢复的Unix时间，未设置 ttl_seconds 时为0
+}
+
+// ActionManualOverride 按手动指定的币种切换时记录的api_result
+type ActionManualOverride struct {
+	Action       string `json:"action"`
+	OldChainName string `json:"old_chain_name"`
+	NewChainName string `json:"new_chain_name"`
+}
+
+// overrideChain 返回手动指定的币种，已过期时清除并恢复自动选择
+func (s *algorithmSwitcher) overrideChain() string {
+	chain, _ := s.overrideChainExpiry()
+	return chain
+}
+
+// overrideChainExpiry 返回手动指定的币种及其过期时间
+func (s *algorithmSwitcher) overrideChainExpiry() (string, time.Time) {
+	s.manualOverrideLock.Lock()
+	defer s.manualOverrideLock.Unlock()
+
+	if s.manualOverride != "" && !s.manualOverrideExpiry.IsZero() && !time.Now().Before(s.manualOverrideExpiry) {
+		glog.Warning("Manual override expired: ", s.manualOverride, ", back to automatic selection")
+		s.manualOverride = ""
+		s.manualOverrideExpiry = time.Time{}
+	}
+	return s.manualOverride, s.manualOverrideExpiry
+}
+
+// setOverrideChain 手动指定币种，ttl大于0时经过ttl后自动恢复自动选择，chain为空时立即恢复自动选择
+func (s *algorithmSwitcher) setOverrideChain(chain string, ttl time.Duration) {
+	s.manualOverrideLock.Lock()
+	defer s.manualOverrideLock.Unlock()
+
+	if s.manualOverride != chain {
+		glog.Warning("Manual override changed: ", s.manualOverride, " -> ", chain)
+	}
+	s.manualOverride = chain
+	s.manualOverrideExpiry = time.Time{}
+	if chain != "" && ttl > 0 {
+		s.manualOverrideExpiry = time.Now().Add(ttl)
+		glog.Warning("Manual override to ", chain, " expires at ", s.manualOverrideExpiry.UTC().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// overrideStatus 手动指定币种的状态说明，用于日志
+func overrideStatus(chain string, expiry time.Time) string {
+	if expiry.IsZero() {
+		return chain + " (no expiry)"
+	}
+	return chain + " (expires in " + time.Until(expiry).Round(time.Second).String() + ")"
+}
+
+// overrideChainValid 手动指定的币种须为 ChainNameMap 中的币种名，且sserver支持
+func (s *algorithmSwitcher) overrideChainValid(chain string) bool {
+	for _, name := range s.config.ChainNameMap {
+		if name == chain {
+			return s.chainSupported(chain)
+		}
+	}
+	return false
+}
+
+// applyManualOverride 轮询时切换到手动指定的币种，不请求接口，也不受粘性及每日切换次数限制
+func (s *algorithmSwitcher) applyManualOverride(chain string) {
+	now := time.Now()
+	s.updateTime = now.Unix()
+
+	oldChainName := s.currentChainName
+	if oldChainName == chain {
+		s.observeChainDwell(s.currentChainName, now)
+		_, expiry := s.overrideChainExpiry()
+		glog.Info("Chain pinned by manual override: ", overrideStatus(chain, expiry))
+		return
+	}
+
+	s.switchTo(chain, now)
+	s.recordSwitchMetrics(oldChainName, s.currentChainName, now)
+	s.switchLimit.record(now)
+	// 手动指定的币种不回滚、不灰度
+	s.switchRollback.beginSwitch("", s.currentChainName)
+	s.canary.beginSwitch("", s.currentChainName)
+	glog.Warning("Manual Override Switch: ", oldChainName, " -> ", s.currentChainName)
+	s.notifySwitch(SwitchEvent{Action: "manual_override", OldChain: oldChainName, NewChain: s.currentChainName})
+
+	bytes, _ := json.Marshal(ActionManualOverride{
+		Action:       "manual_override",
+		OldChainName: oldChainName,
+		NewChainName: s.currentChainName})
+	err := s.historyStore.InsertRecord(s.config.Algorithm, oldChainName, s.currentChainName, switchReasonManualOverride, bytes)
+	if err != nil {
+		glog.Fatal(s.config.DBDriver, " error: ", err.Error())
+	}
+}
+
+// overrideAuthorized 检查 HTTP Basic 认证，未配置 OverrideAPIUser 时不允许访问
+func overrideAuthorized(req *http.Request) bool {
+	if configData.OverrideAPIUser == "" {
+		return false
+	}
+	user, password, ok := req.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(configData.OverrideAPIUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(configData.OverrideAPIPassword)) == 1
+}
+
+// requireOverrideAuth 为 /override、/loglevel 及 /preview 等管理接口加上与 /override 相同的 HTTP Basic 认证
+func requireOverrideAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !overrideAuthorized(req) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// overrideHandle 查询（GET）、设置（POST {"chain":"btc","ttl_seconds":3600}）或取消（DELETE）手动指定的币种
+// 设置后从下一次轮询开始固定在该币种，取消或过期后恢复自动选择
+// 配置了多个算法时须指定算法：POST时为请求中的 algorithm，GET、DELETE时为查询参数 ?algorithm=
+func overrideHandle(w http.ResponseWriter, req *http.Request) {
+	var state OverrideState
+	switch req.Method {
+	case http.MethodGet, http.MethodDelete:
+		state.Algorithm = req.URL.Query().Get("algorithm")
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(body, &state); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed, use GET, POST or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := findSwitcher(state.Algorithm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPost:
+		if s.config.SubPoolDispatch {
+			http.Error(w, "manual override is not supported with SubPoolDispatch", http.StatusBadRequest)
+			return
+		}
+		if !s.overrideChainValid(state.Chain) {
+			http.Error(w, "unknown chain '"+state.Chain+"'", http.StatusBadRequest)
+			return
+		}
+		if state.TTLSeconds < 0 {
+			http.Error(w, "ttl_seconds should not be negative", http.StatusBadRequest)
+			return
+		}
+		s.setOverrideChain(state.Chain, time.Duration(state.TTLSeconds)*time.Second)
+	case http.MethodDelete:
+		s.setOverrideChain("", 0)
+	}
+
+	chain, expiry := s.overrideChainExpiry()
+	state = OverrideState{Active: chain != "", Chain: chain, Algorithm: s.config.Algorithm}
+	if !expiry.IsZero() {
+		state.ExpiresAt = expiry.Unix()
+	}
+	response, _ := json.Marshal(state)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
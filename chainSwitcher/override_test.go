@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// overrideRequest 以 admin:secret 认证请求 /override
+func overrideRequest(method string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/override", strings.NewReader(body))
+	request.SetBasicAuth("admin", "secret")
+	recorder := httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, request)
+	return recorder
+}
+
+// initOverrideTest 初始化手动指定币种的测试
+func initOverrideTest() (*algorithmSwitcher, *memHistoryStore) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	switchers = []*algorithmSwitcher{s}
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.OverrideAPIUser = "admin"
+	configData.OverrideAPIPassword = "secret"
+	store := &memHistoryStore{}
+	s.historyStore = store
+	return s, store
+}
+
+// 测试设置、查询及取消手动指定的币种
+func TestOverrideHandle(t *testing.T) {
+	s, _ := initOverrideTest()
+	defer s.setOverrideChain("", 0)
+
+	if recorder := overrideRequest("GET", ""); recorder.Body.String() != `{"active":false,"chain":"","algorithm":"sha256"}` {
+		t.Errorf("no override expected, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder := overrideRequest("POST", `{"chain":"bcc"}`)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"active":true,"chain":"bcc","algorithm":"sha256"}` {
+		t.Errorf("set override expected: 200 bcc, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder = overrideRequest("GET", ""); recorder.Body.String() != `{"active":true,"chain":"bcc","algorithm":"sha256"}` {
+		t.Errorf("get override expected: bcc, got: %s", recorder.Body.String())
+	}
+
+	recorder = overrideRequest("DELETE", "")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"active":false,"chain":"","algorithm":"sha256"}` {
+		t.Errorf("clear override expected: 200 inactive, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// 测试设置了 ttl_seconds 的手动指定在过期后自动取消
+func TestOverrideTTL(t *testing.T) {
+	s, _ := initOverrideTest()
+	defer s.setOverrideChain("", 0)
+
+	before := time.Now().Add(time.Hour).Unix()
+	recorder := overrideRequest("POST", `{"algorithm":"sha256","chain":"bcc","ttl_seconds":3600}`)
+	var state OverrideState
+	if err := json.Unmarshal(recorder.Body.Bytes(), &state); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	if recorder.Code != http.StatusOK || !state.Active || state.Chain != "bcc" ||
+		state.ExpiresAt < before || state.ExpiresAt > time.Now().Add(time.Hour).Unix() {
+		t.Errorf("override with expiry in 1 hour expected, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// 模拟到期
+	s.manualOverrideLock.Lock()
+	s.manualOverrideExpiry = time.Now().Add(-time.Second)
+	s.manualOverrideLock.Unlock()
+	if chain := s.overrideChain(); chain != "" {
+		t.Errorf("expired override should be cleared, got: %s", chain)
+	}
+	if recorder = overrideRequest("GET", ""); recorder.Body.String() != `{"active":false,"chain":"","algorithm":"sha256"}` {
+		t.Errorf("no override expected after expiry, got: %s", recorder.Body.String())
+	}
+}
+
+// 测试不在 ChainNameMap 中的币种及未认证的请求被拒绝
+func TestOverrideHandleInvalid(t *testing.T) {
+	s, _ := initOverrideTest()
+	defer s.setOverrideChain("", 0)
+
+	for _, body := range []string{`{"chain":"bsv"}`, `{"chain":""}`, `{"chain":`,
+		`{"chain":"bcc","algorithm":"scrypt"}`, `{"chain":"bcc","ttl_seconds":-1}`} {
+		if recorder := overrideRequest("POST", body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s expected: 400, got: %d %s", body, recorder.Code, recorder.Body.String())
+		}
+	}
+	if chain := s.overrideChain(); chain != "" {
+		t.Errorf("override should not be set, got: %s", chain)
+	}
+
+	recorder := httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, httptest.NewRequest("POST", "/override", strings.NewReader(`{"chain":"bcc"}`)))
+	if recorder.Code != http.StatusUnauthorized || s.overrideChain() != "" {
+		t.Errorf("request without auth expected: 401, got: %d", recorder.Code)
+	}
+
+	// 未配置认证时禁用该接口
+	configData.OverrideAPIUser = ""
+	if recorder = overrideRequest("GET", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("disabled override API expected: 401, got: %d", recorder.Code)
+	}
+}
+
+// 测试轮询时切换到手动指定的币种
+func TestApplyManualOverride(t *testing.T) {
+	s, store := initOverrideTest()
+	s.currentChainName = "btc"
+
+	s.applyManualOverride("bcc")
+	if s.currentChainName != "bcc" || len(store.records) != 1 || store.records[0] != [2]string{"btc", "bcc"} {
+		t.Errorf("switch to override chain expected, current: %s, records: %v", s.currentChainName, store.records)
+	}
+	if len(store.reasons) != 1 || store.reasons[0] != switchReasonManualOverride {
+		t.Errorf("switch reason %s expected, got: %v", switchReasonManualOverride, store.reasons)
+	}
+
+	s.applyManualOverride("bcc")
+	if len(store.records) != 1 {
+		t.Errorf("pinned chain should not be recorded again, records: %v", store.records)
+	}
+}
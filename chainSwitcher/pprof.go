@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/golang/glog"
+)
+
+// pprofListenAddr 补全 pprof 的监听地址，未指定IP时（如":6060"）只监听本机
+func pprofListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// newPprofServer 创建独立监听的 pprof Server，PprofListenAddr 为空时返回nil
+func newPprofServer(listenAddr string) *http.Server {
+	if listenAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return &http.Server{
+		Addr:    pprofListenAddr(listenAddr),
+		Handler: mux,
+	}
+}
+
+func runPprofServer(server *http.Server) {
+	glog.Info("Listen pprof HTTP ", server.Addr)
+	err := server.ListenAndServe()
+	if err != nil {
+		glog.Error("pprof HTTP Listen Failed: ", err)
+	}
+}
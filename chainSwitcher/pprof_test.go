@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试 pprof 只在配置后启用
+func TestNewPprofServer(t *testing.T) {
+	if server := newPprofServer(""); server != nil {
+		t.Errorf("pprof server should be disabled by default, got: %s", server.Addr)
+	}
+
+	server := newPprofServer(":6060")
+	if server == nil {
+		t.Fatalf("pprof server should be enabled")
+	}
+	if server.Addr != "127.0.0.1:6060" {
+		t.Errorf("pprof addr expected: 127.0.0.1:6060, got: %s", server.Addr)
+	}
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("pprof index expected: 200, got: %d", recorder.Code)
+	}
+
+	if server := newPprofServer("0.0.0.0:6060"); server.Addr != "0.0.0.0:6060" {
+		t.Errorf("pprof addr expected: 0.0.0.0:6060, got: %s", server.Addr)
+	}
+}
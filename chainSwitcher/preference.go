@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// defaultPreferenceWeightsReloadSeconds 重新读取 PreferenceWeightsFile 的默认间隔
+const defaultPreferenceWeightsReloadSeconds = 60
+
+// preferenceWeights 从 PreferenceWeightsFile 读取的各币种权重，未列出的币种权重为1
+type preferenceWeights struct {
+	lock    sync.Mutex
+	weights map[string]float64
+}
+
+// 当前的币种权重，未配置 PreferenceWeightsFile 时为nil
+var preferences *preferenceWeights
+
+// readPreferenceWeights 读取权重文件，格式为以币种（ChainDispatchAPI中的币种名）为键的对象：{"BCH": 1.2, "BTC": 0.9}
+func readPreferenceWeights(path string) (map[string]float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]float64)
+	if err = json.Unmarshal(data, &weights); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %s", path, err)
+	}
+	for coin, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("weight of coin %s in %s cannot be negative: %v", coin, path, weight)
+		}
+	}
+	return weights, nil
+}
+
+// newPreferenceWeights 读取权重文件，读取失败时返回错误
+func newPreferenceWeights(path string) (*preferenceWeights, error) {
+	weights, err := readPreferenceWeights(path)
+	if err != nil {
+		return nil, err
+	}
+	glog.Info("preference weights loaded from ", path, ": ", weights)
+	return &preferenceWeights{weights: weights}, nil
+}
+
+// reload 重新读取权重文件，内容变化时输出日志。读取失败时保留原有的权重
+func (p *preferenceWeights) reload(path string) error {
+	weights, err := readPreferenceWeights(path)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !reflect.DeepEqual(weights, p.weights) {
+		glog.Info("preference weights reloaded from ", path, ": ", p.weights, " -> ", weights)
+		p.weights = weights
+	}
+	return nil
+}
+
+// runReload 每隔interval重新读取权重文件
+func (p *preferenceWeights) runReload(path string, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if err := p.reload(path); err != nil {
+			glog.Error("reload PreferenceWeightsFile failed, keep current weights: ", err)
+		}
+	}
+}
+
+// apply 将各币种的 dispatch_hashrate 乘以权重，并按结果从高到低重新排序
+// 未配置 PreferenceWeightsFile 时原样返回。各算法共用同一份权重
+func (p *preferenceWeights) apply(coins CoinList) CoinList {
+	if p == nil {
+		return coins
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.weights) == 0 {
+		return coins
+	}
+
+	weighted := make(CoinList, len(coins))
+	copy(weighted, coins)
+	for i := range weighted {
+		if weight, ok := p.weights[weighted[i].Coin]; ok {
+			weighted[i].DispatchHashrate *= weight
+		}
+	}
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].DispatchHashrate > weighted[j].DispatchHashrate
+	})
+	return weighted
+}
+
+// applyPreferences 将币种权重作用于本算法的币种，权重改变了选出的币种名时输出日志
+func (s *algorithmSwitcher) applyPreferences(coins CoinList) CoinList {
+	weighted := preferences.apply(coins)
+	before, after := s.firstChain(coins), s.firstChain(weighted)
+	if before != after {
+		glog.Info("Preference weights changed the best chain: ", before, " -> ", after,
+			", weighted coins (dispatch/dispatchable): ", coinScores(weighted))
+	}
+	return weighted
+}
+
+// firstChain 推荐顺序中第一个已配置的币种名，没有时为空
+func (s *algorithmSwitcher) firstChain(coins CoinList) string {
+	chains := s.candidateChains(coins)
+	if len(chains) == 0 {
+		return ""
+	}
+	return chains[0]
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试权重改变选出的币种，未列出的币种权重为1
+func TestPreferenceWeightsSelection(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc", "BSV": "bsv"}
+	configData.FailSafeChain = "btc"
+	coins := CoinList{
+		{Coin: "BCH", DispatchHashrate: 150},
+		{Coin: "BTC", DispatchHashrate: 100},
+		{Coin: "BSV", DispatchHashrate: 90},
+	}
+
+	dir, err := ioutil.TempDir("", "chainSwitcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "weights.json")
+	ioutil.WriteFile(path, []byte(`{"BTC": 2, "BCH": 0.5}`), 0644)
+	weights, err := newPreferenceWeights(path)
+	if err != nil {
+		t.Fatalf("load weights failed: %s", err)
+	}
+
+	preferences = nil
+	if chain := s.selectBestChain(preferences.apply(coins)); chain != "bcc" {
+		t.Errorf("bcc expected without weights, got: %s", chain)
+	}
+
+	preferences = weights
+	defer func() { preferences = nil }()
+	weighted := preferences.apply(coins)
+	if chain := s.selectBestChain(weighted); chain != "btc" {
+		t.Errorf("btc expected with weights, got: %s", chain)
+	}
+	// BTC 200, BSV 90（权重为1）, BCH 75
+	if weighted[0].DispatchHashrate != 200 || weighted[1].Coin != "BSV" || weighted[2].DispatchHashrate != 75 {
+		t.Errorf("wrong weighted coins: %v", weighted)
+	}
+	if coins[0].Coin != "BCH" || coins[0].DispatchHashrate != 150 {
+		t.Errorf("original coins should not be modified: %v", coins)
+	}
+
+	// 重新读取后使用新的权重
+	ioutil.WriteFile(path, []byte(`{"BSV": 3}`), 0644)
+	if err := preferences.reload(path); err != nil {
+		t.Fatalf("reload failed: %s", err)
+	}
+	if chain := s.selectBestChain(preferences.apply(coins)); chain != "bsv" {
+		t.Errorf("bsv expected after reload, got: %s", chain)
+	}
+
+	// 文件无效时保留原有的权重
+	ioutil.WriteFile(path, []byte(`{"BSV": -1}`), 0644)
+	if err := preferences.reload(path); err == nil {
+		t.Errorf("negative weight should be rejected")
+	}
+	ioutil.WriteFile(path, []byte(`not json`), 0644)
+	if err := preferences.reload(path); err == nil {
+		t.Errorf("invalid file should be rejected")
+	}
+	if chain := s.selectBestChain(preferences.apply(coins)); chain != "bsv" {
+		t.Errorf("weights should be kept after failed reload, got: %s", chain)
+	}
+}
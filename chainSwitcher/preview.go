@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// previewOutcomeManualOverride 手动指定了币种时 /preview 返回的决策结果
+const previewOutcomeManualOverride = "manual_override"
+
+// PreviewResponse /preview 接口的响应
+type PreviewResponse struct {
+	Algorithm    string             `json:"algorithm"`
+	CurrentChain string             `json:"current_chain"`
+	BestChain    string             `json:"best_chain"`
+	NextChain    string             `json:"next_chain"` // 下次轮询时将使用的币种
+	WouldSwitch  bool               `json:"would_switch"`
+	Outcome      string             `json:"outcome"`
+	Reasons      []string           `json:"reasons"` // 阻止切换到 best_chain 的原因
+	Scores       map[string]float64 `json:"scores"`  // 各币种名的 dispatch_hashrate
+}
+
+// previewHandle 立即请求接口并按与轮询相同的规则选择币种，返回下次轮询将做出的决策
+// 不发送命令，不写入切换记录和决策记录，也不修改当前币种及切换次数等状态
+// 配置了多个算法时须以查询参数 ?algorithm= 指定算法
+func previewHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed, use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := findSwitcher(req.URL.Query().Get("algorithm"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.config.SubPoolDispatch {
+		http.Error(w, "preview is not supported with SubPoolDispatch", http.StatusBadRequest)
+		return
+	}
+
+	_, coins, err := s.fetchAlgorithmCoins()
+	if err != nil {
+		http.Error(w, "fetch ChainDispatchAPI failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	oldChain, lastSwitchTime := s.chainSnapshot()
+	bestChain := s.previewBestChain(coins)
+	decision, reasons := s.decideChain(coins, oldChain, lastSwitchTime, bestChain, time.Now())
+	if chain := s.overrideChain(); chain != "" {
+		// 手动指定币种时不受其他限制
+		decision.NewChain = chain
+		decision.Outcome = previewOutcomeManualOverride
+		reasons = []string{"manual override to " + chain}
+	}
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	_, hashrates := s.chainHashrates(coins)
+	response, _ := json.Marshal(PreviewResponse{
+		Algorithm:    s.config.Algorithm,
+		CurrentChain: oldChain,
+		BestChain:    bestChain,
+		NextChain:    decision.NewChain,
+		WouldSwitch:  decision.NewChain != oldChain,
+		Outcome:      decision.Outcome,
+		Reasons:      reasons,
+		Scores:       hashrates,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// previewRequest 以 admin:secret 认证请求 /preview
+func previewRequest() *http.Request {
+	request := httptest.NewRequest("GET", "/preview", nil)
+	request.SetBasicAuth("admin", "secret")
+	return request
+}
+
+// 测试 /preview 返回被每日切换次数限制阻止的切换及原因，且不修改任何状态
+func TestPreviewSuppressedSwitch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{` +
+			`"BCH":{"dispatch_hashrate":150,"dispatchable_hashrate":200},` +
+			`"BTC":{"dispatch_hashrate":100,"dispatchable_hashrate":120}}}}}`))
+	}))
+	defer server.Close()
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256", OverrideAPIUser: "admin", OverrideAPIPassword: "secret"}
+	s := newAlgorithmSwitcher(configData)
+	switchers = []*algorithmSwitcher{s}
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.MaxSwitchesPerDay = 1
+	httpClient = server.Client()
+	store := &memHistoryStore{}
+	s.historyStore = store
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.switchLimit = newSwitchLimiter(1, 24*time.Hour)
+	s.switchLimit.record(time.Now().Add(-time.Hour))
+	s.currentChainName = "btc"
+
+	recorder := httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, previewRequest())
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("preview expected 200, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	var preview PreviewResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("parse preview failed: %s", err)
+	}
+	if preview.CurrentChain != "btc" || preview.BestChain != "bcc" || preview.NextChain != "btc" || preview.WouldSwitch {
+		t.Errorf("switch to bcc expected to be suppressed, got: %+v", preview)
+	}
+	if preview.Outcome != decisionSuppressed || len(preview.Reasons) != 1 ||
+		!strings.Contains(preview.Reasons[0], "MaxSwitchesPerDay 1") {
+		t.Errorf("suppressed by MaxSwitchesPerDay expected, got: %s %v", preview.Outcome, preview.Reasons)
+	}
+	if preview.Scores["bcc"] != 150 || preview.Scores["btc"] != 100 {
+		t.Errorf("wrong scores: %v", preview.Scores)
+	}
+
+	if s.currentChainName != "btc" || s.switchLimit.count(time.Now()) != 1 {
+		t.Errorf("preview should not change state, chain: %s, switches: %d", s.currentChainName, s.switchLimit.count(time.Now()))
+	}
+	if len(writer.messages) != 0 || len(store.records) != 0 {
+		t.Errorf("preview should not send or record anything, commands: %d, records: %d", len(writer.messages), len(store.records))
+	}
+
+	// 不再受限时预览为切换到bcc
+	s.switchLimit = newSwitchLimiter(0, 24*time.Hour)
+	recorder = httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, previewRequest())
+	json.Unmarshal(recorder.Body.Bytes(), &preview)
+	if preview.NextChain != "bcc" || !preview.WouldSwitch || preview.Outcome != decisionSwitched || len(preview.Reasons) != 0 {
+		t.Errorf("switch to bcc expected, got: %+v", preview)
+	}
+
+	// 与 /override 相同需要认证
+	recorder = httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, httptest.NewRequest("GET", "/preview", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("request without auth expected: 401, got: %d", recorder.Code)
+	}
+}
+
+// 测试 /preview 只读取算力平滑值而不更新
+func TestPreviewKeepsHashrateSmoothing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{` +
+			`"BCH":{"dispatch_hashrate":150,"dispatchable_hashrate":200},` +
+			`"BTC":{"dispatch_hashrate":100,"dispatchable_hashrate":120}}}}}`))
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.NewWithDSN("preview-smoothing")
+	if err != nil {
+		t.Fatalf("create sqlmock failed: %s", err)
+	}
+	defer db.Close()
+	hashrateDBDriver = "sqlmock"
+	defer func() { hashrateDBDriver = "mysql" }()
+	// 300 share/5m * base 1 / 300 = 1 H/s
+	mock.ExpectQuery("SELECT sum").WillReturnRows(sqlmock.NewRows([]string{"accept_5m", "users"}).AddRow(300, 1))
+
+	configData = &ChainSwitcherConfig{Algorithm: "sha256", OverrideAPIUser: "admin", OverrideAPIPassword: "secret"}
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.ChainLimits = map[string]ChainLimit{"bcc": {MySQL: MySQLInfo{ConnStr: "preview-smoothing"},
+		name: "bcc", hashrate: 10, hashrateBase: 1}}
+	configData.HashrateSmoothing = HashrateSmoothingConfig{Alpha: 0.5}
+	s := newAlgorithmSwitcher(configData)
+	switchers = []*algorithmSwitcher{s}
+	httpClient = server.Client()
+	s.currentChainName = "btc"
+	s.hashrateSmoothing.update("bcc", 100)
+
+	recorder := httptest.NewRecorder()
+	newMetricsMux().ServeHTTP(recorder, previewRequest())
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("preview expected 200, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("hashrate of bcc expected to be read: %s", err)
+	}
+
+	// 平滑后的算力 50.5 仍超过限制，bcc 被跳过
+	var preview PreviewResponse
+	json.Unmarshal(recorder.Body.Bytes(), &preview)
+	if preview.BestChain != "btc" {
+		t.Errorf("bcc expected to be over limit with smoothed hashrate, got: %+v", preview)
+	}
+	if v := s.hashrateSmoothing.values["bcc"]; v != 100 {
+		t.Errorf("preview should not update hashrate smoothing, bcc expected: 100, got: %v", v)
+	}
+}
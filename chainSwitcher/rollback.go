@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 自动回滚的默认配置
+const (
+	defaultRollbackMaxFailedAcks     = 3
+	defaultRollbackAckTimeoutSeconds = 30
+	defaultRollbackHoldSeconds       = 3600
+)
+
+// AutoRollbackConfig 切换后收不到sserver成功响应时自动回滚到原币种的配置
+type AutoRollbackConfig struct {
+	Enabled           bool
+	MaxFailedAcks     int           // 切换后连续多少条命令超时未收到成功响应时回滚
+	AckTimeoutSeconds time.Duration // 命令发送后等待成功响应的时间
+	HoldSeconds       time.Duration // 回滚后多久内不再自动切换到回滚离开的币种
+}
+
+// ActionAutoRollback 自动回滚时记录的api_result
+type ActionAutoRollback struct {
+	Action       string `json:"action"`
+	FailedAcks   int    `json:"failed_acks"`
+	OldChainName string `json:"old_chain_name"`
+	NewChainName string `json:"new_chain_name"`
+}
+
+// switchRollbacksTotal 自动回滚的次数
+var switchRollbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "switch_rollbacks_total",
+	Help: "Number of switches rolled back because no successful sserver response arrived, by the chain rolled back from.",
+}, []string{"algorithm", "chain"})
+
+func init() {
+	prometheus.MustRegister(switchRollbacksTotal)
+}
+
+// rollbackTracker 跟踪最近一次切换的命令是否收到了sserver的成功响应
+// 命令发送和检查在切换币种的goroutine中进行，响应在读取Kafka的goroutine中记录
+type rollbackTracker struct {
+	lock        sync.Mutex
+	clock       Clock
+	maxFailures int
+	timeout     time.Duration
+	hold        time.Duration
+
+	prevChain string               // 切换前的币种，为空时没有待确认的切换
+	currChain string               // 切换后的币种
+	pending   map[uint64]time.Time // 已发送、尚未收到成功响应的命令及其发送时间
+	failures  int                  // 超时未收到成功响应的命令数
+
+	heldChain string // 最近一次回滚离开的币种，heldUntil 之前不再自动切换到该币种
+	heldUntil time.Time
+}
+
+// newRollbackTracker 创建自动回滚跟踪，未开启时返回nil
+func newRollbackTracker(clock Clock, conf AutoRollbackConfig) *rollbackTracker {
+	if !conf.Enabled {
+		return nil
+	}
+	return &rollbackTracker{
+		clock:       clock,
+		maxFailures: conf.MaxFailedAcks,
+		timeout:     conf.AckTimeoutSeconds * time.Second,
+		hold:        conf.HoldSeconds * time.Second,
+		pending:     make(map[uint64]time.Time),
+	}
+}
+
+// beginSwitch 开始跟踪从 prevChain 到 currChain 的切换，之前的切换不再跟踪
+// 启动后的首次选择（prevChain为空）没有可回滚的币种，不跟踪
+func (t *rollbackTracker) beginSwitch(prevChain string, currChain string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.prevChain = prevChain
+	t.currChain = currChain
+	t.pending = make(map[uint64]time.Time)
+	t.failures = 0
+}
+
+// commandSent 记录切换后发送的命令
+func (t *rollbackTracker) commandSent(command KafkaCommand) {
+	if t == nil {
+		return
+	}
+	id, ok := command.ID.(uint64)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.prevChain != "" && command.SubPool == "" && command.ChainName == t.currChain {
+		t.pending[id] = t.clock.Now()
+	}
+}
+
+// responseReceived 记录sserver的响应，待确认命令的成功响应表示切换已生效
+func (t *rollbackTracker) responseReceived(response *KafkaMessage) {
+	if t == nil || !response.Result {
+		return
+	}
+	// JSON数字被解析为float64
+	id, ok := response.ID.(float64)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.pending[uint64(id)]; ok {
+		glog.Info("Switch acknowledged: ", t.prevChain, " -> ", t.currChain, ", id: ", uint64(id))
+		t.prevChain = ""
+		t.pending = make(map[uint64]time.Time)
+		t.failures = 0
+	}
+}
+
+// checkRollback 统计超时未收到成功响应的命令，达到 MaxFailedAcks 时返回需回滚到的币种并停止跟踪
+func (t *rollbackTracker) checkRollback() (prevChain string, currChain string, failures int, rollback bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.prevChain == "" {
+		return
+	}
+	now := t.clock.Now()
+	for id, sentAt := range t.pending {
+		if now.Sub(sentAt) >= t.timeout {
+			delete(t.pending, id)
+			t.failures++
+			glog.Warning("No successful response of command ", id, " (", t.currChain, ") in ", t.timeout,
+				", failed acks: ", t.failures, "/", t.maxFailures)
+		}
+	}
+	if t.failures < t.maxFailures {
+		return
+	}
+
+	prevChain, currChain, failures, rollback = t.prevChain, t.currChain, t.failures, true
+	t.heldChain = currChain
+	t.heldUntil = now.Add(t.hold)
+	t.prevChain = ""
+	t.pending = make(map[uint64]time.Time)
+	t.failures = 0
+	return
+}
+
+// holdUntil 币种因自动回滚而暂停自动切换时，返回暂停的截止时间
+func (t *rollbackTracker) holdUntil(chain string) (until time.Time, held bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if chain == "" || chain != t.heldChain || !t.clock.Now().Before(t.heldUntil) {
+		return
+	}
+	return t.heldUntil, true
+}
+
+// rollbackCurrentChain 切换后多次收不到成功响应时回滚到原币种，返回是否进行了回滚
+// 回滚本身不再跟踪，回滚离开的币种在 HoldSeconds 内也不会被再次自动选中，避免在sserver都不响应时来回切换
+func (s *algorithmSwitcher) rollbackCurrentChain() bool {
+	prevChain, currChain, failures, rollback := s.switchRollback.checkRollback()
+	if !rollback || s.currentChainName != currChain {
+		return false
+	}
+
+	now := time.Now()
+	s.switchTo(prevChain, now)
+	s.canary.beginSwitch("", prevChain)
+	switchRollbacksTotal.WithLabelValues(s.config.Algorithm, currChain).Inc()
+	s.recordSwitchMetrics(currChain, prevChain, now)
+	s.switchLimit.record(now)
+	glog.Warning("Auto Rollback: ", currChain, " -> ", prevChain, ", ", failures, " commands without successful response")
+	s.notifySwitch(SwitchEvent{Action: "auto_rollback", OldChain: currChain, NewChain: prevChain})
+
+	bytes, _ := json.Marshal(ActionAutoRollback{
+		Action:       "auto_rollback",
+		FailedAcks:   failures,
+		OldChainName: currChain,
+		NewChainName: prevChain})
+	err := s.historyStore.InsertRecord(s.config.Algorithm, currChain, prevChain, switchReasonAutoRollback, bytes)
+	if err != nil {
+		glog.Fatal(s.config.DBDriver, " error: ", err.Error())
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// memHistoryStore 记录写入的切换记录
+type memHistoryStore struct {
+	records [][2]string
+	reasons []string
+}
+
+func (s *memHistoryStore) InsertRecord(algorithm string, prevChain string, currChain string, reason string, apiResult []byte) error {
+	s.records = append(s.records, [2]string{prevChain, currChain})
+	s.reasons = append(s.reasons, reason)
+	return nil
+}
+
+func (s *memHistoryStore) RecentSwitches(algorithm string, since time.Time) ([]time.Time, error) {
+	return nil, nil
+}
+
+// initRollbackTest 初始化切换后待确认的状态，返回切换、模拟时钟、Kafka和切换记录
+func initRollbackTest() (*algorithmSwitcher, *fakeClock, *mockWriter, *memHistoryStore) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	configData.AutoRollback = AutoRollbackConfig{Enabled: true, MaxFailedAcks: 3, AckTimeoutSeconds: 30}
+
+	s := newAlgorithmSwitcher(configData)
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	writer := &mockWriter{}
+	store := &memHistoryStore{}
+	s.controllerProducer = writer
+	s.historyStore = store
+	s.switchRollback = newRollbackTracker(clock, configData.AutoRollback)
+
+	s.currentChainName = "bcc"
+	s.switchRollback.beginSwitch("btc", "bcc")
+	return s, clock, writer, store
+}
+
+// emitWithRollback 与 updateChain 中的发送相同：先检查回滚再发送当前币种
+func emitWithRollback(s *algorithmSwitcher) bool {
+	rolledBack := s.rollbackCurrentChain()
+	s.sendCurrentChainToKafka()
+	return rolledBack
+}
+
+// 测试切换后连续收不到成功响应时回滚到原币种
+func TestAutoRollbackOnMissingAcks(t *testing.T) {
+	s, clock, writer, store := initRollbackTest()
+
+	for i := 0; i < 3; i++ {
+		if emitWithRollback(s) {
+			t.Fatalf("rollback before %d failed acks", configData.AutoRollback.MaxFailedAcks)
+		}
+		// 失败的响应不算确认
+		s.switchRollback.responseReceived(&KafkaMessage{ID: float64(s.commandID), Result: false})
+		clock.advance(60 * time.Second)
+	}
+	if !emitWithRollback(s) {
+		t.Fatalf("should roll back after %d failed acks", configData.AutoRollback.MaxFailedAcks)
+	}
+	if s.currentChainName != "btc" {
+		t.Errorf("current chain after rollback expected: btc, got: %s", s.currentChainName)
+	}
+
+	var command KafkaCommand
+	if err := json.Unmarshal(writer.messages[len(writer.messages)-1].Value, &command); err != nil {
+		t.Fatal(err)
+	}
+	if command.ChainName != "btc" {
+		t.Errorf("command after rollback expected: btc, got: %s", command.ChainName)
+	}
+	if len(store.records) != 1 || store.records[0] != [2]string{"bcc", "btc"} {
+		t.Errorf("history records expected: [[bcc btc]], got: %v", store.records)
+	}
+
+	// 回滚本身不再跟踪
+	for i := 0; i < 5; i++ {
+		clock.advance(60 * time.Second)
+		if emitWithRollback(s) {
+			t.Fatalf("rollback should not be tracked")
+		}
+	}
+	if s.currentChainName != "btc" {
+		t.Errorf("current chain expected to stay btc, got: %s", s.currentChainName)
+	}
+}
+
+// 测试收到成功响应后不再回滚
+func TestAutoRollbackAcknowledged(t *testing.T) {
+	s, clock, _, store := initRollbackTest()
+
+	emitWithRollback(s)
+	clock.advance(60 * time.Second)
+	emitWithRollback(s)
+	s.switchRollback.responseReceived(&KafkaMessage{ID: float64(s.commandID), Result: true})
+
+	for i := 0; i < 5; i++ {
+		clock.advance(60 * time.Second)
+		if emitWithRollback(s) {
+			t.Fatalf("acknowledged switch should not be rolled back")
+		}
+	}
+	if s.currentChainName != "bcc" || len(store.records) != 0 {
+		t.Errorf("chain expected: bcc without history records, got: %s, %v", s.currentChainName, store.records)
+	}
+}
+
+// 测试回滚后交替轮询和发送时，在 HoldSeconds 内不会再次切换到回滚离开的币种
+func TestAutoRollbackHold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"algorithms":{"sha256":{"coins":{` +
+			`"BCH":{"dispatch_hashrate":150,"dispatchable_hashrate":200},` +
+			`"BTC":{"dispatch_hashrate":100,"dispatchable_hashrate":120}}}}}`))
+	}))
+	defer server.Close()
+
+	s, clock, _, store := initRollbackTest()
+	configData.ChainDispatchAPI = server.URL
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	configData.AutoRollback.HoldSeconds = 3600
+	httpClient = server.Client()
+	s.switchRollback = newRollbackTracker(clock, configData.AutoRollback)
+	s.currentChainName = "btc"
+
+	// 接口始终认为bcc最优，sserver始终不响应
+	for i := 0; i < 30; i++ {
+		s.updateCurrentChain()
+		emitWithRollback(s)
+		clock.advance(60 * time.Second)
+	}
+	if s.currentChainName != "btc" {
+		t.Errorf("current chain expected to stay btc after rollback, got: %s", s.currentChainName)
+	}
+	if len(store.records) != 2 || store.records[0] != [2]string{"btc", "bcc"} || store.records[1] != [2]string{"bcc", "btc"} {
+		t.Fatalf("one switch and one rollback expected, got: %v", store.records)
+	}
+	_, coins, _ := s.fetchAlgorithmCoins()
+	if decision, reasons := s.decideChain(coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionHeldByRollback ||
+		decision.NewChain != "btc" || len(reasons) != 1 {
+		t.Errorf("switch to bcc expected to be held by rollback, got: %s %s %v", decision.Outcome, decision.NewChain, reasons)
+	}
+
+	// 过了 HoldSeconds 后照常切换
+	clock.advance(time.Hour)
+	s.updateCurrentChain()
+	if s.currentChainName != "bcc" || len(store.records) != 3 {
+		t.Errorf("switch to bcc expected after hold, current: %s, records: %v", s.currentChainName, store.records)
+	}
+}
+
+// 测试未开启时不跟踪
+func TestAutoRollbackDisabled(t *testing.T) {
+	if newRollbackTracker(&fakeClock{}, AutoRollbackConfig{}) != nil {
+		t.Errorf("tracker should be nil when AutoRollback is disabled")
+	}
+	var tracker *rollbackTracker
+	tracker.beginSwitch("btc", "bcc")
+	tracker.commandSent(KafkaCommand{ID: uint64(1), ChainName: "bcc"})
+	if _, _, _, rollback := tracker.checkRollback(); rollback {
+		t.Errorf("disabled tracker should not roll back")
+	}
+}
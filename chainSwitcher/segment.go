@@ -0,0 +1,41 @@
+package main
+
+import "fmt"
+
+// checkSwitchSegments 检查 SwitchSegments 中的分段名非空且不重复
+func checkSwitchSegments(segments []string) error {
+	seen := make(map[string]bool, len(segments))
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("empty segment name")
+		}
+		if seen[segment] {
+			return fmt.Errorf("duplicate segment %s", segment)
+		}
+		seen[segment] = true
+	}
+	return nil
+}
+
+// currentChainCommands 构造当前币种的命令：未配置 SwitchSegments 时为一条面向所有sserver的命令，
+// 否则每个分段一条带有 segment 的命令，只有这些分段的用户会切换
+func (s *algorithmSwitcher) currentChainCommands() []KafkaCommand {
+	rolloutPercent := s.canary.commandPercent(s.currentChainName)
+	segments := s.config.SwitchSegments
+	if len(segments) == 0 {
+		segments = []string{""}
+	}
+
+	commands := make([]KafkaCommand, 0, len(segments))
+	for _, segment := range segments {
+		s.commandID++
+		command := s.newKafkaCommand(s.commandID, s.currentChainName)
+		command.Segment = segment
+		command.RolloutPercent = rolloutPercent
+		if serverIDs := s.canary.commandServerIDs(rolloutPercent); serverIDs != nil {
+			command.TargetServerIDs = serverIDs
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
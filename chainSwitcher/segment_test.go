@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// 测试配置了 SwitchSegments 时每个分段发送一条带有分段名的命令
+func TestSegmentCommands(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.SwitchSegments = []string{"eu", "us"}
+	s.currentChainName = "bcc"
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+
+	if err := s.sendCurrentChainToKafka(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []KafkaCommand{
+		{Version: kafkaSchemaVersion, ID: float64(1), Type: "sserver_cmd", Action: "auto_switch_chain", ChainName: "bcc", Segment: "eu"},
+		{Version: kafkaSchemaVersion, ID: float64(2), Type: "sserver_cmd", Action: "auto_switch_chain", ChainName: "bcc", Segment: "us"},
+	}
+	if commands := decodeCommands(t, writer); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("segment commands expected: %+v, got: %+v", expected, commands)
+	}
+
+	// 默认不分段，命令中不带 segment
+	configData.SwitchSegments = nil
+	writer.messages = nil
+	s.sendCurrentChainToKafka()
+	if len(writer.messages) != 1 {
+		t.Fatalf("one command expected, got: %d", len(writer.messages))
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(writer.messages[0].Value, &fields)
+	if _, ok := fields["segment"]; ok {
+		t.Errorf("segment should be omitted: %s", writer.messages[0].Value)
+	}
+}
+
+// 测试检查 SwitchSegments 配置
+func TestCheckSwitchSegments(t *testing.T) {
+	if err := checkSwitchSegments([]string{"eu", "us"}); err != nil {
+		t.Errorf("valid segments failed: %v", err)
+	}
+	for _, segments := range [][]string{{"eu", ""}, {"eu", "eu"}} {
+		if err := checkSwitchSegments(segments); err == nil {
+			t.Errorf("invalid segments %v should fail", segments)
+		}
+	}
+}
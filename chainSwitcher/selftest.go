@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/segmentio/kafka-go"
+)
+
+// selfTestTimeout 自检中数据库及Kafka阶段的超时时间
+const selfTestTimeout = 10 * time.Second
+
+// selfTestTable 自检使用的临时表，只在当前连接中可见，连接关闭后自动删除
+const selfTestTable = "chain_switcher_selftest"
+
+// selfTestStore 自检中写入并读回切换记录的存储
+type selfTestStore interface {
+	writeRecord(algorithm string, prevChain string, currChain string, apiResult []byte) error
+	readRecord() (currChain string, apiResult []byte, err error)
+}
+
+// sqlSelfTestStore 使用数据库临时表的 selfTestStore
+type sqlSelfTestStore struct {
+	ctx     context.Context
+	conn    *sql.Conn
+	dialect historyDialect
+}
+
+// newSQLSelfTestStore 在db的一个连接上创建临时表
+func newSQLSelfTestStore(ctx context.Context, db *sql.DB, dialect historyDialect) (*sqlSelfTestStore, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(ctx, dialect.createTableSQL(selfTestTable, true))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sqlSelfTestStore{ctx, conn, dialect}, nil
+}
+
+func (s *sqlSelfTestStore) writeRecord(algorithm string, prevChain string, currChain string, apiResult []byte) error {
+	_, err := s.conn.ExecContext(s.ctx, s.dialect.insertSQL(selfTestTable), algorithm, prevChain, currChain, "selftest", apiResult)
+	return err
+}
+
+func (s *sqlSelfTestStore) readRecord() (currChain string, apiResult []byte, err error) {
+	err = s.conn.QueryRowContext(s.ctx, s.dialect.lastRecordSQL(selfTestTable)).Scan(&currChain, &apiResult)
+	return
+}
+
+func (s *sqlSelfTestStore) close() {
+	s.conn.Close()
+}
+
+// selectChains 解析接口响应并选择币种（不发送）
+// 子池模式下返回各子池的币种，否则返回的map中只有一项，键为空字符串
+func (s *algorithmSwitcher) selectChains(body []byte) (map[string]string, error) {
+	chains := make(map[string]string)
+
+	if s.config.SubPoolDispatch {
+		records, err := parseSubPoolDispatch(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, errors.New("no sub-pool found")
+		}
+		for subPool, record := range records {
+			chains[subPool] = s.selectBestChain(record.Coins)
+		}
+		return chains, nil
+	}
+
+	chainDispatchRecord := new(ChainDispatchRecord)
+	err := json.Unmarshal(body, chainDispatchRecord)
+	if err != nil {
+		return nil, err
+	}
+	algorithms, ok := chainDispatchRecord.Algorithms[s.config.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("cannot find algorithm %s", s.config.Algorithm)
+	}
+	chains[""] = s.selectBestChain(algorithms.Coins)
+	return chains, nil
+}
+
+// selfTestRecord 将选择结果作为一条切换记录写入store并读回比较
+func (s *algorithmSwitcher) selfTestRecord(store selfTestStore, chains map[string]string) error {
+	apiResult, _ := json.Marshal(chains)
+	currChain := chains[""]
+	if s.config.SubPoolDispatch {
+		currChain = chains[subPoolNames(chains)[0]]
+	}
+
+	err := store.writeRecord(s.config.Algorithm, "", currChain, apiResult)
+	if err != nil {
+		return fmt.Errorf("write record failed: %s", err)
+	}
+	readChain, readResult, err := store.readRecord()
+	if err != nil {
+		return fmt.Errorf("read record failed: %s", err)
+	}
+	if readChain != currChain || string(readResult) != string(apiResult) {
+		return fmt.Errorf("record mismatch, wrote: %s %s, read: %s %s", currChain, apiResult, readChain, readResult)
+	}
+	return nil
+}
+
+// selfTestKafka 向自检topic发送一条消息，并在timeout内读回
+func selfTestKafka(writer kafkaWriter, read func(ctx context.Context) (kafka.Message, error), timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	payload := []byte(`{"type":"chain_switcher_selftest","id":` + strconv.FormatInt(time.Now().UnixNano(), 10) + `}`)
+	err := writer.WriteMessages(ctx, kafka.Message{Value: payload})
+	if err != nil {
+		return fmt.Errorf("write kafka failed: %s", err)
+	}
+	for {
+		m, err := read(ctx)
+		if err != nil {
+			return fmt.Errorf("read kafka failed: %s", err)
+		}
+		if string(m.Value) == string(payload) {
+			return nil
+		}
+	}
+}
+
+// runSelfTest 依次检查各算法的接口请求和币种选择、数据库读写和Kafka收发，输出各阶段的结果，全部成功时返回true
+func runSelfTest() bool {
+	ok := true
+	report := func(stage string, err error, detail ...interface{}) {
+		if err != nil {
+			ok = false
+			glog.Error("[selftest] ", stage, ": FAILED, ", err)
+			return
+		}
+		glog.Info(append([]interface{}{"[selftest] ", stage, ": OK "}, detail...)...)
+	}
+
+	// 各算法选出的币种，选择失败的算法不写入数据库
+	selected := make(map[*algorithmSwitcher]map[string]string)
+	for _, s := range switchers {
+		algorithm := " (" + s.config.Algorithm + ")"
+		body, err := s.fetchChainDispatchAPI()
+		report("dispatch API"+algorithm, err, len(body), " bytes")
+		if err != nil {
+			report("selection"+algorithm, errors.New("skipped, dispatch API failed"))
+			continue
+		}
+		chains, err := s.selectChains(body)
+		report("selection"+algorithm, err, chains)
+		if err == nil {
+			selected[s] = chains
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	dialect, err := newHistoryDialect(configData.DBDriver)
+	var db *sql.DB
+	if err == nil {
+		db, err = sql.Open(configData.DBDriver, configData.MySQL.ConnStr)
+	}
+	if err == nil {
+		defer db.Close()
+		err = db.PingContext(ctx)
+	}
+	report(configData.DBDriver+" connect", err)
+	if err == nil && len(selected) > 0 {
+		var store *sqlSelfTestStore
+		store, err = newSQLSelfTestStore(ctx, db, dialect)
+		if err == nil {
+			defer store.close()
+			for _, s := range switchers {
+				if chains, ok := selected[s]; ok && err == nil {
+					err = s.selfTestRecord(store, chains)
+				}
+			}
+		}
+		report(configData.DBDriver+" record", err, "temporary table ", selfTestTable)
+	} else {
+		report(configData.DBDriver+" record", errors.New("skipped, "+configData.DBDriver+" or selection failed"))
+	}
+
+	if configData.Kafka.SelfTestTopic == "" {
+		glog.Info("[selftest] kafka: SKIPPED, Kafka.SelfTestTopic is empty")
+		return ok
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   configData.Kafka.Brokers,
+		Topic:     configData.Kafka.SelfTestTopic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+		Dialer:    kafkaDialer,
+	})
+	defer reader.Close()
+	reader.SetOffset(kafka.LastOffset)
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  configData.Kafka.Brokers,
+		Topic:    configData.Kafka.SelfTestTopic,
+		Balancer: &kafka.LeastBytes{},
+		Dialer:   kafkaDialer,
+	})
+	defer writer.Close()
+	report("kafka", selfTestKafka(writer, reader.ReadMessage, selfTestTimeout), "topic ", configData.Kafka.SelfTestTopic)
+
+	return ok
+}
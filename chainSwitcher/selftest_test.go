@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// memSelfTestStore 内存中的 selfTestStore
+type memSelfTestStore struct {
+	currChain string
+	apiResult []byte
+	corrupt   bool
+}
+
+func (s *memSelfTestStore) writeRecord(algorithm string, prevChain string, currChain string, apiResult []byte) error {
+	s.currChain = currChain
+	s.apiResult = apiResult
+	return nil
+}
+
+func (s *memSelfTestStore) readRecord() (string, []byte, error) {
+	if s.corrupt {
+		return s.currChain, []byte("{}"), nil
+	}
+	return s.currChain, s.apiResult, nil
+}
+
+// 测试自检中的币种选择及记录读写
+func TestSelfTestSelectionAndRecord(t *testing.T) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.FailSafeChain = "btc"
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc"}
+
+	chains, err := s.selectChains([]byte(`{"algorithms":{"sha256":{"coins":["BCH","BTC"]}}}`))
+	if err != nil {
+		t.Fatalf("selectChains failed: %s", err)
+	}
+	if !reflect.DeepEqual(chains, map[string]string{"": "bcc"}) {
+		t.Errorf("selected chains expected: map[:bcc], got: %v", chains)
+	}
+	if _, err := s.selectChains([]byte(`{"algorithms":{"scrypt":{"coins":["LTC"]}}}`)); err == nil {
+		t.Errorf("missing algorithm should fail")
+	}
+
+	store := &memSelfTestStore{}
+	if err := s.selfTestRecord(store, chains); err != nil {
+		t.Errorf("selfTestRecord failed: %s", err)
+	}
+	if store.currChain != "bcc" || string(store.apiResult) != `{"":"bcc"}` {
+		t.Errorf("wrong record written: %s %s", store.currChain, store.apiResult)
+	}
+	store.corrupt = true
+	if err := s.selfTestRecord(store, chains); err == nil {
+		t.Errorf("mismatched record should fail")
+	}
+
+	// 子池模式
+	configData.SubPoolDispatch = true
+	chains, err = s.selectChains([]byte(`{"pool2":{"coins":["BTC"]},"pool1":{"coins":["BCH"]}}`))
+	if err != nil {
+		t.Fatalf("selectChains of sub-pools failed: %s", err)
+	}
+	store = &memSelfTestStore{}
+	if err := s.selfTestRecord(store, chains); err != nil {
+		t.Errorf("selfTestRecord of sub-pools failed: %s", err)
+	}
+	if !reflect.DeepEqual(chains, map[string]string{"pool1": "bcc", "pool2": "btc"}) {
+		t.Errorf("selected sub-pool chains expected: map[pool1:bcc pool2:btc], got: %v", chains)
+	}
+	if store.currChain != "bcc" {
+		t.Errorf("record of first sub-pool expected: bcc, got: %s", store.currChain)
+	}
+}
+
+// 测试自检中的Kafka收发
+func TestSelfTestKafka(t *testing.T) {
+	writer := &mockWriter{}
+	read := func(ctx context.Context) (kafka.Message, error) {
+		if len(writer.messages) == 0 {
+			<-ctx.Done()
+			return kafka.Message{}, ctx.Err()
+		}
+		m := writer.messages[0]
+		writer.messages = writer.messages[1:]
+		return m, nil
+	}
+
+	writer.messages = []kafka.Message{{Value: []byte("old message")}}
+	if err := selfTestKafka(writer, read, time.Second); err != nil {
+		t.Errorf("selfTestKafka failed: %s", err)
+	}
+
+	if err := selfTestKafka(&mockWriter{err: errors.New("broker down")}, read, time.Second); err == nil {
+		t.Errorf("write failure should fail")
+	}
+	if err := selfTestKafka(&mockWriter{}, read, 50*time.Millisecond); err == nil {
+		t.Errorf("missing message should time out")
+	}
+}
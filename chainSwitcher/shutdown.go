@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// handleShutdownSignals 收到SIGTERM或SIGINT时取消返回的ctx，使主循环在当前轮询结束后退出
+// 收到信号后恢复默认的信号处理，再次收到信号时立即退出
+func handleShutdownSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		glog.Info("received ", sig, ", shutting down after the current iteration...")
+		cancel()
+	}()
+	return ctx
+}
+
+// shutdown 写入各算法剩余的决策记录，发送Kafka中尚未发送的消息，并关闭Kafka及数据库连接
+func shutdown() {
+	for _, s := range switchers {
+		s.close()
+	}
+	if historyDB != nil {
+		if err := historyDB.Close(); err != nil {
+			glog.Error("close ", configData.DBDriver, " failed: ", err)
+		}
+	}
+	glog.Info("shutdown completed")
+	glog.Flush()
+}
+
+// closeKafkaWriter 关闭Kafka producer，关闭前会发送完缓冲中的消息
+func closeKafkaWriter(name string, writer kafkaWriter) {
+	closer, ok := writer.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		glog.Error("close kafka ", name, " producer failed: ", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+// closingWriter 记录是否被关闭的 mockWriter
+type closingWriter struct {
+	mockWriter
+	closed bool
+}
+
+func (w *closingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+// 测试退出时写入队列中剩余的决策记录并关闭Kafka producer
+func TestShutdown(t *testing.T) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	switchers = []*algorithmSwitcher{s}
+	store := &memDecisionStore{}
+	s.journal = newDecisionJournal(configData.Algorithm, store)
+	go s.journal.run()
+	s.journal.record(DecisionRecord{Outcome: decisionSwitched, OldChain: "btc", NewChain: "bcc"})
+	s.journal.record(DecisionRecord{Outcome: decisionUnchanged, OldChain: "bcc", NewChain: "bcc"})
+
+	controller := &closingWriter{}
+	s.controllerProducer = controller
+	historyDB = nil
+
+	shutdown()
+	if len(store.records) != 2 {
+		t.Errorf("pending decisions expected to be written before exit, got: %d", len(store.records))
+	}
+	if !controller.closed {
+		t.Errorf("controller producer expected to be closed")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// HashrateSmoothingConfig ChainLimits 中矿机算力的指数平滑（EMA）配置
+type HashrateSmoothingConfig struct {
+	Alpha        float64 // 新值的权重（0~1]，为0时不平滑
+	ResetPercent float64 // 新值偏离平滑值超过该百分比时直接采用新值，为0时不重置
+}
+
+// checkHashrateSmoothing 检查算力平滑配置
+func checkHashrateSmoothing(conf HashrateSmoothingConfig) error {
+	if conf.Alpha < 0 || conf.Alpha > 1 {
+		return fmt.Errorf("Alpha %v should be within 0-1", conf.Alpha)
+	}
+	if conf.ResetPercent < 0 {
+		return fmt.Errorf("ResetPercent %v should not be negative", conf.ResetPercent)
+	}
+	return nil
+}
+
+// hashrateSmoother 各币种矿机算力的指数平滑值
+// 子池模式下各子池共用同一个币种的平滑值，因为读取的是同一份矿机算力
+type hashrateSmoother struct {
+	lock         sync.Mutex
+	alpha        float64
+	resetPercent float64
+	values       map[string]float64 // 币种名 -> 平滑后的算力
+}
+
+// newHashrateSmoother 创建算力平滑，Alpha为0时返回nil
+func newHashrateSmoother(conf HashrateSmoothingConfig) *hashrateSmoother {
+	if conf.Alpha == 0 {
+		return nil
+	}
+	return &hashrateSmoother{
+		alpha:        conf.Alpha,
+		resetPercent: conf.ResetPercent,
+		values:       make(map[string]float64),
+	}
+}
+
+// update 加入币种的一个新的算力值，返回平滑后的算力
+// 第一个值直接采用；新值偏离平滑值超过 ResetPercent 时认为是真实的阶跃（如大矿工加入），直接采用新值
+func (s *hashrateSmoother) update(chain string, hashrate float64) float64 {
+	if s == nil {
+		return hashrate
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	smoothed, reset := s.next(chain, hashrate)
+	if reset {
+		glog.Info("hashrate of chain ", chain, " jumped: ", formatHashrate(s.values[chain]), " -> ", formatHashrate(hashrate),
+			", deviation > ", strconv.FormatFloat(s.resetPercent, 'f', -1, 64), "%, smoothing reset")
+	}
+	s.values[chain] = smoothed
+	return smoothed
+}
+
+// peek 返回加入新的算力值后的平滑值，但不保存，用于 /preview 等不应影响平滑状态的场合
+func (s *hashrateSmoother) peek(chain string, hashrate float64) float64 {
+	if s == nil {
+		return hashrate
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	smoothed, _ := s.next(chain, hashrate)
+	return smoothed
+}
+
+// next 计算加入新的算力值后的平滑值，reset 表示偏离超过 ResetPercent 而直接采用了新值，调用者须持有锁
+func (s *hashrateSmoother) next(chain string, hashrate float64) (smoothed float64, reset bool) {
+	smoothed, ok := s.values[chain]
+	if !ok {
+		return hashrate, false
+	}
+	if s.resetPercent > 0 && deviationPercent(hashrate, smoothed) > s.resetPercent {
+		return hashrate, true
+	}
+	return s.alpha*hashrate + (1-s.alpha)*smoothed, false
+}
+
+// deviationPercent value 相对 base 的偏离百分比，base为0时只要value不为0即视为无穷大
+func deviationPercent(value float64, base float64) float64 {
+	if base == 0 {
+		if value == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(value-base) / math.Abs(base) * 100
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// 测试小幅波动的算力被平滑
+func TestHashrateSmoothingGradual(t *testing.T) {
+	smoother := newHashrateSmoother(HashrateSmoothingConfig{Alpha: 0.5, ResetPercent: 50})
+
+	series := []float64{100, 110, 90, 120}
+	expected := []float64{100, 105, 97.5, 108.75}
+	for i, hashrate := range series {
+		if smoothed := smoother.update("bcc", hashrate); math.Abs(smoothed-expected[i]) > 1e-9 {
+			t.Errorf("step %d: smoothed %v expected, got: %v", i, expected[i], smoothed)
+		}
+	}
+	// 各币种独立平滑
+	if smoothed := smoother.update("bsv", 10); smoothed != 10 {
+		t.Errorf("first value of another chain should be taken as is, got: %v", smoothed)
+	}
+}
+
+// 测试偏离超过 ResetPercent 的阶跃直接采用新值，之后继续平滑
+func TestHashrateSmoothingStep(t *testing.T) {
+	smoother := newHashrateSmoother(HashrateSmoothingConfig{Alpha: 0.1, ResetPercent: 50})
+	smoother.update("bcc", 100)
+	smoother.update("bcc", 100)
+
+	if smoothed := smoother.update("bcc", 300); smoothed != 300 {
+		t.Errorf("step change should snap to 300, got: %v", smoothed)
+	}
+	if smoothed := smoother.update("bcc", 310); math.Abs(smoothed-301) > 1e-9 {
+		t.Errorf("smoothing should continue from the snapped value, expected 301, got: %v", smoothed)
+	}
+
+	// 不配置 ResetPercent 时阶跃同样被平滑
+	smoother = newHashrateSmoother(HashrateSmoothingConfig{Alpha: 0.1})
+	smoother.update("bcc", 100)
+	if smoothed := smoother.update("bcc", 300); math.Abs(smoothed-120) > 1e-9 {
+		t.Errorf("step change should be smoothed without ResetPercent, expected 120, got: %v", smoothed)
+	}
+}
+
+// 测试未开启时原样返回算力，以及配置检查
+func TestHashrateSmoothingDisabled(t *testing.T) {
+	smoother := newHashrateSmoother(HashrateSmoothingConfig{})
+	if smoother != nil {
+		t.Fatalf("smoother should be nil when Alpha is 0")
+	}
+	if smoothed := smoother.update("bcc", 123); smoothed != 123 {
+		t.Errorf("disabled smoothing should return raw value, got: %v", smoothed)
+	}
+
+	for _, conf := range []HashrateSmoothingConfig{{Alpha: -0.1}, {Alpha: 1.5}, {Alpha: 0.5, ResetPercent: -1}} {
+		if err := checkHashrateSmoothing(conf); err == nil {
+			t.Errorf("config %+v should be rejected", conf)
+		}
+	}
+	if err := checkHashrateSmoothing(HashrateSmoothingConfig{Alpha: 0.3, ResetPercent: 20}); err != nil {
+		t.Errorf("valid config rejected: %s", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/golang/glog"
+)
+
+// defaultStateTableSuffix 未配置 StateTable 时，在切换记录表名后追加的后缀
+const defaultStateTableSuffix = "_state"
+
+// StateStore 重启后需要恢复的运行状态的存储，每个算法一条
+type StateStore interface {
+	// LoadState 读取算法最后发送的币种和命令id，没有记录时 found 为false
+	LoadState(algorithm string) (chain string, commandID uint64, found bool, err error)
+	// SaveState 写入或更新算法最后发送的币种和命令id
+	SaveState(algorithm string, chain string, commandID uint64) error
+}
+
+// sqlStateStore 使用 database/sql 的 StateStore，与切换记录共用数据库连接
+type sqlStateStore struct {
+	db      *sql.DB
+	table   string
+	dialect historyDialect
+}
+
+// newSQLStateStore 建表（若不存在）
+func newSQLStateStore(db *sql.DB, dialect historyDialect, table string) *sqlStateStore {
+	_, err := db.Exec(dialect.createStateTableSQL(table))
+	if err != nil {
+		// 没有建表权限时表可能已由DBA建好，由之后的读取判断表是否可用
+		glog.Warning("create table ", table, " failed: ", err)
+	}
+	return &sqlStateStore{db, table, dialect}
+}
+
+func (s *sqlStateStore) LoadState(algorithm string) (chain string, commandID uint64, found bool, err error) {
+	err = s.db.QueryRow(s.dialect.loadStateSQL(s.table), algorithm).Scan(&chain, &commandID)
+	if err == sql.ErrNoRows {
+		return "", 0, false, nil
+	}
+	return chain, commandID, err == nil, err
+}
+
+func (s *sqlStateStore) SaveState(algorithm string, chain string, commandID uint64) error {
+	_, err := s.db.Exec(s.dialect.saveStateSQL(s.table), algorithm, chain, commandID)
+	return err
+}
+
+// stateTable 运行状态表名，支持 {algorithm} 占位符
+func (s *algorithmSwitcher) stateTable() string {
+	if s.config.StateTable != "" {
+		return historyTableName(s.config.StateTable, s.config.Algorithm)
+	}
+	return historyTableName(s.config.MySQL.Table, s.config.Algorithm) + defaultStateTableSuffix
+}
+
+// restoreState 启动时恢复命令id，使重启后的命令id不与重启前的重复；非子池模式下同时恢复当前币种
+// 恢复的币种使第一次轮询不被当作切换，且选出的币种未变化时不重新发送命令
+func (s *algorithmSwitcher) restoreState() {
+	if s.stateStore == nil {
+		return
+	}
+	chain, id, found, err := s.stateStore.LoadState(s.config.Algorithm)
+	if err != nil {
+		glog.Error("load state failed, start without it: ", err)
+		return
+	}
+	if !found {
+		glog.Info("no saved state of algorithm ", s.config.Algorithm)
+		return
+	}
+
+	s.commandID = id
+	if !s.config.SubPoolDispatch && s.isKnownChain(chain) {
+		s.chainLock.Lock()
+		s.currentChainName = chain
+		s.chainLock.Unlock()
+		s.restoredChain = chain
+	}
+	glog.Info("restored state, chain: ", chain, ", command id: ", id)
+}
+
+// saveState 发送成功后保存最后发送的币种和命令id，失败时只输出错误日志
+func (s *algorithmSwitcher) saveState(chain string) {
+	if s.stateStore == nil {
+		return
+	}
+	if err := s.stateStore.SaveState(s.config.Algorithm, chain, s.commandID); err != nil {
+		glog.Error("save state failed: ", err)
+	}
+}
+
+// skipRestoredEmit 启动后第一次发送时，选出的币种与恢复的币种相同则跳过发送
+func (s *algorithmSwitcher) skipRestoredEmit() bool {
+	chain := s.restoredChain
+	if chain == "" {
+		return false
+	}
+	s.restoredChain = ""
+	if chain != s.currentChainName {
+		return false
+	}
+	glog.Info("Chain ", chain, " unchanged since last run, skip sending after restart")
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// memStateStore 保存在内存中的运行状态
+type memStateStore struct {
+	chain     string
+	commandID uint64
+	found     bool
+}
+
+func (s *memStateStore) LoadState(algorithm string) (string, uint64, bool, error) {
+	return s.chain, s.commandID, s.found, nil
+}
+
+func (s *memStateStore) SaveState(algorithm string, chain string, commandID uint64) error {
+	s.chain, s.commandID, s.found = chain, commandID, true
+	return nil
+}
+
+// 测试MySQL运行状态表的读写
+func TestSQLStateStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("create sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS `chain_switcher_record_state`(")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT curr_chain, command_id FROM `chain_switcher_record_state` WHERE algorithm = ?")).
+		WithArgs("sha256").WillReturnRows(sqlmock.NewRows([]string{"curr_chain", "command_id"}))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `chain_switcher_record_state`(algorithm,curr_chain,command_id) VALUES(?,?,?) ON DUPLICATE KEY UPDATE")).
+		WithArgs("sha256", "bcc", uint64(42)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT curr_chain, command_id FROM `chain_switcher_record_state`")).
+		WithArgs("sha256").WillReturnRows(sqlmock.NewRows([]string{"curr_chain", "command_id"}).AddRow("bcc", 42))
+
+	store := newSQLStateStore(db, mysqlDialect{}, "chain_switcher_record_state")
+	if _, _, found, err := store.LoadState("sha256"); found || err != nil {
+		t.Errorf("no state expected, got: %v, %v", found, err)
+	}
+	if err := store.SaveState("sha256", "bcc", 42); err != nil {
+		t.Errorf("SaveState failed: %s", err)
+	}
+	chain, id, found, err := store.LoadState("sha256")
+	if !found || err != nil || chain != "bcc" || id != 42 {
+		t.Errorf("state bcc/42 expected, got: %s, %d, %v, %v", chain, id, found, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+// 测试重启后恢复命令id和币种：选出的币种未变化时不重新发送，变化时发送并继续递增命令id
+func TestRestoreState(t *testing.T) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	store := &memStateStore{chain: "bcc", commandID: 41, found: true}
+	s.stateStore = store
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.acks = nil
+	s.currentChainName = ""
+
+	s.restoreState()
+	if s.commandID != 41 || s.currentChainName != "bcc" {
+		t.Fatalf("restored state bcc/41 expected, got: %s/%d", s.currentChainName, s.commandID)
+	}
+
+	guard := newClockGuard(&fakeClock{time.Unix(1500000000, 0)}, "sha256", 5*time.Second, false)
+	if !s.emitChains(guard) || len(writer.messages) != 0 {
+		t.Errorf("unchanged chain should not be sent after restart, sent: %d", len(writer.messages))
+	}
+
+	// 之后按发送间隔照常发送
+	s.currentChainName = "btc"
+	if !s.emitChains(guard) {
+		t.Fatalf("emit failed")
+	}
+	commands := decodeCommands(t, writer)
+	if len(commands) != 1 || commands[0].ChainName != "btc" || commands[0].ID != float64(42) {
+		t.Errorf("command 42 of btc expected, got: %+v", commands)
+	}
+	if store.chain != "btc" || store.commandID != 42 {
+		t.Errorf("saved state btc/42 expected, got: %s/%d", store.chain, store.commandID)
+	}
+}
+
+// 测试恢复的币种与选出的币种不同时第一次发送照常进行
+func TestRestoreStateChanged(t *testing.T) {
+	configData = &ChainSwitcherConfig{Algorithm: "sha256"}
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BCH": "bcc"}
+	s.stateStore = &memStateStore{chain: "bcc", commandID: 7, found: true}
+	writer := &mockWriter{}
+	s.controllerProducer = writer
+	s.acks = nil
+
+	s.restoreState()
+	s.currentChainName = "btc"
+	guard := newClockGuard(&fakeClock{time.Unix(1500000000, 0)}, "sha256", 5*time.Second, false)
+	if !s.emitChains(guard) {
+		t.Fatalf("emit failed")
+	}
+	if commands := decodeCommands(t, writer); len(commands) != 1 || commands[0].ChainName != "btc" || commands[0].ID != float64(8) {
+		t.Errorf("command 8 of btc expected, got: %+v", commands)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// 粘性衰减函数
+const (
+	// stickinessDecayLinear 所需优势在 DecaySeconds 内线性降为0
+	stickinessDecayLinear = "linear"
+	// stickinessDecayExponential 所需优势每经过 DecaySeconds 减半
+	stickinessDecayExponential = "exponential"
+)
+
+// StickinessConfig 当前币种的粘性配置
+// 刚切换后，其他币种的 dispatch_hashrate 需超过当前币种 InitialMarginPercent 才能再次切换，所需优势随停留时间衰减
+type StickinessConfig struct {
+	InitialMarginPercent float64
+	DecaySeconds         time.Duration
+	DecayFunction        string
+}
+
+// chainStickiness 新币种为 challenger 时使用的粘性配置
+// 若 ChainNameMap 中为该币种配置了 switch_threshold_percent，则以其代替全局的 InitialMarginPercent
+func (s *algorithmSwitcher) chainStickiness(challenger string) StickinessConfig {
+	conf := s.config.Stickiness
+	if threshold, ok := s.config.ChainSwitchThresholds[challenger]; ok {
+		conf.InitialMarginPercent = threshold
+	}
+	return conf
+}
+
+// chainSwitchThreshold 新币种为 challenger 时使用的固定切换阈值（百分比）
+// 配置了 SwitchThresholdPercent 时，ChainNameMap 中该币种的 switch_threshold_percent 同样代替它；未配置时保持不限制
+func (s *algorithmSwitcher) chainSwitchThreshold(challenger string) float64 {
+	if s.config.SwitchThresholdPercent <= 0 {
+		return 0
+	}
+	if threshold, ok := s.config.ChainSwitchThresholds[challenger]; ok {
+		return threshold
+	}
+	return s.config.SwitchThresholdPercent
+}
+
+// requiredSwitchMargin 距上次切换 elapsed 后，切换所需的优势（百分比）
+func requiredSwitchMargin(conf StickinessConfig, elapsed time.Duration) float64 {
+	if conf.InitialMarginPercent <= 0 {
+		return 0
+	}
+	if conf.DecaySeconds <= 0 {
+		return conf.InitialMarginPercent
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	ratio := float64(elapsed) / float64(conf.DecaySeconds*time.Second)
+	if conf.DecayFunction == stickinessDecayExponential {
+		return conf.InitialMarginPercent * math.Pow(0.5, ratio)
+	}
+	if ratio >= 1 {
+		return 0
+	}
+	return conf.InitialMarginPercent * (1 - ratio)
+}
+
+// keepCurrentChain 判断新币种相对当前币种的算力优势是否不足，不足时保持当前币种
+// 当前币种或新币种不在接口结果中时总是允许切换
+func (s *algorithmSwitcher) keepCurrentChain(coins CoinList, currentChain string, bestChain string, margin float64) bool {
+	if margin <= 0 || currentChain == "" || currentChain == bestChain {
+		return false
+	}
+	_, hashrates := s.chainHashrates(coins)
+	currentHashrate, ok := hashrates[currentChain]
+	if !ok {
+		return false
+	}
+	bestHashrate, ok := hashrates[bestChain]
+	if !ok {
+		return false
+	}
+	return bestHashrate < currentHashrate*(1+margin/100)
+}
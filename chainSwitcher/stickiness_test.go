@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试不同停留时间下切换所需的优势
+func TestRequiredSwitchMargin(t *testing.T) {
+	linear := StickinessConfig{InitialMarginPercent: 20, DecaySeconds: 600, DecayFunction: stickinessDecayLinear}
+	exponential := StickinessConfig{InitialMarginPercent: 20, DecaySeconds: 600, DecayFunction: stickinessDecayExponential}
+
+	cases := []struct {
+		conf     StickinessConfig
+		elapsed  time.Duration
+		expected float64
+	}{
+		{linear, 0, 20},
+		{linear, 150 * time.Second, 15},
+		{linear, 300 * time.Second, 10},
+		{linear, 600 * time.Second, 0},
+		{linear, time.Hour, 0},
+		{exponential, 0, 20},
+		{exponential, 600 * time.Second, 10},
+		{exponential, 1200 * time.Second, 5},
+		{StickinessConfig{}, 0, 0},
+		{StickinessConfig{InitialMarginPercent: 5}, time.Hour, 5},
+	}
+	for _, c := range cases {
+		if margin := requiredSwitchMargin(c.conf, c.elapsed); math.Abs(margin-c.expected) > 1e-9 {
+			t.Errorf("margin of %+v after %s expected: %f, got: %f", c.conf, c.elapsed, c.expected, margin)
+		}
+	}
+}
+
+// 测试优势不足时保持当前币种
+func TestKeepCurrentChain(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc", "BSV": "bsv"}
+
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":110},"BTC":{"dispatch_hashrate":100}}}`), &record)
+
+	if !s.keepCurrentChain(record.Coins, "btc", "bcc", 20) {
+		t.Errorf("10%% advantage should not beat 20%% margin")
+	}
+	if s.keepCurrentChain(record.Coins, "btc", "bcc", 5) {
+		t.Errorf("10%% advantage should beat 5%% margin")
+	}
+	if s.keepCurrentChain(record.Coins, "btc", "bcc", 0) {
+		t.Errorf("no stickiness should always allow switching")
+	}
+	if s.keepCurrentChain(record.Coins, "bsv", "bcc", 20) {
+		t.Errorf("current chain missing in API result should allow switching")
+	}
+
+	// 没有算力信息时不生效
+	json.Unmarshal([]byte(`{"coins":["BCH","BTC"]}`), &record)
+	if s.keepCurrentChain(record.Coins, "btc", "bcc", 20) {
+		t.Errorf("stickiness should not apply without hashrates")
+	}
+}
+
+// 测试 ChainNameMap 中按币种配置的切换阈值
+func TestChainSwitchThresholds(t *testing.T) {
+	configJSON := []byte(`{
+		"ChainNameMap": {
+			"BTC": "btc",
+			"BCH": {"chain": "bcc", "switch_threshold_percent": 5},
+			"BSV": {"chain": "bsv", "switch_threshold_percent": 50}
+		},
+		"Stickiness": {"InitialMarginPercent": 20}
+	}`)
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	if err := json.Unmarshal(configJSON, configData); err != nil {
+		t.Fatalf("parse config failed: %s", err)
+	}
+	thresholds, err := parseChainSwitchThresholds(configJSON)
+	if err != nil {
+		t.Fatalf("parse thresholds failed: %s", err)
+	}
+	configData.ChainSwitchThresholds = thresholds
+
+	expectedNames := map[string]string{"BTC": "btc", "BCH": "bcc", "BSV": "bsv"}
+	for coin, chain := range expectedNames {
+		if configData.ChainNameMap[coin] != chain {
+			t.Errorf("chain of %s expected: %s, got: %s", coin, chain, configData.ChainNameMap[coin])
+		}
+	}
+
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":110},"BSV":{"dispatch_hashrate":130},"BTC":{"dispatch_hashrate":100}}}`), &record)
+
+	// bcc 的阈值5%低于全局的20%，10%的优势足以切换
+	if s.keepCurrentChain(record.Coins, "btc", "bcc", requiredSwitchMargin(s.chainStickiness("bcc"), 0)) {
+		t.Errorf("10%% advantage should beat per-coin 5%% threshold")
+	}
+	// bsv 的阈值50%高于全局的20%，30%的优势不足以切换
+	if !s.keepCurrentChain(record.Coins, "btc", "bsv", requiredSwitchMargin(s.chainStickiness("bsv"), 0)) {
+		t.Errorf("30%% advantage should not beat per-coin 50%% threshold")
+	}
+	// btc 未配置阈值，使用全局的20%
+	if !s.keepCurrentChain(record.Coins, "bcc", "btc", requiredSwitchMargin(s.chainStickiness("btc"), 0)) {
+		t.Errorf("chain without override should use global threshold")
+	}
+	if margin := requiredSwitchMargin(s.chainStickiness("btc"), 0); margin != 20 {
+		t.Errorf("margin of btc expected: 20, got: %f", margin)
+	}
+
+	// 映射到同一币种名的阈值冲突
+	_, err = parseChainSwitchThresholds([]byte(`{"ChainNameMap": {
+		"BCH": {"chain": "bcc", "switch_threshold_percent": 5},
+		"BCHN": {"chain": "bcc", "switch_threshold_percent": 10}}}`))
+	if err == nil {
+		t.Errorf("conflicting thresholds should be rejected")
+	}
+	if err := json.Unmarshal([]byte(`{"ChainNameMap": {"BCH": {"switch_threshold_percent": 5}}}`), new(ChainSwitcherConfig)); err == nil {
+		t.Errorf("object entry without chain should be rejected")
+	}
+}
+
+// 测试固定的切换阈值阻止切换时，说明中包含新币种和当前币种的算力
+func TestDecideChainFixedThreshold(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc"}
+	configData.Stickiness = StickinessConfig{InitialMarginPercent: 5}
+	s.lastSwitchTime = time.Now().Add(-24 * time.Hour)
+
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":102},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	decision, reasons := s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now())
+	if decision.Outcome != decisionHeldByStickiness || decision.NewChain != "btc" ||
+		len(reasons) != 1 || !strings.Contains(reasons[0], "102 vs 100") {
+		t.Errorf("2%% advantage should be held by 5%% threshold, got: %s %s %v", decision.Outcome, decision.NewChain, reasons)
+	}
+
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":106},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	if decision, _ = s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.NewChain != "bcc" {
+		t.Errorf("6%% advantage should beat 5%% threshold, got: %s", decision.NewChain)
+	}
+}
+
+// 测试 SwitchThresholdPercent：阈值内保持当前币种，超过阈值时切换，当前币种不在接口结果中时立即切换
+func TestDecideChainSwitchThreshold(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc", "BSV": "bsv"}
+	configData.SwitchThresholdPercent = 5
+	s.lastSwitchTime = time.Now().Add(-24 * time.Hour)
+
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":104},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	decision, reasons := s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now())
+	if decision.Outcome != decisionHeldByThreshold || decision.NewChain != "btc" ||
+		len(reasons) != 1 || !strings.Contains(reasons[0], "104 vs 100") {
+		t.Errorf("4%% advantage should be held by 5%% threshold, got: %s %s %v", decision.Outcome, decision.NewChain, reasons)
+	}
+
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":106},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	if decision, _ = s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionSwitched || decision.NewChain != "bcc" {
+		t.Errorf("6%% advantage should beat 5%% threshold, got: %s %s", decision.Outcome, decision.NewChain)
+	}
+
+	// 当前币种bsv不在接口结果中
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":101},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	if decision, _ = s.decideChain(record.Coins, "bsv", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionSwitched || decision.NewChain != "bcc" {
+		t.Errorf("missing incumbent should switch immediately, got: %s %s", decision.Outcome, decision.NewChain)
+	}
+
+	// 同时配置粘性时两者都须满足
+	configData.Stickiness = StickinessConfig{InitialMarginPercent: 10}
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":106},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	if decision, _ = s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionHeldByStickiness {
+		t.Errorf("6%% advantage should be held by 10%% stickiness, got: %s", decision.Outcome)
+	}
+}
+
+// 测试 ChainNameMap 中的 switch_threshold_percent 代替新币种的 SwitchThresholdPercent
+func TestDecideChainSwitchThresholdPerChain(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc", "BSV": "bsv"}
+	configData.SwitchThresholdPercent = 5
+	configData.ChainSwitchThresholds = map[string]float64{"bcc": 2}
+	s.lastSwitchTime = time.Now().Add(-24 * time.Hour)
+
+	// bcc 的阈值为2%，4%的优势足以切换
+	var record ChainRecord
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":104},"BSV":{"dispatch_hashrate":104},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	if decision, _ := s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionSwitched {
+		t.Errorf("4%% advantage should beat 2%% threshold of bcc, got: %s", decision.Outcome)
+	}
+	// bsv 未单独配置，仍使用全局的5%
+	decision, reasons := s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bsv", time.Now())
+	if decision.Outcome != decisionHeldByThreshold || len(reasons) != 1 || !strings.Contains(reasons[0], "threshold: 5.00%") {
+		t.Errorf("4%% advantage of bsv should be held by global 5%% threshold, got: %s %v", decision.Outcome, reasons)
+	}
+
+	// bcc 的阈值高于全局值时同样生效
+	configData.ChainSwitchThresholds = map[string]float64{"bcc": 10}
+	json.Unmarshal([]byte(`{"coins":{"BCH":{"dispatch_hashrate":106},"BTC":{"dispatch_hashrate":100}}}`), &record)
+	decision, reasons = s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now())
+	if decision.Outcome != decisionHeldByThreshold || len(reasons) != 2 || !strings.Contains(reasons[0], "threshold: 10.00%") {
+		t.Errorf("6%% advantage should be held by 10%% threshold of bcc, got: %s %v", decision.Outcome, reasons)
+	}
+
+	// 未配置 SwitchThresholdPercent 时 switch_threshold_percent 只代替 InitialMarginPercent
+	configData.SwitchThresholdPercent = 0
+	if decision, _ = s.decideChain(record.Coins, "btc", s.lastSwitchTime, "bcc", time.Now()); decision.Outcome != decisionHeldByStickiness {
+		t.Errorf("6%% advantage should be held by 10%% stickiness of bcc, got: %s", decision.Outcome)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 子池模式（SubPoolDispatch）下，ChainDispatchAPI 返回各子池的推荐币种：
+// {"<subpool>": {"coins": ["BCH", "BTC"]}, ...}
+// 每个子池独立选择币种，并发送带有子池名的切换命令。
+
+// parseSubPoolDispatch 解析子池模式下的ChainDispatchAPI响应
+func parseSubPoolDispatch(body []byte) (map[string]ChainRecord, error) {
+	records := make(map[string]ChainRecord)
+	err := json.Unmarshal(body, &records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// subPoolNames 返回排序后的子池名，使命令的发送顺序固定
+func subPoolNames(chains map[string]string) []string {
+	names := make([]string, 0, len(chains))
+	for subPool := range chains {
+		names = append(names, subPool)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subPoolChainCount 已知币种的子池数
+func (s *algorithmSwitcher) subPoolChainCount() int {
+	s.subPoolChainsLock.Lock()
+	defer s.subPoolChainsLock.Unlock()
+	return len(s.subPoolChains)
+}
+
+// subPoolCommands 为每个子池构造一条切换命令
+func (s *algorithmSwitcher) subPoolCommands() []KafkaCommand {
+	s.subPoolChainsLock.Lock()
+	defer s.subPoolChainsLock.Unlock()
+
+	commands := make([]KafkaCommand, 0, len(s.subPoolChains))
+	for _, subPool := range subPoolNames(s.subPoolChains) {
+		s.commandID++
+		command := s.newKafkaCommand(s.commandID, s.subPoolChains[subPool])
+		command.SubPool = subPool
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// sendSubPoolChainsToKafka 发送各子池的币种，返回第一个发送失败的错误
+func (s *algorithmSwitcher) sendSubPoolChainsToKafka() (sendErr error) {
+	for _, command := range s.subPoolCommands() {
+		if err := s.writeCommand(command); err != nil && sendErr == nil {
+			sendErr = err
+		}
+	}
+	return
+}
+
+// setSubPoolChain 设置子池的币种，返回原来的币种
+func (s *algorithmSwitcher) setSubPoolChain(subPool string, chain string) (oldChain string) {
+	s.subPoolChainsLock.Lock()
+	defer s.subPoolChainsLock.Unlock()
+
+	oldChain = s.subPoolChains[subPool]
+	s.subPoolChains[subPool] = chain
+	return
+}
+
+// recordSubPoolSwitch 记录子池的切换，algorithm 列为 "<Algorithm>/<子池名>"
+func (s *algorithmSwitcher) recordSubPoolSwitch(subPool string, oldChain string, newChain string, reason string, apiResult []byte) {
+	err := s.historyStore.InsertRecord(s.config.Algorithm+"/"+subPool, oldChain, newChain, reason, apiResult)
+	if err != nil {
+		glog.Fatal(s.config.DBDriver, " error: ", err.Error())
+	}
+}
+
+func (s *algorithmSwitcher) updateSubPoolChains() {
+	body, err := s.fetchChainDispatchAPI()
+	if err != nil {
+		return
+	}
+
+	records, err := parseSubPoolDispatch(body)
+	if err != nil {
+		glog.Error("Parse Result Failed: ", err)
+		return
+	}
+	if len(records) == 0 {
+		glog.Error("No sub-pool found, json: ", string(body))
+		return
+	}
+
+	factors, err := s.fetchDispatchFactors()
+	if err != nil {
+		return
+	}
+
+	// 按子池名排序，使连续几次轮询的日志可以逐行对比
+	names := make([]string, 0, len(records))
+	for subPool := range records {
+		names = append(names, subPool)
+	}
+	sort.Strings(names)
+
+	for _, subPool := range names {
+		record := records[subPool]
+		glog.Info("Coins of sub-pool ", subPool, " (dispatch/dispatchable): ", coinScores(record.Coins))
+		coins := s.applyPreferences(s.combineDispatchFactors(record.Coins, factors))
+		bestChain := s.selectBestChain(coins)
+		if bestChain == "" || s.refuseUnsupportedChain(subPool, bestChain) {
+			continue
+		}
+		s.updateChainMetrics(subPool, coins, bestChain)
+
+		oldChain := s.setSubPoolChain(subPool, bestChain)
+		if oldChain != bestChain {
+			glog.Info(s.logPrefix(), "Best Chain of sub-pool ", subPool, " Changed: ", oldChain, " -> ", bestChain)
+			s.recordSubPoolSwitch(subPool, oldChain, bestChain, s.autoSwitchReason(coins, oldChain), body)
+		} else if ok, suppressed := s.unchangedLog.allow(subPool); ok {
+			glog.Info(s.logPrefix(), "Best Chain of sub-pool ", subPool, " not Changed: ", bestChain, suppressedLogSuffix(suppressed))
+		}
+	}
+	s.updateTime = time.Now().Unix()
+	lastSuccessfulPollTimestamp.WithLabelValues(s.config.Algorithm).Set(float64(s.updateTime))
+}
+
+// failSafeSubPools API失效时将所有已知子池切换到FailSafeChain
+func (s *algorithmSwitcher) failSafeSubPools(now int64) {
+	s.subPoolChainsLock.Lock()
+	names := subPoolNames(s.subPoolChains)
+	s.subPoolChainsLock.Unlock()
+
+	for _, subPool := range names {
+		oldChain := s.setSubPoolChain(subPool, s.config.FailSafeChain)
+		glog.Info(s.logPrefix(), "Fail Safe Switch of sub-pool ", subPool, ": ", oldChain, " -> ", s.config.FailSafeChain,
+			", lastUpdateTime: ", time.Unix(s.updateTime, 0).UTC().Format("2006-01-02 15:04:05"),
+			", currentTime: ", time.Unix(now, 0).UTC().Format("2006-01-02 15:04:05"))
+
+		apiResult := ActionFailSafeSwitch{
+			"fail_safe_switch",
+			s.updateTime,
+			now,
+			oldChain,
+			s.config.FailSafeChain}
+		bytes, _ := json.Marshal(apiResult)
+		s.recordSubPoolSwitch(subPool, oldChain, s.config.FailSafeChain, switchReasonFailSafe, bytes)
+	}
+	s.sendSubPoolChainsToKafka()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 测试解析子池模式的接口响应
+func TestParseSubPoolDispatch(t *testing.T) {
+	body := []byte(`{"pool-a":{"coins":["BCH","BTC"]},"pool-b":{"coins":["BTC"]}}`)
+	records, err := parseSubPoolDispatch(body)
+	if err != nil {
+		t.Fatalf("parse sub-pool response failed: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("sub-pool number expected: 2, got: %d", len(records))
+	}
+	if coins := records["pool-a"].Coins; len(coins) != 2 || coins[0].Coin != "BCH" || coins[1].Coin != "BTC" {
+		t.Errorf("wrong coins of pool-a: %v", coins)
+	}
+	if coins := records["pool-b"].Coins; len(coins) != 1 || coins[0].Coin != "BTC" {
+		t.Errorf("wrong coins of pool-b: %v", coins)
+	}
+
+	if _, err := parseSubPoolDispatch([]byte(`{"pool-a":["BCH"]}`)); err == nil {
+		t.Errorf("parse wrong shape should fail")
+	}
+}
+
+// 测试每个子池发送一条带子池名的命令
+func TestSubPoolCommands(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.FailSafeChain = "btc"
+	configData.ChainNameMap = map[string]string{"BTC": "btc", "BCH": "bcc"}
+
+	records, _ := parseSubPoolDispatch([]byte(`{"pool-b":{"coins":["BTC","BCH"]},"pool-a":{"coins":["BCH","BTC"]},"pool-c":{"coins":["XXX"]}}`))
+	for subPool, record := range records {
+		s.setSubPoolChain(subPool, s.selectBestChain(record.Coins))
+	}
+
+	commands := s.subPoolCommands()
+	if len(commands) != 3 {
+		t.Fatalf("command number expected: 3, got: %d", len(commands))
+	}
+	expected := []struct{ subPool, chain string }{{"pool-a", "bcc"}, {"pool-b", "btc"}, {"pool-c", "btc"}}
+	for i, e := range expected {
+		if commands[i].SubPool != e.subPool || commands[i].ChainName != e.chain {
+			t.Errorf("command %d expected: %s -> %s, got: %s -> %s", i, e.subPool, e.chain, commands[i].SubPool, commands[i].ChainName)
+		}
+		if commands[i].ID != uint64(i+1) {
+			t.Errorf("command %d id expected: %d, got: %v", i, i+1, commands[i].ID)
+		}
+	}
+
+	bytes, _ := json.Marshal(commands[0])
+	var fields map[string]interface{}
+	json.Unmarshal(bytes, &fields)
+	if fields["subpool_name"] != "pool-a" {
+		t.Errorf("subpool_name missing in command json: %s", string(bytes))
+	}
+
+	// 全局模式的命令不带子池名
+	bytes, _ = json.Marshal(s.newKafkaCommand(1, "btc"))
+	fields = nil
+	json.Unmarshal(bytes, &fields)
+	if _, ok := fields["subpool_name"]; ok {
+		t.Errorf("subpool_name should be omitted in global command: %s", string(bytes))
+	}
+}
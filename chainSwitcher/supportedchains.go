@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// chainSupported 判断sserver是否支持该币种，未配置 SupportedChains 时认为都支持
+func (s *algorithmSwitcher) chainSupported(chain string) bool {
+	if len(s.config.SupportedChains) == 0 {
+		return true
+	}
+	for _, supported := range s.config.SupportedChains {
+		if supported == chain {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSupportedChains 检查 FailSafeChain 在 SupportedChains 中，并对 ChainNameMap 中不支持的币种名给出警告
+func (s *algorithmSwitcher) checkSupportedChains() error {
+	if len(s.config.SupportedChains) == 0 {
+		return nil
+	}
+	if s.config.FailSafeChain != "" && !s.chainSupported(s.config.FailSafeChain) {
+		return fmt.Errorf("FailSafeChain %s is not in SupportedChains [%s]",
+			s.config.FailSafeChain, strings.Join(s.config.SupportedChains, ", "))
+	}
+	for coin, chain := range s.config.ChainNameMap {
+		if !s.chainSupported(chain) {
+			glog.Warning("ChainNameMap ", coin, ": ", chain, " is not in SupportedChains, it will never be selected")
+		}
+	}
+	return nil
+}
+
+// refuseUnsupportedChain 选中的币种不在 SupportedChains 中时记录错误并返回true，此时不应切换到该币种
+// subPool 仅用于日志，非子池模式下为空字符串
+func (s *algorithmSwitcher) refuseUnsupportedChain(subPool string, chain string) bool {
+	if s.chainSupported(chain) {
+		return false
+	}
+	target := chain
+	if subPool != "" {
+		target = chain + " (sub-pool " + subPool + ")"
+	}
+	glog.Error("Switch to ", target, " refused: not in SupportedChains [", strings.Join(s.config.SupportedChains, ", "), "]")
+	return true
+}
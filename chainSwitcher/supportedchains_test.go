@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+// 测试选中的币种是否在 SupportedChains 中
+func TestChainSupported(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	if !s.chainSupported("bsv") || s.refuseUnsupportedChain("", "bsv") {
+		t.Errorf("all chains should be supported without SupportedChains")
+	}
+
+	configData.SupportedChains = []string{"btc", "bcc"}
+	for _, chain := range []string{"btc", "bcc"} {
+		if s.refuseUnsupportedChain("", chain) {
+			t.Errorf("supported chain %s should not be refused", chain)
+		}
+	}
+	if !s.refuseUnsupportedChain("", "bsv") || !s.refuseUnsupportedChain("pool1", "bsv") {
+		t.Errorf("unsupported chain bsv should be refused")
+	}
+}
+
+// 测试检查 FailSafeChain 是否在 SupportedChains 中
+func TestCheckSupportedChains(t *testing.T) {
+	configData = new(ChainSwitcherConfig)
+	s := newAlgorithmSwitcher(configData)
+	configData.FailSafeChain = "bsv"
+	configData.ChainNameMap = ChainNameMap{"BTC": "btc", "BSV": "bsv"}
+	if err := s.checkSupportedChains(); err != nil {
+		t.Errorf("no SupportedChains should pass, got: %v", err)
+	}
+
+	configData.SupportedChains = []string{"btc", "bcc"}
+	if err := s.checkSupportedChains(); err == nil {
+		t.Errorf("unsupported FailSafeChain should fail")
+	}
+
+	// ChainNameMap 中不支持的币种名只给出警告
+	configData.FailSafeChain = "btc"
+	if err := s.checkSupportedChains(); err != nil {
+		t.Errorf("supported FailSafeChain should pass, got: %v", err)
+	}
+}
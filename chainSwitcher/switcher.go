@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/snappy"
+)
+
+// AlgorithmConfig 同一进程中切换的一个算法，为空的项使用顶层配置中的同名项
+type AlgorithmConfig struct {
+	Algorithm             string
+	ChainDispatchAPI      string
+	ControllerTopic       string
+	ProcessorTopic        string
+	StagingTopic          string
+	FailSafeChain         string
+	ChainNameMap          ChainNameMap
+	ChainSwitchThresholds map[string]float64 `json:"-"` // 由 ChainNameMap 解析
+}
+
+// algorithmSwitcher 一个算法的币种切换，各算法有独立的当前币种、命令id、Kafka topic及各项切换限制
+// 同一进程中的各算法共用数据库连接池、HTTP客户端及Prometheus指标（以 algorithm 标签区分）
+type algorithmSwitcher struct {
+	// config 本算法的配置，Algorithms 中的项已合并到顶层配置的副本中
+	config *ChainSwitcherConfig
+
+	updateTime int64
+	commandID  uint64
+
+	// chainLock 保护 currentChainName 和 lastSwitchTime 的写入，其他goroutine（如 /preview）通过 chainSnapshot 读取
+	chainLock        sync.Mutex
+	currentChainName string
+	// lastSwitchTime 上次切换币种的时间
+	lastSwitchTime time.Time
+
+	// stagingPromoted 是否已从预发布提升到生产环境
+	stagingPromoted bool
+
+	controllerProducer kafkaWriter
+	stagingProducer    kafkaWriter
+	processorConsumer  *kafka.Reader
+
+	historyStore HistoryStore
+	// stateStore 运行状态的存储，未开启 PersistState 时为nil
+	stateStore StateStore
+	// restoredChain 启动时恢复的币种，第一次发送前与选出的币种相同时不再发送，之后清空
+	restoredChain string
+	// journal 决策记录，未开启 DecisionJournal 时为nil
+	journal *decisionJournal
+
+	// switchLimit 每日切换次数限制
+	switchLimit *switchLimiter
+	// unchangedLog “币种未变化”日志的限制，未配置 UnchangedLogIntervalSeconds 时为nil，每次都输出
+	unchangedLog *unchangedLogLimiter
+	// switchRollback 自动回滚跟踪，未开启时为nil
+	switchRollback *rollbackTracker
+	// acks 响应跟踪，未配置 AckTimeoutSeconds 时为nil
+	acks *ackTracker
+	// canary 灰度切换，未开启时为nil
+	canary *canaryRollout
+	// hashrateSmoothing 矿机算力的平滑，未开启时为nil
+	hashrateSmoothing *hashrateSmoother
+
+	// manualOverride 手动指定的币种，为空时自动选择；manualOverrideExpiry 为其过期时间，为零值时一直有效
+	manualOverrideLock   sync.Mutex
+	manualOverride       string
+	manualOverrideExpiry time.Time
+
+	// subPoolChains 各子池的当前币种
+	subPoolChainsLock sync.Mutex
+	subPoolChains     map[string]string
+
+	// expectationLock 保护lastSentChains和expectedOldChains
+	expectationLock sync.Mutex
+	// lastSentChains 最近一次成功发送的币种，子池模式下按子池名区分
+	// 与 currentChainName 等选定的币种不同时，说明选定的币种尚未成功发送
+	lastSentChains map[string]string
+	// expectedOldChains 各命令发送前的币种，即sserver响应中预期的 old_chain_name
+	expectedOldChains map[uint64]string
+
+	// correlationLock 保护currentCorrelationIDs、correlatedSwitches和correlationOrder
+	correlationLock sync.Mutex
+	// currentCorrelationIDs 各子池当前币种的关联id
+	currentCorrelationIDs map[correlatedSwitch]string
+	// correlatedSwitches 最近的切换，键为关联id；correlationOrder 为其生成顺序
+	correlatedSwitches map[string]correlatedSwitch
+	correlationOrder   []string
+
+	// chainMetrics 最近一次轮询时各子池选中币种的算力信息，非子池模式下键为空字符串
+	chainMetricsLock sync.Mutex
+	chainMetrics     map[string]chainMetricsRecord
+
+	// chainDwellLock 保护chainObservedAt、recentChains和currentChainLabel
+	chainDwellLock sync.Mutex
+	// chainObservedAt 上次统计币种停留时间的时刻
+	chainObservedAt time.Time
+	// recentChains 最近使用过的币种，用于识别回退
+	recentChains *chainHistory
+	// currentChainLabel current_chain 指标中值为1的币种，切换时删除该序列
+	currentChainLabel string
+}
+
+// 本进程切换的各算法，启动时创建，之后不再改变
+var switchers []*algorithmSwitcher
+
+// newAlgorithmSwitcher 按算法的配置创建切换及其跟踪状态，Kafka连接及数据库存储由调用者设置
+func newAlgorithmSwitcher(conf *ChainSwitcherConfig) *algorithmSwitcher {
+	recentChainsSize := conf.RecentChainsSize
+	if recentChainsSize <= 0 {
+		recentChainsSize = defaultRecentChainsSize
+	}
+	return &algorithmSwitcher{
+		config:                conf,
+		switchLimit:           newSwitchLimiter(conf.MaxSwitchesPerDay, 24*time.Hour),
+		unchangedLog:          newUnchangedLogLimiter(realClock{}, conf.UnchangedLogIntervalSeconds*time.Second),
+		switchRollback:        newRollbackTracker(realClock{}, conf.AutoRollback),
+		acks:                  newAckTracker(realClock{}, conf.Algorithm, conf.AckTimeoutSeconds*time.Second),
+		canary:                newCanaryRollout(realClock{}, conf.CanaryRollout),
+		hashrateSmoothing:     newHashrateSmoother(conf.HashrateSmoothing),
+		subPoolChains:         make(map[string]string),
+		lastSentChains:        make(map[string]string),
+		expectedOldChains:     make(map[uint64]string),
+		currentCorrelationIDs: make(map[correlatedSwitch]string),
+		correlatedSwitches:    make(map[string]correlatedSwitch),
+		chainMetrics:          make(map[string]chainMetricsRecord),
+		recentChains:          newChainHistory(recentChainsSize),
+	}
+}
+
+// algorithmConfigs 返回各算法的配置：未配置 Algorithms 时只有顶层配置本身，
+// 否则为顶层配置的副本，并以 Algorithms 中各项不为空的值覆盖
+func algorithmConfigs(conf *ChainSwitcherConfig) ([]*ChainSwitcherConfig, error) {
+	if len(conf.Algorithms) == 0 {
+		return []*ChainSwitcherConfig{conf}, nil
+	}
+
+	configs := make([]*ChainSwitcherConfig, 0, len(conf.Algorithms))
+	topics := make(map[string]string) // topic -> 使用该topic的算法
+	for i, algorithm := range conf.Algorithms {
+		if algorithm.Algorithm == "" {
+			return nil, fmt.Errorf("Algorithm of Algorithms[%d] cannot be empty", i)
+		}
+		for _, existing := range configs {
+			if existing.Algorithm == algorithm.Algorithm {
+				return nil, fmt.Errorf("duplicate algorithm %s", algorithm.Algorithm)
+			}
+		}
+
+		algorithmConf := *conf
+		algorithmConf.Algorithms = nil
+		algorithmConf.Algorithm = algorithm.Algorithm
+		if algorithm.ChainDispatchAPI != "" {
+			algorithmConf.ChainDispatchAPI = algorithm.ChainDispatchAPI
+		}
+		if algorithm.ControllerTopic != "" {
+			algorithmConf.Kafka.ControllerTopic = algorithm.ControllerTopic
+		}
+		if algorithm.ProcessorTopic != "" {
+			algorithmConf.Kafka.ProcessorTopic = algorithm.ProcessorTopic
+		}
+		if algorithm.StagingTopic != "" {
+			algorithmConf.Kafka.StagingTopic = algorithm.StagingTopic
+		}
+		if algorithm.FailSafeChain != "" {
+			algorithmConf.FailSafeChain = algorithm.FailSafeChain
+		}
+		if algorithm.ChainNameMap != nil {
+			algorithmConf.ChainNameMap = algorithm.ChainNameMap
+			algorithmConf.ChainSwitchThresholds = algorithm.ChainSwitchThresholds
+		}
+
+		// 各算法须使用不同的topic，否则一个算法的sserver会执行另一个算法的命令
+		algorithmTopics := []string{algorithmConf.Kafka.ControllerTopic, algorithmConf.Kafka.ProcessorTopic}
+		if algorithmConf.Kafka.StagingMode != stagingModeOff {
+			algorithmTopics = append(algorithmTopics, algorithmConf.Kafka.StagingTopic)
+		}
+		for _, topic := range algorithmTopics {
+			if other, ok := topics[topic]; ok && other != algorithmConf.Algorithm {
+				return nil, fmt.Errorf("Kafka topic %s is used by both algorithm %s and %s", topic, other, algorithmConf.Algorithm)
+			}
+			topics[topic] = algorithmConf.Algorithm
+		}
+		configs = append(configs, &algorithmConf)
+	}
+	return configs, nil
+}
+
+// switcherAlgorithms 本进程切换的各算法名，用于日志及错误信息
+func switcherAlgorithms() string {
+	names := make([]string, 0, len(switchers))
+	for _, s := range switchers {
+		names = append(names, s.config.Algorithm)
+	}
+	return strings.Join(names, ", ")
+}
+
+// findSwitcher 按算法名查找切换，只切换一个算法时 algorithm 可以为空
+func findSwitcher(algorithm string) (*algorithmSwitcher, error) {
+	if algorithm == "" {
+		if len(switchers) == 1 {
+			return switchers[0], nil
+		}
+		return nil, fmt.Errorf("algorithm is required, one of: %s", switcherAlgorithms())
+	}
+	for _, s := range switchers {
+		if s.config.Algorithm == algorithm {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("algorithm '%s' is not served by this switcher (%s)", algorithm, switcherAlgorithms())
+}
+
+// switchTo 切换当前币种并记录切换时间
+func (s *algorithmSwitcher) switchTo(chain string, at time.Time) {
+	s.chainLock.Lock()
+	defer s.chainLock.Unlock()
+	s.currentChainName = chain
+	s.lastSwitchTime = at
+}
+
+// chainSnapshot 加锁读取当前币种及上次切换时间
+func (s *algorithmSwitcher) chainSnapshot() (chain string, lastSwitchTime time.Time) {
+	s.chainLock.Lock()
+	defer s.chainLock.Unlock()
+	return s.currentChainName, s.lastSwitchTime
+}
+
+// openKafka 创建本算法的Kafka consumer及producer
+func (s *algorithmSwitcher) openKafka() {
+	s.processorConsumer = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.config.Kafka.Brokers,
+		Topic:     s.config.Kafka.ProcessorTopic,
+		Partition: 0,
+		MinBytes:  128,  // 128B
+		MaxBytes:  10e6, // 10MB
+		Dialer:    kafkaDialer,
+	})
+
+	s.controllerProducer = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:          s.config.Kafka.Brokers,
+		Topic:            s.config.Kafka.ControllerTopic,
+		Balancer:         &kafka.LeastBytes{},
+		CompressionCodec: snappy.NewCompressionCodec(),
+		Dialer:           kafkaDialer,
+	})
+
+	if s.config.Kafka.StagingMode != stagingModeOff {
+		s.stagingProducer = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:          s.config.Kafka.Brokers,
+			Topic:            s.config.Kafka.StagingTopic,
+			Balancer:         &kafka.LeastBytes{},
+			CompressionCodec: snappy.NewCompressionCodec(),
+			Dialer:           kafkaDialer,
+		})
+	}
+}
+
+// close 写入剩余的决策记录，发送Kafka中尚未发送的消息，并关闭本算法的Kafka连接
+func (s *algorithmSwitcher) close() {
+	s.journal.close()
+	closeKafkaWriter("controller", s.controllerProducer)
+	closeKafkaWriter("staging", s.stagingProducer)
+	if s.processorConsumer != nil {
+		if err := s.processorConsumer.Close(); err != nil {
+			glog.Error("close kafka consumer of algorithm ", s.config.Algorithm, " failed: ", err)
+		}
+	}
+}
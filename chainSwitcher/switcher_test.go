@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 测试未配置 Algorithms 时只使用顶层配置
+func TestAlgorithmConfigsSingle(t *testing.T) {
+	conf := &ChainSwitcherConfig{Algorithm: "sha256"}
+	configs, err := algorithmConfigs(conf)
+	if err != nil {
+		t.Fatalf("single algorithm config failed: %s", err)
+	}
+	if len(configs) != 1 || configs[0] != conf {
+		t.Errorf("top-level config expected to be used as is, got: %v", configs)
+	}
+}
+
+// 测试 Algorithms 中不为空的项覆盖顶层配置，且各算法的配置互不影响
+func TestAlgorithmConfigsOverride(t *testing.T) {
+	configJSON := []byte(`{
+		"Algorithm": "sha256",
+		"ChainDispatchAPI": "http://127.0.0.1:8000/sha256",
+		"FailSafeChain": "btc",
+		"ChainNameMap": {"BTC": "btc", "BCH": "bcc"},
+		"MaxSwitchesPerDay": 5,
+		"Kafka": {"ControllerTopic": "BtcManController", "ProcessorTopic": "BtcManProcessor"},
+		"Algorithms": [
+			{"Algorithm": "sha256"},
+			{
+				"Algorithm": "scrypt",
+				"ChainDispatchAPI": "http://127.0.0.1:8000/scrypt",
+				"ControllerTopic": "LtcManController",
+				"ProcessorTopic": "LtcManProcessor",
+				"FailSafeChain": "ltc",
+				"ChainNameMap": {"LTC": "ltc", "DOGE": {"chain": "doge", "switch_threshold_percent": 5}}
+			}
+		]
+	}`)
+	conf := new(ChainSwitcherConfig)
+	if err := json.Unmarshal(configJSON, conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseAlgorithmSwitchThresholds(configJSON, conf.Algorithms); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := algorithmConfigs(conf)
+	if err != nil {
+		t.Fatalf("algorithm configs failed: %s", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("2 configs expected, got: %d", len(configs))
+	}
+	sha256, scrypt := configs[0], configs[1]
+	if sha256.ChainDispatchAPI != conf.ChainDispatchAPI || sha256.Kafka.ControllerTopic != "BtcManController" ||
+		sha256.FailSafeChain != "btc" || sha256.ChainNameMap["BCH"] != "bcc" {
+		t.Errorf("sha256 expected to use the top-level config, got: %+v", sha256)
+	}
+	if scrypt.Algorithm != "scrypt" || scrypt.ChainDispatchAPI != "http://127.0.0.1:8000/scrypt" ||
+		scrypt.Kafka.ControllerTopic != "LtcManController" || scrypt.Kafka.ProcessorTopic != "LtcManProcessor" ||
+		scrypt.FailSafeChain != "ltc" || scrypt.ChainNameMap["DOGE"] != "doge" || scrypt.ChainNameMap["BTC"] != "" {
+		t.Errorf("scrypt overrides expected, got: %+v", scrypt)
+	}
+	if scrypt.ChainSwitchThresholds["doge"] != 5 {
+		t.Errorf("switch threshold of doge expected: 5, got: %v", scrypt.ChainSwitchThresholds)
+	}
+	if scrypt.MaxSwitchesPerDay != 5 || scrypt.Kafka.Brokers != nil || len(scrypt.Algorithms) != 0 {
+		t.Errorf("other items expected to be copied from the top-level config, got: %+v", scrypt)
+	}
+	if conf.Algorithm != "sha256" || conf.Kafka.ControllerTopic != "BtcManController" {
+		t.Errorf("top-level config should not be changed, got: %+v", conf)
+	}
+}
+
+// 测试重复的算法、空的算法名及多个算法共用的topic被拒绝
+func TestAlgorithmConfigsInvalid(t *testing.T) {
+	conf := &ChainSwitcherConfig{Algorithm: "sha256"}
+	conf.Kafka.ControllerTopic = "BtcManController"
+	conf.Kafka.ProcessorTopic = "BtcManProcessor"
+	conf.Kafka.StagingTopic = "BtcManStaging"
+
+	for _, algorithms := range [][]AlgorithmConfig{
+		{{Algorithm: ""}},
+		{{Algorithm: "sha256"}, {Algorithm: "sha256", ControllerTopic: "A", ProcessorTopic: "B"}},
+		{{Algorithm: "sha256"}, {Algorithm: "scrypt"}},
+		{{Algorithm: "sha256"}, {Algorithm: "scrypt", ControllerTopic: "LtcManController"}},
+		{{Algorithm: "sha256"}, {Algorithm: "scrypt", ControllerTopic: "BtcManProcessor", ProcessorTopic: "LtcManProcessor"}},
+	} {
+		conf.Algorithms = algorithms
+		if _, err := algorithmConfigs(conf); err == nil {
+			t.Errorf("algorithms %+v should be rejected", algorithms)
+		}
+	}
+
+	// 未开启预发布模式时不检查 StagingTopic
+	conf.Algorithms = []AlgorithmConfig{{Algorithm: "sha256"},
+		{Algorithm: "scrypt", ControllerTopic: "LtcManController", ProcessorTopic: "LtcManProcessor"}}
+	if _, err := algorithmConfigs(conf); err != nil {
+		t.Errorf("distinct topics should pass, got: %s", err)
+	}
+	conf.Kafka.StagingMode = stagingModeStaging
+	if _, err := algorithmConfigs(conf); err == nil {
+		t.Errorf("shared StagingTopic should be rejected in staging mode")
+	}
+}
+
+// 测试多个算法不能共用 ControllerTopic，无论是显式配置还是沿用顶层配置
+// 这保证一个进程不会向同一组sserver发送两个算法的命令，因而不需要在算法之间仲裁币种
+func TestAlgorithmConfigsSharedControllerTopic(t *testing.T) {
+	conf := &ChainSwitcherConfig{Algorithm: "sha256"}
+	conf.Kafka.ControllerTopic = "BtcManController"
+	conf.Kafka.ProcessorTopic = "BtcManProcessor"
+
+	for _, algorithms := range [][]AlgorithmConfig{
+		{{Algorithm: "sha256"}, {Algorithm: "scrypt", ProcessorTopic: "LtcManProcessor"}},
+		{{Algorithm: "sha256"}, {Algorithm: "scrypt", ControllerTopic: "BtcManController", ProcessorTopic: "LtcManProcessor"}},
+		{{Algorithm: "sha256", ControllerTopic: "SharedController", ProcessorTopic: "BtcManProcessor"},
+			{Algorithm: "scrypt", ControllerTopic: "SharedController", ProcessorTopic: "LtcManProcessor"}},
+	} {
+		conf.Algorithms = algorithms
+		_, err := algorithmConfigs(conf)
+		if err == nil || !strings.Contains(err.Error(), "Controller") {
+			t.Errorf("shared controller topic of %+v should be rejected, got: %v", algorithms, err)
+		}
+	}
+}
+
+// 测试按算法名查找切换
+func TestFindSwitcher(t *testing.T) {
+	sha256 := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "sha256"})
+	scrypt := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "scrypt"})
+	defer func() { switchers = nil }()
+
+	switchers = []*algorithmSwitcher{sha256}
+	if s, err := findSwitcher(""); err != nil || s != sha256 {
+		t.Errorf("the only switcher expected without algorithm, got: %v, %v", s, err)
+	}
+	if _, err := findSwitcher("scrypt"); err == nil {
+		t.Errorf("unknown algorithm should be rejected")
+	}
+
+	switchers = []*algorithmSwitcher{sha256, scrypt}
+	if _, err := findSwitcher(""); err == nil {
+		t.Errorf("algorithm should be required with multiple switchers")
+	}
+	if s, err := findSwitcher("scrypt"); err != nil || s != scrypt {
+		t.Errorf("scrypt switcher expected, got: %v, %v", s, err)
+	}
+}
+
+// 测试各算法的切换状态及指标互相独立
+func TestAlgorithmSwitchersIndependent(t *testing.T) {
+	switchesTotal.Reset()
+	currentChain.Reset()
+	sha256 := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "sha256", MaxSwitchesPerDay: 1})
+	scrypt := newAlgorithmSwitcher(&ChainSwitcherConfig{Algorithm: "scrypt", MaxSwitchesPerDay: 1})
+
+	now := time.Unix(1500000000, 0)
+	sha256.currentChainName = "bcc"
+	sha256.recordSwitchMetrics("btc", "bcc", now)
+	sha256.setCurrentChainMetric("bcc")
+	sha256.switchLimit.record(now)
+	scrypt.currentChainName = "ltc"
+	scrypt.setCurrentChainMetric("ltc")
+
+	if scrypt.currentChainName != "ltc" || sha256.currentChainName != "bcc" {
+		t.Errorf("current chains expected to be independent, got: %s, %s", sha256.currentChainName, scrypt.currentChainName)
+	}
+	if sha256.switchLimit.allow(now) || !scrypt.switchLimit.allow(now) {
+		t.Errorf("switch limit expected to be counted per algorithm")
+	}
+	if v := testutil.ToFloat64(switchesTotal.WithLabelValues("sha256", "bcc")); v != 1 {
+		t.Errorf("sha256 switches to bcc expected: 1, got: %v", v)
+	}
+	if v := testutil.ToFloat64(switchesTotal.WithLabelValues("scrypt", "bcc")); v != 0 {
+		t.Errorf("scrypt switches to bcc expected: 0, got: %v", v)
+	}
+
+	// 一个算法切换时不影响另一个算法的 current_chain
+	sha256.setCurrentChainMetric("btc")
+	if n := testutil.CollectAndCount(currentChain); n != 2 {
+		t.Errorf("one current chain per algorithm expected, got: %d series", n)
+	}
+	if v := testutil.ToFloat64(currentChain.WithLabelValues("scrypt", "ltc")); v != 1 {
+		t.Errorf("scrypt current chain ltc expected: 1, got: %v", v)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// switchLimiter 限制滚动时间窗口内的切换次数
+// /preview 接口会在HTTP服务的goroutine中查询，因此需要加锁
+type switchLimiter struct {
+	lock   sync.Mutex
+	max    int           // 窗口内允许的最大切换次数，为0则不限制
+	window time.Duration // 时间窗口长度
+	times  []time.Time   // 窗口内各次切换的时间，按时间排序
+}
+
+func newSwitchLimiter(max int, window time.Duration) *switchLimiter {
+	return &switchLimiter{max: max, window: window}
+}
+
+// prune 移除窗口外的切换记录，调用者需持有锁
+func (l *switchLimiter) prune(now time.Time) {
+	i := 0
+	for i < len(l.times) && !l.times[i].After(now.Add(-l.window)) {
+		i++
+	}
+	l.times = l.times[i:]
+}
+
+// allow 判断现在是否允许再切换一次
+func (l *switchLimiter) allow(now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.allowLocked(now)
+}
+
+// allowLocked 同 allow，调用者需持有锁
+func (l *switchLimiter) allowLocked(now time.Time) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.prune(now)
+	return len(l.times) < l.max
+}
+
+// record 记录一次切换，同时移除窗口外的记录
+// 不限制次数时 allow 不会移除记录，因此在这里移除，以免记录无限增长
+func (l *switchLimiter) record(t time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(t)
+	l.times = append(l.times, t)
+}
+
+// count 返回窗口内的切换次数
+func (l *switchLimiter) count(now time.Time) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.prune(now)
+	return len(l.times)
+}
+
+// nextAllowed 返回窗口内最早的切换移出窗口的时间，即下次允许切换的时间
+func (l *switchLimiter) nextAllowed(now time.Time) time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.allowLocked(now) || len(l.times) == 0 {
+		return now
+	}
+	return l.times[len(l.times)-l.max].Add(l.window)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试达到切换次数上限，以及窗口滚动后恢复
+func TestSwitchLimiter(t *testing.T) {
+	begin := time.Unix(1500000000, 0)
+	l := newSwitchLimiter(3, 24*time.Hour)
+
+	for i := 0; i < 3; i++ {
+		now := begin.Add(time.Duration(i) * time.Hour)
+		if !l.allow(now) {
+			t.Fatalf("switch %d should be allowed", i)
+		}
+		l.record(now)
+	}
+
+	if l.allow(begin.Add(3 * time.Hour)) {
+		t.Errorf("switch should be suppressed after reaching the cap")
+	}
+	if next := l.nextAllowed(begin.Add(3 * time.Hour)); !next.Equal(begin.Add(24 * time.Hour)) {
+		t.Errorf("next allowed time expected: %s, got: %s", begin.Add(24*time.Hour), next)
+	}
+
+	// 第一次切换移出窗口后，可以再切换一次
+	if !l.allow(begin.Add(24 * time.Hour)) {
+		t.Errorf("switch should be allowed after the window frees up")
+	}
+	if c := l.count(begin.Add(24 * time.Hour)); c != 2 {
+		t.Errorf("switch count in window expected: 2, got: %d", c)
+	}
+}
+
+// 测试不限制切换次数
+func TestSwitchLimiterUnlimited(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	l := newSwitchLimiter(0, 24*time.Hour)
+	for i := 0; i < 100; i++ {
+		l.record(now)
+	}
+	if !l.allow(now) {
+		t.Errorf("switch should always be allowed without a cap")
+	}
+
+	// 窗口外的切换记录同样被移除
+	for i := 1; i <= 100; i++ {
+		l.record(now.Add(time.Duration(i) * time.Hour))
+	}
+	if n := len(l.times); n != 24 {
+		t.Errorf("switches in window expected: 24, got: %d", n)
+	}
+}
@@ -16,11 +16,51 @@ if (empty($c['Kafka']['Brokers']) || in_array('', $c['Kafka']['Brokers'])) {
 }
 $c['Kafka']['ControllerTopic'] = notNullTrim("KafkaControllerTopic");
 $c['Kafka']['ProcessorTopic'] = notNullTrim("KafkaProcessorTopic");
+$c['Kafka']['StagingTopic'] = optionalTrim("KafkaStagingTopic");
+$c['Kafka']['StagingMode'] = optionalTrim("KafkaStagingMode");
+$c['Kafka']['StagingSeconds'] = (int)optionalTrim("KafkaStagingSeconds", 0);
+$c['Kafka']['SelfTestTopic'] = optionalTrim("KafkaSelfTestTopic");
+$c['Kafka']['TLS'] = [
+    'Enabled' => isTrue('KafkaTLS_Enabled'),
+    'CAFile' => optionalTrim('KafkaTLS_CAFile'),
+    'InsecureSkipVerify' => isTrue('KafkaTLS_InsecureSkipVerify'),
+];
+$c['Kafka']['SASL'] = [
+    'Mechanism' => optionalTrim('KafkaSASL_Mechanism'),
+    'Username' => optionalTrim('KafkaSASL_Username'),
+    'Password' => optionalTrim('KafkaSASL_Password'),
+];
 
 
 $c['Algorithm'] = notNullTrim("Algorithm");
 $c['ChainDispatchAPI'] = notNullTrim("ChainDispatchAPI");
+$c['SubPoolDispatch'] = isTrue('SubPoolDispatch');
+$c['AggregateByChain'] = isTrue('AggregateByChain');
+foreach (['dispatch', 'dispatchable'] as $field) {
+    if (optionalTrim("CoinFieldNames_{$field}") != '') {
+        $c['CoinFieldNames'][$field] = optionalTrim("CoinFieldNames_{$field}");
+    }
+}
+$c['ChainDispatchAPITLS'] = [
+    'CertFile' => optionalTrim('ChainDispatchAPITLS_CertFile'),
+    'KeyFile' => optionalTrim('ChainDispatchAPITLS_KeyFile'),
+    'CAFile' => optionalTrim('ChainDispatchAPITLS_CAFile'),
+];
+$c['ChainDispatchAPIRedirect'] = isTrue('ChainDispatchAPIRedirect');
+$c['HTTPTimeoutSeconds'] = (int)optionalTrim('HTTPTimeoutSeconds', 10);
+$c['HTTPRetryCount'] = (int)optionalTrim('HTTPRetryCount', 0);
+$c['HTTPRetryBaseDelayMilliseconds'] = (int)optionalTrim('HTTPRetryBaseDelayMilliseconds', 500);
+$c['DispatchSources'] = [];
+if (optionalTrim('DispatchSources') != '') {
+    $c['DispatchSources'] = json_decode(optionalTrim('DispatchSources'), true);
+    if (!is_array($c['DispatchSources'])) {
+        fatal('wrong JSON in DispatchSources');
+    }
+}
 $c['SwitchIntervalSeconds'] = (int)optionalTrim('SwitchIntervalSeconds', 60);
+$c['PollIntervalSeconds'] = (int)optionalTrim('PollIntervalSeconds', $c['SwitchIntervalSeconds']);
+$c['EmitIntervalSeconds'] = (int)optionalTrim('EmitIntervalSeconds', $c['SwitchIntervalSeconds']);
+$c['UnchangedLogIntervalSeconds'] = (int)optionalTrim('UnchangedLogIntervalSeconds', 0);
 
 $c['FailSafeChain'] = notNullTrim("FailSafeChain");
 $c['FailSafeSeconds'] = (int)optionalTrim('FailSafeSeconds', $c['SwitchIntervalSeconds'] * 10);
@@ -32,12 +72,42 @@ if ($c['ChainNameMap'] === null) {
 if (empty($c['ChainNameMap']) || in_array('', $c['ChainNameMap'])) {
     fatal('ChainNameMap cannot be empty');
 }
+$c['Algorithms'] = [];
+if (optionalTrim('Algorithms') != '') {
+    $c['Algorithms'] = json_decode(optionalTrim('Algorithms'), true);
+    if (!is_array($c['Algorithms'])) {
+        fatal('wrong JSON in Algorithms');
+    }
+}
 
+$c['DBDriver'] = optionalTrim('DBDriver', 'mysql');
 $c['MySQL']['ConnStr'] = notNullTrim("MySQLConnStr");
 $c['MySQL']['Table'] = optionalTrim('MySQLTable', 'chain_switcher_record');
+$c['MySQLMaxOpenConns'] = (int)optionalTrim('MySQLMaxOpenConns', 0);
+$c['MySQLMaxIdleConns'] = (int)optionalTrim('MySQLMaxIdleConns', 0);
+$c['MySQLConnMaxLifetimeSeconds'] = (int)optionalTrim('MySQLConnMaxLifetimeSeconds', 0);
+if (optionalTrim('MySQLExtraColumns') != '') {
+    $c['MySQLExtraColumns'] = json_decode(optionalTrim('MySQLExtraColumns'), true);
+    if (!is_array($c['MySQLExtraColumns'])) {
+        fatal('wrong JSON in MySQLExtraColumns');
+    }
+}
+$c['DecisionJournal'] = isTrue('DecisionJournal');
+$c['DecisionJournalTable'] = optionalTrim('DecisionJournalTable');
+$c['PersistState'] = isTrue('PersistState');
+$c['StateTable'] = optionalTrim('StateTable');
 
 $c['ChainLimits'] = [];
-foreach ($c['ChainNameMap'] as $chain) {
+$chainNames = array_values($c['ChainNameMap']);
+foreach ($c['Algorithms'] as $algorithm) {
+    if (isset($algorithm['ChainNameMap'])) {
+        $chainNames = array_merge($chainNames, array_values($algorithm['ChainNameMap']));
+    }
+}
+foreach ($chainNames as $chain) {
+    if (is_array($chain)) {
+        $chain = $chain['chain'];
+    }
     if (isset($_ENV["ChainLimits_{$chain}_MaxHashrate"])) {
         $c['ChainLimits'][$chain] = [
             'MaxHashrate' => notNullTrim("ChainLimits_{$chain}_MaxHashrate"),
@@ -50,10 +120,66 @@ foreach ($c['ChainNameMap'] as $chain) {
 }
 
 $c['RecordLifetime'] = (int)optionalTrim('RecordLifetime', '60');
+$c['MetricsListenAddr'] = optionalTrim('MetricsListenAddr');
+$c['PprofListenAddr'] = optionalTrim('PprofListenAddr');
+$c['MaxSwitchesPerDay'] = (int)optionalTrim('MaxSwitchesPerDay', 0);
+$c['NotifyWebhookURL'] = optionalTrim('NotifyWebhookURL');
+$c['NotifyFormat'] = optionalTrim('NotifyFormat', 'raw');
+$c['NotifyTemplate'] = optionalTrim('NotifyTemplate');
+$c['SwitchThresholdPercent'] = (float)optionalTrim('SwitchThresholdPercent', 0);
+$c['Stickiness'] = [
+    'InitialMarginPercent' => (float)optionalTrim('Stickiness_InitialMarginPercent', 0),
+    'DecaySeconds' => (int)optionalTrim('Stickiness_DecaySeconds', 0),
+    'DecayFunction' => optionalTrim('Stickiness_DecayFunction', 'linear'),
+];
+$c['ClockJumpThresholdSeconds'] = (int)optionalTrim('ClockJumpThresholdSeconds', 5);
+$c['ClockJumpDeferEmit'] = isTrue('ClockJumpDeferEmit');
+$c['IncludeMetrics'] = isTrue('IncludeMetrics');
+$c['AckTimeoutSeconds'] = (int)optionalTrim('AckTimeoutSeconds', 0);
+$c['DryRun'] = isTrue('DryRun');
+$c['HashrateSmoothing'] = [
+    'Alpha' => (float)optionalTrim('HashrateSmoothing_Alpha', 0),
+    'ResetPercent' => (float)optionalTrim('HashrateSmoothing_ResetPercent', 0),
+];
+$c['CommandEncoding'] = optionalTrim('CommandEncoding', 'json');
+$c['PreferenceWeightsFile'] = optionalTrim('PreferenceWeightsFile');
+$c['PreferenceWeightsReloadSeconds'] = (int)optionalTrim('PreferenceWeightsReloadSeconds', 60);
+$c['SwitchGraceSeconds'] = (int)optionalTrim('SwitchGraceSeconds', 0);
+$c['OverrideAPIUser'] = optionalTrim('OverrideAPIUser');
+$c['OverrideAPIPassword'] = optionalTrim('OverrideAPIPassword');
+if (optionalTrim('SwitchSegments') != '') {
+    $c['SwitchSegments'] = array_map('trim', explode(',', optionalTrim('SwitchSegments')));
+}
+if (optionalTrim('SupportedChains') != '') {
+    $c['SupportedChains'] = array_map('trim', explode(',', optionalTrim('SupportedChains')));
+}
+$c['AutoRollback'] = [
+    'Enabled' => isTrue('AutoRollback_Enabled'),
+    'MaxFailedAcks' => (int)optionalTrim('AutoRollback_MaxFailedAcks', 3),
+    'AckTimeoutSeconds' => (int)optionalTrim('AutoRollback_AckTimeoutSeconds', 30),
+    'HoldSeconds' => (int)optionalTrim('AutoRollback_HoldSeconds', 3600),
+];
+$c['CanaryRollout'] = [
+    'Enabled' => isTrue('CanaryRollout_Enabled'),
+    'Steps' => array_map('intval', explode(',', optionalTrim('CanaryRollout_Steps', '10,50,100'))),
+    'StepSeconds' => (int)optionalTrim('CanaryRollout_StepSeconds', 300),
+];
+if (optionalTrim('CanaryRollout_ServerIDs') != '') {
+    $c['CanaryRollout']['ServerIDs'] = array_map('intval', explode(',', optionalTrim('CanaryRollout_ServerIDs')));
+}
+if (optionalTrim('TargetServerIDs') != '') {
+    $c['TargetServerIDs'] = array_map('intval', explode(',', optionalTrim('TargetServerIDs')));
+}
 
 echo toJSON($c);
 
 hideMySQLPwd($c['MySQL']['ConnStr']);
+if ($c['OverrideAPIPassword'] != '') {
+    $c['OverrideAPIPassword'] = '******';
+}
+if ($c['Kafka']['SASL']['Password'] != '') {
+    $c['Kafka']['SASL']['Password'] = '******';
+}
 outputConfigJSON($c);
 
 function hideMySQLPwd(&$str) {
@@ -19,14 +19,41 @@ foreach ($c['AvailableCoins'] as $coin) {
     }
 }
 
+$c['UserListPageParams'] = [];
+foreach ($c['UserListAPI'] as $coin => $url) {
+    if (!empty($_ENV["UserListPageParam_$coin"])) {
+        $c['UserListPageParams'][$coin] = notNullTrim("UserListPageParam_$coin");
+    }
+}
+
 $c['IntervalSeconds'] = (int)optionalTrim('IntervalSeconds', 10);
 
+$c['UpstreamAPITLS'] = [
+    'CertFile' => optionalTrim('UpstreamAPITLS_CertFile'),
+    'KeyFile' => optionalTrim('UpstreamAPITLS_KeyFile'),
+    'CAFile' => optionalTrim('UpstreamAPITLS_CAFile'),
+];
+$c['UpstreamAPIProxy'] = optionalTrim('UpstreamAPIProxy');
+
+$c['FetchWatchdogSeconds'] = (int)optionalTrim('FetchWatchdogSeconds', 0);
+
 $c['ZKBroker'] = commaSplitTrim('ZKBroker');
 if (empty($c['ZKBroker']) || in_array('', $c['ZKBroker'])) {
     fatal('ZKBroker cannot be empty');
 }
 
 $c['ZKSwitcherWatchDir'] = notNullTrim("ZKSwitcherWatchDir");
+$c['ZKOpTimeoutSeconds'] = (int)optionalTrim('ZKOpTimeoutSeconds', 0);
+$c['ZKDigestAuth'] = optionalTrim('ZKDigestAuth');
+$c['ZKACLMigrateConcurrency'] = (int)optionalTrim('ZKACLMigrateConcurrency', 8);
+$c['ZKPrefetchConcurrency'] = (int)optionalTrim('ZKPrefetchConcurrency', 0);
+$c['ZKSlowWriteMilliseconds'] = (int)optionalTrim('ZKSlowWriteMilliseconds', 0);
+$c['ZKWriteConcurrency'] = (int)optionalTrim('ZKWriteConcurrency', 0);
+$c['ZKBackpressureFactor'] = (float)optionalTrim('ZKBackpressureFactor', 2);
+$c['ZKBackpressureMaxMultiplier'] = (float)optionalTrim('ZKBackpressureMaxMultiplier', 8);
+$c['ZKSnapshotDir'] = optionalTrim('ZKSnapshotDir');
+$c['ZKSnapshotIntervalSeconds'] = (int)optionalTrim('ZKSnapshotIntervalSeconds', 3600);
+$c['ZKSnapshotRetention'] = (int)optionalTrim('ZKSnapshotRetention', 24);
 $c['EnableUserAutoReg'] = isTrue('EnableUserAutoReg');
 
 if ($c['EnableUserAutoReg']) {
@@ -47,14 +74,27 @@ if ($c['EnableUserAutoReg']) {
 
 $c['StratumServerCaseInsensitive'] = isTrue('StratumServerCaseInsensitive');
 $c['ZKUserCaseInsensitiveIndex'] = optionalTrim('ZKUserCaseInsensitiveIndex');
+$c['IgnoredUsers'] = array_values(array_filter(array_map('trim', explode(',', optionalTrim('IgnoredUsers'))), 'notEmpty'));
+$c['IgnoredUserPrefixes'] = array_values(array_filter(array_map('trim', explode(',', optionalTrim('IgnoredUserPrefixes'))), 'notEmpty'));
+$c['RejectDuplicatePUIDs'] = isTrue('RejectDuplicatePUIDs');
 
 $c['EnableAPIServer'] = isTrue('EnableAPIServer');
 if ($c['EnableAPIServer']) {
     $c['ListenAddr'] = notNullTrim("ListenAddr");
     $c['APIUser'] = optionalTrim('APIUser');
     $c['APIPassword'] = optionalTrim('APIPassword');
+    $c['HTTPReadTimeoutSeconds'] = (int)optionalTrim('HTTPReadTimeoutSeconds', 30);
+    $c['HTTPWriteTimeoutSeconds'] = (int)optionalTrim('HTTPWriteTimeoutSeconds', 60);
+    $c['HTTPIdleTimeoutSeconds'] = (int)optionalTrim('HTTPIdleTimeoutSeconds', 120);
+    $c['AuditLogFile'] = optionalTrim('AuditLogFile');
+    $c['MaxConcurrentBulkOps'] = (int)optionalTrim('MaxConcurrentBulkOps', 2);
 }
 
+$c['PprofListenAddr'] = optionalTrim('PprofListenAddr');
+$c['StatsDAddr'] = optionalTrim('StatsDAddr');
+$c['StatsDPrefix'] = optionalTrim('StatsDPrefix');
+$c['StatsDIntervalSeconds'] = (int)optionalTrim('StatsDIntervalSeconds', 10);
+
 $c['EnableCronJob'] = isTrue('EnableCronJob');
 if ($c['EnableCronJob']) {
     $c['CronIntervalSeconds'] = (int)optionalTrim('CronIntervalSeconds', 60);
@@ -65,4 +105,7 @@ echo toJSON($c);
 
 $c['APIUser'] = '******';
 $c['APIPassword'] = '******';
+if ($c['ZKDigestAuth'] != '') {
+    $c['ZKDigestAuth'] = '******';
+}
 outputConfigJSON($c);
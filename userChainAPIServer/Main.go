@@ -2,6 +2,11 @@ package main
 
 import (
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
 
 	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
 	switcherapiserver "github.com/btccom/btcpool-go-modules/userChainAPIServer/switcherAPIServer"
@@ -12,6 +17,18 @@ func main() {
 	configFilePath := flag.String("config", "./config.json", "Path of config file")
 	flag.Parse()
 
+	// 收到SIGHUP时重新加载配置
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		for range signals {
+			_, err := switcherapiserver.ReloadConfig()
+			if err != nil {
+				glog.Error("reload config failed: ", err)
+			}
+		}
+	}()
+
 	go switcherapiserver.Main(*configFilePath)
 	initusercoin.Main(*configFilePath)
 }
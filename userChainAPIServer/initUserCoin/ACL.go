@@ -0,0 +1,150 @@
+package initusercoin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// zkACLMigrateLogInterval 迁移ACL时每处理多少个节点输出一次进度
+const zkACLMigrateLogInterval = 1000
+
+// zkNodeACL 新建Zookeeper节点时使用的ACL，配置了 ZKDigestAuth 时为该用户的digest ACL
+var zkNodeACL = zk.WorldACL(zk.PermAll)
+var zkNodeACLLock sync.RWMutex
+
+// ZKNodeACL 新建Zookeeper节点时使用的ACL
+func ZKNodeACL() []zk.ACL {
+	zkNodeACLLock.RLock()
+	defer zkNodeACLLock.RUnlock()
+	return zkNodeACL
+}
+
+// SetZKNodeACL 设置新建Zookeeper节点时使用的ACL，switcherAPIServer 推迟的写入同样使用该ACL
+func SetZKNodeACL(acl []zk.ACL) {
+	zkNodeACLLock.Lock()
+	zkNodeACL = acl
+	zkNodeACLLock.Unlock()
+}
+
+// NewZKACL 按 ZKDigestAuth（形如“用户名:密码”）生成新建节点使用的ACL，为空时为 world:anyone 的全部权限
+func NewZKACL(digestAuth string) ([]zk.ACL, error) {
+	if digestAuth == "" {
+		return zk.WorldACL(zk.PermAll), nil
+	}
+	parts := strings.SplitN(digestAuth, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("ZKDigestAuth should be user:password")
+	}
+	return zk.DigestACL(zk.PermAll, parts[0], parts[1]), nil
+}
+
+// AddZKDigestAuth 以 ZKDigestAuth 认证Zookeeper连接，使之后可以读写digest ACL的节点，为空时不认证
+func AddZKDigestAuth(conn *zk.Conn, digestAuth string) error {
+	if digestAuth == "" {
+		return nil
+	}
+	return conn.AddAuth("digest", []byte(digestAuth))
+}
+
+// ZKACLMigration ACL迁移的结果
+type ZKACLMigration struct {
+	Total     int      `json:"total"`     // 子节点数
+	Migrated  int      `json:"migrated"`  // 已改为目标ACL的节点数
+	Unchanged int      `json:"unchanged"` // 原本就是目标ACL的节点数
+	Failed    []string `json:"failed"`    // 读取或设置ACL失败的子节点名
+}
+
+// MigrateZKACL 以不超过concurrency的并发将 dir 下所有子节点的ACL设置为 acl
+// 已是目标ACL的节点不再设置，因此可重复执行；单个节点失败时只记录日志并继续
+func MigrateZKACL(conn Zookeeper, dir string, acl []zk.ACL, concurrency int, timeout time.Duration) (*ZKACLMigration, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	dir = strings.TrimSuffix(dir, "/")
+	var children []string
+	err := RunZKOp(timeout, func() (err error) {
+		children, _, err = conn.Children(dir)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.Info("migrating ACL of ", len(children), " nodes in ", dir)
+
+	result := &ZKACLMigration{Total: len(children), Failed: []string{}}
+	var resultLock sync.Mutex
+	var waitGroup sync.WaitGroup
+	jobs := make(chan string)
+
+	for i := 0; i < concurrency; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for child := range jobs {
+				migrated, err := migrateNodeACL(conn, dir+"/"+child, acl, timeout)
+
+				resultLock.Lock()
+				if err != nil {
+					glog.Error("migrate ACL of ", dir+"/"+child, " failed: ", err)
+					result.Failed = append(result.Failed, child)
+				} else if migrated {
+					result.Migrated++
+				} else {
+					result.Unchanged++
+				}
+				if done := result.Migrated + result.Unchanged + len(result.Failed); done%zkACLMigrateLogInterval == 0 {
+					glog.Info("migrating ACL: ", done, "/", result.Total)
+				}
+				resultLock.Unlock()
+			}
+		}()
+	}
+	for _, child := range children {
+		jobs <- child
+	}
+	close(jobs)
+	waitGroup.Wait()
+
+	glog.Info("migrate ACL finished, migrated: ", result.Migrated, ", unchanged: ", result.Unchanged,
+		", failed: ", len(result.Failed))
+	return result, nil
+}
+
+// migrateNodeACL 节点的ACL与目标不同时设置为目标ACL，返回是否做了修改
+func migrateNodeACL(conn Zookeeper, path string, acl []zk.ACL, timeout time.Duration) (migrated bool, err error) {
+	var current []zk.ACL
+	err = RunZKOp(timeout, func() (err error) {
+		current, _, err = conn.GetACL(path)
+		return
+	})
+	if err != nil {
+		return false, err
+	}
+	if equalACL(current, acl) {
+		return false, nil
+	}
+	err = RunZKOp(timeout, func() (err error) {
+		_, err = conn.SetACL(path, acl, -1)
+		return
+	})
+	return err == nil, err
+}
+
+// equalACL 两组ACL是否相同（按顺序比较）
+func equalACL(a, b []zk.ACL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
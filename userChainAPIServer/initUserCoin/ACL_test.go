@@ -0,0 +1,77 @@
+package initusercoin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// failingACLZookeeper 设置指定节点的ACL时返回错误的 MemZookeeper
+type failingACLZookeeper struct {
+	*MemZookeeper
+	failPath string
+}
+
+func (z *failingACLZookeeper) SetACL(path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	if path == z.failPath {
+		return nil, errors.New("set acl failed")
+	}
+	return z.MemZookeeper.SetACL(path, acl, version)
+}
+
+// 测试将子账户节点的ACL迁移为digest ACL，重复执行时跳过已迁移的节点
+func TestMigrateZKACL(t *testing.T) {
+	if _, err := NewZKACL("user"); err == nil {
+		t.Errorf("NewZKACL without password expected error")
+	}
+	acl, err := NewZKACL("user:password")
+	if err != nil {
+		t.Fatalf("NewZKACL failed: %s", err)
+	}
+	if acl[0].Scheme != "digest" || acl[0].Perms != zk.PermAll {
+		t.Fatalf("wrong digest ACL: %v", acl)
+	}
+
+	mem := NewMemZookeeper()
+	conn := &failingACLZookeeper{mem, "/switcher/bad"}
+	world := zk.WorldACL(zk.PermAll)
+	mem.Create("/switcher", nil, 0, world)
+	mem.Create("/switcher/a", []byte("btc"), 0, world)
+	mem.Create("/switcher/b", []byte("bcc"), 0, world)
+	mem.Create("/switcher/c", []byte("btc"), 0, acl)
+	mem.Create("/switcher/bad", []byte("btc"), 0, world)
+
+	migration, err := MigrateZKACL(conn, "/switcher/", acl, 2, 0)
+	if err != nil {
+		t.Fatalf("MigrateZKACL failed: %s", err)
+	}
+	if migration.Total != 4 || migration.Migrated != 2 || migration.Unchanged != 1 ||
+		len(migration.Failed) != 1 || migration.Failed[0] != "bad" {
+		t.Errorf("wrong migration: %+v", migration)
+	}
+	for _, path := range []string{"/switcher/a", "/switcher/b", "/switcher/c"} {
+		if current, _, _ := mem.GetACL(path); !equalACL(current, acl) {
+			t.Errorf("%s expected digest ACL, got: %v", path, current)
+		}
+	}
+	if current, _, _ := mem.GetACL("/switcher/bad"); !equalACL(current, world) {
+		t.Errorf("failed node expected world ACL, got: %v", current)
+	}
+	if data, _, _ := mem.Get("/switcher/a"); string(data) != "btc" {
+		t.Errorf("data should not change, got: %s", data)
+	}
+
+	conn.failPath = ""
+	migration, err = MigrateZKACL(conn, "/switcher/", acl, 2, 0)
+	if err != nil {
+		t.Fatalf("MigrateZKACL failed: %s", err)
+	}
+	if migration.Migrated != 1 || migration.Unchanged != 3 || len(migration.Failed) != 0 {
+		t.Errorf("only the failed node expected to migrate again, got: %+v", migration)
+	}
+
+	if _, err = MigrateZKACL(conn, "/missing", acl, 2, 0); err != zk.ErrNoNode {
+		t.Errorf("missing dir expected ErrNoNode, got: %v", err)
+	}
+}
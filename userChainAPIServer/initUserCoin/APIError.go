@@ -42,4 +42,7 @@ var (
 
 	// APIErrRecordExists 记录已存在
 	APIErrRecordExists = NewAPIError(108, "record exists, skip")
+
+	// APIErrUserIgnored 子账户在忽略列表中
+	APIErrUserIgnored = NewAPIError(109, "user ignored, skip")
 )
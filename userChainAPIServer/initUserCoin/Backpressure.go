@@ -0,0 +1,98 @@
+package initusercoin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Zookeeper写入变慢时放慢拉取的默认配置
+const (
+	defaultZKBackpressureFactor        = 2
+	defaultZKBackpressureMaxMultiplier = 8
+)
+
+// checkZKBackpressure 检查写入变慢时放慢拉取的配置并填充默认值
+func checkZKBackpressure(configData *ConfigData) error {
+	if configData.ZKBackpressureFactor == 0 {
+		configData.ZKBackpressureFactor = defaultZKBackpressureFactor
+	}
+	if configData.ZKBackpressureMaxMultiplier == 0 {
+		configData.ZKBackpressureMaxMultiplier = defaultZKBackpressureMaxMultiplier
+	}
+	if configData.ZKBackpressureFactor <= 1 {
+		return fmt.Errorf("ZKBackpressureFactor %v should be greater than 1", configData.ZKBackpressureFactor)
+	}
+	if configData.ZKBackpressureMaxMultiplier < 1 {
+		return fmt.Errorf("ZKBackpressureMaxMultiplier %v should not be less than 1", configData.ZKBackpressureMaxMultiplier)
+	}
+	return nil
+}
+
+// zkBackpressure 根据Zookeeper的写入延迟调整子账户列表的拉取间隔
+// 写入在各币种的拉取goroutine及自动注册中进行，调整在各币种的拉取goroutine休眠前进行
+type zkBackpressure struct {
+	lock       sync.Mutex
+	slowest    time.Duration // 上次调整以来最慢的一次写入
+	multiplier float64       // 拉取间隔的倍数，不小于1
+	lastAdjust time.Time
+}
+
+// 当前的拉取间隔调整
+var backpressure = newZKBackpressure()
+
+func newZKBackpressure() *zkBackpressure {
+	return &zkBackpressure{multiplier: 1}
+}
+
+// recordWrite 记录一次写入的耗时
+func (b *zkBackpressure) recordWrite(latency time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if latency > b.slowest {
+		b.slowest = latency
+	}
+}
+
+// interval 返回调整后的拉取间隔，base 为配置的拉取间隔
+// 每个 base 间隔最多调整一次（各币种共用）：期间有写入超过 ZKSlowWriteMilliseconds 时乘以 ZKBackpressureFactor，
+// 最多放大到 ZKBackpressureMaxMultiplier 倍；否则除以 ZKBackpressureFactor，直到恢复为 base
+func (b *zkBackpressure) interval(base time.Duration, now time.Time) time.Duration {
+	if configData.ZKSlowWriteMilliseconds == 0 {
+		return base
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if now.Sub(b.lastAdjust) >= base {
+		threshold := time.Duration(configData.ZKSlowWriteMilliseconds) * time.Millisecond
+		old := b.multiplier
+		if b.slowest > threshold {
+			b.multiplier *= configData.ZKBackpressureFactor
+			if b.multiplier > configData.ZKBackpressureMaxMultiplier {
+				b.multiplier = configData.ZKBackpressureMaxMultiplier
+			}
+			if b.multiplier != old {
+				glog.Warning("Zookeeper write slow (", b.slowest, " > ", threshold, "), fetch interval: ",
+					time.Duration(float64(base)*old), " -> ", time.Duration(float64(base)*b.multiplier))
+			}
+		} else if b.multiplier > 1 {
+			b.multiplier /= configData.ZKBackpressureFactor
+			if b.multiplier < 1 {
+				b.multiplier = 1
+			}
+			glog.Info("Zookeeper write recovering (", b.slowest, "), fetch interval: ",
+				time.Duration(float64(base)*old), " -> ", time.Duration(float64(base)*b.multiplier))
+		}
+		b.slowest = 0
+		b.lastAdjust = now
+	}
+	return time.Duration(float64(base) * b.multiplier)
+}
+
+// fetchInterval 子账户列表的拉取间隔，Zookeeper写入变慢时放大
+func fetchInterval() time.Duration {
+	return backpressure.interval(time.Duration(intervalSeconds())*time.Second, time.Now())
+}
@@ -0,0 +1,91 @@
+package initusercoin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// slowZookeeper 写入前等待 delay 的 MemZookeeper
+type slowZookeeper struct {
+	*MemZookeeper
+	delay time.Duration
+}
+
+func (s *slowZookeeper) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	time.Sleep(s.delay)
+	return s.MemZookeeper.Create(path, data, flags, acl)
+}
+
+// 测试Zookeeper写入变慢时拉取间隔逐步放大，恢复后逐步还原
+func TestZKBackpressure(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir:      "/stratumSwitcher/btcbcc/",
+		ZKSlowWriteMilliseconds: 5,
+	}
+	if err := checkZKBackpressure(configData); err != nil {
+		t.Fatal(err)
+	}
+	conn := &slowZookeeper{MemZookeeper: NewMemZookeeper()}
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	backpressure = newZKBackpressure()
+	defer func() { backpressure = newZKBackpressure() }()
+
+	base := 10 * time.Second
+	now := time.Unix(1500000000, 0)
+	users := 0
+	write := func() {
+		users++
+		if err := zkCreate(fmt.Sprintf("%suser%d", configData.ZKSwitcherWatchDir, users), []byte("btc")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// next 模拟一轮拉取：写入后计算下一次的拉取间隔
+	next := func() time.Duration {
+		write()
+		now = now.Add(base)
+		return backpressure.interval(base, now)
+	}
+
+	if interval := next(); interval != base {
+		t.Errorf("fast writes expected interval: %s, got: %s", base, interval)
+	}
+
+	conn.delay = 20 * time.Millisecond
+	for _, expected := range []time.Duration{2 * base, 4 * base, 8 * base, 8 * base} {
+		if interval := next(); interval != expected {
+			t.Errorf("slow writes expected interval: %s, got: %s", expected, interval)
+		}
+	}
+
+	// 同一个间隔内的其他币种不再调整
+	if interval := backpressure.interval(base, now.Add(time.Second)); interval != 8*base {
+		t.Errorf("interval should be adjusted once per base interval, got: %s", interval)
+	}
+
+	conn.delay = 0
+	for _, expected := range []time.Duration{4 * base, 2 * base, base, base} {
+		if interval := next(); interval != expected {
+			t.Errorf("recovered writes expected interval: %s, got: %s", expected, interval)
+		}
+	}
+}
+
+// 测试未配置 ZKSlowWriteMilliseconds 时不调整拉取间隔，以及无效的配置
+func TestZKBackpressureDisabled(t *testing.T) {
+	configData = &ConfigData{}
+	b := newZKBackpressure()
+	b.recordWrite(time.Hour)
+	if interval := b.interval(time.Second, time.Unix(1500000000, 0)); interval != time.Second {
+		t.Errorf("disabled backpressure expected interval: 1s, got: %s", interval)
+	}
+
+	for _, conf := range []ConfigData{{ZKBackpressureFactor: 1}, {ZKBackpressureMaxMultiplier: 0.5}} {
+		if err := checkZKBackpressure(&conf); err == nil {
+			t.Errorf("invalid config should fail: %+v", conf)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package initusercoin
+
+import "sync"
+
+// 各币种子账户列表的增量拉取进度（已拉取到的最大puid）
+var lastPUIDs = make(map[string]int)
+var lastPUIDsLock sync.RWMutex
+
+// LastPUIDs 返回各币种已拉取到的最大puid的副本
+func LastPUIDs() map[string]int {
+	lastPUIDsLock.RLock()
+	defer lastPUIDsLock.RUnlock()
+
+	cursors := make(map[string]int, len(lastPUIDs))
+	for coin, puid := range lastPUIDs {
+		cursors[coin] = puid
+	}
+	return cursors
+}
+
+// setLastPUID 记录币种已拉取到的最大puid
+func setLastPUID(coin string, puid int) {
+	lastPUIDsLock.Lock()
+	lastPUIDs[coin] = puid
+	lastPUIDsLock.Unlock()
+}
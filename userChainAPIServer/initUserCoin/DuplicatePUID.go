@@ -0,0 +1,84 @@
+package initusercoin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DuplicatePUID 子账户列表API为多个子账户返回的同一个puid
+type DuplicatePUID struct {
+	Coin     string   `json:"coin"`
+	PUID     int      `json:"puid"`
+	PUNames  []string `json:"punames"`   // 使用该puid的子账户，第一个为先加入子账户列表的子账户
+	Rejected bool     `json:"rejected"`  // 开启 RejectDuplicatePUIDs 时后来的子账户未加入子账户列表
+	LastSeen int64    `json:"last_seen"` // 最近一次发现重复的时间
+}
+
+// 发现的重复puid（币种 -> puid -> 记录）
+var duplicatePUIDs = make(map[string]map[int]*DuplicatePUID)
+var duplicatePUIDsLock sync.Mutex
+
+// checkDuplicatePUID 检查币种的子账户列表中puid是否已属于其他子账户，是则记录并输出警告
+// 返回true表示应拒绝该子账户（开启了 RejectDuplicatePUIDs）
+func checkDuplicatePUID(coin string, puid int, puname string) (reject bool) {
+	owner := getUserName(puid, coin)
+	if owner == "" || owner == puname {
+		return false
+	}
+
+	reject = configData.RejectDuplicatePUIDs
+	IncStat(StatDuplicatePUID)
+	glog.Warning("duplicate puid ", puid, " of coin ", coin, ": ", owner, " and ", puname, ", rejected: ", reject)
+
+	duplicatePUIDsLock.Lock()
+	defer duplicatePUIDsLock.Unlock()
+
+	puids, ok := duplicatePUIDs[coin]
+	if !ok {
+		puids = make(map[int]*DuplicatePUID)
+		duplicatePUIDs[coin] = puids
+	}
+	duplicate, ok := puids[puid]
+	if !ok {
+		duplicate = &DuplicatePUID{Coin: coin, PUID: puid, PUNames: []string{owner}}
+		puids[puid] = duplicate
+	}
+	found := false
+	for _, name := range duplicate.PUNames {
+		if name == puname {
+			found = true
+			break
+		}
+	}
+	if !found {
+		duplicate.PUNames = append(duplicate.PUNames, puname)
+	}
+	duplicate.Rejected = reject
+	duplicate.LastSeen = time.Now().Unix()
+	return
+}
+
+// DuplicatePUIDs 发现的重复puid，按币种和puid排序，返回值为副本
+func DuplicatePUIDs() []DuplicatePUID {
+	duplicatePUIDsLock.Lock()
+	defer duplicatePUIDsLock.Unlock()
+
+	duplicates := []DuplicatePUID{}
+	for _, puids := range duplicatePUIDs {
+		for _, duplicate := range puids {
+			copied := *duplicate
+			copied.PUNames = append([]string{}, duplicate.PUNames...)
+			duplicates = append(duplicates, copied)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Coin != duplicates[j].Coin {
+			return duplicates[i].Coin < duplicates[j].Coin
+		}
+		return duplicates[i].PUID < duplicates[j].PUID
+	})
+	return duplicates
+}
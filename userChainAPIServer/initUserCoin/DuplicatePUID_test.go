@@ -0,0 +1,56 @@
+package initusercoin
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 测试发现子账户列表中被不同子账户使用的puid，开启 RejectDuplicatePUIDs 时拒绝后来的子账户
+func TestDuplicatePUID(t *testing.T) {
+	configData = &ConfigData{
+		UserListAPI:        map[string]string{"dup": "http://127.0.0.1/"},
+		ZKSwitcherWatchDir: "/stratumSwitcher/dup/",
+	}
+	conn := NewMemZookeeper()
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+
+	addUserOfCoin("dup", "alice", 10, 0)
+	addUserOfCoin("dup", "alice", 10, 10) // 同一子账户再次出现不算重复
+	if duplicates := DuplicatePUIDs(); len(duplicates) != 0 {
+		t.Fatalf("no duplicate expected, got: %+v", duplicates)
+	}
+
+	configData.RejectDuplicatePUIDs = true
+	if lastPUID := addUserOfCoin("dup", "bob", 10, 10); lastPUID != 10 {
+		t.Errorf("lastPUID 10 expected, got: %d", lastPUID)
+	}
+	expected := []DuplicatePUID{{Coin: "dup", PUID: 10, PUNames: []string{"alice", "bob"}, Rejected: true}}
+	duplicates := DuplicatePUIDs()
+	for i := range duplicates {
+		if duplicates[i].LastSeen == 0 {
+			t.Errorf("last_seen should be set: %+v", duplicates[i])
+		}
+		duplicates[i].LastSeen = 0
+	}
+	if !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("duplicates expected: %+v, got: %+v", expected, duplicates)
+	}
+	if name := getUserName(10, "dup"); name != "alice" {
+		t.Errorf("puid 10 should stay alice, got: %s", name)
+	}
+	if exists, _, _ := conn.Exists("/stratumSwitcher/dup/bob"); exists {
+		t.Errorf("rejected user bob should not be written to zookeeper")
+	}
+
+	// 不拒绝时后来的子账户照常加入
+	configData.RejectDuplicatePUIDs = false
+	addUserOfCoin("dup", "carol", 10, 10)
+	duplicates = DuplicatePUIDs()
+	if len(duplicates) != 1 || len(duplicates[0].PUNames) != 3 || duplicates[0].Rejected {
+		t.Errorf("carol expected in accepted duplicate, got: %+v", duplicates)
+	}
+	if name := getUserName(10, "dup"); name != "carol" {
+		t.Errorf("puid 10 expected carol, got: %s", name)
+	}
+}
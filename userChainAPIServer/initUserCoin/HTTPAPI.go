@@ -5,8 +5,10 @@ package initusercoin
 import "C"
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 	"unsafe"
 
 	"github.com/golang/glog"
@@ -24,7 +26,7 @@ func runAPIServer() {
 
 	http.HandleFunc("/", getUserIDList)
 
-	err := http.ListenAndServe(configData.ListenAddr, nil)
+	err := newAPIServer().ListenAndServe()
 
 	if err != nil {
 		glog.Fatal("HTTP Listen Failed: ", err)
@@ -32,6 +34,17 @@ func runAPIServer() {
 	}
 }
 
+// newAPIServer 创建带有超时设置的 API Server，防止慢速客户端长期占用连接
+func newAPIServer() *http.Server {
+	return &http.Server{
+		Addr:         configData.ListenAddr,
+		Handler:      withoutPprof(http.DefaultServeMux),
+		ReadTimeout:  time.Duration(configData.HTTPReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(configData.HTTPWriteTimeoutSeconds) * time.Second,
+		IdleTimeout:  time.Duration(configData.HTTPIdleTimeoutSeconds) * time.Second,
+	}
+}
+
 // getUserIDList 获取子账户列表
 func getUserIDList(w http.ResponseWriter, req *http.Request) {
 	coin := req.FormValue("coin")
@@ -44,6 +57,28 @@ func getUserIDList(w http.ResponseWriter, req *http.Request) {
 	w.Write([]byte(json))
 }
 
+// AddUser 将子账户加入币种的子账户列表（同时加入所有币种合并后的列表）
+func AddUser(puid int, puname string, coin string) {
+	punameC := C.CString(puname)
+	coinC := C.CString(coin)
+	defer C.free(unsafe.Pointer(punameC))
+	defer C.free(unsafe.Pointer(coinC))
+	C.addUser(C.int(puid), punameC, coinC)
+}
+
+// ListUsers 获取内存中所有币种合并后的子账户列表（子账户名 -> puid）
+func ListUsers() (map[string]int, error) {
+	coinC := C.CString("")
+	defer C.free(unsafe.Pointer(coinC))
+
+	response := new(UserIDMapResponse)
+	err := json.Unmarshal([]byte(C.GoString(C.getUserListJson(0, coinC))), response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
 // GetUserUpdateTime 获取用户的更新时间（即进入列表的时间）
 func GetUserUpdateTime(puname string, coin string) int64 {
 	punameC := C.CString(puname)
@@ -53,7 +88,26 @@ func GetUserUpdateTime(puname string, coin string) int64 {
 	return int64(C.getUserUpdateTime(punameC, coinC))
 }
 
+// getUserName 获取币种的子账户列表中puid对应的子账户名，不存在时返回空
+func getUserName(puid int, coin string) string {
+	coinC := C.CString(coin)
+	defer C.free(unsafe.Pointer(coinC))
+	punameC := C.getUserName(C.int(puid), coinC)
+	if punameC == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(punameC))
+	return C.GoString(punameC)
+}
+
+// GetUserCount 获取币种的子账户数，coin为空时为所有币种合并后的子账户数（按puid去重）
+func GetUserCount(coin string) int64 {
+	coinC := C.CString(coin)
+	defer C.free(unsafe.Pointer(coinC))
+	return int64(C.getUserCount(coinC))
+}
+
 // GetSafetyPeriod 获取用户更新的安全期（在安全期内，子账户可能尚未进入sserver的缓存）
 func GetSafetyPeriod() int64 {
-	return int64(configData.IntervalSeconds * 15 / 10)
+	return int64(intervalSeconds() * 15 / 10)
 }
@@ -0,0 +1,30 @@
+package initusercoin
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试 API Server 使用配置的超时时间
+func TestNewAPIServer(t *testing.T) {
+	configData = &ConfigData{
+		ListenAddr:              "127.0.0.1:8080",
+		HTTPReadTimeoutSeconds:  5,
+		HTTPWriteTimeoutSeconds: 10,
+		HTTPIdleTimeoutSeconds:  15,
+	}
+
+	server := newAPIServer()
+	if server.Addr != "127.0.0.1:8080" {
+		t.Errorf("addr expected: 127.0.0.1:8080, got: %s", server.Addr)
+	}
+	if server.ReadTimeout != 5*time.Second {
+		t.Errorf("read timeout expected: 5s, got: %s", server.ReadTimeout)
+	}
+	if server.WriteTimeout != 10*time.Second {
+		t.Errorf("write timeout expected: 10s, got: %s", server.WriteTimeout)
+	}
+	if server.IdleTimeout != 15*time.Second {
+		t.Errorf("idle timeout expected: 15s, got: %s", server.IdleTimeout)
+	}
+}
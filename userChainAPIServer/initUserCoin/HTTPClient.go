@@ -0,0 +1,88 @@
+package initusercoin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// TLSClientConfig HTTPS双向认证的客户端配置
+type TLSClientConfig struct {
+	// 客户端证书（PEM）
+	CertFile string
+	// 客户端私钥（PEM）
+	KeyFile string
+	// 验证服务器证书的CA（PEM），为空则使用系统CA
+	CAFile string
+}
+
+// httpClient 访问用户列表、自动注册等上游API的HTTP客户端
+var httpClient = http.DefaultClient
+
+// NewHTTPClient 根据TLS配置和代理创建访问上游API的HTTP客户端，未配置证书和代理时使用默认的Transport
+// proxy 为空时与默认的Transport一样使用环境变量（HTTP_PROXY、HTTPS_PROXY、NO_PROXY）中的代理
+func NewHTTPClient(conf TLSClientConfig, proxy string) (*http.Client, error) {
+	proxyURL, err := ParseProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if conf.CertFile == "" && conf.KeyFile == "" && conf.CAFile == "" && proxyURL == nil {
+		return &http.Client{}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if conf.CertFile == "" && conf.KeyFile == "" && conf.CAFile == "" {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert %s / key %s failed: %s", conf.CertFile, conf.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if conf.CAFile != "" {
+		caPEM, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file %s failed: %s", conf.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// ParseProxyURL 解析并检查上游API的代理地址（如 http://proxy.example.com:3128），为空时返回nil
+func ParseProxyURL(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("wrong proxy URL %s: %s", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("wrong proxy URL %s: scheme should be http, https or socks5", proxy)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("wrong proxy URL %s: no host", proxy)
+	}
+	return proxyURL, nil
+}
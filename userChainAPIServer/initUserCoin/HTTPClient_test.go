@@ -0,0 +1,148 @@
+package initusercoin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert 生成自签名的客户端证书，写入dir，返回证书及其文件路径
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "userChainAPIServer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, certFile, keyFile
+}
+
+// 测试使用客户端证书访问要求双向认证的服务器
+func TestNewHTTPClientWithClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userChainAPIServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"err_no":0,"data":{}}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	client, err := NewHTTPClient(TLSClientConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}, "")
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %s", err)
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with client cert failed: %s", err)
+	}
+	response.Body.Close()
+
+	// 没有客户端证书时应被服务器拒绝
+	client, err = NewHTTPClient(TLSClientConfig{CAFile: caFile}, "")
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %s", err)
+	}
+	if response, err = client.Get(server.URL); err == nil {
+		response.Body.Close()
+		t.Errorf("request without client cert should fail")
+	}
+}
+
+// 测试证书文件无法加载时返回错误
+func TestNewHTTPClientBadCert(t *testing.T) {
+	_, err := NewHTTPClient(TLSClientConfig{CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"}, "")
+	if err == nil {
+		t.Errorf("NewHTTPClient should fail with missing cert files")
+	}
+}
+
+// 测试配置代理后通过代理拉取子账户列表
+func TestNewHTTPClientWithProxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 发给代理的请求中为完整的URL
+		proxiedHost = r.URL.Host
+		w.Write([]byte(`{"err_no":0,"data":{"aaa":1}}`))
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(TLSClientConfig{}, proxy.URL)
+	if err != nil {
+		t.Fatalf("NewHTTPClient failed: %s", err)
+	}
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = client
+	configData = &ConfigData{UserListAPI: map[string]string{"btc": "http://userlist.invalid/btc"}}
+
+	users, err := fetchUserIDList("btc", "http://userlist.invalid/btc", 0, "proxy-test")
+	if err != nil {
+		t.Fatalf("fetch through proxy failed: %s", err)
+	}
+	if proxiedHost != "userlist.invalid" || users["aaa"] != 1 {
+		t.Errorf("request expected via proxy, host: %s, users: %v", proxiedHost, users)
+	}
+}
+
+// 测试代理地址的检查
+func TestParseProxyURL(t *testing.T) {
+	if proxyURL, err := ParseProxyURL(""); proxyURL != nil || err != nil {
+		t.Errorf("empty proxy expected nil, got: %v, %v", proxyURL, err)
+	}
+	for _, proxy := range []string{"http://proxy.example.com:3128", "socks5://127.0.0.1:1080"} {
+		if _, err := ParseProxyURL(proxy); err != nil {
+			t.Errorf("%s should be accepted: %s", proxy, err)
+		}
+	}
+	for _, proxy := range []string{"proxy.example.com:3128", "ftp://proxy.example.com", "http://", "http://%zz"} {
+		if _, err := ParseProxyURL(proxy); err == nil {
+			t.Errorf("%s should be rejected", proxy)
+		}
+		if _, err := NewHTTPClient(TLSClientConfig{}, proxy); err == nil {
+			t.Errorf("NewHTTPClient should fail with proxy %s", proxy)
+		}
+	}
+}
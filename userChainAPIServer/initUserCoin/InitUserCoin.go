@@ -2,21 +2,16 @@ package initusercoin
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
-	"unsafe"
 
 	"github.com/golang/glog"
-	"github.com/samuel/go-zookeeper/zk"
 )
 
-// #cgo CXXFLAGS: -std=c++11
-// #include "UserListJSON.h"
-import "C"
-
 // UserIDMapResponse 用户id列表接口响应的数据结构
 type UserIDMapResponse struct {
 	ErrNo  int            `json:"err_no"`
@@ -32,93 +27,164 @@ type UserIDMapEmptyResponse struct {
 }
 
 // InitUserCoin 拉取用户id列表来初始化用户币种记录
-func InitUserCoin(coin string, url string) {
+// lastPUID 为预热时已拉取到的最大puid，从该puid之后开始增量拉取
+// 每次拉取时读取当前配置的API地址，币种被从配置中移除后退出
+func InitUserCoin(coin string, lastPUID int) {
 	defer waitGroup.Done()
-
-	// 上次请求的最大puid
-	lastPUID := 0
+	setLastPUID(coin, lastPUID)
 
 	for {
-		// 执行操作
-		// 定义在函数中，这样失败时可以简单的return并进入休眠
-		func() {
-			urlWithLastID := url + "?last_id=" + strconv.Itoa(lastPUID)
+		// 休眠，Zookeeper写入变慢时休眠更久
+		time.Sleep(fetchInterval())
 
-			glog.Info("HTTP GET ", urlWithLastID)
-			response, err := http.Get(urlWithLastID)
+		url, ok := userListURL(coin)
+		if !ok {
+			glog.Info("Stop: ", coin, "; removed from UserListAPI")
+			return
+		}
 
-			if err != nil {
-				glog.Error("HTTP Request Failed: ", err)
-				return
-			}
+		userIDMap, err := fetchUserIDList(coin, url, lastPUID, NewRequestID())
+		if err != nil {
+			glog.Error(err)
+			continue
+		}
+		if len(userIDMap) == 0 {
+			glog.Info("Finish: ", coin, "; No New User", "; ", url)
+			continue
+		}
 
-			body, err := ioutil.ReadAll(response.Body)
+		// 遍历用户币种列表
+		for puname, puid := range userIDMap {
+			lastPUID = addUserOfCoin(coin, puname, puid, lastPUID)
+		}
+		setLastPUID(coin, lastPUID)
 
-			if err != nil {
-				glog.Error("HTTP Fetch Body Failed: ", err)
-				return
-			}
+		glog.Info("Finish: ", coin, "; User Num: ", len(userIDMap), "; ", url)
+	}
+}
 
-			userIDMapResponse := new(UserIDMapResponse)
-			err = json.Unmarshal(body, userIDMapResponse)
+// defaultUserListPageParam 用户列表API默认的分页参数名
+const defaultUserListPageParam = "last_id"
 
-			if err != nil {
-				// 用户id接口在返回0个用户的时候data字段数据类型会由object变成array，需要用另一个struct解析
-				userIDMapEmptyResponse := new(UserIDMapEmptyResponse)
-				err = json.Unmarshal(body, userIDMapEmptyResponse)
+// checkUserListPageParams 检查分页参数名只配置给了已有的币种，且是合法的URL参数名
+func checkUserListPageParams(apis map[string]string, params map[string]string) error {
+	for coin, param := range params {
+		if _, ok := apis[coin]; !ok {
+			return fmt.Errorf("coin %s not in UserListAPI", coin)
+		}
+		if param == "" || url.QueryEscape(param) != param {
+			return fmt.Errorf("invalid parameter name %q of coin %s", param, coin)
+		}
+	}
+	return nil
+}
 
-				if err != nil {
-					glog.Error("Parse Result Failed: ", err, "; ", string(body))
-					return
-				}
+// userListPageURL 构造拉取lastPUID之后的用户id列表的URL
+func userListPageURL(apiURL string, param string, lastPUID int) string {
+	return apiURL + "?" + param + "=" + strconv.Itoa(lastPUID)
+}
 
-				glog.Info("Finish: ", coin, "; No New User", "; ", url)
-				return
-			}
+// fetchUserIDList 拉取lastPUID之后的用户id列表
+// requestID 通过 X-Request-ID 头发送给上游API并记录在日志中
+func fetchUserIDList(coin string, url string, lastPUID int, requestID string) (userIDMap map[string]int, err error) {
+	defer func() {
+		if err != nil {
+			IncStat(StatFetchUserListFailure)
+			err = fmt.Errorf("%s (request id: %s)", err, requestID)
+		} else {
+			IncStat(StatFetchUserListSuccess)
+		}
+		RecordFetch(coin, err)
+	}()
 
-			if userIDMapResponse.ErrNo != 0 {
-				glog.Error("API Returned a Error: ", string(body))
-				return
-			}
+	urlWithLastID := userListPageURL(url, userListPageParam(coin), lastPUID)
 
-			glog.Info("HTTP GET Success. User Num: ", len(userIDMapResponse.Data))
+	glog.Info("HTTP GET ", urlWithLastID, " (request id: ", requestID, ")")
+	response, err := HTTPGet(httpClient, urlWithLastID, requestID)
 
-			// 遍历用户币种列表
-			for puname, puid := range userIDMapResponse.Data {
-				if strings.Contains(puname, "_") {
-					// remove coin postfix of puname
-					puname = puname[0:strings.LastIndex(puname, "_")]
-				}
+	if err != nil {
+		return nil, fmt.Errorf("HTTP Request Failed: %s", err)
+	}
+	defer response.Body.Close()
 
-				err := setMiningCoin(puname, coin)
+	body, err := ioutil.ReadAll(response.Body)
 
-				if err != nil {
-					glog.Info(err.ErrMsg, ": ", puname, ": ", coin)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP Fetch Body Failed: %s", err)
+	}
 
-					if err != APIErrRecordExists {
-						continue
-					}
-				} else {
-					glog.Info("success: ", puname, " (", puid, "): ", coin)
-				}
+	userIDMapResponse := new(UserIDMapResponse)
+	err = json.Unmarshal(body, userIDMapResponse)
 
-				if puid > lastPUID {
-					lastPUID = puid
-				}
+	if err != nil {
+		// 用户id接口在返回0个用户的时候data字段数据类型会由object变成array，需要用另一个struct解析
+		userIDMapEmptyResponse := new(UserIDMapEmptyResponse)
+		err = json.Unmarshal(body, userIDMapEmptyResponse)
 
-				punameC := C.CString(puname)
-				coinC := C.CString(coin)
-				C.addUser(C.int(puid), punameC, coinC)
-				C.free(unsafe.Pointer(punameC))
-				C.free(unsafe.Pointer(coinC))
-			}
+		if err != nil {
+			return nil, fmt.Errorf("Parse Result Failed: %s; %s", err, string(body))
+		}
+
+		return map[string]int{}, nil
+	}
+
+	if userIDMapResponse.ErrNo != 0 {
+		return nil, fmt.Errorf("API Returned a Error: %s", string(body))
+	}
+
+	glog.Info("HTTP GET Success. Coin: ", coin, ", User Num: ", len(userIDMapResponse.Data), " (request id: ", requestID, ")")
+	return userIDMapResponse.Data, nil
+}
+
+// addUserOfCoin 初始化子账户的币种记录并将其加入子账户列表，返回更新后的lastPUID
+func addUserOfCoin(coin string, puname string, puid int, lastPUID int) int {
+	if strings.Contains(puname, "_") {
+		// remove coin postfix of puname
+		puname = puname[0:strings.LastIndex(puname, "_")]
+	}
+
+	if checkDuplicatePUID(coin, puid, puname) {
+		if puid > lastPUID {
+			lastPUID = puid
+		}
+		return lastPUID
+	}
+
+	err := setMiningCoin(puname, coin)
+
+	if err != nil {
+		glog.Info(err.ErrMsg, ": ", puname, ": ", coin)
+
+		if err != APIErrRecordExists {
+			return lastPUID
+		}
+	} else {
+		glog.Info("success: ", puname, " (", puid, "): ", coin)
+	}
+
+	if puid > lastPUID {
+		lastPUID = puid
+	}
+
+	AddUser(puid, puname, coin)
 
-			glog.Info("Finish: ", coin, "; User Num: ", len(userIDMapResponse.Data), "; ", url)
-		}()
+	return lastPUID
+}
 
-		// 休眠
-		time.Sleep(time.Duration(configData.IntervalSeconds) * time.Second)
+// IsIgnoredUser 判断子账户是否在忽略列表中（完全匹配names或以prefixes中的任意一项开头）
+// 被忽略的子账户不会写入zookeeper。puname应当是已经过大小写转换的子账户名。
+func IsIgnoredUser(puname string, names []string, prefixes []string) bool {
+	for _, name := range names {
+		if puname == name {
+			return true
+		}
 	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(puname, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 func setMiningCoin(puname string, coin string) (apiErr *APIError) {
@@ -139,16 +205,7 @@ func setMiningCoin(puname string, coin string) (apiErr *APIError) {
 	}
 
 	// 检查币种是否存在
-	exists := false
-
-	for availableCoin := range configData.UserListAPI {
-		if availableCoin == coin {
-			exists = true
-			break
-		}
-	}
-
-	if !exists {
+	if _, exists := userListURL(coin); !exists {
 		apiErr = APIErrCoinIsInexistent
 		return
 	}
@@ -157,28 +214,42 @@ func setMiningCoin(puname string, coin string) (apiErr *APIError) {
 		// stratum server对子账户名大小写不敏感
 		// 简单的将子账户名转换为小写即可
 		puname = strings.ToLower(puname)
-	} else if len(configData.ZKUserCaseInsensitiveIndex) > 0 {
+	}
+
+	if IsIgnoredUser(puname, configData.IgnoredUsers, configData.IgnoredUserPrefixes) {
+		glog.V(3).Info("ignored user: ", puname, ": ", coin)
+		apiErr = APIErrUserIgnored
+		return
+	}
+
+	if !configData.StratumServerCaseInsensitive && len(configData.ZKUserCaseInsensitiveIndex) > 0 {
 		// stratum server对子账户名大小写敏感
 		// 且 ZKUserCaseInsensitiveIndex 未被禁用（不为空）
 		// 写入大小写不敏感的用户名索引
 		zkIndexPath := configData.ZKUserCaseInsensitiveIndex + strings.ToLower(puname)
-		exists, _, err := zookeeperConn.Exists(zkIndexPath)
+		exists, err := zkExists(zkIndexPath)
 		if err != nil {
 			glog.Error("zk.Exists(", zkIndexPath, ",", puname, ") Failed: ", err)
 		}
 		if !exists {
-			_, err = zookeeperConn.Create(zkIndexPath, []byte(puname), 0, zk.WorldACL(zk.PermAll))
+			err = zkCreate(zkIndexPath, []byte(puname))
 			if err != nil {
 				glog.Error("zk.Create(", zkIndexPath, ",", puname, ") Failed: ", err)
 			}
 		}
 	}
 
+	// 预热时已从zookeeper预读到该记录，跳过
+	if _, ok := prefetchedChain(puname); ok {
+		apiErr = APIErrRecordExists
+		return
+	}
+
 	// stratumSwitcher 监控的键
 	zkPath := configData.ZKSwitcherWatchDir + puname
 
 	// 看看键是否存在
-	exists, _, err := zookeeperConn.Exists(zkPath)
+	exists, err := zkExists(zkPath)
 
 	if err != nil {
 		glog.Error("zk.Exists(", zkPath, ") Failed: ", err)
@@ -194,7 +265,7 @@ func setMiningCoin(puname string, coin string) (apiErr *APIError) {
 	}
 
 	// 不存在，创建
-	_, err = zookeeperConn.Create(zkPath, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	err = zkCreate(zkPath, []byte(coin))
 
 	if err != nil {
 		glog.Error("zk.Create(", zkPath, ",", coin, ") Failed: ", err)
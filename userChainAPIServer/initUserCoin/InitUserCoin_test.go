@@ -0,0 +1,114 @@
+package initusercoin
+
+import (
+	"testing"
+)
+
+// 测试忽略列表的匹配
+func TestIsIgnoredUser(t *testing.T) {
+	names := []string{"testpool", "internal"}
+	prefixes := []string{"test_", "qa"}
+
+	cases := map[string]bool{
+		"testpool":  true,
+		"internal":  true,
+		"test_abc":  true,
+		"qa01":      true,
+		"testpool2": false,
+		"hu60":      false,
+		"atest_":    false,
+	}
+	for puname, expected := range cases {
+		if ignored := IsIgnoredUser(puname, names, prefixes); ignored != expected {
+			t.Errorf("IsIgnoredUser(%s) expected: %v, got: %v", puname, expected, ignored)
+		}
+	}
+}
+
+// 测试被忽略的子账户不会写入zookeeper
+func TestSetMiningCoinIgnoredUser(t *testing.T) {
+	configData = &ConfigData{
+		UserListAPI:                  map[string]string{"btc": "http://127.0.0.1/"},
+		StratumServerCaseInsensitive: true,
+		IgnoredUsers:                 []string{"testpool"},
+	}
+
+	// zookeeperConn 为 nil，若没有被忽略则会panic
+	zookeeperConn = nil
+	if err := setMiningCoin("TestPool", "btc"); err != APIErrUserIgnored {
+		t.Errorf("setMiningCoin of ignored user expected: %v, got: %v", APIErrUserIgnored, err)
+	}
+	if err := setMiningCoin("TestPool", "xxx"); err != APIErrCoinIsInexistent {
+		t.Errorf("setMiningCoin with wrong coin expected: %v, got: %v", APIErrCoinIsInexistent, err)
+	}
+}
+
+// 测试初始化子账户的币种记录，已存在的记录不会被覆盖
+func TestSetMiningCoin(t *testing.T) {
+	configData = &ConfigData{
+		UserListAPI:                map[string]string{"btc": "http://127.0.0.1/", "bcc": "http://127.0.0.1/"},
+		ZKSwitcherWatchDir:         "/stratumSwitcher/btcbcc/",
+		ZKUserCaseInsensitiveIndex: "/stratumSwitcher/bitcoin_case/",
+	}
+	conn := NewMemZookeeper()
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	createZookeeperPath(configData.ZKUserCaseInsensitiveIndex)
+
+	if err := setMiningCoin("Abc", "btc"); err != nil {
+		t.Fatalf("setMiningCoin failed: %v", err)
+	}
+	if data, _, _ := conn.Get("/stratumSwitcher/btcbcc/Abc"); string(data) != "btc" {
+		t.Errorf("coin of Abc expected: btc, got: %s", data)
+	}
+	if data, _, _ := conn.Get("/stratumSwitcher/bitcoin_case/abc"); string(data) != "Abc" {
+		t.Errorf("case insensitive index of abc expected: Abc, got: %s", data)
+	}
+
+	if err := setMiningCoin("Abc", "bcc"); err != APIErrRecordExists {
+		t.Errorf("setMiningCoin of existing user expected: %v, got: %v", APIErrRecordExists, err)
+	}
+	if data, _, _ := conn.Get("/stratumSwitcher/btcbcc/Abc"); string(data) != "btc" {
+		t.Errorf("existing record should not be changed, got: %s", data)
+	}
+}
+
+// 测试按币种的分页参数名构造用户列表URL
+func TestUserListPageURL(t *testing.T) {
+	configData = &ConfigData{
+		UserListAPI:        map[string]string{"btc": "http://127.0.0.1/btc", "bcc": "http://127.0.0.1/bcc"},
+		UserListPageParams: map[string]string{"bcc": "since_id"},
+	}
+
+	cases := map[string]string{
+		"btc": "http://127.0.0.1/btc?last_id=100",
+		"bcc": "http://127.0.0.1/bcc?since_id=100",
+	}
+	for coin, expected := range cases {
+		url, _ := userListURL(coin)
+		if got := userListPageURL(url, userListPageParam(coin), 100); got != expected {
+			t.Errorf("user list URL of %s expected: %s, got: %s", coin, expected, got)
+		}
+	}
+}
+
+// 测试分页参数名的检查
+func TestCheckUserListPageParams(t *testing.T) {
+	apis := map[string]string{"btc": "http://127.0.0.1/btc"}
+
+	if err := checkUserListPageParams(apis, map[string]string{"btc": "since_id"}); err != nil {
+		t.Errorf("valid page param failed: %v", err)
+	}
+	invalid := []map[string]string{
+		{"bcc": "since_id"},
+		{"btc": ""},
+		{"btc": "last_id&a"},
+		{"btc": "last id"},
+		{"btc": "a=b"},
+	}
+	for _, params := range invalid {
+		if err := checkUserListPageParams(apis, params); err == nil {
+			t.Errorf("invalid page params %v should fail", params)
+		}
+	}
+}
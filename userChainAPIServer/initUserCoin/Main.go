@@ -2,6 +2,7 @@ package initusercoin
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"sync"
 	"time"
@@ -13,6 +14,13 @@ import (
 // Zookeeper连接超时时间
 const zookeeperConnTimeout = 5
 
+// API Server 超时时间的默认值（秒）
+const (
+	defaultHTTPReadTimeout  = 30
+	defaultHTTPWriteTimeout = 60
+	defaultHTTPIdleTimeout  = 120
+)
+
 // AutoRegAPIConfig 用户自动注册API定义
 type AutoRegAPIConfig struct {
 	IntervalSeconds time.Duration
@@ -27,13 +35,41 @@ type AutoRegAPIConfig struct {
 type ConfigData struct {
 	// UserListAPI 币种对应的用户列表，形如{"btc":"url", "bcc":"url"}
 	UserListAPI map[string]string
+	// UserListPageParams 各币种的用户列表API的分页参数名，形如{"bcc":"since_id"}，未配置的币种使用 last_id
+	UserListPageParams map[string]string
 	// IntervalSeconds 每次拉取的间隔时间
 	IntervalSeconds uint
+	// UpstreamAPITLS 访问上游API（用户列表、用户币种列表、自动注册）的HTTPS客户端证书，可空
+	UpstreamAPITLS TLSClientConfig
+	// UpstreamAPIProxy 访问上游API的HTTP代理（如 http://proxy.example.com:3128），为空时使用环境变量中的代理
+	UpstreamAPIProxy string
+	// FetchWatchdogSeconds 各币种的子账户列表或用户币种列表超过该时间（秒）未成功拉取时告警并标记为未就绪，为0时不检查
+	FetchWatchdogSeconds uint
 
 	// Zookeeper集群的IP:端口列表
 	ZKBroker []string
 	// ZKSwitcherWatchDir Switcher监控的Zookeeper路径，以斜杠结尾
 	ZKSwitcherWatchDir string
+	// ZKOpTimeoutSeconds 读写用户币种记录时单次Zookeeper操作的超时时间（秒），为0时不限制
+	ZKOpTimeoutSeconds uint
+	// ZKPrefetchConcurrency 预热前并发读取 ZKSwitcherWatchDir 下已有记录的并发数，为0时不预读
+	ZKPrefetchConcurrency uint
+	// ZKWriteConcurrency 写入用户币种记录的总并发数（包括API和各定时任务的写入），为0时不限制
+	ZKWriteConcurrency uint
+	// ZKSlowWriteMilliseconds 写入用户币种记录的耗时超过该值（毫秒）时放慢子账户列表的拉取，为0时不放慢
+	ZKSlowWriteMilliseconds uint
+	// ZKBackpressureFactor 每次放慢或恢复时拉取间隔乘以或除以的倍数，默认2
+	ZKBackpressureFactor float64
+	// ZKBackpressureMaxMultiplier 拉取间隔最多放大到 IntervalSeconds 的多少倍，默认8
+	ZKBackpressureMaxMultiplier float64
+	// ZKSnapshotDir 定时将 ZKSwitcherWatchDir 下的子账户币种记录保存到该目录，为空时不保存
+	ZKSnapshotDir string
+	// ZKSnapshotIntervalSeconds 保存快照的间隔（秒），默认3600
+	ZKSnapshotIntervalSeconds uint
+	// ZKSnapshotRetention 保留最新的多少个快照，默认24
+	ZKSnapshotRetention uint
+	// ZKDigestAuth Zookeeper的digest认证（用户名:密码），配置后以该用户认证连接，新建的节点只允许该用户访问，为空时不认证
+	ZKDigestAuth string
 
 	// EnableUserAutoReg 启用用户自动注册
 	EnableUserAutoReg bool
@@ -43,6 +79,12 @@ type ConfigData struct {
 	UserAutoRegAPI AutoRegAPIConfig
 	// StratumServerCaseInsensitive 挖矿服务器对子账户名大小写不敏感，此时将总是写入小写的子账户名
 	StratumServerCaseInsensitive bool
+	// IgnoredUsers 忽略的子账户（如内部测试账户），不会写入zookeeper
+	IgnoredUsers []string
+	// IgnoredUserPrefixes 以这些前缀开头的子账户将被忽略
+	IgnoredUserPrefixes []string
+	// RejectDuplicatePUIDs 子账户列表API为不同的子账户返回了同一个puid时，不将后来的子账户加入子账户列表（也不写入zookeeper），默认只输出警告
+	RejectDuplicatePUIDs bool
 	// ZKUserCaseInsensitiveIndex 大小写不敏感的子账户索引
 	//（可空，仅在 StratumServerCaseInsensitive == false 时用到）
 	ZKUserCaseInsensitiveIndex string
@@ -51,40 +93,84 @@ type ConfigData struct {
 	EnableAPIServer bool
 	// API Server 的监听IP:端口
 	ListenAddr string
+	// API Server 读取请求的超时时间（秒），为0时使用默认值
+	HTTPReadTimeoutSeconds uint
+	// API Server 写入响应的超时时间（秒），为0时使用默认值
+	HTTPWriteTimeoutSeconds uint
+	// API Server 保持空闲连接的超时时间（秒），为0时使用默认值
+	HTTPIdleTimeoutSeconds uint
+
+	// pprof 的监听IP:端口，为空时不启用；未指定IP时（如":6060"）只监听本机
+	PprofListenAddr string
+
+	// StatsD 的IP:端口（UDP），为空时不推送统计数据
+	StatsDAddr string
+	// StatsD 统计项名称的前缀
+	StatsDPrefix string
+	// StatsD 推送间隔（秒），为0时使用默认值
+	StatsDIntervalSeconds uint
 }
 
 // zookeeperConn Zookeeper连接对象
-var zookeeperConn *zk.Conn
+var zookeeperConn Zookeeper
 
 // 配置数据
 var configData *ConfigData
 
+// 配置文件路径，重新加载配置时使用
+var configFile string
+
 // 用于等待goroutine结束
 var waitGroup sync.WaitGroup
 
-// Main function
-func Main(configFilePath string) {
-	// 读取配置文件
+// ReadConfigFile 读取配置文件，补全默认值
+func ReadConfigFile(configFilePath string) (*ConfigData, error) {
 	configJSON, err := ioutil.ReadFile(configFilePath)
 
 	if err != nil {
-		glog.Fatal("read config failed: ", err)
-		return
+		return nil, fmt.Errorf("read config failed: %s", err)
 	}
 
-	configData = new(ConfigData)
+	configData := new(ConfigData)
 	err = json.Unmarshal(configJSON, configData)
 
 	if err != nil {
-		glog.Fatal("parse config failed: ", err)
-		return
+		return nil, fmt.Errorf("parse config failed: %s", err)
+	}
+
+	if configData.HTTPReadTimeoutSeconds == 0 {
+		configData.HTTPReadTimeoutSeconds = defaultHTTPReadTimeout
+	}
+	if configData.HTTPWriteTimeoutSeconds == 0 {
+		configData.HTTPWriteTimeoutSeconds = defaultHTTPWriteTimeout
+	}
+	if configData.HTTPIdleTimeoutSeconds == 0 {
+		configData.HTTPIdleTimeoutSeconds = defaultHTTPIdleTimeout
+	}
+	if configData.StatsDIntervalSeconds == 0 {
+		configData.StatsDIntervalSeconds = defaultStatsDInterval
+	}
+	if configData.ZKSnapshotIntervalSeconds == 0 {
+		configData.ZKSnapshotIntervalSeconds = defaultZKSnapshotInterval
+	}
+	if configData.ZKSnapshotRetention == 0 {
+		configData.ZKSnapshotRetention = defaultZKSnapshotRetention
+	}
+	if err = checkUserListPageParams(configData.UserListAPI, configData.UserListPageParams); err != nil {
+		return nil, fmt.Errorf("wrong UserListPageParams: %s", err)
+	}
+	if err = checkZKBackpressure(configData); err != nil {
+		return nil, err
+	}
+	if _, err = NewZKACL(configData.ZKDigestAuth); err != nil {
+		return nil, err
 	}
 
 	// 若zookeeper路径不以“/”结尾，则添加
-	if configData.ZKSwitcherWatchDir[len(configData.ZKSwitcherWatchDir)-1] != '/' {
+	if len(configData.ZKSwitcherWatchDir) > 0 && configData.ZKSwitcherWatchDir[len(configData.ZKSwitcherWatchDir)-1] != '/' {
 		configData.ZKSwitcherWatchDir += "/"
 	}
-	if configData.EnableUserAutoReg && configData.ZKAutoRegWatchDir[len(configData.ZKAutoRegWatchDir)-1] != '/' {
+	if configData.EnableUserAutoReg && len(configData.ZKAutoRegWatchDir) > 0 && configData.ZKAutoRegWatchDir[len(configData.ZKAutoRegWatchDir)-1] != '/' {
 		configData.ZKAutoRegWatchDir += "/"
 	}
 	if !configData.StratumServerCaseInsensitive &&
@@ -93,6 +179,28 @@ func Main(configFilePath string) {
 		configData.ZKUserCaseInsensitiveIndex += "/"
 	}
 
+	return configData, nil
+}
+
+// Main function
+func Main(configFilePath string) {
+	// 读取配置文件
+	var err error
+	configData, err = ReadConfigFile(configFilePath)
+
+	if err != nil {
+		glog.Fatal(err)
+		return
+	}
+	configFile = configFilePath
+	SetZKWriteConcurrency(int(configData.ZKWriteConcurrency))
+
+	httpClient, err = NewHTTPClient(configData.UpstreamAPITLS, configData.UpstreamAPIProxy)
+	if err != nil {
+		glog.Fatal("init upstream API client failed: ", err)
+		return
+	}
+
 	// 建立到Zookeeper集群的连接
 	conn, _, err := zk.Connect(configData.ZKBroker, time.Duration(zookeeperConnTimeout)*time.Second)
 
@@ -103,6 +211,14 @@ func Main(configFilePath string) {
 
 	zookeeperConn = conn
 
+	err = AddZKDigestAuth(conn, configData.ZKDigestAuth)
+	if err != nil {
+		glog.Fatal("Zookeeper Auth Failed: ", err)
+		return
+	}
+	acl, _ := NewZKACL(configData.ZKDigestAuth)
+	SetZKNodeACL(acl)
+
 	// 检查并创建StratumSwitcher使用的Zookeeper路径
 	err = createZookeeperPath(configData.ZKSwitcherWatchDir)
 
@@ -129,24 +245,47 @@ func Main(configFilePath string) {
 		}
 	}
 
-	// 开始执行币种初始化任务
-	for coin, url := range configData.UserListAPI {
-		waitGroup.Add(1)
-		go InitUserCoin(coin, url)
-	}
-
 	// 启动自动注册
 	if configData.EnableUserAutoReg {
 		waitGroup.Add(1)
 		go RunUserAutoReg(configData)
 	}
 
+	// 启动 pprof
+	if server := newPprofServer(); server != nil {
+		go runPprofServer(server)
+	}
+
+	// 启动 StatsD 推送
+	if configData.StatsDAddr != "" {
+		go runStatsD()
+	}
+
+	// 启动zookeeper定时快照
+	if configData.ZKSnapshotDir != "" {
+		go runZKSnapshot()
+	}
+
 	// 启动子账户列表API
 	if configData.EnableAPIServer {
 		waitGroup.Add(1)
 		go runAPIServer()
 	}
 
+	// 预热，完整拉取一次子账户列表
+	lastPUIDs := Warmup()
+
+	// 预热完成后开始检查拉取是否停滞
+	if configData.FetchWatchdogSeconds > 0 {
+		go runFetchWatchdog(time.Duration(configData.FetchWatchdogSeconds) * time.Second)
+	}
+
+	// 开始执行币种初始化任务
+	for coin := range userListAPI() {
+		waitGroup.Add(1)
+		go InitUserCoin(coin, lastPUIDs[coin])
+	}
+
 	waitGroup.Wait()
 
 	glog.Info("Init User Coin Finished.")
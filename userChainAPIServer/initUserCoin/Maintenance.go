@@ -0,0 +1,103 @@
+package initusercoin
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// pendingZKWrite 维护模式下被推迟的Zookeeper写入
+type pendingZKWrite struct {
+	data []byte
+	// createOnly 仅在节点不存在时创建（如初始化用户币种记录），否则覆盖写入
+	createOnly bool
+}
+
+// 维护模式：暂停所有Zookeeper写入，退出时按顺序写入期间积累的变更
+var maintenanceMode bool
+var pendingZKWrites = make(map[string]pendingZKWrite)
+var pendingZKPaths []string
+var maintenanceLock sync.Mutex
+
+// zkFlushWrite 退出维护模式时写入单个变更，可在测试中替换
+var zkFlushWrite = flushZKWrite
+
+// InMaintenance 是否处于维护模式，以及待写入的变更数
+func InMaintenance() (enabled bool, pending int) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+	return maintenanceMode, len(pendingZKPaths)
+}
+
+// EnterMaintenance 进入维护模式
+func EnterMaintenance() {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+	if !maintenanceMode {
+		glog.Info("enter maintenance mode, zookeeper writes are deferred")
+	}
+	maintenanceMode = true
+}
+
+// ExitMaintenance 写入维护期间积累的变更并退出维护模式
+// 写入失败时保持维护模式，未写入的变更保留在队列中，可稍后重试
+func ExitMaintenance() error {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+	if !maintenanceMode {
+		return nil
+	}
+
+	glog.Info("exit maintenance mode, flushing ", len(pendingZKPaths), " deferred zookeeper writes")
+	for len(pendingZKPaths) > 0 {
+		path := pendingZKPaths[0]
+		err := zkFlushWrite(path, pendingZKWrites[path])
+		if err != nil {
+			glog.Error("flush deferred zookeeper write ", path, " failed: ", err, "; ", len(pendingZKPaths), " writes remain")
+			return err
+		}
+		delete(pendingZKWrites, path)
+		pendingZKPaths = pendingZKPaths[1:]
+	}
+
+	maintenanceMode = false
+	glog.Info("maintenance mode exited")
+	return nil
+}
+
+// DeferZKWrite 维护模式下将写入加入队列并返回true，否则返回false，由调用者直接写入
+// 同一节点只保留最后一次覆盖写入，仅创建的写入不会覆盖已在队列中的写入
+func DeferZKWrite(path string, data []byte, createOnly bool) bool {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+	if !maintenanceMode {
+		return false
+	}
+
+	if _, exists := pendingZKWrites[path]; !exists {
+		pendingZKPaths = append(pendingZKPaths, path)
+	} else if createOnly {
+		return true
+	}
+	pendingZKWrites[path] = pendingZKWrite{data, createOnly}
+	glog.V(3).Info("maintenance mode, deferred zookeeper write: ", path, ": ", string(data))
+	return true
+}
+
+// flushZKWrite 写入被推迟的变更，节点不存在时创建
+func flushZKWrite(path string, write pendingZKWrite) error {
+	return CountZKWrite(RunZKWrite(zkOpTimeout(), func() (err error) {
+		if !write.createOnly {
+			_, err = zookeeperConn.Set(path, write.data, -1)
+			if err != zk.ErrNoNode {
+				return
+			}
+		}
+		_, err = zookeeperConn.Create(path, write.data, 0, ZKNodeACL())
+		if write.createOnly && err == zk.ErrNodeExists {
+			return nil
+		}
+		return
+	}))
+}
@@ -0,0 +1,90 @@
+package initusercoin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// 测试维护模式下推迟写入，退出时按顺序写入
+func TestMaintenanceDeferredFlush(t *testing.T) {
+	var flushed []string
+	var failPath string
+	zkFlushWrite = func(path string, write pendingZKWrite) error {
+		if path == failPath {
+			return errors.New("zk down")
+		}
+		flushed = append(flushed, path+"="+string(write.data))
+		return nil
+	}
+	defer func() { zkFlushWrite = flushZKWrite }()
+
+	if DeferZKWrite("/a", []byte("btc"), false) {
+		t.Errorf("write should not be deferred out of maintenance")
+	}
+
+	EnterMaintenance()
+	if enabled, _ := InMaintenance(); !enabled {
+		t.Fatalf("should be in maintenance")
+	}
+	DeferZKWrite("/a", []byte("btc"), false)
+	DeferZKWrite("/b", []byte("bcc"), true)
+	DeferZKWrite("/a", []byte("bcc"), false)
+	// 仅创建的写入不覆盖已在队列中的写入
+	DeferZKWrite("/a", []byte("ltc"), true)
+	DeferZKWrite("/c", []byte("btc"), false)
+	if _, pending := InMaintenance(); pending != 3 {
+		t.Errorf("pending writes expected: 3, got: %d", pending)
+	}
+
+	// 写入失败时保持维护模式
+	failPath = "/b"
+	if err := ExitMaintenance(); err == nil {
+		t.Errorf("exit should fail when flush fails")
+	}
+	if enabled, pending := InMaintenance(); !enabled || pending != 2 {
+		t.Errorf("maintenance with 2 pending writes expected, got: %v, %d", enabled, pending)
+	}
+
+	failPath = ""
+	if err := ExitMaintenance(); err != nil {
+		t.Fatalf("exit maintenance failed: %s", err)
+	}
+	expected := []string{"/a=bcc", "/b=bcc", "/c=btc"}
+	if !reflect.DeepEqual(flushed, expected) {
+		t.Errorf("flushed writes expected: %v, got: %v", expected, flushed)
+	}
+	if enabled, pending := InMaintenance(); enabled || pending != 0 {
+		t.Errorf("maintenance should be exited, got: %v, %d", enabled, pending)
+	}
+	if DeferZKWrite("/a", []byte("btc"), false) {
+		t.Errorf("write should not be deferred after maintenance")
+	}
+}
+
+// 测试写入推迟的变更：覆盖写入时节点不存在则创建，仅创建的写入不覆盖已有节点
+func TestFlushZKWrite(t *testing.T) {
+	configData = &ConfigData{}
+	conn := NewMemZookeeper()
+	zookeeperConn = conn
+	conn.Create("/a", []byte("btc"), 0, nil)
+
+	if err := flushZKWrite("/a", pendingZKWrite{[]byte("bcc"), true}); err != nil {
+		t.Errorf("create-only write of existing node failed: %s", err)
+	}
+	if data, _, _ := conn.Get("/a"); string(data) != "btc" {
+		t.Errorf("create-only write should not change existing node, got: %s", data)
+	}
+	if err := flushZKWrite("/a", pendingZKWrite{[]byte("bcc"), false}); err != nil {
+		t.Errorf("write of existing node failed: %s", err)
+	}
+	if data, _, _ := conn.Get("/a"); string(data) != "bcc" {
+		t.Errorf("/a expected: bcc, got: %s", data)
+	}
+	if err := flushZKWrite("/b", pendingZKWrite{[]byte("ltc"), false}); err != nil {
+		t.Errorf("write of missing node failed: %s", err)
+	}
+	if data, _, _ := conn.Get("/b"); string(data) != "ltc" {
+		t.Errorf("/b expected: ltc, got: %s", data)
+	}
+}
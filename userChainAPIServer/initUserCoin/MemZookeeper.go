@@ -0,0 +1,201 @@
+package initusercoin
+
+import (
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// memZNode MemZookeeper中的节点
+type memZNode struct {
+	data       []byte
+	version    int32
+	acl        []zk.ACL
+	aclVersion int32
+}
+
+// MemZookeeper 内存中的Zookeeper实现，用于在没有Zookeeper集群时测试
+// 只实现了本模块用到的语义：父节点必须存在、版本号检查、一次性的watch
+type MemZookeeper struct {
+	lock          sync.Mutex
+	nodes         map[string]*memZNode
+	dataWatchers  map[string][]chan zk.Event
+	childWatchers map[string][]chan zk.Event
+}
+
+// NewMemZookeeper 创建只有根节点的 MemZookeeper
+func NewMemZookeeper() *MemZookeeper {
+	return &MemZookeeper{
+		nodes:         map[string]*memZNode{"/": {}},
+		dataWatchers:  make(map[string][]chan zk.Event),
+		childWatchers: make(map[string][]chan zk.Event),
+	}
+}
+
+// Exists 节点是否存在
+func (m *MemZookeeper) Exists(path string) (bool, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return false, nil, nil
+	}
+	return true, &zk.Stat{Version: node.version}, nil
+}
+
+// ExistsW 节点是否存在，并watch该节点的变化
+func (m *MemZookeeper) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	exists, stat, _ := m.Exists(path)
+	return exists, stat, m.watch(m.dataWatchers, path), nil
+}
+
+// Get 读取节点的值
+func (m *MemZookeeper) Get(path string) ([]byte, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return node.data, &zk.Stat{Version: node.version}, nil
+}
+
+// Set 写入节点的值，version为-1时不检查版本号
+func (m *MemZookeeper) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != node.version {
+		return nil, zk.ErrBadVersion
+	}
+	node.data = data
+	node.version++
+	m.fire(m.dataWatchers, path, zk.EventNodeDataChanged)
+	return &zk.Stat{Version: node.version}, nil
+}
+
+// Create 创建节点，父节点必须存在
+func (m *MemZookeeper) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.nodes[path]; ok {
+		return "", zk.ErrNodeExists
+	}
+	parent := parentPath(path)
+	if _, ok := m.nodes[parent]; !ok {
+		return "", zk.ErrNoNode
+	}
+	m.nodes[path] = &memZNode{data: data, acl: acl}
+	m.fire(m.dataWatchers, path, zk.EventNodeCreated)
+	m.fire(m.childWatchers, parent, zk.EventNodeChildrenChanged)
+	return path, nil
+}
+
+// GetACL 读取节点的ACL
+func (m *MemZookeeper) GetACL(path string) ([]zk.ACL, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return node.acl, &zk.Stat{Version: node.version, Aversion: node.aclVersion}, nil
+}
+
+// SetACL 设置节点的ACL，version为-1时不检查ACL的版本号
+// 不检查权限，即设置后仍可用任意ACL读写
+func (m *MemZookeeper) SetACL(path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != node.aclVersion {
+		return nil, zk.ErrBadVersion
+	}
+	node.acl = acl
+	node.aclVersion++
+	return &zk.Stat{Version: node.version, Aversion: node.aclVersion}, nil
+}
+
+// Delete 删除没有子节点的节点，version为-1时不检查版本号
+func (m *MemZookeeper) Delete(path string, version int32) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if version != -1 && version != node.version {
+		return zk.ErrBadVersion
+	}
+	if len(m.children(path)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(m.nodes, path)
+	m.fire(m.dataWatchers, path, zk.EventNodeDeleted)
+	m.fire(m.childWatchers, path, zk.EventNodeDeleted)
+	m.fire(m.childWatchers, parentPath(path), zk.EventNodeChildrenChanged)
+	return nil
+}
+
+// Children 列出子节点（按名称排序）
+func (m *MemZookeeper) Children(path string) ([]string, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	node, ok := m.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	children := m.children(path)
+	return children, &zk.Stat{Version: node.version, NumChildren: int32(len(children))}, nil
+}
+
+// ChildrenW 列出子节点（按名称排序），并watch子节点的变化
+func (m *MemZookeeper) ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, err := m.Children(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return children, stat, m.watch(m.childWatchers, path), nil
+}
+
+// children 子节点的名称，调用者需持有锁
+func (m *MemZookeeper) children(parent string) []string {
+	children := []string{}
+	for p := range m.nodes {
+		if p != "/" && parentPath(p) == parent {
+			children = append(children, path.Base(p))
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// watch 注册一次性的watch
+func (m *MemZookeeper) watch(watchers map[string][]chan zk.Event, path string) <-chan zk.Event {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ch := make(chan zk.Event, 1)
+	watchers[path] = append(watchers[path], ch)
+	return ch
+}
+
+// fire 触发并移除节点上的watch，调用者需持有锁
+func (m *MemZookeeper) fire(watchers map[string][]chan zk.Event, path string, eventType zk.EventType) {
+	for _, ch := range watchers[path] {
+		ch <- zk.Event{Type: eventType, Path: path}
+	}
+	delete(watchers, path)
+}
+
+// parentPath 父节点的路径
+func parentPath(p string) string {
+	return path.Dir(p)
+}
@@ -0,0 +1,62 @@
+package initusercoin
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// pprofPathPrefix pprof 接口的路径前缀
+const pprofPathPrefix = "/debug/pprof/"
+
+// pprofListenAddr 补全 pprof 的监听地址，未指定IP时（如":6060"）只监听本机
+func pprofListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// newPprofServer 创建独立监听的 pprof Server，PprofListenAddr 为空时返回nil
+func newPprofServer() *http.Server {
+	if configData.PprofListenAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPathPrefix, pprof.Index)
+	mux.HandleFunc(pprofPathPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPathPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPathPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPathPrefix+"trace", pprof.Trace)
+
+	return &http.Server{
+		Addr:    pprofListenAddr(configData.PprofListenAddr),
+		Handler: mux,
+	}
+}
+
+// runPprofServer 启动 pprof Server
+func runPprofServer(server *http.Server) {
+	glog.Info("Listen pprof HTTP ", server.Addr)
+	err := server.ListenAndServe()
+	if err != nil {
+		glog.Error("pprof HTTP Listen Failed: ", err)
+	}
+}
+
+// withoutPprof 导入 net/http/pprof 时会向 http.DefaultServeMux 注册 pprof 接口，
+// 而 API Server 使用 http.DefaultServeMux，因此需要屏蔽这些路径，避免暴露到公开的 API 端口上
+func withoutPprof(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, pprofPathPrefix) {
+			http.NotFound(w, req)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,41 @@
+package initusercoin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试 pprof 只在配置后启用，且不会出现在 API Server 上
+func TestPprofServer(t *testing.T) {
+	configData = &ConfigData{ListenAddr: "0.0.0.0:8080"}
+	if server := newPprofServer(); server != nil {
+		t.Errorf("pprof server should be disabled by default, got: %s", server.Addr)
+	}
+
+	// API Server 不提供 pprof 接口
+	recorder := httptest.NewRecorder()
+	newAPIServer().Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("pprof on API server expected: 404, got: %d", recorder.Code)
+	}
+
+	configData.PprofListenAddr = ":6060"
+	server := newPprofServer()
+	if server == nil {
+		t.Fatalf("pprof server should be enabled")
+	}
+	if server.Addr != "127.0.0.1:6060" {
+		t.Errorf("pprof addr expected: 127.0.0.1:6060, got: %s", server.Addr)
+	}
+	recorder = httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("pprof index expected: 200, got: %d", recorder.Code)
+	}
+
+	configData.PprofListenAddr = "0.0.0.0:6060"
+	if server := newPprofServer(); server.Addr != "0.0.0.0:6060" {
+		t.Errorf("pprof addr expected: 0.0.0.0:6060, got: %s", server.Addr)
+	}
+}
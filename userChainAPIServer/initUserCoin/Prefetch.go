@@ -0,0 +1,96 @@
+package initusercoin
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// userChainMap 从zookeeper预读的子账户币种记录（子账户名 -> 币种）
+var userChainMap map[string]string
+var userChainMapLock sync.RWMutex
+
+// PrefetchAllFromZK 列出 ZKSwitcherWatchDir 的子节点，以不超过concurrency的并发读取各子账户的币种记录并保存到 userChainMap
+// 单个记录读取失败时只记录日志，该子账户在之后写入时仍会逐个检查zookeeper。返回读取到的记录数
+func PrefetchAllFromZK(concurrency int) (int, error) {
+	chains, total, err := readAllFromZK(concurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	userChainMapLock.Lock()
+	userChainMap = chains
+	userChainMapLock.Unlock()
+
+	glog.Info("prefetch finished, ", len(chains), "/", total, " records")
+	return len(chains), nil
+}
+
+// readAllFromZK 列出 ZKSwitcherWatchDir 的子节点，以不超过concurrency的并发读取各子账户的币种记录
+// 单个记录读取失败时只记录日志并跳过。total 为子节点数
+func readAllFromZK(concurrency int) (chains map[string]string, total int, err error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	zkWatchDir := strings.TrimSuffix(configData.ZKSwitcherWatchDir, "/") // 移除结尾的"/"
+	var users []string
+	err = RunZKOp(zkOpTimeout(), func() (err error) {
+		users, _, err = zookeeperConn.Children(zkWatchDir)
+		return
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	glog.Info("reading ", len(users), " records in ", configData.ZKSwitcherWatchDir)
+
+	chains = make(map[string]string, len(users))
+	var chainsLock sync.Mutex
+	var waitGroup sync.WaitGroup
+	jobs := make(chan string)
+
+	for i := 0; i < concurrency; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for puname := range jobs {
+				zkPath := configData.ZKSwitcherWatchDir + puname
+				var data []byte
+				err := RunZKOp(zkOpTimeout(), func() (err error) {
+					data, _, err = zookeeperConn.Get(zkPath)
+					return
+				})
+				if err != nil {
+					glog.Error("zk.Get(", zkPath, ") Failed: ", err)
+					continue
+				}
+				chainsLock.Lock()
+				chains[puname] = string(data)
+				chainsLock.Unlock()
+			}
+		}()
+	}
+	for _, puname := range users {
+		jobs <- puname
+	}
+	close(jobs)
+	waitGroup.Wait()
+
+	return chains, len(users), nil
+}
+
+// prefetchedChain 返回预读到的子账户币种记录
+func prefetchedChain(puname string) (string, bool) {
+	userChainMapLock.RLock()
+	defer userChainMapLock.RUnlock()
+	chain, ok := userChainMap[puname]
+	return chain, ok
+}
+
+// clearPrefetched 清除预读的记录
+func clearPrefetched() {
+	userChainMapLock.Lock()
+	userChainMap = nil
+	userChainMapLock.Unlock()
+}
@@ -0,0 +1,82 @@
+package initusercoin
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// countingZookeeper 统计 Exists 调用次数的 MemZookeeper
+type countingZookeeper struct {
+	*MemZookeeper
+	exists int32
+}
+
+func (c *countingZookeeper) Exists(path string) (bool, *zk.Stat, error) {
+	atomic.AddInt32(&c.exists, 1)
+	return c.MemZookeeper.Exists(path)
+}
+
+// 测试从有大量子节点的zookeeper预读子账户币种记录
+func TestPrefetchAllFromZK(t *testing.T) {
+	configData = &ConfigData{
+		UserListAPI:        map[string]string{"btc": "http://127.0.0.1/", "bcc": "http://127.0.0.1/"},
+		ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/",
+	}
+	conn := &countingZookeeper{MemZookeeper: NewMemZookeeper()}
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	defer clearPrefetched()
+
+	const users = 1000
+	for i := 0; i < users; i++ {
+		coin := "btc"
+		if i%3 == 0 {
+			coin = "bcc"
+		}
+		conn.Create(fmt.Sprintf("%suser%d", configData.ZKSwitcherWatchDir, i), []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	}
+
+	n, err := PrefetchAllFromZK(8)
+	if err != nil {
+		t.Fatalf("PrefetchAllFromZK failed: %v", err)
+	}
+	if n != users || len(userChainMap) != users {
+		t.Fatalf("prefetched records expected: %d, got: %d (map: %d)", users, n, len(userChainMap))
+	}
+	if chain, _ := prefetchedChain("user3"); chain != "bcc" {
+		t.Errorf("prefetched chain of user3 expected: bcc, got: %s", chain)
+	}
+	if chain, _ := prefetchedChain("user4"); chain != "btc" {
+		t.Errorf("prefetched chain of user4 expected: btc, got: %s", chain)
+	}
+
+	// 预读到的子账户不再逐个检查zookeeper
+	atomic.StoreInt32(&conn.exists, 0)
+	if err := setMiningCoin("user4", "bcc"); err != APIErrRecordExists {
+		t.Errorf("setMiningCoin of prefetched user expected: %v, got: %v", APIErrRecordExists, err)
+	}
+	if calls := atomic.LoadInt32(&conn.exists); calls != 0 {
+		t.Errorf("no zk.Exists expected for prefetched user, got: %d", calls)
+	}
+	if err := setMiningCoin("newuser", "btc"); err != nil {
+		t.Errorf("setMiningCoin of new user failed: %v", err)
+	}
+
+	clearPrefetched()
+	if _, ok := prefetchedChain("user4"); ok {
+		t.Errorf("prefetched records should be cleared")
+	}
+}
+
+// 测试监控目录不存在时预读失败
+func TestPrefetchAllFromZKNoNode(t *testing.T) {
+	configData = &ConfigData{ZKSwitcherWatchDir: "/not/exists/"}
+	zookeeperConn = NewMemZookeeper()
+
+	if _, err := PrefetchAllFromZK(4); err != zk.ErrNoNode {
+		t.Errorf("prefetch of missing dir expected: %v, got: %v", zk.ErrNoNode, err)
+	}
+}
@@ -0,0 +1,141 @@
+package initusercoin
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// configLock 保护可在运行时重新加载的配置项（IntervalSeconds、UserListAPI）
+var configLock sync.RWMutex
+
+// intervalSeconds 子账户列表的拉取间隔
+func intervalSeconds() uint {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return configData.IntervalSeconds
+}
+
+// userListAPI 各币种的子账户列表API
+// 重新加载时整体替换该map而不是修改，因此调用者可以在不加锁的情况下遍历返回值（但不应修改）
+func userListAPI() map[string]string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return configData.UserListAPI
+}
+
+// userListURL 币种的子账户列表API，币种不存在时返回false
+func userListURL(coin string) (url string, ok bool) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	url, ok = configData.UserListAPI[coin]
+	return
+}
+
+// userListPageParam 币种的用户列表API的分页参数名
+func userListPageParam(coin string) string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if param := configData.UserListPageParams[coin]; param != "" {
+		return param
+	}
+	return defaultUserListPageParam
+}
+
+// DiffConfigFields 比较两个相同类型的配置结构体，返回值不同的字段名
+func DiffConfigFields(a interface{}, b interface{}) []string {
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	fields := []string{}
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, va.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
+
+// CheckReload 重新读取配置文件，检查是否只修改了可重新加载的配置项（IntervalSeconds、UserListAPI、UserListPageParams）
+func CheckReload() (*ConfigData, error) {
+	if configData == nil {
+		return nil, errors.New("config not loaded")
+	}
+
+	newConfig, err := ReadConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	configLock.RLock()
+	current := *configData
+	configLock.RUnlock()
+
+	// 忽略可重新加载的配置项后，其余配置项应当不变
+	candidate := *newConfig
+	candidate.IntervalSeconds = current.IntervalSeconds
+	candidate.UserListAPI = current.UserListAPI
+	candidate.UserListPageParams = current.UserListPageParams
+	if fields := DiffConfigFields(current, candidate); len(fields) > 0 {
+		return nil, fmt.Errorf("cannot reload %s, restart required", strings.Join(fields, ", "))
+	}
+	return newConfig, nil
+}
+
+// ApplyReload 应用重新加载的配置项，并为新增的币种启动子账户列表拉取，返回变更说明
+func ApplyReload(newConfig *ConfigData) []string {
+	changes, addedCoins := applyReloadableConfig(newConfig)
+	for _, change := range changes {
+		glog.Info("config reloaded: ", change)
+	}
+	for _, coin := range addedCoins {
+		// 新币种从头开始拉取
+		waitGroup.Add(1)
+		go InitUserCoin(coin, 0)
+	}
+	return changes
+}
+
+// applyReloadableConfig 替换可重新加载的配置项，返回变更说明和新增的币种
+func applyReloadableConfig(newConfig *ConfigData) (changes []string, addedCoins []string) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	changes = []string{}
+	if newConfig.IntervalSeconds != configData.IntervalSeconds {
+		changes = append(changes, fmt.Sprintf("IntervalSeconds: %d -> %d", configData.IntervalSeconds, newConfig.IntervalSeconds))
+		configData.IntervalSeconds = newConfig.IntervalSeconds
+	}
+
+	apiChanges := []string{}
+	for coin, url := range newConfig.UserListAPI {
+		oldURL, exists := configData.UserListAPI[coin]
+		if !exists {
+			apiChanges = append(apiChanges, fmt.Sprintf("UserListAPI[%s]: added %s", coin, url))
+			addedCoins = append(addedCoins, coin)
+		} else if oldURL != url {
+			apiChanges = append(apiChanges, fmt.Sprintf("UserListAPI[%s]: %s -> %s", coin, oldURL, url))
+		}
+	}
+	for coin := range configData.UserListAPI {
+		if _, exists := newConfig.UserListAPI[coin]; !exists {
+			apiChanges = append(apiChanges, fmt.Sprintf("UserListAPI[%s]: removed", coin))
+		}
+	}
+	for coin := range newConfig.UserListAPI {
+		oldParam, newParam := configData.UserListPageParams[coin], newConfig.UserListPageParams[coin]
+		if _, exists := configData.UserListAPI[coin]; exists && oldParam != newParam {
+			apiChanges = append(apiChanges, fmt.Sprintf("UserListPageParams[%s]: %q -> %q", coin, oldParam, newParam))
+		}
+	}
+	sort.Strings(apiChanges)
+	sort.Strings(addedCoins)
+	changes = append(changes, apiChanges...)
+	configData.UserListAPI = newConfig.UserListAPI
+	configData.UserListPageParams = newConfig.UserListPageParams
+	return
+}
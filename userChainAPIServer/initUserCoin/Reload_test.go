@@ -0,0 +1,105 @@
+package initusercoin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 测试重新加载拉取间隔和子账户列表API
+func TestReloadUserListAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userChainAPIServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile = filepath.Join(dir, "config.json")
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher/","IntervalSeconds":10,` +
+		`"UserListAPI":{"btc":"http://127.0.0.1/btc","bcc":"http://127.0.0.1/bcc"}}`)
+	configData, err = ReadConfigFile(configFile)
+	if err != nil {
+		t.Fatalf("read config failed: %s", err)
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher/","IntervalSeconds":5,` +
+		`"UserListAPI":{"btc":"http://127.0.0.1/btc2","bsv":"http://127.0.0.1/bsv"}}`)
+	newConfig, err := CheckReload()
+	if err != nil {
+		t.Fatalf("check reload failed: %s", err)
+	}
+	changes, addedCoins := applyReloadableConfig(newConfig)
+	expected := []string{
+		"IntervalSeconds: 10 -> 5",
+		"UserListAPI[bcc]: removed",
+		"UserListAPI[bsv]: added http://127.0.0.1/bsv",
+		"UserListAPI[btc]: http://127.0.0.1/btc -> http://127.0.0.1/btc2",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("changes expected: %v, got: %v", expected, changes)
+	}
+	if !reflect.DeepEqual(addedCoins, []string{"bsv"}) {
+		t.Errorf("added coins expected: [bsv], got: %v", addedCoins)
+	}
+	if intervalSeconds() != 5 {
+		t.Errorf("interval after reload expected: 5, got: %d", intervalSeconds())
+	}
+	if _, ok := userListURL("bcc"); ok {
+		t.Errorf("bcc should be removed after reload")
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/other/","IntervalSeconds":5,` +
+		`"UserListAPI":{"btc":"http://127.0.0.1/btc2","bsv":"http://127.0.0.1/bsv"}}`)
+	if _, err := CheckReload(); err == nil {
+		t.Errorf("reload with changed ZKSwitcherWatchDir should fail")
+	}
+}
+
+// 测试重新加载子账户列表API的分页参数名
+func TestReloadUserListPageParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userChainAPIServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile = filepath.Join(dir, "config.json")
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher/","IntervalSeconds":10,` +
+		`"UserListAPI":{"btc":"http://127.0.0.1/btc","bcc":"http://127.0.0.1/bcc"}}`)
+	configData, err = ReadConfigFile(configFile)
+	if err != nil {
+		t.Fatalf("read config failed: %s", err)
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher/","IntervalSeconds":10,` +
+		`"UserListAPI":{"btc":"http://127.0.0.1/btc","bcc":"http://127.0.0.1/bcc"},"UserListPageParams":{"bcc":"since_id"}}`)
+	newConfig, err := CheckReload()
+	if err != nil {
+		t.Fatalf("check reload failed: %s", err)
+	}
+	changes, _ := applyReloadableConfig(newConfig)
+	expected := []string{`UserListPageParams[bcc]: "" -> "since_id"`}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("changes expected: %v, got: %v", expected, changes)
+	}
+	if param := userListPageParam("bcc"); param != "since_id" {
+		t.Errorf("page param of bcc expected: since_id, got: %s", param)
+	}
+	if param := userListPageParam("btc"); param != defaultUserListPageParam {
+		t.Errorf("page param of btc expected: %s, got: %s", defaultUserListPageParam, param)
+	}
+}
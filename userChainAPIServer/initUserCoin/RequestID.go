@@ -0,0 +1,64 @@
+package initusercoin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader 携带请求ID的HTTP头，用于关联本程序与上游API的日志
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 接受的外部请求ID的最大长度
+const maxRequestIDLength = 64
+
+// NewRequestID 生成随机的请求ID
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// RequestID 返回API请求携带的请求ID，未携带或格式不合法时生成新的ID
+func RequestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		return NewRequestID()
+	}
+	return id
+}
+
+// validRequestID 请求ID只允许字母、数字及 -_.: ，以免污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewGetRequest 创建带请求ID的GET请求
+func NewGetRequest(url string, requestID string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(RequestIDHeader, requestID)
+	return req, nil
+}
+
+// HTTPGet 发送带请求ID的GET请求
+func HTTPGet(client *http.Client, url string, requestID string) (*http.Response, error) {
+	req, err := NewGetRequest(url, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,88 @@
+package initusercoin
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog 捕获执行 f 期间输出的glog日志
+func captureLog(f func()) string {
+	flag.Set("logtostderr", "true")
+	defer flag.Set("logtostderr", "false")
+
+	r, w, _ := os.Pipe()
+	stderr := os.Stderr
+	os.Stderr = w
+	f()
+	os.Stderr = stderr
+	w.Close()
+
+	log, _ := ioutil.ReadAll(r)
+	return string(log)
+}
+
+// 测试拉取用户id列表时发送并记录请求ID
+func TestFetchUserIDListRequestID(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(RequestIDHeader)
+		w.Write([]byte(`{"err_no":0,"err_msg":null,"data":{"aaa":1}}`))
+	}))
+	defer server.Close()
+	httpClient = http.DefaultClient
+	configData = &ConfigData{UserListAPI: map[string]string{"btc": server.URL}}
+
+	var err error
+	log := captureLog(func() {
+		_, err = fetchUserIDList("btc", server.URL, 0, "trace-123")
+	})
+	if err != nil {
+		t.Fatalf("fetchUserIDList failed: %s", err)
+	}
+	if received != "trace-123" {
+		t.Errorf("%s expected: trace-123, got: %s", RequestIDHeader, received)
+	}
+	if strings.Count(log, "request id: trace-123") != 2 {
+		t.Errorf("request and success log lines should contain request id, got:\n%s", log)
+	}
+
+	// 失败时错误信息中带有请求ID
+	server.Close()
+	_, err = fetchUserIDList("btc", server.URL, 0, "trace-456")
+	if err == nil || !strings.Contains(err.Error(), "request id: trace-456") {
+		t.Errorf("error should contain request id, got: %v", err)
+	}
+}
+
+// 测试从API请求中获取请求ID
+func TestRequestID(t *testing.T) {
+	cases := []struct {
+		header string
+		keep   bool
+	}{
+		{"abc-123_x.y:z", true},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, c.header)
+		id := RequestID(req)
+		if c.keep && id != c.header {
+			t.Errorf("request id %q should be kept, got: %q", c.header, id)
+		}
+		if !c.keep && (id == c.header || !validRequestID(id)) {
+			t.Errorf("request id %q should be replaced with a generated one, got: %q", c.header, id)
+		}
+	}
+	if NewRequestID() == NewRequestID() {
+		t.Errorf("generated request ids should be unique")
+	}
+}
@@ -0,0 +1,95 @@
+package initusercoin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// 定时快照的默认配置
+const (
+	defaultZKSnapshotInterval  = 3600
+	defaultZKSnapshotRetention = 24
+)
+
+// zkSnapshotPrefix 快照文件名的前缀，文件名形如 zk-snapshot-20180907-063000.json（UTC时间）
+const zkSnapshotPrefix = "zk-snapshot-"
+
+// ZKSnapshot 快照文件的内容
+type ZKSnapshot struct {
+	Path  string            `json:"path"`  // ZKSwitcherWatchDir
+	Time  int64             `json:"time"`  // 快照时间（Unix时间戳）
+	Users map[string]string `json:"users"` // 子账户名 -> 币种
+}
+
+// takeZKSnapshot 读取 ZKSwitcherWatchDir 下的全部子账户币种记录并写入 dir 下的快照文件，返回文件路径
+// 先写入临时文件再重命名，不会留下不完整的快照
+func takeZKSnapshot(dir string, now time.Time) (string, error) {
+	chains, total, err := readAllFromZK(int(configData.ZKPrefetchConcurrency))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(ZKSnapshot{configData.ZKSwitcherWatchDir, now.Unix(), chains})
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, zkSnapshotPrefix+now.UTC().Format("20060102-150405")+".json")
+	if err = ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return "", err
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return "", err
+	}
+
+	glog.Info("zookeeper snapshot saved: ", path, ", ", len(chains), "/", total, " records")
+	return path, nil
+}
+
+// pruneZKSnapshots 只保留 dir 下最新的 keep 个快照文件，返回删除的文件
+func pruneZKSnapshots(dir string, keep int) (removed []string, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, zkSnapshotPrefix+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	// 文件名中的时间可以按字符串排序
+	sort.Strings(files)
+	for len(files) > keep {
+		if err = os.Remove(files[0]); err != nil {
+			return removed, err
+		}
+		removed = append(removed, files[0])
+		files = files[1:]
+	}
+	return removed, nil
+}
+
+// runZKSnapshot 每隔 ZKSnapshotIntervalSeconds 将子账户币种记录保存到 ZKSnapshotDir，保留最新的 ZKSnapshotRetention 个
+func runZKSnapshot() {
+	if err := os.MkdirAll(configData.ZKSnapshotDir, 0755); err != nil {
+		glog.Error("zookeeper snapshot disabled: ", err)
+		return
+	}
+	glog.Info("Save zookeeper snapshots to ", configData.ZKSnapshotDir)
+	for {
+		time.Sleep(time.Duration(configData.ZKSnapshotIntervalSeconds) * time.Second)
+
+		if _, err := takeZKSnapshot(configData.ZKSnapshotDir, time.Now()); err != nil {
+			glog.Error("zookeeper snapshot failed: ", err)
+			continue
+		}
+		removed, err := pruneZKSnapshots(configData.ZKSnapshotDir, int(configData.ZKSnapshotRetention))
+		if err != nil {
+			glog.Error("remove old zookeeper snapshots failed: ", err)
+		}
+		for _, path := range removed {
+			glog.Info("old zookeeper snapshot removed: ", path)
+		}
+	}
+}
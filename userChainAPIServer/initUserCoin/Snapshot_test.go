@@ -0,0 +1,76 @@
+package initusercoin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试将zookeeper中的子账户币种记录保存为快照文件，并只保留最新的几个
+func TestZKSnapshot(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir:    "/stratumSwitcher/btcbcc/",
+		ZKPrefetchConcurrency: 4,
+	}
+	zookeeperConn = NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	expected := map[string]string{"aaa": "btc", "bbb": "bcc", "ccc": "btc"}
+	for puname, coin := range expected {
+		zookeeperConn.Create(configData.ZKSwitcherWatchDir+puname, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	}
+
+	dir, err := ioutil.TempDir("", "zk-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2018, 9, 7, 6, 30, 0, 0, time.UTC)
+	path, err := takeZKSnapshot(dir, now)
+	if err != nil {
+		t.Fatalf("take snapshot failed: %s", err)
+	}
+	if path != filepath.Join(dir, "zk-snapshot-20180907-063000.json") {
+		t.Errorf("unexpected snapshot path: %s", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot ZKSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("parse snapshot failed: %s; %s", err, data)
+	}
+	if snapshot.Path != configData.ZKSwitcherWatchDir || snapshot.Time != now.Unix() || len(snapshot.Users) != len(expected) {
+		t.Errorf("unexpected snapshot: %s", data)
+	}
+	for puname, coin := range expected {
+		if snapshot.Users[puname] != coin {
+			t.Errorf("%s expected: %s, got: %s", puname, coin, snapshot.Users[puname])
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := takeZKSnapshot(dir, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := pruneZKSnapshots(dir, 2)
+	if err != nil || len(removed) != 2 || removed[0] != path {
+		t.Errorf("oldest 2 snapshots should be removed, got: %v, %v", removed, err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	expectedFiles := []string{
+		filepath.Join(dir, "zk-snapshot-20180907-083000.json"),
+		filepath.Join(dir, "zk-snapshot-20180907-093000.json"),
+	}
+	if len(files) != 2 || files[0] != expectedFiles[0] || files[1] != expectedFiles[1] {
+		t.Errorf("remaining snapshots expected: %v, got: %v", expectedFiles, files)
+	}
+}
@@ -0,0 +1,126 @@
+package initusercoin
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// defaultStatsDInterval StatsD 推送间隔的默认值（秒）
+const defaultStatsDInterval = 10
+
+// statsDMaxPacketSize 单个UDP包的最大长度，超过时分多个包发送
+const statsDMaxPacketSize = 1432
+
+// 统计项名称
+const (
+	StatFetchUserListSuccess    = "fetch_user_list.success"
+	StatFetchUserListFailure    = "fetch_user_list.failure"
+	StatFetchUserCoinMapSuccess = "fetch_user_coin_map.success"
+	StatFetchUserCoinMapFailure = "fetch_user_coin_map.failure"
+	StatZKWriteSuccess          = "zk_write.success"
+	StatZKWriteFailure          = "zk_write.failure"
+	StatUserCoinMapSize         = "user_coin_map.size"
+	StatDuplicatePUID           = "user_list.duplicate_puid"
+)
+
+// 统计数据，计数器在每次推送后清零
+var statsLock sync.Mutex
+var statCounters = make(map[string]int64)
+var statGauges = make(map[string]int64)
+
+// IncStat 计数器加1
+func IncStat(name string) {
+	statsLock.Lock()
+	statCounters[name]++
+	statsLock.Unlock()
+}
+
+// SetStatGauge 设置gauge的值
+func SetStatGauge(name string, value int64) {
+	statsLock.Lock()
+	statGauges[name] = value
+	statsLock.Unlock()
+}
+
+// CountZKWrite 按结果统计一次Zookeeper写入，返回err以便调用者直接返回
+func CountZKWrite(err error) error {
+	if err != nil {
+		IncStat(StatZKWriteFailure)
+	} else {
+		IncStat(StatZKWriteSuccess)
+	}
+	return err
+}
+
+// takeStatsDLines 以StatsD格式输出当前的统计数据，并将计数器清零
+func takeStatsDLines(prefix string) []string {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	lines := make([]string, 0, len(statCounters)+len(statGauges))
+	for name, value := range statCounters {
+		lines = append(lines, prefix+name+":"+strconv.FormatInt(value, 10)+"|c")
+	}
+	for name, value := range statGauges {
+		lines = append(lines, prefix+name+":"+strconv.FormatInt(value, 10)+"|g")
+	}
+	statCounters = make(map[string]int64)
+	sort.Strings(lines)
+	return lines
+}
+
+// sendStatsD 将统计数据写入w，每个包中的多行以换行分隔
+func sendStatsD(w io.Writer, prefix string) error {
+	var packet bytes.Buffer
+	for _, line := range takeStatsDLines(prefix) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacketSize {
+			if _, err := w.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err := w.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+// statsDPrefix 统计项名称的前缀，非空时以“.”结尾
+func statsDPrefix() string {
+	prefix := configData.StatsDPrefix
+	if len(prefix) > 0 && prefix[len(prefix)-1] != '.' {
+		prefix += "."
+	}
+	return prefix
+}
+
+// runStatsD 定期向StatsD推送统计数据
+func runStatsD() {
+	conn, err := net.Dial("udp", configData.StatsDAddr)
+	if err != nil {
+		glog.Error("StatsD Dial Failed: ", err)
+		return
+	}
+	defer conn.Close()
+
+	glog.Info("Push stats to StatsD ", configData.StatsDAddr)
+	for {
+		time.Sleep(time.Duration(configData.StatsDIntervalSeconds) * time.Second)
+		if err := sendStatsD(conn, statsDPrefix()); err != nil {
+			glog.Warning("StatsD Send Failed: ", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package initusercoin
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试向模拟的StatsD服务器推送统计数据
+func TestSendStatsD(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp failed: %s", err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial udp failed: %s", err)
+	}
+	defer conn.Close()
+
+	statCounters = make(map[string]int64)
+	statGauges = make(map[string]int64)
+	IncStat(StatFetchUserListSuccess)
+	IncStat(StatFetchUserListSuccess)
+	IncStat(StatFetchUserListFailure)
+	CountZKWrite(nil)
+	CountZKWrite(errors.New("zk down"))
+	SetStatGauge(StatUserCoinMapSize, 42)
+
+	configData = &ConfigData{StatsDPrefix: "usercoin"}
+	if err := sendStatsD(conn, statsDPrefix()); err != nil {
+		t.Fatalf("sendStatsD failed: %s", err)
+	}
+
+	buf := make([]byte, statsDMaxPacketSize)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read udp failed: %s", err)
+	}
+	expected := []string{
+		"usercoin.fetch_user_list.failure:1|c",
+		"usercoin.fetch_user_list.success:2|c",
+		"usercoin.user_coin_map.size:42|g",
+		"usercoin.zk_write.failure:1|c",
+		"usercoin.zk_write.success:1|c",
+	}
+	if lines := string(buf[:n]); lines != strings.Join(expected, "\n") {
+		t.Errorf("statsd lines expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), lines)
+	}
+
+	// 计数器在推送后清零，gauge保持
+	if lines := takeStatsDLines("usercoin."); len(lines) != 1 || lines[0] != "usercoin.user_coin_map.size:42|g" {
+		t.Errorf("only gauge should remain after push, got: %v", lines)
+	}
+}
@@ -0,0 +1,73 @@
+package initusercoin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Version 程序版本，可在构建时通过
+// -ldflags "-X github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin.Version=..." 设置
+var Version = "unknown"
+
+// FetchUserCoinMap 用户币种列表在 FetchStatuses 中的名称，各币种的子账户列表以币种名记录
+const FetchUserCoinMap = "user_coin_map"
+
+// FetchStatus 最近一次成功及失败的拉取
+type FetchStatus struct {
+	LastSuccess   int64  `json:"last_success"`    // 最近一次成功的时间，从未成功时为0
+	LastError     string `json:"last_error"`      // 最近一次失败的错误信息
+	LastErrorTime int64  `json:"last_error_time"` // 最近一次失败的时间，从未失败时为0
+}
+
+var fetchStatuses = make(map[string]FetchStatus)
+var fetchStatusesLock sync.RWMutex
+
+// RecordFetch 记录一次拉取的结果
+func RecordFetch(name string, err error) {
+	fetchStatusesLock.Lock()
+	defer fetchStatusesLock.Unlock()
+
+	status := fetchStatuses[name]
+	if err != nil {
+		status.LastError = err.Error()
+		status.LastErrorTime = time.Now().Unix()
+	} else {
+		status.LastSuccess = time.Now().Unix()
+	}
+	fetchStatuses[name] = status
+}
+
+// FetchStatuses 各币种子账户列表及用户币种列表的拉取状态，返回值为副本
+func FetchStatuses() map[string]FetchStatus {
+	fetchStatusesLock.RLock()
+	defer fetchStatusesLock.RUnlock()
+
+	statuses := make(map[string]FetchStatus, len(fetchStatuses))
+	for name, status := range fetchStatuses {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// UserCounts 内存中子账户列表的子账户数，total为所有币种合并后的子账户数
+// 按币种统计时包括所有已开始拉取的币种（即 LastPUIDs 中的币种）
+func UserCounts() (total int64, coins map[string]int64) {
+	coins = make(map[string]int64)
+	for coin := range LastPUIDs() {
+		coins[coin] = GetUserCount(coin)
+	}
+	return GetUserCount(""), coins
+}
+
+// ZookeeperState zookeeper连接的状态，conn为nil时为 "disconnected"，无法获取状态时为 "unknown"
+func ZookeeperState(conn Zookeeper) string {
+	if conn == nil {
+		return "disconnected"
+	}
+	if c, ok := conn.(interface{ State() zk.State }); ok {
+		return c.State().String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,21 @@
+package initusercoin
+
+import (
+	"errors"
+	"testing"
+)
+
+// 测试记录拉取状态，失败不覆盖最近一次成功的时间
+func TestRecordFetch(t *testing.T) {
+	RecordFetch("btc", nil)
+	RecordFetch("btc", errors.New("HTTP Request Failed"))
+
+	status := FetchStatuses()["btc"]
+	if status.LastSuccess == 0 || status.LastErrorTime == 0 || status.LastError != "HTTP Request Failed" {
+		t.Errorf("wrong fetch status: %+v", status)
+	}
+
+	if state := ZookeeperState(nil); state != "disconnected" {
+		t.Errorf("state of nil zookeeper expected: disconnected, got: %s", state)
+	}
+}
@@ -120,7 +120,7 @@ func HTTPPost(api AutoRegAPIConfig, data interface{}) (response []byte, err erro
 	}
 
 	// do request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		err = fmt.Errorf("Error when performing http request: %s", err)
 		return
@@ -1,6 +1,7 @@
 #include <map>
 #include <string>
 #include <mutex>
+#include <string.h>
 #include <time.h>
 
 #include "UserListJSON.h"
@@ -85,4 +86,29 @@ extern "C"
 		return itr->second;
 	}
 
+	// returns a copy of the puname (to be freed by the caller), or NULL if the puid is not in the list
+	char *getUserName(int puid, const char *coin) {
+		lock_guard<mutex> scopeLock(userIDMapLock);
+
+		auto mapItr = userIDMaps.find(coin);
+		if (mapItr == userIDMaps.end()) {
+			return nullptr;
+		}
+		auto itr = mapItr->second.find(puid);
+		if (itr == mapItr->second.end()) {
+			return nullptr;
+		}
+		return strdup(itr->second.c_str());
+	}
+
+	int64_t getUserCount(const char *coin) {
+		lock_guard<mutex> scopeLock(userIDMapLock);
+
+		auto itr = userIDMaps.find(coin);
+		if (itr == userIDMaps.end()) {
+			return 0;
+		}
+		return itr->second.size();
+	}
+
 } // end of extern "C"
@@ -10,6 +10,8 @@ extern "C"
     void addUser(int puid, const char *puname, const char *coin);
     const char *getUserListJson(int lastUserId, const char *coin);
     int64_t getUserUpdateTime(const char *puname, const char *coin);
+    int64_t getUserCount(const char *coin);
+    char *getUserName(int puid, const char *coin);
 
 #ifdef __cplusplus
 }
@@ -0,0 +1,94 @@
+package initusercoin
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// ready 预热是否已完成
+var ready bool
+var readyLock sync.Mutex
+var readyCond = sync.NewCond(&readyLock)
+
+// IsReady 返回是否就绪：预热已完成（各币种的子账户列表已完整拉取过一次），且没有停滞的拉取（见 FetchWatchdogSeconds）
+func IsReady() bool {
+	readyLock.Lock()
+	defer readyLock.Unlock()
+	return ready && len(StaleFetches()) == 0
+}
+
+// WaitReady 等待预热完成
+func WaitReady() {
+	readyLock.Lock()
+	defer readyLock.Unlock()
+	for !ready {
+		readyCond.Wait()
+	}
+}
+
+func setReady() {
+	readyLock.Lock()
+	ready = true
+	readyLock.Unlock()
+	readyCond.Broadcast()
+}
+
+// Warmup 启动时完整拉取一次各币种的子账户列表并记录进度，完成后标记为就绪
+// 返回各币种已拉取到的最大puid，供之后的增量拉取使用
+func Warmup() map[string]int {
+	lastPUIDs := make(map[string]int)
+	userIDMaps := make(map[string]map[string]int)
+	total := 0
+
+	if configData.ZKPrefetchConcurrency > 0 {
+		if _, err := PrefetchAllFromZK(int(configData.ZKPrefetchConcurrency)); err != nil {
+			// 预读失败时逐个检查记录
+			glog.Error("prefetch from zookeeper failed: ", err)
+		}
+		// 预读的记录只在预热期间使用，之后的记录可能被其他程序修改
+		defer clearPrefetched()
+	}
+
+	apis := userListAPI()
+	for coin, url := range apis {
+		userIDMap, err := fetchUserIDList(coin, url, 0, NewRequestID())
+		if err != nil {
+			// 失败的币种留给之后的增量拉取处理
+			glog.Error("warmup ", coin, " failed: ", err)
+			continue
+		}
+		userIDMaps[coin] = userIDMap
+		total += len(userIDMap)
+	}
+
+	glog.Info("warmup started, ", len(userIDMaps), "/", len(apis), " coins, ", total, " users")
+
+	done := 0
+	lastPercent := 0
+	for coin, userIDMap := range userIDMaps {
+		lastPUID := 0
+		for puname, puid := range userIDMap {
+			lastPUID = addUserOfCoin(coin, puname, puid, lastPUID)
+
+			done++
+			if percent := warmupPercent(done, total); percent/10 > lastPercent/10 {
+				lastPercent = percent
+				glog.Info("warmup ", percent, "% (", done, "/", total, " users)")
+			}
+		}
+		lastPUIDs[coin] = lastPUID
+	}
+
+	setReady()
+	glog.Info("warmup finished, ", done, " users")
+	return lastPUIDs
+}
+
+// warmupPercent 计算预热进度百分比
+func warmupPercent(done int, total int) int {
+	if total <= 0 {
+		return 100
+	}
+	return done * 100 / total
+}
@@ -0,0 +1,68 @@
+package initusercoin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试拉取用户id列表，包括0个用户时data为数组的情况
+func TestFetchUserIDList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("last_id") == "0" {
+			w.Write([]byte(`{"err_no":0,"err_msg":null,"data":{"aaa":1,"bbb_btc":2}}`))
+		} else {
+			w.Write([]byte(`{"err_no":0,"err_msg":null,"data":[]}`))
+		}
+	}))
+	defer server.Close()
+	configData = &ConfigData{UserListAPI: map[string]string{"btc": server.URL}}
+
+	userIDMap, err := fetchUserIDList("btc", server.URL, 0, "test")
+	if err != nil {
+		t.Fatalf("fetchUserIDList failed: %s", err)
+	}
+	if len(userIDMap) != 2 || userIDMap["aaa"] != 1 || userIDMap["bbb_btc"] != 2 {
+		t.Errorf("wrong user id list: %v", userIDMap)
+	}
+
+	userIDMap, err = fetchUserIDList("btc", server.URL, 2, "test")
+	if err != nil {
+		t.Fatalf("fetchUserIDList with empty result failed: %s", err)
+	}
+	if len(userIDMap) != 0 {
+		t.Errorf("user id list expected to be empty, got: %v", userIDMap)
+	}
+}
+
+// 测试预热完成后标记为就绪
+func TestWarmupSetsReady(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"err_no":0,"err_msg":null,"data":[]}`))
+	}))
+	defer server.Close()
+
+	configData = &ConfigData{
+		UserListAPI: map[string]string{"btc": server.URL, "bcc": server.URL},
+	}
+	ready = false
+
+	lastPUIDs := Warmup()
+	if !IsReady() {
+		t.Errorf("should be ready after warmup")
+	}
+	if len(lastPUIDs) != 2 {
+		t.Errorf("last puids of 2 coins expected, got: %v", lastPUIDs)
+	}
+	WaitReady()
+}
+
+// 测试预热进度计算
+func TestWarmupPercent(t *testing.T) {
+	if p := warmupPercent(4000, 10000); p != 40 {
+		t.Errorf("warmup percent expected: 40, got: %d", p)
+	}
+	if p := warmupPercent(0, 0); p != 100 {
+		t.Errorf("warmup percent of empty list expected: 100, got: %d", p)
+	}
+}
@@ -0,0 +1,91 @@
+package initusercoin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// fetchWatchdogCheckInterval 检查拉取是否停滞的间隔
+const fetchWatchdogCheckInterval = 10 * time.Second
+
+// StatFetchWatchdogAlarm 拉取停滞告警的次数
+const StatFetchWatchdogAlarm = "fetch_watchdog.alarm"
+
+// staleFetches 超过 FetchWatchdogSeconds 未成功的拉取，非空时不再就绪
+var staleFetches = make(map[string]bool)
+var staleFetchesLock sync.Mutex
+
+// watchdogStart 开始检查的时间，从未成功的拉取从此时开始计算
+var watchdogStart time.Time
+
+// StaleFetches 返回已停滞的拉取（币种名或 FetchUserCoinMap），按名称排序
+func StaleFetches() []string {
+	staleFetchesLock.Lock()
+	defer staleFetchesLock.Unlock()
+	names := make([]string, 0, len(staleFetches))
+	for name := range staleFetches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFetchWatchdog 检查各币种的子账户列表及用户币种列表最近一次成功拉取的时间
+// 超过window未成功时输出错误日志并计入告警，恢复时输出日志。返回当前停滞的拉取
+func checkFetchWatchdog(now time.Time, window time.Duration) []string {
+	statuses := FetchStatuses()
+	names := make(map[string]bool, len(statuses))
+	for coin := range userListAPI() {
+		names[coin] = true
+	}
+	// 用户币种列表只在启用了定时任务时拉取，开始拉取后才检查
+	for name := range statuses {
+		names[name] = true
+	}
+
+	staleFetchesLock.Lock()
+	defer staleFetchesLock.Unlock()
+	for name := range names {
+		status := statuses[name]
+		lastSuccess := watchdogStart
+		if status.LastSuccess > 0 {
+			lastSuccess = time.Unix(status.LastSuccess, 0)
+		}
+
+		stale := now.Sub(lastSuccess) > window
+		if stale && !staleFetches[name] {
+			glog.Error("FETCH WATCHDOG: no successful fetch of ", name, " since ", lastSuccess.UTC().Format("2006-01-02 15:04:05"),
+				" (", now.Sub(lastSuccess).Round(time.Second), "), last error: ", status.LastError, ", marked as not ready")
+			IncStat(StatFetchWatchdogAlarm)
+			staleFetches[name] = true
+		} else if !stale && staleFetches[name] {
+			glog.Info("fetch watchdog: fetch of ", name, " recovered")
+			delete(staleFetches, name)
+		}
+	}
+	for name := range staleFetches {
+		if !names[name] {
+			// 已从配置中移除的币种
+			delete(staleFetches, name)
+		}
+	}
+
+	stale := make([]string, 0, len(staleFetches))
+	for name := range staleFetches {
+		stale = append(stale, name)
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// runFetchWatchdog 定期检查拉取是否停滞
+func runFetchWatchdog(window time.Duration) {
+	watchdogStart = time.Now()
+	for {
+		time.Sleep(fetchWatchdogCheckInterval)
+		checkFetchWatchdog(time.Now(), window)
+	}
+}
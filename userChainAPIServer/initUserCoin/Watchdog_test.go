@@ -0,0 +1,58 @@
+package initusercoin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 测试拉取停滞时触发告警并标记为未就绪，恢复后重新就绪
+func TestFetchWatchdog(t *testing.T) {
+	configData = &ConfigData{UserListAPI: map[string]string{"btc": "http://btc", "bcc": "http://bcc"}}
+	fetchStatusesLock.Lock()
+	fetchStatuses = make(map[string]FetchStatus)
+	fetchStatusesLock.Unlock()
+	staleFetchesLock.Lock()
+	staleFetches = make(map[string]bool)
+	staleFetchesLock.Unlock()
+	setReady()
+	defer func() { ready = false }()
+
+	start := time.Now()
+	watchdogStart = start
+	window := 5 * time.Minute
+	RecordFetch("btc", nil)
+	RecordFetch(FetchUserCoinMap, nil)
+
+	if stale := checkFetchWatchdog(start.Add(time.Minute), window); len(stale) != 0 || !IsReady() {
+		t.Errorf("no stale fetch expected within window, got: %v", stale)
+	}
+
+	// bcc从未成功，btc和用户币种列表不再拉取
+	RecordFetch("bcc", errors.New("HTTP status 401 Unauthorized"))
+	alarms := statCounters[StatFetchWatchdogAlarm]
+	stale := checkFetchWatchdog(start.Add(10*time.Minute), window)
+	if len(stale) != 3 || stale[0] != "bcc" || stale[1] != "btc" || stale[2] != FetchUserCoinMap {
+		t.Errorf("all fetches expected to be stale, got: %v", stale)
+	}
+	if IsReady() {
+		t.Errorf("stale fetches should mark not ready")
+	}
+	if n := statCounters[StatFetchWatchdogAlarm] - alarms; n != 3 {
+		t.Errorf("3 alarms expected, got: %d", n)
+	}
+
+	// 持续停滞时不重复告警
+	checkFetchWatchdog(start.Add(11*time.Minute), window)
+	if n := statCounters[StatFetchWatchdogAlarm] - alarms; n != 3 {
+		t.Errorf("alarm expected only once per stale fetch, got: %d", n)
+	}
+
+	// 恢复后重新就绪
+	RecordFetch("btc", nil)
+	RecordFetch("bcc", nil)
+	RecordFetch(FetchUserCoinMap, nil)
+	if stale := checkFetchWatchdog(time.Now(), window); len(stale) != 0 || !IsReady() {
+		t.Errorf("recovered fetches expected to be ready, got: %v", stale)
+	}
+}
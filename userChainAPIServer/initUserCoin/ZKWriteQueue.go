@@ -0,0 +1,86 @@
+package initusercoin
+
+import (
+	"sync"
+	"time"
+)
+
+// Zookeeper写入队列的统计项
+const (
+	StatZKWriteQueueDepth       = "zk_write_queue.depth"
+	StatZKWriteQueueBusy        = "zk_write_queue.busy"
+	StatZKWriteQueueUtilization = "zk_write_queue.utilization"
+)
+
+// zkWriteQueue 限制用户币种记录写入的总并发数
+// 子账户列表的拉取、用户币种列表的定时任务、API及维护模式结束时的写入共用同一个队列
+type zkWriteQueue struct {
+	lock    sync.Mutex
+	slots   chan struct{} // 容量为并发数，为nil时不限制
+	waiting int64         // 等待空闲并发的写入数
+	busy    int64         // 正在进行的写入数
+}
+
+// 当前的写入队列
+var zkWrites = new(zkWriteQueue)
+
+// SetZKWriteConcurrency 设置用户币种记录写入的总并发数，为0时不限制
+// 已在进行或等待的写入仍按原来的并发数完成
+func SetZKWriteConcurrency(concurrency int) {
+	zkWrites.lock.Lock()
+	defer zkWrites.lock.Unlock()
+	if concurrency > 0 {
+		zkWrites.slots = make(chan struct{}, concurrency)
+	} else {
+		zkWrites.slots = nil
+	}
+	zkWrites.updateStatsLocked()
+}
+
+// acquire 等待空闲的并发，返回写入完成后应调用的release
+func (q *zkWriteQueue) acquire() (release func()) {
+	q.lock.Lock()
+	slots := q.slots
+	q.waiting++
+	q.updateStatsLocked()
+	q.lock.Unlock()
+
+	if slots != nil {
+		slots <- struct{}{}
+	}
+
+	q.lock.Lock()
+	q.waiting--
+	q.busy++
+	q.updateStatsLocked()
+	q.lock.Unlock()
+
+	return func() {
+		if slots != nil {
+			<-slots
+		}
+		q.lock.Lock()
+		q.busy--
+		q.updateStatsLocked()
+		q.lock.Unlock()
+	}
+}
+
+// updateStatsLocked 更新队列长度、正在进行的写入数及其占并发数的百分比
+func (q *zkWriteQueue) updateStatsLocked() {
+	SetStatGauge(StatZKWriteQueueDepth, q.waiting)
+	SetStatGauge(StatZKWriteQueueBusy, q.busy)
+	if q.slots != nil {
+		SetStatGauge(StatZKWriteQueueUtilization, q.busy*100/int64(cap(q.slots)))
+	}
+}
+
+// RunZKWrite 在写入队列中执行用户币种记录的Zookeeper写入，超时同 RunZKOp
+// 等待空闲并发的时间不计入timeout；写入超时后仍占用并发，直到操作实际完成，使Zookeeper上的并发不超过限制
+func RunZKWrite(timeout time.Duration, op func() error) error {
+	release := zkWrites.acquire()
+	return RunZKOp(timeout, func() error {
+		defer release()
+		return op()
+	})
+}
@@ -0,0 +1,125 @@
+package initusercoin
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// concurrencyZookeeper 记录同时进行的写入数的 MemZookeeper
+type concurrencyZookeeper struct {
+	*MemZookeeper
+	lock    sync.Mutex
+	current int
+	peak    int
+}
+
+func (c *concurrencyZookeeper) write() func() {
+	c.lock.Lock()
+	c.current++
+	if c.current > c.peak {
+		c.peak = c.current
+	}
+	c.lock.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	return func() {
+		c.lock.Lock()
+		c.current--
+		c.lock.Unlock()
+	}
+}
+
+func (c *concurrencyZookeeper) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer c.write()()
+	return c.MemZookeeper.Create(path, data, flags, acl)
+}
+
+func (c *concurrencyZookeeper) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+	defer c.write()()
+	return c.MemZookeeper.Set(path, data, version)
+}
+
+// 测试多个拉取同时写入时，Zookeeper上的写入总并发数不超过 ZKWriteConcurrency
+func TestZKWriteQueueConcurrency(t *testing.T) {
+	configData = &ConfigData{ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/", ZKOpTimeoutSeconds: 5}
+	conn := &concurrencyZookeeper{MemZookeeper: NewMemZookeeper()}
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	SetZKWriteConcurrency(3)
+	defer SetZKWriteConcurrency(0)
+
+	var wg sync.WaitGroup
+	for fetch := 0; fetch < 8; fetch++ {
+		wg.Add(1)
+		go func(fetch int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				path := fmt.Sprintf("%suser%d_%d", configData.ZKSwitcherWatchDir, fetch, i)
+				if fetch%2 == 0 {
+					// 子账户列表的拉取
+					if err := zkCreate(path, []byte("btc")); err != nil {
+						t.Errorf("create %s failed: %s", path, err)
+					}
+				} else {
+					// 用户币种列表的定时任务
+					if err := flushZKWrite(path, pendingZKWrite{data: []byte("bcc")}); err != nil {
+						t.Errorf("write %s failed: %s", path, err)
+					}
+				}
+			}
+		}(fetch)
+	}
+	wg.Wait()
+
+	if conn.peak > 3 {
+		t.Errorf("zookeeper write concurrency expected not more than 3, got: %d", conn.peak)
+	}
+	statsLock.Lock()
+	depth, busy := statGauges[StatZKWriteQueueDepth], statGauges[StatZKWriteQueueBusy]
+	statsLock.Unlock()
+	if depth != 0 || busy != 0 {
+		t.Errorf("queue expected to be empty after writes, depth: %d, busy: %d", depth, busy)
+	}
+}
+
+// 测试写入超时后仍占用并发，直到操作实际完成
+func TestZKWriteQueueTimeout(t *testing.T) {
+	SetZKWriteConcurrency(1)
+	defer SetZKWriteConcurrency(0)
+
+	done := make(chan struct{})
+	err := RunZKWrite(10*time.Millisecond, func() error {
+		<-done
+		return nil
+	})
+	if err != ErrZKOpTimeout {
+		t.Fatalf("timeout expected, got: %v", err)
+	}
+
+	started := make(chan struct{})
+	go RunZKWrite(0, func() error {
+		close(started)
+		return nil
+	})
+	select {
+	case <-started:
+		t.Fatalf("second write should wait for the timed out one")
+	case <-time.After(20 * time.Millisecond):
+	}
+	statsLock.Lock()
+	depth, utilization := statGauges[StatZKWriteQueueDepth], statGauges[StatZKWriteQueueUtilization]
+	statsLock.Unlock()
+	if depth != 1 || utilization != 100 {
+		t.Errorf("one waiting write and full utilization expected, depth: %d, utilization: %d", depth, utilization)
+	}
+
+	close(done)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Errorf("second write expected to run after the first one completed")
+	}
+}
@@ -1,12 +1,30 @@
 package initusercoin
 
 import (
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
+// Zookeeper 读写用户币种记录所用的Zookeeper操作，*zk.Conn 实现了该接口
+type Zookeeper interface {
+	Exists(path string) (bool, *zk.Stat, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Children(path string) ([]string, *zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	GetACL(path string) ([]zk.ACL, *zk.Stat, error)
+	SetACL(path string, acl []zk.ACL, version int32) (*zk.Stat, error)
+}
+
+var _ Zookeeper = (*zk.Conn)(nil)
+
 // 递归创建Zookeeper Node
 func createZookeeperPath(path string) error {
 	pathTrimmed := strings.Trim(path, "/")
@@ -30,7 +48,7 @@ func createZookeeperPath(path string) error {
 		}
 
 		// 不存在，创建
-		_, err = zookeeperConn.Create(currPath, []byte{}, 0, zk.WorldACL(zk.PermAll))
+		_, err = zookeeperConn.Create(currPath, []byte{}, 0, ZKNodeACL())
 
 		if err != nil {
 			// 再看看键是否存在（键可能已被其他线程创建）
@@ -47,3 +65,61 @@ func createZookeeperPath(path string) error {
 
 	return nil
 }
+
+// ErrZKOpTimeout Zookeeper操作超时
+var ErrZKOpTimeout = errors.New("zookeeper operation timeout")
+
+// RunZKOp 执行Zookeeper操作，超过timeout仍未完成时返回ErrZKOpTimeout，使调用者不会被缓慢的Zookeeper集群阻塞
+// 超时后操作仍会在后台继续执行，其结果被丢弃。timeout为0时不限制
+func RunZKOp(timeout time.Duration, op func() error) error {
+	if timeout <= 0 {
+		return op()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrZKOpTimeout
+	}
+}
+
+// zkOpTimeout 单次Zookeeper操作的超时时间
+func zkOpTimeout() time.Duration {
+	return time.Duration(configData.ZKOpTimeoutSeconds) * time.Second
+}
+
+// zkExists 带超时的 zk.Exists
+func zkExists(path string) (exists bool, err error) {
+	var result bool
+	err = RunZKOp(zkOpTimeout(), func() (err error) {
+		result, _, err = zookeeperConn.Exists(path)
+		return
+	})
+	if err != nil {
+		return false, err
+	}
+	return result, nil
+}
+
+// zkCreate 带超时的 zk.Create，维护模式下推迟写入
+func zkCreate(path string, data []byte) error {
+	if DeferZKWrite(path, data, true) {
+		return nil
+	}
+	start := time.Now()
+	err := RunZKWrite(zkOpTimeout(), func() (err error) {
+		_, err = zookeeperConn.Create(path, data, 0, ZKNodeACL())
+		return
+	})
+	backpressure.recordWrite(time.Since(start))
+	return CountZKWrite(err)
+}
@@ -0,0 +1,87 @@
+package initusercoin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试缓慢的Zookeeper操作会超时返回
+func TestRunZKOpTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	err := RunZKOp(50*time.Millisecond, func() error {
+		<-release
+		return nil
+	})
+	if err != ErrZKOpTimeout {
+		t.Errorf("slow op expected: %v, got: %v", ErrZKOpTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow op should return after timeout, took: %s", elapsed)
+	}
+
+	opErr := errors.New("no node")
+	if err := RunZKOp(time.Second, func() error { return opErr }); err != opErr {
+		t.Errorf("fast op expected: %v, got: %v", opErr, err)
+	}
+
+	// 为0时不限制
+	if err := RunZKOp(0, func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Errorf("op without timeout expected: nil, got: %v", err)
+	}
+}
+
+// 测试 MemZookeeper 的节点语义与watch
+func TestMemZookeeper(t *testing.T) {
+	conn := NewMemZookeeper()
+
+	if _, err := conn.Create("/a/b", []byte("x"), 0, zk.WorldACL(zk.PermAll)); err != zk.ErrNoNode {
+		t.Errorf("create without parent expected: %v, got: %v", zk.ErrNoNode, err)
+	}
+	zookeeperConn = conn
+	if err := createZookeeperPath("/a/b/"); err != nil {
+		t.Fatalf("createZookeeperPath failed: %s", err)
+	}
+	if _, err := conn.Create("/a/b", nil, 0, zk.WorldACL(zk.PermAll)); err != zk.ErrNodeExists {
+		t.Errorf("create existing node expected: %v, got: %v", zk.ErrNodeExists, err)
+	}
+
+	children, _, childEvents, err := conn.ChildrenW("/a")
+	if err != nil || len(children) != 1 || children[0] != "b" {
+		t.Errorf("children of /a expected: [b], got: %v, %v", children, err)
+	}
+	_, stat, dataEvents, _ := conn.ExistsW("/a/b")
+	if _, err := conn.Set("/a/b", []byte("y"), stat.Version+1); err != zk.ErrBadVersion {
+		t.Errorf("set with wrong version expected: %v, got: %v", zk.ErrBadVersion, err)
+	}
+	if _, err := conn.Set("/a/b", []byte("y"), stat.Version); err != nil {
+		t.Errorf("set failed: %s", err)
+	}
+	if event := <-dataEvents; event.Type != zk.EventNodeDataChanged || event.Path != "/a/b" {
+		t.Errorf("wrong data event: %+v", event)
+	}
+	if data, _, _ := conn.Get("/a/b"); string(data) != "y" {
+		t.Errorf("data of /a/b expected: y, got: %s", data)
+	}
+
+	if err := conn.Delete("/a", -1); err != zk.ErrNotEmpty {
+		t.Errorf("delete non-empty node expected: %v, got: %v", zk.ErrNotEmpty, err)
+	}
+	if err := conn.Delete("/a/b", -1); err != nil {
+		t.Errorf("delete failed: %s", err)
+	}
+	if event := <-childEvents; event.Type != zk.EventNodeChildrenChanged || event.Path != "/a" {
+		t.Errorf("wrong children event: %+v", event)
+	}
+	if exists, _, _ := conn.Exists("/a/b"); exists {
+		t.Errorf("/a/b should be deleted")
+	}
+}
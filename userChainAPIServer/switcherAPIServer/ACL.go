@@ -0,0 +1,56 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// defaultZKACLMigrateConcurrency 迁移ACL时默认的并发数
+const defaultZKACLMigrateConcurrency = 8
+
+// MigrateACLResponse 迁移ACL的API响应
+type MigrateACLResponse struct {
+	APIResponse
+	*initusercoin.ZKACLMigration
+}
+
+// migrateACLHandle 将 ZKSwitcherWatchDir 下所有子账户节点的ACL设置为 ZKDigestAuth 的ACL
+// 已迁移的节点会被跳过，失败时可重复调用。与批量对账共用 MaxConcurrentBulkOps 的并发限制
+func migrateACLHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, 405, "method not allowed, use POST")
+		return
+	}
+	if configData.ZKDigestAuth == "" {
+		writeError(w, 400, "ZKDigestAuth is not configured")
+		return
+	}
+	if !acquireBulkOp(w) {
+		return
+	}
+	defer bulkOps.release()
+
+	migration, err := initusercoin.MigrateZKACL(zookeeperConn, configData.ZKSwitcherWatchDir,
+		initusercoin.ZKNodeACL(), int(configData.ZKACLMigrateConcurrency), zkOpTimeout())
+	if err != nil {
+		writeError(w, 500, "list zookeeper nodes failed: "+err.Error())
+		return
+	}
+
+	var apiErr *APIError
+	if len(migration.Failed) > 0 {
+		apiErr = NewAPIError(500, fmt.Sprintf("%d nodes failed", len(migration.Failed)))
+	}
+	audit(newAuditRecord(req, auditOpMigrateACL, configData.ZKSwitcherWatchDir, "",
+		fmt.Sprintf("migrated %d, unchanged %d", migration.Migrated, migration.Unchanged), apiErr))
+
+	response := MigrateACLResponse{APIResponse{0, "", true}, migration}
+	if apiErr != nil {
+		response.APIResponse = APIResponse{apiErr.ErrNo, apiErr.ErrMsg, false}
+	}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
@@ -42,4 +42,20 @@ var (
 
 	// APIErrUserCoinsEmpty 用户币种数组为空
 	APIErrUserCoinsEmpty = NewAPIError(108, "usercoins is empty")
+
+	// APIErrUserIgnored 子账户在忽略列表中
+	APIErrUserIgnored = NewAPIError(109, "user ignored")
+
+	// APIErrPunamesEmpty 子账户数组为空
+	APIErrPunamesEmpty = NewAPIError(110, "punames is empty")
+	// APIErrTooManyPunames 子账户数组过长
+	APIErrTooManyPunames = NewAPIError(111, "too many punames")
+	// APIErrUserNotFound 上游用户币种列表中没有该子账户
+	APIErrUserNotFound = NewAPIError(112, "user not found in upstream")
+	// APIErrPunameTooLong puname过长
+	APIErrPunameTooLong = NewAPIError(113, "puname too long")
+	// APIErrTooManyBulkOps 同时进行的批量操作过多
+	APIErrTooManyBulkOps = NewAPIError(114, "too many bulk operations in progress")
+	// APIErrInvalidSample 抽样数不合法
+	APIErrInvalidSample = NewAPIError(115, "invalid sample size")
 )
@@ -0,0 +1,92 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// auditLogBufferSize 审计日志的缓冲区大小，写入跟不上时丢弃新记录而不阻塞请求
+const auditLogBufferSize = 1024
+
+// 审计日志记录的操作
+const (
+	auditOpSwitch          = "switch"
+	auditOpSwitchMultiUser = "switch-multi-user"
+	auditOpReconcile       = "reconcile"
+	auditOpSubPoolUpdate   = "subpool-update"
+	auditOpMigrateACL      = "migrate-acl"
+)
+
+// AuditRecord 通过API执行的修改操作的审计记录
+type AuditRecord struct {
+	Time      int64  `json:"time"`
+	Operator  string `json:"operator"` // Basic认证的用户名
+	Source    string `json:"source"`   // 请求来源地址
+	Operation string `json:"operation"`
+	Target    string `json:"target"` // 子账户名，或子池的“币种/子池名”
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	Success   bool   `json:"success"`
+	ErrMsg    string `json:"err_msg,omitempty"`
+}
+
+// auditRecords 待写入的审计记录，未配置 AuditLogFile 时为nil
+var auditRecords chan AuditRecord
+
+// newAuditRecord 创建请求req的审计记录
+func newAuditRecord(req *http.Request, operation string, target string, oldValue string, newValue string, apiErr *APIError) AuditRecord {
+	operator, _, _ := req.BasicAuth()
+	record := AuditRecord{
+		Time:      time.Now().Unix(),
+		Operator:  operator,
+		Source:    req.RemoteAddr,
+		Operation: operation,
+		Target:    target,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		Success:   apiErr == nil,
+	}
+	if apiErr != nil {
+		record.ErrMsg = apiErr.ErrMsg
+	}
+	return record
+}
+
+// audit 记录审计日志，不会阻塞调用者
+func audit(record AuditRecord) {
+	if auditRecords == nil {
+		return
+	}
+	select {
+	case auditRecords <- record:
+	default:
+		glog.Warning("audit log buffer full, record dropped: ", record)
+	}
+}
+
+// initAuditLog 打开审计日志文件并启动写入
+func initAuditLog(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	auditRecords = make(chan AuditRecord, auditLogBufferSize)
+	go runAuditLogWriter(file, auditRecords)
+	return nil
+}
+
+// runAuditLogWriter 将审计记录逐行以JSON格式写入w
+func runAuditLogWriter(w io.Writer, records <-chan AuditRecord) {
+	for record := range records {
+		line, _ := json.Marshal(record)
+		_, err := w.Write(append(line, '\n'))
+		if err != nil {
+			glog.Error("write audit log failed: ", err, "; ", string(line))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package switcherapiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// 测试通过API切换币种时产生审计记录
+func TestSwitchAudit(t *testing.T) {
+	configData = &ConfigData{
+		AvailableCoins:      []string{"btc", "bcc"},
+		IgnoredUserPrefixes: []string{"test_"},
+	}
+	auditRecords = make(chan AuditRecord, 2)
+	defer func() { auditRecords = nil }()
+
+	req := httptest.NewRequest("GET", "/switch?puname=abc&coin=ltc", nil)
+	req.SetBasicAuth("admin", "admin")
+	req.RemoteAddr = "10.0.0.1:12345"
+	switchHandle(httptest.NewRecorder(), req)
+
+	// 被忽略的子账户没有被修改，不记录
+	req = httptest.NewRequest("GET", "/switch?puname=test_abc&coin=btc", nil)
+	switchHandle(httptest.NewRecorder(), req)
+
+	if len(auditRecords) != 1 {
+		t.Fatalf("audit records expected: 1, got: %d", len(auditRecords))
+	}
+	record := <-auditRecords
+	record.Time = 0
+	expected := AuditRecord{
+		Operator:  "admin",
+		Source:    "10.0.0.1:12345",
+		Operation: auditOpSwitch,
+		Target:    "abc",
+		NewValue:  "ltc",
+		ErrMsg:    APIErrCoinIsInexistent.ErrMsg,
+	}
+	if record != expected {
+		t.Errorf("audit record expected: %+v, got: %+v", expected, record)
+	}
+
+	// 切换成功
+	configData.ZKSwitcherWatchDir = "/stratumSwitcher/btcbcc/"
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	req = httptest.NewRequest("GET", "/switch?puname=abc&coin=bcc", nil)
+	req.SetBasicAuth("admin", "admin")
+	switchHandle(httptest.NewRecorder(), req)
+
+	record = <-auditRecords
+	if record.Operator != "admin" || record.Target != "abc" || record.NewValue != "bcc" || !record.Success || record.ErrMsg != "" {
+		t.Errorf("wrong audit record of successful switch: %+v", record)
+	}
+}
+
+// 测试审计记录写入及缓冲区满时不阻塞
+func TestAuditLogWriter(t *testing.T) {
+	auditRecords = make(chan AuditRecord, 1)
+	defer func() { auditRecords = nil }()
+
+	audit(AuditRecord{Time: 1500000000, Operator: "admin", Operation: auditOpSwitch, Target: "abc", OldValue: "btc", NewValue: "bcc", Success: true})
+	// 缓冲区已满，丢弃而不阻塞
+	audit(AuditRecord{Target: "dropped"})
+	close(auditRecords)
+
+	var buf bytes.Buffer
+	runAuditLogWriter(&buf, auditRecords)
+
+	var record AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("parse audit log failed: %s; %s", err, buf.String())
+	}
+	if record.Target != "abc" || record.OldValue != "btc" || record.NewValue != "bcc" || !record.Success {
+		t.Errorf("wrong audit record: %s", buf.String())
+	}
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("one audit line expected, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,87 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// compareMaxPunames 单次比较的最大子账户数
+const compareMaxPunames = 100
+
+// CompareUser 单个子账户当前的币种
+type CompareUser struct {
+	PUName  string `json:"puname"`
+	Chain   string `json:"chain"`   // zookeeper中记录的币种，子账户不存在时为空
+	Exists  bool   `json:"exists"`  // 子账户在zookeeper中是否存在
+	Differs bool   `json:"differs"` // 币种与多数子账户的币种不同
+}
+
+// CompareResponse 比较子账户币种的响应数据结构
+type CompareResponse struct {
+	APIResponse
+	Chain     string        `json:"chain"`      // 多数子账户所在的币种
+	SameChain bool          `json:"same_chain"` // 所有子账户都存在且币种相同
+	Users     []CompareUser `json:"users"`
+}
+
+// compareUsers 标记币种与多数子账户不同的子账户，票数相同时以先出现的币种为准
+func compareUsers(users []CompareUser) (chain string, sameChain bool) {
+	counts := make(map[string]int)
+	for _, user := range users {
+		if user.Exists {
+			counts[user.Chain]++
+			if counts[user.Chain] > counts[chain] {
+				chain = user.Chain
+			}
+		}
+	}
+	sameChain = true
+	for i := range users {
+		users[i].Differs = !users[i].Exists || users[i].Chain != chain
+		if users[i].Differs {
+			sameChain = false
+		}
+	}
+	return
+}
+
+// compareHandle 并排返回多个子账户当前的币种并标出不同者，用于排查同一客户的子账户为何不在同一币种
+// 形如 /compare?users=a,b,c
+func compareHandle(w http.ResponseWriter, req *http.Request) {
+	var punames []string
+	for _, puname := range strings.Split(req.URL.Query().Get("users"), ",") {
+		if puname = strings.TrimSpace(puname); len(puname) > 0 {
+			punames = append(punames, puname)
+		}
+	}
+	if apiErr := checkPunames(punames, compareMaxPunames); apiErr != nil {
+		writeErrorStatus(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	users := make([]CompareUser, len(punames))
+	for i, puname := range punames {
+		users[i].PUName = puname
+		zkPath := configData.ZKSwitcherWatchDir + RegularUserName(puname)
+		data, err := zkGet(zkPath)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			glog.Error("zk.Get(", zkPath, ") Failed: ", err)
+			writeError(w, APIErrReadRecordFailed.ErrNo, APIErrReadRecordFailed.ErrMsg)
+			return
+		}
+		users[i].Chain = string(data)
+		users[i].Exists = true
+	}
+
+	chain, sameChain := compareUsers(users)
+	response := CompareResponse{APIResponse{0, "", true}, chain, sameChain, users}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
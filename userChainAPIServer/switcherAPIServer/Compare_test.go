@@ -0,0 +1,62 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试比较多个子账户的币种，包括不存在的子账户
+func TestCompareHandle(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir:           "/stratumSwitcher/btcbcc/",
+		StratumServerCaseInsensitive: true,
+	}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	for puname, coin := range map[string]string{"aaa": "btc", "bbb": "bcc", "ccc": "bcc"} {
+		zookeeperConn.Create(configData.ZKSwitcherWatchDir+puname, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	}
+
+	recorder := httptest.NewRecorder()
+	compareHandle(recorder, httptest.NewRequest("GET", "/compare?users=AAA,bbb,,ccc,ddd", nil))
+
+	var response CompareResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	if !response.Success || response.Chain != "bcc" || response.SameChain {
+		t.Errorf("unexpected response: %s", recorder.Body.String())
+	}
+	expected := []CompareUser{
+		{PUName: "AAA", Chain: "btc", Exists: true, Differs: true},
+		{PUName: "bbb", Chain: "bcc", Exists: true},
+		{PUName: "ccc", Chain: "bcc", Exists: true},
+		{PUName: "ddd", Differs: true},
+	}
+	if len(response.Users) != len(expected) {
+		t.Fatalf("users expected: %+v, got: %+v", expected, response.Users)
+	}
+	for i := range expected {
+		if response.Users[i] != expected[i] {
+			t.Errorf("user %d expected: %+v, got: %+v", i, expected[i], response.Users[i])
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	compareHandle(recorder, httptest.NewRequest("GET", "/compare?users=bbb,ccc", nil))
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if !response.SameChain || response.Users[0].Differs || response.Users[1].Differs {
+		t.Errorf("same chain expected: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	compareHandle(recorder, httptest.NewRequest("GET", "/compare?users=", nil))
+	if !strings.Contains(recorder.Body.String(), APIErrPunamesEmpty.ErrMsg) {
+		t.Errorf("empty users expected error: %s, got: %s", APIErrPunamesEmpty.ErrMsg, recorder.Body.String())
+	}
+}
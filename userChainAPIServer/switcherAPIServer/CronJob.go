@@ -2,11 +2,14 @@ package switcherapiserver
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
 	"github.com/golang/glog"
 )
 
@@ -23,72 +26,154 @@ type UserCoinMapResponse struct {
 	Data   UserCoinMapData `json:"data"`
 }
 
+// 上次请求用户币种列表接口的时间（接口返回的now_date）
+var lastRequestDate int64
+var lastRequestDateLock sync.RWMutex
+
+// LastRequestDate 上次请求用户币种列表接口的时间，尚未请求过时为0
+func LastRequestDate() int64 {
+	lastRequestDateLock.RLock()
+	defer lastRequestDateLock.RUnlock()
+	return lastRequestDate
+}
+
+// coinMapValidators 用户币种列表接口上次响应的 ETag 和 Last-Modified，用于条件请求
+type coinMapValidators struct {
+	url          string // 不含 last_date 参数的接口地址，地址变化后不再使用旧的值
+	etag         string
+	lastModified string
+}
+
+// 定时任务上次拉取用户币种列表时的条件请求信息，只在定时任务中访问
+var cronValidators coinMapValidators
+
+func setLastRequestDate(date int64) {
+	lastRequestDateLock.Lock()
+	lastRequestDate = date
+	lastRequestDateLock.Unlock()
+}
+
 // RunCronJob 运行定时检测任务
 func RunCronJob() {
 	defer waitGroup.Done()
 
-	// 上次请求接口的时间
-	var lastRequestDate int64
+	// 等待子账户列表预热完成，使首次（完整）拉取时所有子账户都已在列表中
+	initusercoin.WaitReady()
 
 	for true {
 		// 休眠放在开头，防止一启动就报 Too new user
-		time.Sleep(time.Duration(configData.CronIntervalSeconds) * time.Second)
-
-		// 执行操作
-		// 定义在函数中，这样失败时可以简单的return并进入休眠
-		func() {
-
-			url := configData.UserCoinMapURL
-			// 若上次请求过接口，则附加上次请求的时间到url
-			if lastRequestDate > 0 {
-				// 减去configData.CronIntervalSeconds是为了防止出现竟态条件。
-				// 比如在上次拉取之后，同一秒内又有币种切换，如果不减去，就可能会错过这个切换消息。
-				url += "?last_date=" + strconv.FormatInt(lastRequestDate-int64(configData.CronIntervalSeconds), 10)
-			}
-			glog.Info("HTTP GET ", url)
-			response, err := http.Get(url)
+		interval := cronInterval()
+		time.Sleep(interval)
 
-			if err != nil {
-				glog.Error("HTTP Request Failed: ", err)
-				return
-			}
+		runCronJobOnce(interval)
+	}
+}
 
-			body, err := ioutil.ReadAll(response.Body)
+// runCronJobOnce 执行一次定时检测
+// 定义为单独的函数，这样失败时可以简单的return并进入休眠
+func runCronJobOnce(interval time.Duration) {
+	url := userCoinMapURL()
+	if cronValidators.url != url {
+		cronValidators = coinMapValidators{url: url}
+	}
+	// 若上次请求过接口，则附加上次请求的时间到url
+	lastRequestDate := LastRequestDate()
+	if lastRequestDate > 0 {
+		// 减去CronIntervalSeconds是为了防止出现竟态条件。
+		// 比如在上次拉取之后，同一秒内又有币种切换，如果不减去，就可能会错过这个切换消息。
+		url += "?last_date=" + strconv.FormatInt(lastRequestDate-int64(interval/time.Second), 10)
+	}
+	userCoinMap, err := fetchUserCoinMap(url, initusercoin.NewRequestID(), &cronValidators)
 
-			if err != nil {
-				glog.Error("HTTP Fetch Body Failed: ", err)
-				return
-			}
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	if userCoinMap == nil {
+		// 接口返回 304 Not Modified，没有需要更新的子账户
+		return
+	}
 
-			userCoinMapResponse := new(UserCoinMapResponse)
+	// 记录本次请求的时间
+	setLastRequestDate(userCoinMap.NowDate)
 
-			err = json.Unmarshal(body, userCoinMapResponse)
+	// 遍历用户币种列表
+	for puname, coin := range userCoinMap.UserCoin {
+		oldCoin, err := changeMiningCoin(puname, coin)
 
-			if err != nil {
-				glog.Error("Parse Result Failed: ", err, "; ", string(body))
-				return
-			}
+		if err != nil {
+			glog.Info(err.ErrMsg, ": ", puname, ": ", oldCoin, " -> ", coin)
+		} else {
+			glog.Info("success: ", puname, ": ", oldCoin, " -> ", coin)
+		}
+	}
+}
 
-			if userCoinMapResponse.ErrNo != 0 {
-				glog.Error("API Returned a Error: ", string(body))
-				return
+// fetchUserCoinMap 拉取用户币种列表
+// requestID 通过 X-Request-ID 头发送给上游API并记录在日志中
+// validators 不为nil时发送条件请求，接口返回 304 Not Modified 时返回 nil, nil，成功时记录新的 ETag 和 Last-Modified
+func fetchUserCoinMap(url string, requestID string, validators *coinMapValidators) (userCoinMap *UserCoinMapData, err error) {
+	defer func() {
+		if err != nil {
+			initusercoin.IncStat(initusercoin.StatFetchUserCoinMapFailure)
+			err = fmt.Errorf("%s (request id: %s)", err, requestID)
+		} else {
+			initusercoin.IncStat(initusercoin.StatFetchUserCoinMapSuccess)
+			if userCoinMap != nil {
+				initusercoin.SetStatGauge(initusercoin.StatUserCoinMapSize, int64(len(userCoinMap.UserCoin)))
 			}
+		}
+		initusercoin.RecordFetch(initusercoin.FetchUserCoinMap, err)
+	}()
+
+	glog.Info("HTTP GET ", url, " (request id: ", requestID, ")")
+	request, err := initusercoin.NewGetRequest(url, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP Request Failed: %s", err)
+	}
+	if validators != nil {
+		if validators.etag != "" {
+			request.Header.Set("If-None-Match", validators.etag)
+		}
+		if validators.lastModified != "" {
+			request.Header.Set("If-Modified-Since", validators.lastModified)
+		}
+	}
+	response, err := httpClient.Do(request)
 
-			// 记录本次请求的时间
-			lastRequestDate = userCoinMapResponse.Data.NowDate
+	if err != nil {
+		return nil, fmt.Errorf("HTTP Request Failed: %s", err)
+	}
+	defer response.Body.Close()
 
-			glog.Info("HTTP GET Success. TimeStamp: ", userCoinMapResponse.Data.NowDate, "; UserCoin Num: ", len(userCoinMapResponse.Data.UserCoin))
+	if validators != nil && response.StatusCode == http.StatusNotModified {
+		glog.Info("HTTP GET Not Modified (request id: ", requestID, ")")
+		return nil, nil
+	}
 
-			// 遍历用户币种列表
-			for puname, coin := range userCoinMapResponse.Data.UserCoin {
-				oldCoin, err := changeMiningCoin(puname, coin)
+	body, err := ioutil.ReadAll(response.Body)
 
-				if err != nil {
-					glog.Info(err.ErrMsg, ": ", puname, ": ", oldCoin, " -> ", coin)
-				} else {
-					glog.Info("success: ", puname, ": ", oldCoin, " -> ", coin)
-				}
-			}
-		}()
+	if err != nil {
+		return nil, fmt.Errorf("HTTP Fetch Body Failed: %s", err)
 	}
+
+	userCoinMapResponse := new(UserCoinMapResponse)
+
+	err = json.Unmarshal(body, userCoinMapResponse)
+
+	if err != nil {
+		return nil, fmt.Errorf("Parse Result Failed: %s; %s", err, string(body))
+	}
+
+	if userCoinMapResponse.ErrNo != 0 {
+		return nil, fmt.Errorf("API Returned a Error: %s", string(body))
+	}
+
+	if validators != nil {
+		validators.etag = response.Header.Get("ETag")
+		validators.lastModified = response.Header.Get("Last-Modified")
+	}
+
+	glog.Info("HTTP GET Success. TimeStamp: ", userCoinMapResponse.Data.NowDate, "; UserCoin Num: ", len(userCoinMapResponse.Data.UserCoin), " (request id: ", requestID, ")")
+	return &userCoinMapResponse.Data, nil
 }
@@ -0,0 +1,79 @@
+package switcherapiserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 测试定时任务的条件请求：200 时记录 ETag 和 Last-Modified，304 时不解析也不处理子账户
+func TestRunCronJobOnceNotModified(t *testing.T) {
+	const lastModified = "Fri, 14 Jul 2017 02:40:00 GMT"
+	requests := 0
+	var ifNoneMatch, ifModifiedSince string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		ifNoneMatch = req.Header.Get("If-None-Match")
+		ifModifiedSince = req.Header.Get("If-Modified-Since")
+		if ifNoneMatch == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprintf(w, `{"err_no":0,"err_msg":"","data":{"user_coin":{"abc":"btc"},"now_date":%d}}`, 1500000000+requests)
+	}))
+	defer server.Close()
+
+	// abc 被忽略，不会访问zookeeper，是否被处理可从日志中看到
+	configData = &ConfigData{
+		UserCoinMapURL: server.URL,
+		AvailableCoins: []string{"btc", "bcc"},
+		IgnoredUsers:   []string{"abc"},
+	}
+	httpClient = http.DefaultClient
+	zookeeperConn = nil
+	setLastRequestDate(0)
+	cronValidators = coinMapValidators{}
+
+	// 首次请求不带条件
+	log := captureLog(func() {
+		runCronJobOnce(cronInterval())
+	})
+	if ifNoneMatch != "" || ifModifiedSince != "" {
+		t.Errorf("first fetch should not be conditional, got: %q, %q", ifNoneMatch, ifModifiedSince)
+	}
+	if !strings.Contains(log, ": abc: ") {
+		t.Errorf("user abc should be processed on 200, log:\n%s", log)
+	}
+	if date := LastRequestDate(); date != 1500000001 {
+		t.Errorf("last request date expected: 1500000001, got: %d", date)
+	}
+
+	log = captureLog(func() {
+		runCronJobOnce(cronInterval())
+	})
+	if ifNoneMatch != `"v1"` || ifModifiedSince != lastModified {
+		t.Errorf("second fetch should send validators, got: %q, %q", ifNoneMatch, ifModifiedSince)
+	}
+	if strings.Contains(log, ": abc: ") {
+		t.Errorf("user abc should not be processed on 304, log:\n%s", log)
+	}
+	if date := LastRequestDate(); date != 1500000001 {
+		t.Errorf("304 should keep last request date, got: %d", date)
+	}
+
+	// 接口地址变化后不再发送旧的条件
+	server2 := httptest.NewServer(server.Config.Handler)
+	defer server2.Close()
+	configData.UserCoinMapURL = server2.URL
+	runCronJobOnce(cronInterval())
+	if ifNoneMatch != "" {
+		t.Errorf("validators of old url should not be sent, got: %q", ifNoneMatch)
+	}
+	if requests != 3 {
+		t.Errorf("requests expected: 3, got: %d", requests)
+	}
+}
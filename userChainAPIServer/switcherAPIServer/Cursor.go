@@ -0,0 +1,24 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// CursorsResponse 增量拉取进度的API响应
+type CursorsResponse struct {
+	LastPUID        map[string]int `json:"last_puid"`
+	LastRequestDate int64          `json:"last_request_date"`
+}
+
+// cursorsHandle 查询各币种子账户列表及用户币种列表的增量拉取进度
+func cursorsHandle(w http.ResponseWriter, req *http.Request) {
+	response := CursorsResponse{
+		LastPUID:        initusercoin.LastPUIDs(),
+		LastRequestDate: LastRequestDate(),
+	}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
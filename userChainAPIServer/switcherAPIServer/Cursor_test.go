@@ -0,0 +1,50 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试拉取用户币种列表后 /cursors 反映最新的拉取进度
+func TestCursorsHandle(t *testing.T) {
+	var lastDate string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lastDate = req.URL.Query().Get("last_date")
+		w.Write([]byte(`{"err_no":0,"err_msg":"","data":{"user_coin":{},"now_date":1500000000}}`))
+	}))
+	defer server.Close()
+
+	configData = &ConfigData{UserCoinMapURL: server.URL, CronIntervalSeconds: 60}
+	httpClient = http.DefaultClient
+	setLastRequestDate(0)
+
+	getCursors := func() CursorsResponse {
+		recorder := httptest.NewRecorder()
+		cursorsHandle(recorder, httptest.NewRequest("GET", "/cursors", nil))
+		var response CursorsResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+		}
+		return response
+	}
+
+	if cursors := getCursors(); cursors.LastRequestDate != 0 {
+		t.Errorf("last_request_date expected: 0, got: %d", cursors.LastRequestDate)
+	}
+
+	runCronJobOnce(cronInterval())
+	if lastDate != "" {
+		t.Errorf("first fetch should not have last_date, got: %s", lastDate)
+	}
+	if cursors := getCursors(); cursors.LastRequestDate != 1500000000 {
+		t.Errorf("last_request_date expected: 1500000000, got: %d", cursors.LastRequestDate)
+	}
+
+	// 下次拉取从上次请求的时间（减去拉取间隔）开始
+	runCronJobOnce(cronInterval())
+	if lastDate != "1499999940" {
+		t.Errorf("last_date expected: 1499999940, got: %s", lastDate)
+	}
+}
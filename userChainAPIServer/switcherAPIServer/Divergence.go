@@ -0,0 +1,185 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 未指定 sample 参数时抽样检查的子账户数
+const defaultDivergenceSample = 1000
+
+// divergenceMaxUsers 单次检查的最大子账户数（包括 full=true 的完整检查）
+const divergenceMaxUsers = 100000
+
+// 差异原因
+const (
+	// divergenceZKNodeMissing 子账户在内存的子账户列表中，但zookeeper中没有其币种记录
+	divergenceZKNodeMissing = "zk_node_missing"
+	// divergenceZKCoinNotInMemory zookeeper中记录的币种的子账户列表不包含该子账户
+	divergenceZKCoinNotInMemory = "zk_coin_not_in_memory"
+)
+
+// DivergenceResult 内存与zookeeper不一致的子账户
+type DivergenceResult struct {
+	PUName      string   `json:"puname"`
+	MemoryCoins []string `json:"memory_coins"` // 内存中包含该子账户的币种子账户列表
+	ZKCoin      string   `json:"zk_coin"`      // zookeeper中的币种，节点不存在时为空
+	Reason      string   `json:"reason"`
+}
+
+// DivergenceResponse 内存与zookeeper差异报告的响应数据结构
+type DivergenceResponse struct {
+	APIResponse
+	Total       int                `json:"total"`       // 内存中所有币种合并后的子账户数
+	Checked     int                `json:"checked"`     // 本次检查的子账户数
+	Full        bool               `json:"full"`        // 是否为完整检查
+	Truncated   bool               `json:"truncated"`   // 完整检查是否因超过上限而只检查了部分子账户
+	Failed      []string           `json:"failed"`      // 读取zookeeper失败的子账户
+	Divergences []DivergenceResult `json:"divergences"` // 不一致的子账户，按子账户名排序
+}
+
+// memoryCoins 返回内存中包含该子账户的币种子账户列表，按 AvailableCoins 的顺序
+func memoryCoins(puname string) []string {
+	coins := []string{}
+	for _, coin := range configData.AvailableCoins {
+		if initusercoin.GetUserUpdateTime(puname, coin) > 0 {
+			coins = append(coins, coin)
+		}
+	}
+	return coins
+}
+
+// checkDivergence 以 reconcileConcurrency 的并发比较子账户在内存与zookeeper中的币种
+func checkDivergence(punames []string) (divergences []DivergenceResult, failed []string) {
+	results := make([]*DivergenceResult, len(punames))
+	errors := make([]bool, len(punames))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < reconcileConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				puname := punames[index]
+				zkPath := configData.ZKSwitcherWatchDir + RegularUserName(puname)
+				data, err := zkGet(zkPath)
+				if err != nil && err != zk.ErrNoNode {
+					glog.Error("zk.Get(", zkPath, ") Failed: ", err)
+					errors[index] = true
+					continue
+				}
+
+				result := DivergenceResult{PUName: puname, MemoryCoins: memoryCoins(puname), ZKCoin: string(data)}
+				if err == zk.ErrNoNode {
+					result.Reason = divergenceZKNodeMissing
+					results[index] = &result
+					continue
+				}
+				inMemory := false
+				for _, coin := range result.MemoryCoins {
+					if coin == result.ZKCoin {
+						inMemory = true
+						break
+					}
+				}
+				if !inMemory {
+					result.Reason = divergenceZKCoinNotInMemory
+					results[index] = &result
+				}
+			}
+		}()
+	}
+	for index := range punames {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	divergences = []DivergenceResult{}
+	failed = []string{}
+	for index, result := range results {
+		if result != nil {
+			divergences = append(divergences, *result)
+		}
+		if errors[index] {
+			failed = append(failed, punames[index])
+		}
+	}
+	return
+}
+
+// divergenceReport 抽样（或 full 为true时完整）检查内存中的子账户，报告与zookeeper不一致的子账户
+// 检查的子账户数不超过 divergenceMaxUsers
+func divergenceReport(users map[string]int, sample int, full bool) DivergenceResponse {
+	punames := make([]string, 0, len(users))
+	for puname := range users {
+		punames = append(punames, puname)
+	}
+
+	response := DivergenceResponse{
+		APIResponse: APIResponse{0, "", true},
+		Total:       len(punames),
+		Full:        full,
+	}
+	limit := sample
+	if full {
+		limit = divergenceMaxUsers
+		response.Truncated = len(punames) > limit
+	}
+	if len(punames) > limit {
+		rand.Shuffle(len(punames), func(i, j int) { punames[i], punames[j] = punames[j], punames[i] })
+		punames = punames[:limit]
+	}
+	sort.Strings(punames)
+
+	response.Checked = len(punames)
+	response.Divergences, response.Failed = checkDivergence(punames)
+	return response
+}
+
+// divergenceHandle 比较内存中的子账户列表与zookeeper中的币种记录，返回不一致的子账户
+// 默认随机抽样 sample 个子账户（默认1000），full=true 时检查所有子账户，均不超过 divergenceMaxUsers
+func divergenceHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, 405, "method not allowed, use GET")
+		return
+	}
+
+	full := req.FormValue("full") == "true"
+	sample := defaultDivergenceSample
+	if sampleStr := req.FormValue("sample"); sampleStr != "" {
+		var err error
+		sample, err = strconv.Atoi(sampleStr)
+		if err != nil || sample < 1 || sample > divergenceMaxUsers {
+			writeErrorStatus(w, http.StatusBadRequest, APIErrInvalidSample)
+			return
+		}
+	}
+
+	if !acquireBulkOp(w) {
+		return
+	}
+	defer bulkOps.release()
+
+	users, err := initusercoin.ListUsers()
+	if err != nil {
+		glog.Error("list users failed: ", err)
+		writeError(w, 500, "list users failed")
+		return
+	}
+
+	response := divergenceReport(users, sample, full)
+	glog.Info("[divergence] users: ", response.Total, ", checked: ", response.Checked,
+		", divergences: ", len(response.Divergences), ", failed: ", len(response.Failed))
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
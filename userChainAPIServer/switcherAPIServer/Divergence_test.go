@@ -0,0 +1,53 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试完整检查时报告内存与zookeeper中币种不一致的子账户
+func TestDivergenceHandle(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/",
+		AvailableCoins:     []string{"btc", "bcc"},
+	}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+
+	initusercoin.AddUser(1, "aaa", "btc")
+	initusercoin.AddUser(2, "bbb", "btc")
+	initusercoin.AddUser(3, "ccc", "bcc")
+	// bbb 在zookeeper中的币种与内存中的子账户列表不一致
+	for puname, coin := range map[string]string{"aaa": "btc", "bbb": "bcc", "ccc": "bcc"} {
+		zookeeperConn.Create(configData.ZKSwitcherWatchDir+puname, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	}
+
+	recorder := httptest.NewRecorder()
+	divergenceHandle(recorder, httptest.NewRequest("GET", "/divergence?full=true", nil))
+
+	var response DivergenceResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	if !response.Success || !response.Full || response.Truncated || response.Total != 3 || response.Checked != 3 || len(response.Failed) != 0 {
+		t.Errorf("unexpected response: %s", recorder.Body.String())
+	}
+	if len(response.Divergences) != 1 {
+		t.Fatalf("1 divergence expected, got: %s", recorder.Body.String())
+	}
+	divergence := response.Divergences[0]
+	if divergence.PUName != "bbb" || divergence.ZKCoin != "bcc" || divergence.Reason != divergenceZKCoinNotInMemory ||
+		len(divergence.MemoryCoins) != 1 || divergence.MemoryCoins[0] != "btc" {
+		t.Errorf("unexpected divergence: %+v", divergence)
+	}
+
+	recorder = httptest.NewRecorder()
+	divergenceHandle(recorder, httptest.NewRequest("GET", "/divergence?sample=0", nil))
+	if recorder.Code != 400 {
+		t.Errorf("invalid sample expected HTTP 400, got: %d", recorder.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// DryRunResponse 预览用户币种列表变更的响应数据结构
+type DryRunResponse struct {
+	APIResponse
+	NowDate   int64             `json:"now_date"`  // 用户币种列表的 now_date
+	Total     int               `json:"total"`     // 列表中的子账户数
+	Unchanged int               `json:"unchanged"` // 币种不变的子账户数
+	Changes   []ReconcileResult `json:"changes"`   // 币种将改变的子账户，old_coin 为空表示将新建节点
+	Skipped   []ReconcileResult `json:"skipped"`   // 不会写入的子账户（如币种不存在、在忽略列表中）
+}
+
+// previewMiningCoin 与 changeMiningCoin 相同的检查，但只读取zookeeper中原来的币种，不写入
+func previewMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIError) {
+	if len(puname) < 1 {
+		return "", APIErrPunameIsEmpty
+	}
+	if strings.Contains(puname, "/") {
+		return "", APIErrPunameInvalid
+	}
+	if len(coin) < 1 {
+		return "", APIErrCoinIsEmpty
+	}
+	if !isAvailableCoin(coin) {
+		return "", APIErrCoinIsInexistent
+	}
+
+	puname = RegularUserName(puname)
+	if initusercoin.IsIgnoredUser(puname, configData.IgnoredUsers, configData.IgnoredUserPrefixes) {
+		return "", APIErrUserIgnored
+	}
+
+	zkPath := configData.ZKSwitcherWatchDir + puname
+	data, err := zkGet(zkPath)
+	if err == zk.ErrNoNode {
+		return "", nil
+	}
+	if err != nil {
+		glog.Error("zk.Get(", zkPath, ") Failed: ", err)
+		return "", APIErrReadRecordFailed
+	}
+	return string(data), nil
+}
+
+// dryRunUserCoinMap 计算按用户币种列表写入后各子账户币种的变化，结果按子账户名排序
+func dryRunUserCoinMap(userCoinMap *UserCoinMapData) DryRunResponse {
+	punames := make([]string, 0, len(userCoinMap.UserCoin))
+	for puname := range userCoinMap.UserCoin {
+		punames = append(punames, puname)
+	}
+	sort.Strings(punames)
+
+	response := DryRunResponse{
+		APIResponse: APIResponse{0, "", true},
+		NowDate:     userCoinMap.NowDate,
+		Total:       len(punames),
+		Changes:     []ReconcileResult{},
+		Skipped:     []ReconcileResult{},
+	}
+	for _, result := range reconcileUsers(punames, userCoinMap.UserCoin, previewMiningCoin) {
+		switch {
+		case !result.Success:
+			response.Skipped = append(response.Skipped, result)
+		case result.OldCoin == result.Coin:
+			response.Unchanged++
+		default:
+			response.Changes = append(response.Changes, result)
+		}
+	}
+	return response
+}
+
+// dryRunCoinMapHandle 预览用户币种列表将引起的变更，不写入zookeeper
+// 请求体为空时从 UserCoinMapURL 完整拉取一次，否则请求体为与该接口格式相同的用户币种列表
+func dryRunCoinMapHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, 405, "method not allowed, use POST")
+		return
+	}
+	if !acquireBulkOp(w) {
+		return
+	}
+	defer bulkOps.release()
+
+	requestJSON, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		glog.Warning(err, ": ", req.RequestURI)
+		writeError(w, 500, err.Error())
+		return
+	}
+
+	var userCoinMap *UserCoinMapData
+	if len(strings.TrimSpace(string(requestJSON))) == 0 {
+		userCoinMap, err = fetchUserCoinMap(userCoinMapURL(), initusercoin.RequestID(req), nil)
+		if err != nil {
+			glog.Error(err)
+			writeError(w, 502, "fetch user coin map failed")
+			return
+		}
+	} else {
+		userCoinMapResponse := new(UserCoinMapResponse)
+		if err = json.Unmarshal(requestJSON, userCoinMapResponse); err != nil {
+			glog.Info(err, ": ", req.RequestURI)
+			writeError(w, 400, err.Error())
+			return
+		}
+		if userCoinMapResponse.ErrNo != 0 {
+			writeError(w, 400, fmt.Sprintf("user coin map with err_no %d", userCoinMapResponse.ErrNo))
+			return
+		}
+		userCoinMap = &userCoinMapResponse.Data
+	}
+
+	response := dryRunUserCoinMap(userCoinMap)
+	glog.Info("[dry-run] users: ", response.Total, ", changes: ", len(response.Changes),
+		", unchanged: ", response.Unchanged, ", skipped: ", len(response.Skipped))
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,74 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试按上传的用户币种列表预览变更，不写入zookeeper
+func TestDryRunCoinMapHandle(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir:           "/stratumSwitcher/btcbcc/",
+		AvailableCoins:               []string{"btc", "bcc"},
+		IgnoredUsers:                 []string{"ignored"},
+		StratumServerCaseInsensitive: true,
+	}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	for puname, coin := range map[string]string{"aaa": "btc", "bbb": "btc", "ccc": "bcc"} {
+		zookeeperConn.Create(configData.ZKSwitcherWatchDir+puname, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+	}
+
+	payload := `{"err_no":0,"err_msg":"","data":{"user_coin":` +
+		`{"AAA":"bcc","bbb":"btc","ccc":"btc","ddd":"bcc","eee":"xxx","ignored":"bcc"},"now_date":1500000000}}`
+	recorder := httptest.NewRecorder()
+	dryRunCoinMapHandle(recorder, httptest.NewRequest("POST", "/dry-run/coin-map", strings.NewReader(payload)))
+
+	var response DryRunResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	if !response.Success || response.NowDate != 1500000000 || response.Total != 6 || response.Unchanged != 1 {
+		t.Errorf("unexpected response: %s", recorder.Body.String())
+	}
+
+	expected := []ReconcileResult{
+		{PUName: "AAA", OldCoin: "btc", Coin: "bcc", Success: true},
+		{PUName: "ccc", OldCoin: "bcc", Coin: "btc", Success: true},
+		{PUName: "ddd", OldCoin: "", Coin: "bcc", Success: true},
+	}
+	if len(response.Changes) != len(expected) {
+		t.Fatalf("changes expected: %+v, got: %+v", expected, response.Changes)
+	}
+	for i := range expected {
+		if response.Changes[i] != expected[i] {
+			t.Errorf("change %d expected: %+v, got: %+v", i, expected[i], response.Changes[i])
+		}
+	}
+	if len(response.Skipped) != 2 || response.Skipped[0].ErrNo != APIErrCoinIsInexistent.ErrNo ||
+		response.Skipped[1].ErrNo != APIErrUserIgnored.ErrNo {
+		t.Errorf("skipped expected: eee (inexistent coin), ignored (ignored user), got: %+v", response.Skipped)
+	}
+
+	// zookeeper中的记录不变
+	for puname, coin := range map[string]string{"aaa": "btc", "ccc": "bcc"} {
+		data, _, _ := zookeeperConn.Get(configData.ZKSwitcherWatchDir + puname)
+		if string(data) != coin {
+			t.Errorf("%s should stay %s, got: %s", puname, coin, data)
+		}
+	}
+	if exists, _, _ := zookeeperConn.Exists(configData.ZKSwitcherWatchDir + "ddd"); exists {
+		t.Errorf("ddd should not be created by a dry run")
+	}
+
+	recorder = httptest.NewRecorder()
+	dryRunCoinMapHandle(recorder, httptest.NewRequest("POST", "/dry-run/coin-map", strings.NewReader(`{"err_no":`)))
+	if !strings.Contains(recorder.Body.String(), `"success":false`) {
+		t.Errorf("invalid payload expected error, got: %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,24 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// DuplicatePUIDsResponse 重复puid列表的响应数据结构
+type DuplicatePUIDsResponse struct {
+	APIResponse
+	Duplicates []initusercoin.DuplicatePUID `json:"duplicates"`
+}
+
+// duplicatePUIDsHandle 返回拉取子账户列表时发现的、被多个子账户使用的puid，只读取内存中的记录
+func duplicatePUIDsHandle(w http.ResponseWriter, req *http.Request) {
+	response := DuplicatePUIDsResponse{
+		APIResponse: APIResponse{0, "", true},
+		Duplicates:  initusercoin.DuplicatePUIDs(),
+	}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
@@ -10,7 +10,6 @@ import (
 
 	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
 	"github.com/golang/glog"
-	"github.com/samuel/go-zookeeper/zk"
 )
 
 // SwitchUserCoins 欲切换的用户和币种
@@ -89,6 +88,28 @@ func runAPIServer() {
 	http.HandleFunc("/subpool/update-coinbase", basicAuth(updateCoinbaseHandle))
 	http.HandleFunc("/subpool-update-coinbase", basicAuth(updateCoinbaseHandle))
 
+	http.HandleFunc("/reload", basicAuth(reloadHandle))
+
+	http.HandleFunc("/users/reconcile", basicAuth(reconcileHandle))
+
+	http.HandleFunc("/users/duplicate-puids", basicAuth(duplicatePUIDsHandle))
+
+	http.HandleFunc("/cursors", basicAuth(cursorsHandle))
+
+	http.HandleFunc("/maintenance", basicAuth(maintenanceHandle))
+
+	http.HandleFunc("/info", basicAuth(infoHandle))
+
+	http.HandleFunc(userPathPrefix, basicAuth(userHandle))
+
+	http.HandleFunc("/compare", basicAuth(compareHandle))
+
+	http.HandleFunc("/dry-run/coin-map", basicAuth(dryRunCoinMapHandle))
+
+	http.HandleFunc("/zk/migrate-acl", basicAuth(migrateACLHandle))
+
+	http.HandleFunc("/divergence", basicAuth(divergenceHandle))
+
 	// The listener will be done in initUserCoin/HTTPAPI.go
 	/*err := http.ListenAndServe(configData.ListenAddr, nil)
 
@@ -101,6 +122,11 @@ func runAPIServer() {
 // basicAuth 执行Basic认证
 func basicAuth(f HTTPRequestHandle) HTTPRequestHandle {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// 确定本次请求的ID并回写到响应头，由其触发的上游请求使用同一ID
+		requestID := initusercoin.RequestID(r)
+		r.Header.Set(initusercoin.RequestIDHeader, requestID)
+		w.Header().Set(initusercoin.RequestIDHeader, requestID)
+
 		apiUser := []byte(configData.APIUser)
 		apiPasswd := []byte(configData.APIPassword)
 
@@ -320,6 +346,15 @@ func updateCoinbaseHandle(w http.ResponseWriter, req *http.Request) {
 			", Coin: ", reqData.Coin, ", SubPool: ", reqData.SubPoolName,
 			", Old: ", ackData.Old, ", New: ", ackData.New)
 
+		oldValue, _ := json.Marshal(ackData.Old)
+		newValue, _ := json.Marshal(ackData.New)
+		record := newAuditRecord(req, auditOpSubPoolUpdate, reqData.Coin+"/"+reqData.SubPoolName, string(oldValue), string(newValue), nil)
+		if !ackData.Success {
+			record.Success = false
+			record.ErrMsg = ackData.ErrMsg
+		}
+		audit(record)
+
 		ackByte, _ := json.Marshal(ackData.SubPoolUpdateAck)
 		w.Write(ackByte)
 		return
@@ -338,6 +373,9 @@ func switchHandle(w http.ResponseWriter, req *http.Request) {
 	coin := req.FormValue("coin")
 
 	oldCoin, err := changeMiningCoin(puname, coin)
+	if err != APIErrUserIgnored {
+		audit(newAuditRecord(req, auditOpSwitch, puname, oldCoin, coin, err))
+	}
 
 	if err != nil {
 		glog.Info(err, ": ", req.RequestURI)
@@ -375,12 +413,36 @@ func switchMultiUserHandle(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// 写入前检查全部子账户，避免只切换了一部分
+	punameNum := 0
+	for _, usercoin := range reqData.UserCoins {
+		punameNum += len(usercoin.PUNames)
+		for _, puname := range usercoin.PUNames {
+			if apiErr := checkPuname(puname); apiErr != nil {
+				glog.Info(apiErr, ": ", req.RequestURI, " {puname=", puname, "}")
+				writeErrorStatus(w, http.StatusBadRequest, apiErr)
+				return
+			}
+		}
+	}
+	if punameNum > bulkMaxPunames {
+		glog.Info(APIErrTooManyPunames.ErrMsg, ": ", req.RequestURI)
+		writeErrorStatus(w, http.StatusBadRequest, APIErrTooManyPunames)
+		return
+	}
+
 	for _, usercoin := range reqData.UserCoins {
 		coin := usercoin.Coin
 
 		for _, puname := range usercoin.PUNames {
 			oldCoin, err := changeMiningCoin(puname, coin)
 
+			if err == APIErrUserIgnored {
+				// 被忽略的子账户不影响批量中的其他子账户
+				continue
+			}
+			audit(newAuditRecord(req, auditOpSwitchMultiUser, puname, oldCoin, coin, err))
+
 			if err != nil {
 				glog.Info(err, ": ", req.RequestURI, " {puname=", puname, ", coin=", coin, "}")
 				writeError(w, err.ErrNo, err.ErrMsg)
@@ -427,16 +489,7 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 	}
 
 	// 检查币种是否存在
-	exists := false
-
-	for _, availableCoin := range configData.AvailableCoins {
-		if availableCoin == coin {
-			exists = true
-			break
-		}
-	}
-
-	if !exists {
+	if !isAvailableCoin(coin) {
 		apiErr = APIErrCoinIsInexistent
 		return
 	}
@@ -447,11 +500,17 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 		puname = strings.ToLower(puname)
 	}
 
+	if initusercoin.IsIgnoredUser(puname, configData.IgnoredUsers, configData.IgnoredUserPrefixes) {
+		glog.V(3).Info("ignored user: ", puname, ": ", coin)
+		apiErr = APIErrUserIgnored
+		return
+	}
+
 	// stratumSwitcher 监控的键
 	zkPath := configData.ZKSwitcherWatchDir + puname
 
 	// 看看键是否存在
-	exists, _, err := zookeeperConn.Exists(zkPath)
+	exists, err := zkExists(zkPath)
 
 	if err != nil {
 		glog.Error("zk.Exists(", zkPath, ") Failed: ", err)
@@ -461,7 +520,7 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 
 	if exists {
 		// 读取zookeeper看看原来的值是多少
-		oldCoinData, _, err := zookeeperConn.Get(zkPath)
+		oldCoinData, err := zkGet(zkPath)
 
 		if err != nil {
 			glog.Error("zk.Get(", zkPath, ") Failed: ", err)
@@ -486,7 +545,7 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 
 		if userUpdateTime != 0 && nowTime-userUpdateTime >= safetyPeriod {
 			// 写入新值
-			_, err = zookeeperConn.Set(zkPath, []byte(coin), -1)
+			err = zkSet(zkPath, []byte(coin))
 
 			if err != nil {
 				glog.Error("zk.Set(", zkPath, ",", coin, ") Failed: ", err)
@@ -504,7 +563,7 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 				time.Sleep(time.Duration(sleepTime) * time.Second)
 
 				// 写入新值
-				_, err = zookeeperConn.Set(zkPath, []byte(coin), -1)
+				err := zkSet(zkPath, []byte(coin))
 
 				if err != nil {
 					glog.Error("zk.Set(", zkPath, ",", coin, ") Failed: ", err)
@@ -514,7 +573,7 @@ func changeMiningCoin(puname string, coin string) (oldCoin string, apiErr *APIEr
 
 	} else {
 		// 不存在，直接创建
-		_, err = zookeeperConn.Create(zkPath, []byte(coin), 0, zk.WorldACL(zk.PermAll))
+		err = zkCreate(zkPath, []byte(coin))
 
 		if err != nil {
 			glog.Error("zk.Create(", zkPath, ",", coin, ") Failed: ", err)
@@ -0,0 +1,44 @@
+package switcherapiserver
+
+import (
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// 测试被忽略的子账户不会写入zookeeper
+func TestChangeMiningCoinIgnoredUser(t *testing.T) {
+	configData = &ConfigData{
+		AvailableCoins:               []string{"btc", "bcc"},
+		StratumServerCaseInsensitive: true,
+		IgnoredUserPrefixes:          []string{"test_"},
+	}
+
+	// zookeeperConn 为 nil，若没有被忽略则会panic
+	zookeeperConn = nil
+	if _, err := changeMiningCoin("TEST_abc", "bcc"); err != APIErrUserIgnored {
+		t.Errorf("changeMiningCoin of ignored user expected: %v, got: %v", APIErrUserIgnored, err)
+	}
+	if _, err := changeMiningCoin("test_abc", ""); err != APIErrCoinIsEmpty {
+		t.Errorf("changeMiningCoin with empty coin expected: %v, got: %v", APIErrCoinIsEmpty, err)
+	}
+}
+
+// 测试切换新子账户的币种时创建记录
+func TestChangeMiningCoinCreate(t *testing.T) {
+	configData = &ConfigData{
+		AvailableCoins:     []string{"btc", "bcc"},
+		ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/",
+	}
+	conn := initusercoin.NewMemZookeeper()
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+
+	oldCoin, err := changeMiningCoin("abc", "bcc")
+	if err != nil || oldCoin != "" {
+		t.Fatalf("changeMiningCoin of new user expected: \"\", nil, got: %s, %v", oldCoin, err)
+	}
+	if data, _, _ := conn.Get("/stratumSwitcher/btcbcc/abc"); string(data) != "bcc" {
+		t.Errorf("coin of abc expected: bcc, got: %s", data)
+	}
+}
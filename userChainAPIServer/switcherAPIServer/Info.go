@@ -0,0 +1,45 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// InfoResponse 供管理后台使用的状态快照
+type InfoResponse struct {
+	Version         string                              `json:"version"`
+	Ready           bool                                `json:"ready"`
+	UserCount       int64                               `json:"user_count"`
+	ChainUserCounts map[string]int64                    `json:"chain_user_counts"`
+	Fetches         map[string]initusercoin.FetchStatus `json:"fetches"`
+	StaleFetches    []string                            `json:"stale_fetches"`
+	ZKState         string                              `json:"zk_state"`
+	Maintenance     bool                                `json:"maintenance"`
+	Cursors         CursorsResponse                     `json:"cursors"`
+}
+
+// infoHandle 一次返回版本、就绪状态、子账户数、拉取状态、zookeeper连接状态及拉取进度
+// 各项均读取内存中的状态，不访问上游API或zookeeper
+func infoHandle(w http.ResponseWriter, req *http.Request) {
+	userCount, chainUserCounts := initusercoin.UserCounts()
+	maintenance, _ := initusercoin.InMaintenance()
+
+	response := InfoResponse{
+		Version:         initusercoin.Version,
+		Ready:           initusercoin.IsReady(),
+		UserCount:       userCount,
+		ChainUserCounts: chainUserCounts,
+		Fetches:         initusercoin.FetchStatuses(),
+		StaleFetches:    initusercoin.StaleFetches(),
+		ZKState:         initusercoin.ZookeeperState(zookeeperConn),
+		Maintenance:     maintenance,
+		Cursors: CursorsResponse{
+			LastPUID:        initusercoin.LastPUIDs(),
+			LastRequestDate: LastRequestDate(),
+		},
+	}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,45 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// 测试 /info 返回的状态快照包含所有字段
+func TestInfoHandle(t *testing.T) {
+	configData = &ConfigData{}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	setLastRequestDate(1500000000)
+	initusercoin.RecordFetch(initusercoin.FetchUserCoinMap, nil)
+
+	recorder := httptest.NewRecorder()
+	infoHandle(recorder, httptest.NewRequest("GET", "/info", nil))
+
+	var info map[string]json.RawMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	for _, key := range []string{"version", "ready", "user_count", "chain_user_counts", "fetches", "stale_fetches", "zk_state", "maintenance", "cursors"} {
+		if _, ok := info[key]; !ok {
+			t.Errorf("key %s missing in /info response: %s", key, recorder.Body.String())
+		}
+	}
+
+	var response InfoResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Cursors.LastRequestDate != 1500000000 {
+		t.Errorf("cursors.last_request_date expected: 1500000000, got: %d", response.Cursors.LastRequestDate)
+	}
+	if status, ok := response.Fetches[initusercoin.FetchUserCoinMap]; !ok || status.LastSuccess == 0 {
+		t.Errorf("fetch status of %s expected to have last_success, got: %+v", initusercoin.FetchUserCoinMap, response.Fetches)
+	}
+	if response.ZKState != "unknown" {
+		t.Errorf("zk_state of in-memory zookeeper expected: unknown, got: %s", response.ZKState)
+	}
+	if response.Version != initusercoin.Version {
+		t.Errorf("version expected: %s, got: %s", initusercoin.Version, response.Version)
+	}
+}
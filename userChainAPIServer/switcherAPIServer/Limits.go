@@ -0,0 +1,94 @@
+package switcherapiserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// bulkMaxPunames 批量切换单次请求的最大子账户数（所有币种合计）
+const bulkMaxPunames = 1000
+
+// maxPunameLength 子账户名（转换为zookeeper中使用的子账户名后）的最大长度
+const maxPunameLength = 128
+
+// defaultMaxConcurrentBulkOps 同时进行的批量对账、预览操作数的默认上限
+const defaultMaxConcurrentBulkOps = 2
+
+// opLimiter 限制同时进行的操作数，为nil时不限制
+type opLimiter struct {
+	slots chan struct{}
+}
+
+// 批量对账、预览等需要完整拉取上游列表的操作的并发限制
+var bulkOps *opLimiter
+
+func newOpLimiter(max int) *opLimiter {
+	return &opLimiter{make(chan struct{}, max)}
+}
+
+// tryAcquire 占用一个位置，已达上限时返回false
+func (l *opLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release 释放 tryAcquire 占用的位置
+func (l *opLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// checkPuname 检查单个子账户名：转换后不能为空、不能包含“/”且不能过长
+func checkPuname(puname string) *APIError {
+	puname = RegularUserName(puname)
+	if len(puname) < 1 {
+		return APIErrPunameIsEmpty
+	}
+	if strings.Contains(puname, "/") {
+		return APIErrPunameInvalid
+	}
+	if len(puname) > maxPunameLength {
+		return APIErrPunameTooLong
+	}
+	return nil
+}
+
+// checkPunames 检查批量请求中的子账户名列表，max 为最大子账户数
+func checkPunames(punames []string, max int) *APIError {
+	if len(punames) == 0 {
+		return APIErrPunamesEmpty
+	}
+	if len(punames) > max {
+		return APIErrTooManyPunames
+	}
+	for _, puname := range punames {
+		if err := checkPuname(puname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeErrorStatus 以指定的HTTP状态码返回错误
+func writeErrorStatus(w http.ResponseWriter, status int, apiErr *APIError) {
+	w.WriteHeader(status)
+	writeError(w, apiErr.ErrNo, apiErr.ErrMsg)
+}
+
+// acquireBulkOp 占用一个批量操作的位置，已达 MaxConcurrentBulkOps 时返回HTTP 429并返回false
+func acquireBulkOp(w http.ResponseWriter) bool {
+	if bulkOps.tryAcquire() {
+		return true
+	}
+	writeErrorStatus(w, http.StatusTooManyRequests, APIErrTooManyBulkOps)
+	return false
+}
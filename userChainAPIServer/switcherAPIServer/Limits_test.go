@@ -0,0 +1,104 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// 测试批量接口拒绝过多或不合法的子账户名，且不写入任何子账户
+func TestBulkInputLimits(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/",
+		AvailableCoins:     []string{"btc", "bcc"},
+	}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+
+	expectError := func(recorder *httptest.ResponseRecorder, apiErr *APIError) {
+		t.Helper()
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), apiErr.ErrMsg) {
+			t.Errorf("expected: 400 %s, got: %d %s", apiErr.ErrMsg, recorder.Code, recorder.Body.String())
+		}
+	}
+	multiSwitch := func(punames []string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(SwitchMultiUserRequest{[]SwitchUserCoins{{Coin: "bcc", PUNames: punames}}})
+		recorder := httptest.NewRecorder()
+		switchMultiUserHandle(recorder, httptest.NewRequest("POST", "/switch/multi-user", strings.NewReader(string(body))))
+		return recorder
+	}
+
+	tooMany := make([]string, bulkMaxPunames+1)
+	for i := range tooMany {
+		tooMany[i] = "user"
+	}
+	expectError(multiSwitch(tooMany), APIErrTooManyPunames)
+
+	longName := strings.Repeat("a", maxPunameLength+1)
+	expectError(multiSwitch([]string{"good", longName}), APIErrPunameTooLong)
+	expectError(multiSwitch([]string{"good", "a/b"}), APIErrPunameInvalid)
+	expectError(multiSwitch([]string{"good", ""}), APIErrPunameIsEmpty)
+	if exists, _, _ := zookeeperConn.Exists(configData.ZKSwitcherWatchDir + "good"); exists {
+		t.Errorf("no user should be switched when any puname is invalid")
+	}
+
+	recorder := httptest.NewRecorder()
+	compareHandle(recorder, httptest.NewRequest("GET", "/compare?users=a,"+longName, nil))
+	expectError(recorder, APIErrPunameTooLong)
+
+	recorder = httptest.NewRecorder()
+	reconcileHandle(recorder, httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(`{"punames":["a/b"]}`)))
+	expectError(recorder, APIErrPunameInvalid)
+
+	if recorder = multiSwitch([]string{"good", strings.Repeat("b", maxPunameLength)}); !strings.Contains(recorder.Body.String(), `"success":true`) {
+		t.Errorf("valid punames expected success, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if data, _, err := zookeeperConn.Get(configData.ZKSwitcherWatchDir + "good"); err != nil || string(data) != "bcc" {
+		t.Errorf("good expected: bcc, got: %s, %v", data, err)
+	}
+}
+
+// 测试同时进行的批量对账、预览操作达到上限时返回HTTP 429
+func TestBulkOpsConcurrencyCap(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/",
+		AvailableCoins:     []string{"btc"},
+	}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	zookeeperConn.Create(configData.ZKSwitcherWatchDir+"a", []byte("btc"), 0, zk.WorldACL(zk.PermAll))
+
+	bulkOps = newOpLimiter(1)
+	defer func() { bulkOps = nil }()
+
+	// 占用唯一的位置，模拟正在进行的批量操作
+	if !bulkOps.tryAcquire() {
+		t.Fatal("first operation should be allowed")
+	}
+	payload := `{"err_no":0,"err_msg":"","data":{"user_coin":{"a":"btc"},"now_date":1500000000}}`
+	recorder := httptest.NewRecorder()
+	dryRunCoinMapHandle(recorder, httptest.NewRequest("POST", "/dry-run/coin-map", strings.NewReader(payload)))
+	if recorder.Code != http.StatusTooManyRequests || !strings.Contains(recorder.Body.String(), APIErrTooManyBulkOps.ErrMsg) {
+		t.Errorf("busy expected: 429, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	reconcileHandle(recorder, httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(`{"punames":["a"]}`)))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("busy expected: 429, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// 释放后可以继续，且请求结束后释放位置
+	bulkOps.release()
+	for i := 0; i < 2; i++ {
+		recorder = httptest.NewRecorder()
+		dryRunCoinMapHandle(recorder, httptest.NewRequest("POST", "/dry-run/coin-map", strings.NewReader(payload)))
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"success":true`) {
+			t.Errorf("request %d expected success, got: %d %s", i, recorder.Code, recorder.Body.String())
+		}
+	}
+}
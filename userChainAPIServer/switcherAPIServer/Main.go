@@ -2,10 +2,13 @@ package switcherapiserver
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"sync"
 	"time"
 
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
 	"github.com/golang/glog"
 	"github.com/samuel/go-zookeeper/zk"
 )
@@ -31,6 +34,12 @@ type ConfigData struct {
 	ZKBroker []string
 	// ZKSwitcherWatchDir Switcher监控的Zookeeper路径，以斜杠结尾
 	ZKSwitcherWatchDir string
+	// 读写用户币种记录时单次Zookeeper操作的超时时间（秒），为0时不限制
+	ZKOpTimeoutSeconds uint
+	// Zookeeper的digest认证（用户名:密码），配置后以该用户认证连接，新建的节点只允许该用户访问，为空时不认证
+	ZKDigestAuth string
+	// 迁移ACL时并发设置的节点数，默认8
+	ZKACLMigrateConcurrency uint
 
 	// 是否启用定时检测任务
 	EnableCronJob bool
@@ -38,48 +47,93 @@ type ConfigData struct {
 	CronIntervalSeconds int
 	// 用户:币种对应表的URL
 	UserCoinMapURL string
+	// 访问上游API的HTTPS客户端证书，可空
+	UpstreamAPITLS initusercoin.TLSClientConfig
+	// 访问上游API的HTTP代理，为空时使用环境变量中的代理
+	UpstreamAPIProxy string
 	// 挖矿服务器对子账户名大小写不敏感，此时将总是写入小写的子账户名
 	StratumServerCaseInsensitive bool
+	// 忽略的子账户（如内部测试账户），不会写入zookeeper
+	IgnoredUsers []string
+	// 以这些前缀开头的子账户将被忽略
+	IgnoredUserPrefixes []string
 	//子池更新用的zookeeper根目录（注意，不应包括币种和子池名称），以斜杠结尾
 	ZKSubPoolUpdateBaseDir string
 	// 子池更新时jobmaker的应答超时时间，如果在该时间内jobmaker没有应答，则API返回错误
 	ZKSubPoolUpdateAckTimeout int
+	// 审计日志文件，记录通过API执行的修改操作，为空时不记录
+	AuditLogFile string
+	// 同时进行的批量对账、预览操作数的上限，超过时返回HTTP 429，默认2
+	MaxConcurrentBulkOps uint
 }
 
 // zookeeperConn Zookeeper连接对象
-var zookeeperConn *zk.Conn
+var zookeeperConn initusercoin.Zookeeper
 
 // 配置数据
 var configData *ConfigData
 
+// 配置文件路径，重新加载配置时使用
+var configFile string
+
 // 用于等待goroutine结束
 var waitGroup sync.WaitGroup
 
-// Main function
-func Main(configFilePath string) {
-	// 读取配置文件
+// httpClient 访问用户币种列表API的HTTP客户端
+var httpClient = http.DefaultClient
+
+// ReadConfigFile 读取配置文件
+func ReadConfigFile(configFilePath string) (*ConfigData, error) {
 	configJSON, err := ioutil.ReadFile(configFilePath)
 
 	if err != nil {
-		glog.Fatal("read config failed: ", err)
-		return
+		return nil, fmt.Errorf("read config failed: %s", err)
 	}
 
-	configData = new(ConfigData)
+	configData := new(ConfigData)
 	err = json.Unmarshal(configJSON, configData)
 
 	if err != nil {
-		glog.Fatal("parse config failed: ", err)
-		return
+		return nil, fmt.Errorf("parse config failed: %s", err)
 	}
 
 	// 若zookeeper路径不以“/”结尾，则添加
-	if configData.ZKSwitcherWatchDir[len(configData.ZKSwitcherWatchDir)-1] != '/' {
+	if len(configData.ZKSwitcherWatchDir) > 0 && configData.ZKSwitcherWatchDir[len(configData.ZKSwitcherWatchDir)-1] != '/' {
 		configData.ZKSwitcherWatchDir += "/"
 	}
 	if len(configData.ZKSubPoolUpdateBaseDir) > 0 && configData.ZKSubPoolUpdateBaseDir[len(configData.ZKSubPoolUpdateBaseDir)-1] != '/' {
 		configData.ZKSubPoolUpdateBaseDir += "/"
 	}
+	if configData.MaxConcurrentBulkOps == 0 {
+		configData.MaxConcurrentBulkOps = defaultMaxConcurrentBulkOps
+	}
+	if configData.ZKACLMigrateConcurrency == 0 {
+		configData.ZKACLMigrateConcurrency = defaultZKACLMigrateConcurrency
+	}
+	if _, err = initusercoin.NewZKACL(configData.ZKDigestAuth); err != nil {
+		return nil, err
+	}
+
+	return configData, nil
+}
+
+// Main function
+func Main(configFilePath string) {
+	// 读取配置文件
+	var err error
+	configData, err = ReadConfigFile(configFilePath)
+
+	if err != nil {
+		glog.Fatal(err)
+		return
+	}
+	configFile = configFilePath
+
+	httpClient, err = initusercoin.NewHTTPClient(configData.UpstreamAPITLS, configData.UpstreamAPIProxy)
+	if err != nil {
+		glog.Fatal("init upstream API client failed: ", err)
+		return
+	}
 
 	// 建立到Zookeeper集群的连接
 	conn, _, err := zk.Connect(configData.ZKBroker, time.Duration(zookeeperConnTimeout)*time.Second)
@@ -91,6 +145,14 @@ func Main(configFilePath string) {
 
 	zookeeperConn = conn
 
+	err = initusercoin.AddZKDigestAuth(conn, configData.ZKDigestAuth)
+	if err != nil {
+		glog.Fatal("Zookeeper Auth Failed: ", err)
+		return
+	}
+	acl, _ := initusercoin.NewZKACL(configData.ZKDigestAuth)
+	initusercoin.SetZKNodeACL(acl)
+
 	// 检查并创建StratumSwitcher使用的Zookeeper路径
 	err = createZookeeperPath(configData.ZKSwitcherWatchDir)
 
@@ -99,7 +161,16 @@ func Main(configFilePath string) {
 		return
 	}
 
+	if configData.AuditLogFile != "" {
+		err = initAuditLog(configData.AuditLogFile)
+		if err != nil {
+			glog.Fatal("Open Audit Log Failed: ", err)
+			return
+		}
+	}
+
 	if configData.EnableAPIServer {
+		bulkOps = newOpLimiter(int(configData.MaxConcurrentBulkOps))
 		waitGroup.Add(1)
 		go runAPIServer()
 	}
@@ -0,0 +1,44 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// MaintenanceResponse 维护模式API的响应
+type MaintenanceResponse struct {
+	APIResponse
+	Maintenance bool `json:"maintenance"`
+	Pending     int  `json:"pending"`
+}
+
+// maintenanceHandle 查询或切换维护模式
+// GET 查询；POST enable=true 进入维护模式，enable=false 写入积累的变更并退出维护模式
+func maintenanceHandle(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		switch req.FormValue("enable") {
+		case "true":
+			initusercoin.EnterMaintenance()
+		case "false":
+			if err := initusercoin.ExitMaintenance(); err != nil {
+				writeError(w, 500, "flush deferred writes failed: "+err.Error())
+				return
+			}
+		default:
+			writeError(w, 400, "enable must be true or false")
+			return
+		}
+	default:
+		writeError(w, 405, "method not allowed, use GET or POST")
+		return
+	}
+
+	enabled, pending := initusercoin.InMaintenance()
+	response := MaintenanceResponse{APIResponse{0, "", true}, enabled, pending}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
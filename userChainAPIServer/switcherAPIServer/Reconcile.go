@@ -0,0 +1,158 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/golang/glog"
+)
+
+// reconcileMaxPunames 单次对账的最大子账户数
+const reconcileMaxPunames = 1000
+
+// reconcileConcurrency 对账时同时写入zookeeper的子账户数
+const reconcileConcurrency = 8
+
+// ReconcileRequest 批量对账请求数据结构
+type ReconcileRequest struct {
+	PUNames []string `json:"punames"`
+}
+
+// ReconcileResult 单个子账户的对账结果
+type ReconcileResult struct {
+	PUName  string `json:"puname"`
+	OldCoin string `json:"old_coin"`
+	Coin    string `json:"coin"`
+	ErrNo   int    `json:"err_no"`
+	ErrMsg  string `json:"err_msg"`
+	Success bool   `json:"success"`
+}
+
+// ReconcileResponse 批量对账响应数据结构
+type ReconcileResponse struct {
+	APIResponse
+	Results []ReconcileResult `json:"results"`
+}
+
+// reconcileUsers 按上游用户币种列表重新写入各子账户的币种，结果的顺序与punames相同
+// apply 为写入函数，最多同时执行 reconcileConcurrency 个
+func reconcileUsers(punames []string, userCoin map[string]string, apply func(puname string, coin string) (string, *APIError)) []ReconcileResult {
+	// 挖矿服务器对子账户名大小写不敏感时，按小写匹配
+	lookup := userCoin
+	if configData.StratumServerCaseInsensitive {
+		lookup = make(map[string]string, len(userCoin))
+		for puname, coin := range userCoin {
+			lookup[strings.ToLower(puname)] = coin
+		}
+	}
+
+	results := make([]ReconcileResult, len(punames))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < reconcileConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				puname := punames[index]
+				result := ReconcileResult{PUName: puname}
+
+				key := puname
+				if configData.StratumServerCaseInsensitive {
+					key = strings.ToLower(puname)
+				}
+				coin, ok := lookup[key]
+				if !ok {
+					result.ErrNo = APIErrUserNotFound.ErrNo
+					result.ErrMsg = APIErrUserNotFound.ErrMsg
+					results[index] = result
+					continue
+				}
+
+				result.Coin = coin
+				oldCoin, err := apply(puname, coin)
+				result.OldCoin = oldCoin
+				if err != nil {
+					result.ErrNo = err.ErrNo
+					result.ErrMsg = err.ErrMsg
+				} else {
+					result.Success = true
+				}
+				results[index] = result
+			}
+		}()
+	}
+
+	for index := range punames {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// reconcileHandle 批量对账：从上游完整拉取一次用户币种列表，并重新写入指定子账户的币种
+// 用于上游故障恢复后修复部分子账户，而不需要全量刷新
+func reconcileHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, 405, "method not allowed, use POST")
+		return
+	}
+
+	var reqData ReconcileRequest
+
+	requestJSON, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		glog.Warning(err, ": ", req.RequestURI)
+		writeError(w, 500, err.Error())
+		return
+	}
+
+	err = json.Unmarshal(requestJSON, &reqData)
+
+	if err != nil {
+		glog.Info(err, ": ", req.RequestURI)
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	if apiErr := checkPunames(reqData.PUNames, reconcileMaxPunames); apiErr != nil {
+		writeErrorStatus(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	if !acquireBulkOp(w) {
+		return
+	}
+	defer bulkOps.release()
+
+	userCoinMap, err := fetchUserCoinMap(userCoinMapURL(), initusercoin.RequestID(req), nil)
+	if err != nil {
+		glog.Error(err)
+		writeError(w, 502, "fetch user coin map failed")
+		return
+	}
+
+	apply := func(puname string, coin string) (string, *APIError) {
+		oldCoin, err := changeMiningCoin(puname, coin)
+		if err != APIErrUserIgnored {
+			audit(newAuditRecord(req, auditOpReconcile, puname, oldCoin, coin, err))
+		}
+		return oldCoin, err
+	}
+	results := reconcileUsers(reqData.PUNames, userCoinMap.UserCoin, apply)
+	for _, result := range results {
+		glog.Info("[reconcile] ", result.PUName, ": ", result.OldCoin, " -> ", result.Coin, ", ", result.ErrMsg)
+	}
+
+	response := ReconcileResponse{APIResponse{0, "", true}, results}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,158 @@
+package switcherapiserver
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+)
+
+// 测试按模拟的上游用户币种列表批量对账
+func TestReconcileUsers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("last_date") != "" {
+			t.Errorf("reconcile should do a full fetch, got: %s", req.URL)
+		}
+		w.Write([]byte(`{"err_no":0,"err_msg":"","data":{"user_coin":{"a":"btc","B":"bcc","c":"btc","d":"xxx"},"now_date":1500000000}}`))
+	}))
+	defer server.Close()
+
+	configData = &ConfigData{UserCoinMapURL: server.URL, StratumServerCaseInsensitive: true}
+	httpClient = http.DefaultClient
+
+	userCoinMap, err := fetchUserCoinMap(userCoinMapURL(), "test", nil)
+	if err != nil {
+		t.Fatalf("fetch user coin map failed: %s", err)
+	}
+
+	var lock sync.Mutex
+	running := 0
+	maxRunning := 0
+	apply := func(puname string, coin string) (string, *APIError) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+
+		if coin == "xxx" {
+			return "", APIErrCoinIsInexistent
+		}
+		return "ltc", nil
+	}
+
+	punames := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 20; i++ {
+		punames = append(punames, "a")
+	}
+	results := reconcileUsers(punames, userCoinMap.UserCoin, apply)
+
+	if len(results) != len(punames) {
+		t.Fatalf("result number expected: %d, got: %d", len(punames), len(results))
+	}
+	expected := []ReconcileResult{
+		{PUName: "a", OldCoin: "ltc", Coin: "btc", Success: true},
+		{PUName: "b", OldCoin: "ltc", Coin: "bcc", Success: true},
+		{PUName: "c", OldCoin: "ltc", Coin: "btc", Success: true},
+		{PUName: "d", Coin: "xxx", ErrNo: APIErrCoinIsInexistent.ErrNo, ErrMsg: APIErrCoinIsInexistent.ErrMsg},
+		{PUName: "e", ErrNo: APIErrUserNotFound.ErrNo, ErrMsg: APIErrUserNotFound.ErrMsg},
+	}
+	for i, e := range expected {
+		if results[i] != e {
+			t.Errorf("result %d expected: %+v, got: %+v", i, e, results[i])
+		}
+	}
+	if maxRunning > reconcileConcurrency {
+		t.Errorf("concurrency should be bounded by %d, got: %d", reconcileConcurrency, maxRunning)
+	}
+}
+
+// 测试批量对账的子账户数限制
+func TestReconcileHandleLimits(t *testing.T) {
+	configData = &ConfigData{}
+
+	recorder := httptest.NewRecorder()
+	reconcileHandle(recorder, httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(`{"punames":[]}`)))
+	if !strings.Contains(recorder.Body.String(), APIErrPunamesEmpty.ErrMsg) {
+		t.Errorf("empty punames expected error: %s, got: %s", APIErrPunamesEmpty.ErrMsg, recorder.Body.String())
+	}
+
+	punames := make([]string, reconcileMaxPunames+1)
+	for i := range punames {
+		punames[i] = `"u"`
+	}
+	recorder = httptest.NewRecorder()
+	body := `{"punames":[` + strings.Join(punames, ",") + `]}`
+	reconcileHandle(recorder, httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(body)))
+	if !strings.Contains(recorder.Body.String(), APIErrTooManyPunames.ErrMsg) {
+		t.Errorf("too many punames expected error: %s, got: %s", APIErrTooManyPunames.ErrMsg, recorder.Body.String())
+	}
+}
+
+// 测试批量对账将API请求的ID传递给拉取子账户币种映射的上游请求
+func TestReconcileHandleRequestID(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(initusercoin.RequestIDHeader)
+		w.Write([]byte(`{"err_no":0,"err_msg":"","data":{"user_coin":{},"now_date":1500000000}}`))
+	}))
+	defer server.Close()
+
+	configData = &ConfigData{UserCoinMapURL: server.URL, APIUser: "admin", APIPassword: "admin"}
+	httpClient = http.DefaultClient
+
+	req := httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(`{"punames":["a"]}`))
+	req.SetBasicAuth("admin", "admin")
+	req.Header.Set(initusercoin.RequestIDHeader, "trace-789")
+	recorder := httptest.NewRecorder()
+	log := captureLog(func() {
+		basicAuth(reconcileHandle)(recorder, req)
+	})
+
+	if !strings.Contains(log, "request id: trace-789") {
+		t.Errorf("fetch log should contain request id, got:\n%s", log)
+	}
+	if received != "trace-789" {
+		t.Errorf("upstream %s expected: trace-789, got: %s", initusercoin.RequestIDHeader, received)
+	}
+	if id := recorder.Header().Get(initusercoin.RequestIDHeader); id != "trace-789" {
+		t.Errorf("response %s expected: trace-789, got: %s", initusercoin.RequestIDHeader, id)
+	}
+
+	// 未携带请求ID时生成新的ID，并与上游请求一致
+	req = httptest.NewRequest("POST", "/users/reconcile", strings.NewReader(`{"punames":["a"]}`))
+	req.SetBasicAuth("admin", "admin")
+	recorder = httptest.NewRecorder()
+	basicAuth(reconcileHandle)(recorder, req)
+	if id := recorder.Header().Get(initusercoin.RequestIDHeader); id == "" || id != received {
+		t.Errorf("generated request id should be sent upstream, response: %s, upstream: %s", id, received)
+	}
+}
+
+// captureLog 捕获执行 f 期间输出的glog日志
+func captureLog(f func()) string {
+	flag.Set("logtostderr", "true")
+	defer flag.Set("logtostderr", "false")
+
+	r, w, _ := os.Pipe()
+	stderr := os.Stderr
+	os.Stderr = w
+	f()
+	os.Stderr = stderr
+	w.Close()
+
+	log, _ := ioutil.ReadAll(r)
+	return string(log)
+}
@@ -0,0 +1,137 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/golang/glog"
+)
+
+// ReloadResponse 重新加载配置的API响应
+type ReloadResponse struct {
+	APIResponse
+	Changes []string `json:"changes"`
+}
+
+// configLock 保护可在运行时重新加载的配置项（CronIntervalSeconds、UserCoinMapURL、AvailableCoins）
+var configLock sync.RWMutex
+
+// cronInterval 定时检测任务的间隔
+func cronInterval() time.Duration {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return time.Duration(configData.CronIntervalSeconds) * time.Second
+}
+
+// userCoinMapURL 用户币种列表API
+func userCoinMapURL() string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return configData.UserCoinMapURL
+}
+
+// isAvailableCoin 判断币种是否可用
+func isAvailableCoin(coin string) bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, availableCoin := range configData.AvailableCoins {
+		if availableCoin == coin {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReload 重新读取配置文件，检查是否只修改了可重新加载的配置项
+func checkReload() (*ConfigData, error) {
+	if configData == nil {
+		return nil, errors.New("config not loaded")
+	}
+
+	newConfig, err := ReadConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	configLock.RLock()
+	current := *configData
+	configLock.RUnlock()
+
+	// 忽略可重新加载的配置项后，其余配置项应当不变
+	candidate := *newConfig
+	candidate.CronIntervalSeconds = current.CronIntervalSeconds
+	candidate.UserCoinMapURL = current.UserCoinMapURL
+	candidate.AvailableCoins = current.AvailableCoins
+	if fields := initusercoin.DiffConfigFields(current, candidate); len(fields) > 0 {
+		return nil, fmt.Errorf("cannot reload %s, restart required", strings.Join(fields, ", "))
+	}
+	return newConfig, nil
+}
+
+// applyReload 替换可重新加载的配置项，返回变更说明
+func applyReload(newConfig *ConfigData) []string {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	changes := []string{}
+	if newConfig.CronIntervalSeconds != configData.CronIntervalSeconds {
+		changes = append(changes, fmt.Sprintf("CronIntervalSeconds: %d -> %d", configData.CronIntervalSeconds, newConfig.CronIntervalSeconds))
+		configData.CronIntervalSeconds = newConfig.CronIntervalSeconds
+	}
+	if newConfig.UserCoinMapURL != configData.UserCoinMapURL {
+		changes = append(changes, fmt.Sprintf("UserCoinMapURL: %s -> %s", configData.UserCoinMapURL, newConfig.UserCoinMapURL))
+		configData.UserCoinMapURL = newConfig.UserCoinMapURL
+	}
+	if !reflect.DeepEqual(newConfig.AvailableCoins, configData.AvailableCoins) {
+		changes = append(changes, fmt.Sprintf("AvailableCoins: %v -> %v", configData.AvailableCoins, newConfig.AvailableCoins))
+		configData.AvailableCoins = newConfig.AvailableCoins
+	}
+	return changes
+}
+
+// ReloadConfig 重新读取配置文件，并应用两个模块中可重新加载的配置项
+// 任一模块中有不可重新加载的配置项被修改时，不应用任何变更
+func ReloadConfig() ([]string, error) {
+	initUserCoinConfig, err := initusercoin.CheckReload()
+	if err != nil {
+		return nil, err
+	}
+	newConfig, err := checkReload()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := initusercoin.ApplyReload(initUserCoinConfig)
+	for _, change := range applyReload(newConfig) {
+		glog.Info("config reloaded: ", change)
+		changes = append(changes, change)
+	}
+	glog.Info("config reloaded, ", len(changes), " changes")
+	return changes, nil
+}
+
+// reloadHandle 重新加载配置
+func reloadHandle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, 405, "method not allowed, use POST")
+		return
+	}
+
+	changes, err := ReloadConfig()
+	if err != nil {
+		glog.Error("reload config failed: ", err)
+		writeError(w, 500, err.Error())
+		return
+	}
+
+	response := ReloadResponse{APIResponse{0, "", true}, changes}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
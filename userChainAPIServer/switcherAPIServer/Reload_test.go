@@ -0,0 +1,66 @@
+package switcherapiserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试重新加载修改后的定时检测间隔
+func TestReloadCronInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "switcherAPIServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile = filepath.Join(dir, "config.json")
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher","AvailableCoins":["btc"],` +
+		`"CronIntervalSeconds":60,"UserCoinMapURL":"http://127.0.0.1/a"}`)
+	configData, err = ReadConfigFile(configFile)
+	if err != nil {
+		t.Fatalf("read config failed: %s", err)
+	}
+	if interval := cronInterval(); interval != 60*time.Second {
+		t.Errorf("cron interval expected: 60s, got: %s", interval)
+	}
+
+	// 可重新加载的配置项
+	writeConfig(`{"ZKBroker":["127.0.0.1:2181"],"ZKSwitcherWatchDir":"/switcher/","AvailableCoins":["btc","bcc"],` +
+		`"CronIntervalSeconds":30,"UserCoinMapURL":"http://127.0.0.1/b"}`)
+	newConfig, err := checkReload()
+	if err != nil {
+		t.Fatalf("check reload failed: %s", err)
+	}
+	changes := applyReload(newConfig)
+	if len(changes) != 3 {
+		t.Errorf("change number expected: 3, got: %v", changes)
+	}
+	if interval := cronInterval(); interval != 30*time.Second {
+		t.Errorf("cron interval after reload expected: 30s, got: %s", interval)
+	}
+	if url := userCoinMapURL(); url != "http://127.0.0.1/b" {
+		t.Errorf("UserCoinMapURL after reload expected: http://127.0.0.1/b, got: %s", url)
+	}
+	if !isAvailableCoin("bcc") {
+		t.Errorf("bcc should be available after reload")
+	}
+
+	// 不可重新加载的配置项
+	writeConfig(`{"ZKBroker":["127.0.0.2:2181"],"ZKSwitcherWatchDir":"/switcher/","AvailableCoins":["btc","bcc"],` +
+		`"CronIntervalSeconds":10,"UserCoinMapURL":"http://127.0.0.1/b"}`)
+	if _, err := checkReload(); err == nil {
+		t.Errorf("reload with changed ZKBroker should fail")
+	}
+	if interval := cronInterval(); interval != 30*time.Second {
+		t.Errorf("cron interval after rejected reload expected: 30s, got: %s", interval)
+	}
+}
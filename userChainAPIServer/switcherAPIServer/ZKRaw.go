@@ -0,0 +1,83 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// userPathPrefix 子账户相关API的路径前缀，形如 /user/{name}/zk-raw
+const userPathPrefix = "/user/"
+
+// ZKRawResponse 子账户在zookeeper中的原始节点
+type ZKRawResponse struct {
+	Path       string `json:"path"`
+	Data       []byte `json:"data"`        // 原始字节，JSON中为base64
+	Version    int32  `json:"version"`     // 数据版本号
+	Ctime      int64  `json:"ctime"`       // 创建时间（毫秒时间戳）
+	Mtime      int64  `json:"mtime"`       // 最后修改时间（毫秒时间戳）
+	Czxid      int64  `json:"czxid"`       // 创建时的事务id
+	Mzxid      int64  `json:"mzxid"`       // 最后修改时的事务id
+	DataLength int32  `json:"data_length"` // 数据长度
+}
+
+// RegularUserName 转换为zookeeper中使用的子账户名：stratum server对大小写不敏感时转换为小写
+func RegularUserName(puname string) string {
+	if configData.StratumServerCaseInsensitive {
+		return strings.ToLower(puname)
+	}
+	return puname
+}
+
+// userHandle 分发 /user/{name}/... 请求
+func userHandle(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, userPathPrefix), "/")
+	if len(parts) == 2 && parts[1] == "zk-raw" {
+		zkRawHandle(w, req, parts[0])
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// zkRawHandle 返回子账户节点的原始数据及 zk.Stat，不做解析，用于排查序列化或版本号问题
+func zkRawHandle(w http.ResponseWriter, req *http.Request, puname string) {
+	if len(puname) < 1 {
+		writeError(w, APIErrPunameIsEmpty.ErrNo, APIErrPunameIsEmpty.ErrMsg)
+		return
+	}
+
+	zkPath := configData.ZKSwitcherWatchDir + RegularUserName(puname)
+	var data []byte
+	var stat *zk.Stat
+	err := initusercoin.RunZKOp(zkOpTimeout(), func() (err error) {
+		data, stat, err = zookeeperConn.Get(zkPath)
+		return
+	})
+	if err == zk.ErrNoNode {
+		w.WriteHeader(http.StatusNotFound)
+		writeError(w, 404, "user '"+puname+"' does not exist")
+		return
+	}
+	if err != nil {
+		glog.Error("zk.Get(", zkPath, ") Failed: ", err)
+		writeError(w, APIErrReadRecordFailed.ErrNo, APIErrReadRecordFailed.ErrMsg)
+		return
+	}
+
+	response := ZKRawResponse{
+		Path:       zkPath,
+		Data:       data,
+		Version:    stat.Version,
+		Ctime:      stat.Ctime,
+		Mtime:      stat.Mtime,
+		Czxid:      stat.Czxid,
+		Mzxid:      stat.Mzxid,
+		DataLength: stat.DataLength,
+	}
+	responseJSON, _ := json.Marshal(response)
+	w.Write(responseJSON)
+}
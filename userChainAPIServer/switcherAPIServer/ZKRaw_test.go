@@ -0,0 +1,87 @@
+package switcherapiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// statZookeeper 为 Get 返回的 zk.Stat 填充时间和事务id的 MemZookeeper
+type statZookeeper struct {
+	*initusercoin.MemZookeeper
+}
+
+func (s statZookeeper) Get(path string) ([]byte, *zk.Stat, error) {
+	data, stat, err := s.MemZookeeper.Get(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat.Ctime = 1500000000000
+	stat.Mtime = 1500000060000
+	stat.Czxid = 10
+	stat.Mzxid = 12
+	stat.DataLength = int32(len(data))
+	return data, stat, nil
+}
+
+// 测试返回子账户节点的原始数据及 zk.Stat
+func TestZKRawHandle(t *testing.T) {
+	configData = &ConfigData{
+		ZKSwitcherWatchDir:           "/stratumSwitcher/btcbcc/",
+		StratumServerCaseInsensitive: true,
+	}
+	conn := statZookeeper{initusercoin.NewMemZookeeper()}
+	zookeeperConn = conn
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+	conn.Create("/stratumSwitcher/btcbcc/abc", []byte("bcc\n"), 0, zk.WorldACL(zk.PermAll))
+	conn.Set("/stratumSwitcher/btcbcc/abc", []byte("btc\x00"), -1)
+
+	recorder := httptest.NewRecorder()
+	userHandle(recorder, httptest.NewRequest("GET", "/user/ABC/zk-raw", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status expected: 200, got: %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response ZKRawResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response failed: %s; %s", err, recorder.Body.String())
+	}
+	expected := ZKRawResponse{
+		Path:       "/stratumSwitcher/btcbcc/abc",
+		Data:       []byte("btc\x00"),
+		Version:    1,
+		Ctime:      1500000000000,
+		Mtime:      1500000060000,
+		Czxid:      10,
+		Mzxid:      12,
+		DataLength: 4,
+	}
+	if string(response.Data) != string(expected.Data) {
+		t.Errorf("data expected: %q, got: %q", expected.Data, response.Data)
+	}
+	response.Data = expected.Data
+	if response.Path != expected.Path || response.Version != expected.Version || response.Ctime != expected.Ctime ||
+		response.Mtime != expected.Mtime || response.Czxid != expected.Czxid || response.Mzxid != expected.Mzxid ||
+		response.DataLength != expected.DataLength {
+		t.Errorf("response expected: %+v, got: %+v", expected, response)
+	}
+}
+
+// 测试节点不存在及路径错误时返回404
+func TestZKRawHandleNotFound(t *testing.T) {
+	configData = &ConfigData{ZKSwitcherWatchDir: "/stratumSwitcher/btcbcc/"}
+	zookeeperConn = initusercoin.NewMemZookeeper()
+	createZookeeperPath(configData.ZKSwitcherWatchDir)
+
+	for _, path := range []string{"/user/nobody/zk-raw", "/user/abc", "/user/abc/other"} {
+		recorder := httptest.NewRecorder()
+		userHandle(recorder, httptest.NewRequest("GET", path, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("status of %s expected: 404, got: %d", path, recorder.Code)
+		}
+	}
+}
@@ -2,9 +2,10 @@ package switcherapiserver
 
 import (
 	"strings"
+	"time"
 
+	initusercoin "github.com/btccom/btcpool-go-modules/userChainAPIServer/initUserCoin"
 	"github.com/golang/glog"
-	"github.com/samuel/go-zookeeper/zk"
 )
 
 // 递归创建Zookeeper Node
@@ -30,7 +31,7 @@ func createZookeeperPath(path string) error {
 		}
 
 		// 不存在，创建
-		_, err = zookeeperConn.Create(currPath, []byte{}, 0, zk.WorldACL(zk.PermAll))
+		_, err = zookeeperConn.Create(currPath, []byte{}, 0, initusercoin.ZKNodeACL())
 
 		if err != nil {
 			// 再看看键是否存在（键可能已被其他线程创建）
@@ -47,3 +48,56 @@ func createZookeeperPath(path string) error {
 
 	return nil
 }
+
+// zkOpTimeout 单次Zookeeper操作的超时时间
+func zkOpTimeout() time.Duration {
+	return time.Duration(configData.ZKOpTimeoutSeconds) * time.Second
+}
+
+// zkExists 带超时的 zk.Exists
+func zkExists(path string) (exists bool, err error) {
+	var result bool
+	err = initusercoin.RunZKOp(zkOpTimeout(), func() (err error) {
+		result, _, err = zookeeperConn.Exists(path)
+		return
+	})
+	if err != nil {
+		return false, err
+	}
+	return result, nil
+}
+
+// zkGet 带超时的 zk.Get
+func zkGet(path string) (data []byte, err error) {
+	var result []byte
+	err = initusercoin.RunZKOp(zkOpTimeout(), func() (err error) {
+		result, _, err = zookeeperConn.Get(path)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// zkSet 带超时的 zk.Set，维护模式下推迟写入
+func zkSet(path string, data []byte) error {
+	if initusercoin.DeferZKWrite(path, data, false) {
+		return nil
+	}
+	return initusercoin.CountZKWrite(initusercoin.RunZKWrite(zkOpTimeout(), func() (err error) {
+		_, err = zookeeperConn.Set(path, data, -1)
+		return
+	}))
+}
+
+// zkCreate 带超时的 zk.Create，维护模式下推迟写入
+func zkCreate(path string, data []byte) error {
+	if initusercoin.DeferZKWrite(path, data, false) {
+		return nil
+	}
+	return initusercoin.CountZKWrite(initusercoin.RunZKWrite(zkOpTimeout(), func() (err error) {
+		_, err = zookeeperConn.Create(path, data, 0, initusercoin.ZKNodeACL())
+		return
+	}))
+}